@@ -0,0 +1,50 @@
+package webdav
+
+import (
+	"github.com/emersion/go-webdav/internal"
+)
+
+// Privilege is an access control privilege, as defined in RFC 3744 section 3.
+type Privilege = internal.AccessPrivilege
+
+var (
+	PrivilegeAll                         = Privilege(internal.PrivilegeAllName)
+	PrivilegeRead                        = Privilege(internal.PrivilegeReadName)
+	PrivilegeWrite                       = Privilege(internal.PrivilegeWriteName)
+	PrivilegeWriteProperties             = Privilege(internal.PrivilegeWritePropertiesName)
+	PrivilegeWriteContent                = Privilege(internal.PrivilegeWriteContentName)
+	PrivilegeUnlock                      = Privilege(internal.PrivilegeUnlockName)
+	PrivilegeReadACL                     = Privilege(internal.PrivilegeReadACLName)
+	PrivilegeReadCurrentUserPrivilegeSet = Privilege(internal.PrivilegeReadCurrentUserPrivilegeSetName)
+	PrivilegeWriteACL                    = Privilege(internal.PrivilegeWriteACLName)
+	PrivilegeBind                        = Privilege(internal.PrivilegeBindName)
+	PrivilegeUnbind                      = Privilege(internal.PrivilegeUnbindName)
+)
+
+// ACEPrincipal describes the principals an ACE applies to. Exactly one of the
+// fields is set: Href is the URL of a principal, the others are the DAV:all,
+// DAV:authenticated, DAV:unauthenticated and DAV:self principals.
+type ACEPrincipal = internal.AccessPrincipal
+
+// ACE is an access control entry, as defined in RFC 3744 section 5.5.
+// Protected ACEs can't be modified with the ACL method, and neither can ACEs
+// inherited from the resource at the path Inherited.
+type ACE = internal.AccessEntry
+
+// Authorizer decides which privileges are granted to the current user, for
+// instance based on the request context.
+//
+// Handlers check the privileges required by each request, as listed in RFC
+// 3744 appendix B, and reply with a 403 Forbidden DAV:need-privileges error
+// if one is missing. They also serve the DAV:acl,
+// DAV:supported-privilege-set and DAV:current-user-privilege-set properties
+// and the ACL method.
+//
+// CurrentUserPrivileges returns the privileges granted on a resource.
+// Aggregate privileges, such as PrivilegeAll or PrivilegeWrite, grant all of
+// the privileges they contain. Creating a resource requires PrivilegeBind on
+// the parent collection, so the path may not exist. ACL returns the access
+// control list of a resource, and SetACL replaces its ACEs which are neither
+// protected nor inherited. SetACL can return a 403 Forbidden HTTP error to
+// reject the ACL.
+type Authorizer = internal.AccessAuthorizer
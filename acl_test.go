@@ -0,0 +1,179 @@
+package webdav
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+// testAuthorizer grants privileges per path. Paths without an entry inherit
+// the privileges of their parent.
+type testAuthorizer struct {
+	privileges map[string][]Privilege
+	aces       []ACE
+}
+
+func (a *testAuthorizer) CurrentUserPrivileges(ctx context.Context, name string) ([]Privilege, error) {
+	name = path.Clean(name)
+	for {
+		if privs, ok := a.privileges[name]; ok {
+			return privs, nil
+		}
+		if name == "/" {
+			return nil, nil
+		}
+		name = path.Dir(name)
+	}
+}
+
+func (a *testAuthorizer) ACL(ctx context.Context, name string) ([]ACE, error) {
+	return a.aces, nil
+}
+
+func (a *testAuthorizer) SetACL(ctx context.Context, name string, aces []ACE) error {
+	a.aces = aces
+	return nil
+}
+
+func TestHandler_acl(t *testing.T) {
+	dir, err := os.MkdirTemp("", "webdav-acl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	fs := LocalFileSystem(dir)
+	if err := fs.Mkdir(ctx, "/private"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/file.txt", "/private/secret.txt"} {
+		if _, _, err := fs.Create(ctx, name, io.NopCloser(strings.NewReader(name)), &CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	authz := &testAuthorizer{
+		privileges: map[string][]Privilege{
+			"/":         {PrivilegeRead, PrivilegeReadCurrentUserPrivilegeSet},
+			"/file.txt": {PrivilegeAll},
+			"/private":  nil,
+		},
+	}
+	h := &Handler{FileSystem: fs, Authorizer: authz}
+
+	serve := func(method, target, body string, header map[string]string) *httptest.ResponseRecorder {
+		var r io.Reader
+		if body != "" {
+			r = strings.NewReader(body)
+		}
+		req := httptest.NewRequest(method, target, r)
+		if body != "" && method != http.MethodPut {
+			req.Header.Set("Content-Type", "application/xml")
+		}
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve(http.MethodOptions, "/", "", nil)
+	if dav := w.Header().Get("DAV"); !strings.Contains(dav, "access-control") {
+		t.Errorf("OPTIONS DAV header = %q, want access-control", dav)
+	}
+
+	if w := serve(http.MethodGet, "/private/secret.txt", "", nil); w.Code != http.StatusForbidden {
+		t.Errorf("GET = %v, want %v", w.Code, http.StatusForbidden)
+	}
+
+	w = serve(http.MethodPut, "/new.txt", "hello", nil)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("PUT new file = %v, want %v", w.Code, http.StatusForbidden)
+	} else if body := w.Body.String(); !strings.Contains(body, "need-privileges") || !strings.Contains(body, "bind") {
+		t.Errorf("PUT response doesn't contain the need-privileges precondition: %v", body)
+	}
+	if w := serve(http.MethodPut, "/file.txt", "hello", nil); w.Code != http.StatusNoContent {
+		t.Errorf("PUT existing file = %v, want %v", w.Code, http.StatusNoContent)
+	}
+	if w := serve(http.MethodDelete, "/file.txt", "", nil); w.Code != http.StatusForbidden {
+		t.Errorf("DELETE = %v, want %v", w.Code, http.StatusForbidden)
+	}
+
+	propfind := `<?xml version="1.0" encoding="utf-8" ?>
+<D:propfind xmlns:D="DAV:">
+  <D:prop><D:current-user-privilege-set/><D:acl/></D:prop>
+</D:propfind>`
+	w = serve("PROPFIND", "/", propfind, map[string]string{"Depth": "1"})
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("PROPFIND = %v, want %v", w.Code, http.StatusMultiStatus)
+	}
+	body := w.Body.String()
+	for _, s := range []string{"read-current-user-privilege-set", "write-content", "403 Forbidden"} {
+		if !strings.Contains(body, s) {
+			t.Errorf("PROPFIND response doesn't contain %q: %v", s, body)
+		}
+	}
+
+	acl := `<?xml version="1.0" encoding="utf-8" ?>
+<D:acl xmlns:D="DAV:">
+  <D:ace>
+    <D:principal><D:href>/principals/alice/</D:href></D:principal>
+    <D:grant><D:privilege><D:write/></D:privilege></D:grant>
+  </D:ace>
+</D:acl>`
+	if w := serve("ACL", "/", acl, nil); w.Code != http.StatusForbidden {
+		t.Errorf("ACL without write-acl = %v, want %v", w.Code, http.StatusForbidden)
+	}
+	if w := serve("ACL", "/file.txt", acl, nil); w.Code != http.StatusOK {
+		t.Errorf("ACL = %v, want %v", w.Code, http.StatusOK)
+	} else if len(authz.aces) != 1 || authz.aces[0].Principal.Href != "/principals/alice/" || len(authz.aces[0].Grant) != 1 || authz.aces[0].Grant[0] != PrivilegeWrite {
+		t.Errorf("ACL stored %+v", authz.aces)
+	}
+
+	invert := `<?xml version="1.0" encoding="utf-8" ?>
+<D:acl xmlns:D="DAV:">
+  <D:ace>
+    <D:invert><D:principal><D:all/></D:principal></D:invert>
+    <D:grant><D:privilege><D:read/></D:privilege></D:grant>
+  </D:ace>
+</D:acl>`
+	if w := serve("ACL", "/file.txt", invert, nil); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "no-invert") {
+		t.Errorf("ACL with invert = %v, want no-invert precondition", w.Code)
+	}
+
+	w = serve("PROPFIND", "/file.txt", propfind, map[string]string{"Depth": "0"})
+	if body := w.Body.String(); !strings.Contains(body, "/principals/alice/") {
+		t.Errorf("PROPFIND response doesn't contain the ACL: %v", body)
+	}
+}
+
+func TestServePrincipal_groupMembership(t *testing.T) {
+	options := &ServePrincipalOptions{
+		CurrentUserPrincipalPath: "/principals/alice/",
+		AlternateURIs:            []string{"mailto:alice@example.org"},
+		GroupMembership:          []string{"/principals/staff/"},
+	}
+
+	propfind := `<?xml version="1.0" encoding="utf-8" ?>
+<D:propfind xmlns:D="DAV:">
+  <D:prop><D:principal-URL/><D:alternate-URI-set/><D:group-membership/></D:prop>
+</D:propfind>`
+	req := httptest.NewRequest("PROPFIND", "/principals/alice/", strings.NewReader(propfind))
+	req.Header.Set("Content-Type", "application/xml")
+	w := httptest.NewRecorder()
+	ServePrincipal(w, req, options)
+
+	body := w.Body.String()
+	for _, s := range []string{"<href>/principals/alice/</href>", "<href>mailto:alice@example.org</href>", "<href>/principals/staff/</href>"} {
+		if !strings.Contains(body, s) {
+			t.Errorf("PROPFIND response doesn't contain %q: %v", s, body)
+		}
+	}
+}
@@ -14,6 +14,10 @@ import (
 
 var CapabilityCalendar = webdav.Capability("calendar-access")
 
+// PrivilegeReadFreeBusy allows computing the busy periods of a calendar, see
+// RFC 4791 section 6.1.1. It's contained in webdav.PrivilegeRead.
+var PrivilegeReadFreeBusy = webdav.Privilege{Space: namespace, Local: "read-free-busy"}
+
 func NewCalendarHomeSet(path string) webdav.BackendSuppliedHomeSet {
 	return &calendarHomeSet{Href: internal.Href{Path: path}}
 }
@@ -69,6 +73,10 @@ type Calendar struct {
 	Description           string
 	MaxResourceSize       int64
 	SupportedComponentSet []string
+	// Timezone is the CALDAV:calendar-timezone property: an iCalendar object
+	// containing a single VTIMEZONE component. Floating date-times and dates
+	// in queries are interpreted in this time zone.
+	Timezone string
 	// ReadOnly reports that the current user may only read this calendar. It
 	// controls the DAV:current-user-privilege-set reported by the server.
 	ReadOnly bool
@@ -84,10 +92,35 @@ type CalendarCompRequest struct {
 	Comps    []CalendarCompRequest
 
 	Expand *CalendarExpandRequest
+
+	// LimitRecurrenceSet and LimitFreeBusySet restrict the returned
+	// overridden recurrence components and free-busy periods to a time range.
+	// They are applied by the server and may be ignored by backends.
+	LimitRecurrenceSet *CalendarLimitRequest
+	LimitFreeBusySet   *CalendarLimitRequest
+
+	// ContentType selects the media type of the returned calendar data,
+	// either "text/calendar" or JCalMIMEType.
+	ContentType string // defaults to "text/calendar"
 }
 
+// CalendarExpandRequest requests recurring components to be expanded into
+// instances within a time range. It is applied by the server with
+// ExpandCalendarObject if the backend doesn't.
 type CalendarExpandRequest struct {
 	Start, End time.Time
+	// Timezone is used to interpret floating date-times, as described in
+	// RFC 4791 section 9.6.5. If nil, UTC is used. It's set by the Handler,
+	// and isn't sent by the Client.
+	Timezone *time.Location
+}
+
+// CalendarLimitRequest restricts calendar data to a time range.
+type CalendarLimitRequest struct {
+	Start, End time.Time
+	// Timezone is used to interpret floating date-times. If nil, UTC is used.
+	// It's set by the Handler, and isn't sent by the Client.
+	Timezone *time.Location
 }
 
 type CompFilter struct {
@@ -115,11 +148,16 @@ type PropFilter struct {
 type TextMatch struct {
 	Text            string
 	NegateCondition bool
+	Collation       string // defaults to "i;ascii-casemap"
 }
 
 type CalendarQuery struct {
 	CompRequest CalendarCompRequest
 	CompFilter  CompFilter
+	// Timezone is used to interpret floating date-times and dates in time
+	// ranges, as described in RFC 4791 section 7.3. If nil, UTC is used. It's
+	// set by the Handler, and isn't sent by the Client.
+	Timezone *time.Location
 }
 
 type CalendarMultiGet struct {
@@ -135,6 +173,38 @@ type CalendarObject struct {
 	Data          *ical.Calendar
 }
 
+// FreeBusyQuery is a request for the busy periods of a calendar, as defined in
+// RFC 4791 section 7.10.
+type FreeBusyQuery struct {
+	Start, End time.Time
+	// Timezone is used to interpret floating date-times and dates, as
+	// described in RFC 4791 section 7.3. If nil, UTC is used. It's set by the
+	// Handler, and isn't sent by the Client.
+	Timezone *time.Location
+}
+
+// FreeBusyType describes why a period is busy, as defined in RFC 5545 section
+// 3.2.9.
+type FreeBusyType string
+
+const (
+	FreeBusyBusy            FreeBusyType = "BUSY"
+	FreeBusyBusyUnavailable FreeBusyType = "BUSY-UNAVAILABLE"
+	FreeBusyBusyTentative   FreeBusyType = "BUSY-TENTATIVE"
+)
+
+// FreeBusyPeriod is a period of time during which a calendar is busy.
+type FreeBusyPeriod struct {
+	Start, End time.Time
+	Type       FreeBusyType
+}
+
+// FreeBusy contains the busy periods of a calendar within a time range.
+type FreeBusy struct {
+	Start, End time.Time
+	Periods    []FreeBusyPeriod
+}
+
 // SyncQuery is the query struct represents a sync-collection request
 type SyncQuery struct {
 	CompRequest CalendarCompRequest
@@ -147,4 +217,7 @@ type SyncResponse struct {
 	SyncToken string
 	Updated   []CalendarObject
 	Deleted   []string
+	// Truncated is set if more changes than SyncQuery.Limit are available.
+	// SyncToken can then be used to fetch the remaining changes.
+	Truncated bool
 }
@@ -24,6 +24,7 @@ var calendarProps = []xml.Name{
 	calendarDescriptionName,
 	maxResourceSizeName,
 	supportedCalendarComponentSetName,
+	calendarTimezoneName,
 }
 
 // DiscoverContextURL performs a DNS-based CardDAV service discovery as
@@ -141,6 +142,11 @@ func decodeCalendar(path string, resp *internal.Response) (*Calendar, error) {
 		return nil, err
 	}
 
+	var tz calendarTimezone
+	if err := resp.DecodeProp(&tz); err != nil && !internal.IsNotFound(err) {
+		return nil, err
+	}
+
 	compNames := make([]string, 0, len(supportedCompSet.Comp))
 	for _, comp := range supportedCompSet.Comp {
 		compNames = append(compNames, comp.Name)
@@ -152,6 +158,7 @@ func decodeCalendar(path string, resp *internal.Response) (*Calendar, error) {
 		Description:           desc.Description,
 		MaxResourceSize:       maxResSize.Size,
 		SupportedComponentSet: compNames,
+		Timezone:              tz.Data,
 	}, nil
 }
 
@@ -189,9 +196,16 @@ func encodeCalendarReq(c *CalendarCompRequest) (*internal.Prop, error) {
 		return nil, err
 	}
 
-	expandReq := encodeExpandRequest(c.Expand)
-
-	calDataReq := calendarDataReq{Comp: compReq, Expand: expandReq}
+	calDataReq := calendarDataReq{
+		Comp:               compReq,
+		Expand:             encodeExpandRequest(c.Expand),
+		LimitRecurrenceSet: encodeLimitRecurrenceSet(c.LimitRecurrenceSet),
+		LimitFreeBusySet:   encodeLimitFreeBusySet(c.LimitFreeBusySet),
+	}
+	if c.ContentType != "" {
+		calDataReq.ContentType = c.ContentType
+		calDataReq.Version = "2.0"
+	}
 
 	getLastModReq := internal.NewRawXMLElement(internal.GetLastModifiedName, nil, nil)
 	getETagReq := internal.NewRawXMLElement(internal.GetETagName, nil, nil)
@@ -245,6 +259,7 @@ func encodeTextMatch(tm *TextMatch) *textMatch {
 
 	encoded := &textMatch{
 		Text:            tm.Text,
+		Collation:       tm.Collation,
 		NegateCondition: negateCondition(tm.NegateCondition),
 	}
 	return encoded
@@ -261,6 +276,26 @@ func encodeExpandRequest(e *CalendarExpandRequest) *expand {
 	return &encoded
 }
 
+func encodeLimitRecurrenceSet(l *CalendarLimitRequest) *limitRecurrenceSet {
+	if l == nil {
+		return nil
+	}
+	return &limitRecurrenceSet{
+		Start: dateWithUTCTime(l.Start),
+		End:   dateWithUTCTime(l.End),
+	}
+}
+
+func encodeLimitFreeBusySet(l *CalendarLimitRequest) *limitFreeBusySet {
+	if l == nil {
+		return nil
+	}
+	return &limitFreeBusySet{
+		Start: dateWithUTCTime(l.Start),
+		End:   dateWithUTCTime(l.End),
+	}
+}
+
 func decodeCalendarObjectList(ms *internal.MultiStatus) ([]CalendarObject, error) {
 	addrs := make([]CalendarObject, 0, len(ms.Responses))
 	errs := make([]error, 0, len(ms.Responses))
@@ -271,45 +306,62 @@ func decodeCalendarObjectList(ms *internal.MultiStatus) ([]CalendarObject, error
 			continue
 		}
 
-		var calData calendarDataResp
-		if err := resp.DecodeProp(&calData); err != nil {
+		co, err := decodeCalendarObject(path, &resp)
+		if err != nil {
 			return nil, err
 		}
+		addrs = append(addrs, *co)
+	}
 
-		var getLastMod internal.GetLastModified
-		if err := resp.DecodeProp(&getLastMod); err != nil && !internal.IsNotFound(err) {
-			return nil, err
-		}
+	return addrs, errors.Join(errs...)
+}
 
-		var getETag internal.GetETag
-		if err := resp.DecodeProp(&getETag); err != nil && !internal.IsNotFound(err) {
-			return nil, err
-		}
+// decodeCalendarData decodes the calendar returned in a calendar-data element,
+// in the media type indicated by its content-type attribute.
+func decodeCalendarData(calData *calendarDataResp) (*ical.Calendar, error) {
+	r := bytes.NewReader(calData.Data)
+	if strings.EqualFold(calData.ContentType, JCalMIMEType) {
+		return DecodeJCal(r)
+	}
+	return ical.NewDecoder(r).Decode()
+}
 
-		var getContentLength internal.GetContentLength
-		if err := resp.DecodeProp(&getContentLength); err != nil && !internal.IsNotFound(err) {
-			return nil, err
-		}
+func decodeCalendarObject(path string, resp *internal.Response) (*CalendarObject, error) {
+	var calData calendarDataResp
+	if err := resp.DecodeProp(&calData); err != nil {
+		return nil, err
+	}
 
-		r := bytes.NewReader(calData.Data)
-		data, err := ical.NewDecoder(r).Decode()
-		if err != nil {
-			return nil, err
-		}
+	var getLastMod internal.GetLastModified
+	if err := resp.DecodeProp(&getLastMod); err != nil && !internal.IsNotFound(err) {
+		return nil, err
+	}
 
-		addrs = append(addrs, CalendarObject{
-			Path:          path,
-			ModTime:       time.Time(getLastMod.LastModified),
-			ContentLength: getContentLength.Length,
-			ETag:          string(getETag.ETag),
-			Data:          data,
-		})
+	var getETag internal.GetETag
+	if err := resp.DecodeProp(&getETag); err != nil && !internal.IsNotFound(err) {
+		return nil, err
 	}
 
-	return addrs, errors.Join(errs...)
+	var getContentLength internal.GetContentLength
+	if err := resp.DecodeProp(&getContentLength); err != nil && !internal.IsNotFound(err) {
+		return nil, err
+	}
+
+	data, err := decodeCalendarData(&calData)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CalendarObject{
+		Path:          path,
+		ModTime:       time.Time(getLastMod.LastModified),
+		ContentLength: getContentLength.Length,
+		ETag:          string(getETag.ETag),
+		Data:          data,
+	}, nil
 }
 
-func (c *Client) QueryCalendar(ctx context.Context, calendar string, query *CalendarQuery) ([]CalendarObject, error) {
+func (c *Client) newCalendarQueryRequest(ctx context.Context, calendar string, query *CalendarQuery) (*http.Request, error) {
 	propReq, err := encodeCalendarReq(&query.CompRequest)
 	if err != nil {
 		return nil, err
@@ -323,7 +375,16 @@ func (c *Client) QueryCalendar(ctx context.Context, calendar string, query *Cale
 	}
 	req.Header.Add("Depth", "1")
 
-	ms, err := c.ic.DoMultiStatus(req.WithContext(ctx))
+	return req.WithContext(ctx), nil
+}
+
+func (c *Client) QueryCalendar(ctx context.Context, calendar string, query *CalendarQuery) ([]CalendarObject, error) {
+	req, err := c.newCalendarQueryRequest(ctx, calendar, query)
+	if err != nil {
+		return nil, err
+	}
+
+	ms, err := c.ic.DoMultiStatus(req)
 	if err != nil {
 		return nil, err
 	}
@@ -331,6 +392,71 @@ func (c *Client) QueryCalendar(ctx context.Context, calendar string, query *Cale
 	return decodeCalendarObjectList(ms)
 }
 
+// QueryCalendarIter is like QueryCalendar, but decodes calendar objects
+// incrementally instead of loading the whole response in memory. The returned
+// iterator must be closed.
+func (c *Client) QueryCalendarIter(ctx context.Context, calendar string, query *CalendarQuery) (*CalendarObjectIterator, error) {
+	req, err := c.newCalendarQueryRequest(ctx, calendar, query)
+	if err != nil {
+		return nil, err
+	}
+
+	mr, err := c.ic.DoMultiStatusReader(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CalendarObjectIterator{mr: mr}, nil
+}
+
+// CalendarObjectIterator iterates over calendar objects returned by the
+// server.
+type CalendarObjectIterator struct {
+	mr   *internal.MultiStatusReader
+	co   *CalendarObject
+	errs []error
+	err  error
+}
+
+// Next advances to the next calendar object. It returns false when there
+// are no more objects or when an error occurs.
+func (it *CalendarObjectIterator) Next() bool {
+	it.co = nil
+	if it.err != nil {
+		return false
+	}
+
+	for it.mr.Next() {
+		resp := it.mr.Response()
+		path, err := resp.Path()
+		if err != nil {
+			it.errs = append(it.errs, err)
+			continue
+		}
+
+		it.co, it.err = decodeCalendarObject(path, resp)
+		return it.err == nil
+	}
+	it.err = it.mr.Err()
+	return false
+}
+
+// CalendarObject returns the current calendar object.
+func (it *CalendarObjectIterator) CalendarObject() *CalendarObject {
+	return it.co
+}
+
+// Err returns the error which stopped the iteration, joined with errors
+// reported by the server for individual objects.
+func (it *CalendarObjectIterator) Err() error {
+	return errors.Join(append(it.errs, it.err)...)
+}
+
+// Close releases the resources held by the iterator.
+func (it *CalendarObjectIterator) Close() error {
+	return it.mr.Close()
+}
+
 func (c *Client) MultiGetCalendar(ctx context.Context, path string, multiGet *CalendarMultiGet) ([]CalendarObject, error) {
 	propReq, err := encodeCalendarReq(&multiGet.CompRequest)
 	if err != nil {
@@ -396,12 +522,20 @@ func populateCalendarObject(co *CalendarObject, h http.Header) error {
 	return nil
 }
 
-func (c *Client) GetCalendarObject(ctx context.Context, path string) (*CalendarObject, error) {
-	req, err := c.ic.NewRequest(http.MethodGet, path, nil)
+// QueryFreeBusy returns the busy periods of a calendar within a time range, as
+// defined in RFC 4791 section 7.10.
+func (c *Client) QueryFreeBusy(ctx context.Context, calendar string, query *FreeBusyQuery) (*FreeBusy, error) {
+	fbQuery := freeBusyQuery{
+		TimeRange: timeRange{
+			Start: dateWithUTCTime(query.Start.UTC()),
+			End:   dateWithUTCTime(query.End.UTC()),
+		},
+	}
+	req, err := c.ic.NewXMLRequest("REPORT", calendar, &fbQuery)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Accept", ical.MIMEType)
+	req.Header.Add("Depth", "1")
 
 	resp, err := c.ic.Do(req.WithContext(ctx))
 	if err != nil {
@@ -421,6 +555,39 @@ func (c *Client) GetCalendarObject(ctx context.Context, path string) (*CalendarO
 	if err != nil {
 		return nil, err
 	}
+	return decodeFreeBusy(cal)
+}
+
+func (c *Client) GetCalendarObject(ctx context.Context, path string) (*CalendarObject, error) {
+	req, err := c.ic.NewRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", ical.MIMEType)
+
+	resp, err := c.ic.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+
+	var cal *ical.Calendar
+	switch strings.ToLower(mediaType) {
+	case ical.MIMEType:
+		cal, err = ical.NewDecoder(resp.Body).Decode()
+	case JCalMIMEType:
+		cal, err = DecodeJCal(resp.Body)
+	default:
+		return nil, fmt.Errorf("caldav: expected Content-Type %q, got %q", ical.MIMEType, mediaType)
+	}
+	if err != nil {
+		return nil, err
+	}
 
 	co := &CalendarObject{
 		Path: resp.Request.URL.Path,
@@ -488,6 +655,11 @@ func (c *Client) SyncCollection(ctx context.Context, path string, query *SyncQue
 		if err != nil {
 			var httpErr *internal.HTTPError
 			hasStatus := errors.As(err, &httpErr)
+			if hasStatus && httpErr.Code == http.StatusInsufficientStorage && (p == path || path == fmt.Sprintf("%s/", p)) {
+				// The server truncated the results, see RFC 6578 section 3.6
+				ret.Truncated = true
+				continue
+			}
 			if !hasStatus || httpErr.Code != http.StatusNotFound {
 				errs = append(errs, err)
 				continue
@@ -522,7 +694,7 @@ func (c *Client) SyncCollection(ctx context.Context, path string, query *SyncQue
 		// data, Data is left nil and the caller fetches it as before.
 		var calData calendarDataResp
 		if err := resp.DecodeProp(&calData); err == nil {
-			cal, err := ical.NewDecoder(bytes.NewReader(calData.Data)).Decode()
+			cal, err := decodeCalendarData(&calData)
 			if err != nil {
 				return nil, err
 			}
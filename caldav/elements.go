@@ -17,12 +17,21 @@ var (
 	supportedCalendarDataName         = xml.Name{namespace, "supported-calendar-data"}
 	supportedCalendarComponentSetName = xml.Name{namespace, "supported-calendar-component-set"}
 	maxResourceSizeName               = xml.Name{namespace, "max-resource-size"}
+	calendarTimezoneName              = xml.Name{namespace, "calendar-timezone"}
 
 	calendarQueryName    = xml.Name{namespace, "calendar-query"}
 	calendarMultigetName = xml.Name{namespace, "calendar-multiget"}
+	freeBusyQueryName    = xml.Name{namespace, "free-busy-query"}
 
 	calendarName     = xml.Name{namespace, "calendar"}
 	calendarDataName = xml.Name{namespace, "calendar-data"}
+
+	scheduleInboxName          = xml.Name{namespace, "schedule-inbox"}
+	scheduleOutboxName         = xml.Name{namespace, "schedule-outbox"}
+	scheduleInboxURLName       = xml.Name{namespace, "schedule-inbox-URL"}
+	scheduleOutboxURLName      = xml.Name{namespace, "schedule-outbox-URL"}
+	calendarUserAddressSetName = xml.Name{namespace, "calendar-user-address-set"}
+	calendarUserTypeName       = xml.Name{namespace, "calendar-user-type"}
 )
 
 // https://tools.ietf.org/html/rfc4791#section-6.2.1
@@ -66,6 +75,18 @@ type maxResourceSize struct {
 	Size    int64    `xml:",chardata"`
 }
 
+// https://tools.ietf.org/html/rfc4791#section-5.2.2
+type calendarTimezone struct {
+	XMLName xml.Name `xml:"urn:ietf:params:xml:ns:caldav calendar-timezone"`
+	Data    string   `xml:",chardata"`
+}
+
+// https://tools.ietf.org/html/rfc4791#section-9.8
+type timezone struct {
+	XMLName xml.Name `xml:"urn:ietf:params:xml:ns:caldav timezone"`
+	Data    string   `xml:",chardata"`
+}
+
 // https://tools.ietf.org/html/rfc4791#section-9.5
 type calendarQuery struct {
 	XMLName  xml.Name       `xml:"urn:ietf:params:xml:ns:caldav calendar-query"`
@@ -73,7 +94,7 @@ type calendarQuery struct {
 	AllProp  *struct{}      `xml:"DAV: allprop,omitempty"`
 	PropName *struct{}      `xml:"DAV: propname,omitempty"`
 	Filter   filter         `xml:"filter"`
-	// TODO: timezone
+	Timezone *timezone      `xml:"timezone,omitempty"`
 }
 
 // https://tools.ietf.org/html/rfc4791#section-9.10
@@ -85,6 +106,12 @@ type calendarMultiget struct {
 	PropName *struct{}       `xml:"DAV: propname,omitempty"`
 }
 
+// https://tools.ietf.org/html/rfc4791#section-7.10
+type freeBusyQuery struct {
+	XMLName   xml.Name  `xml:"urn:ietf:params:xml:ns:caldav free-busy-query"`
+	TimeRange timeRange `xml:"time-range"`
+}
+
 // https://tools.ietf.org/html/rfc4791#section-9.7
 type filter struct {
 	XMLName    xml.Name   `xml:"urn:ietf:params:xml:ns:caldav filter"`
@@ -127,6 +154,11 @@ type textMatch struct {
 	NegateCondition negateCondition `xml:"negate-condition,attr,omitempty"`
 }
 
+// https://tools.ietf.org/html/rfc4791#section-7.8
+type supportedCollation struct {
+	XMLName xml.Name `xml:"urn:ietf:params:xml:ns:caldav supported-collation"`
+}
+
 type negateCondition bool
 
 func (nc *negateCondition) UnmarshalText(b []byte) error {
@@ -177,10 +209,14 @@ func (t *dateWithUTCTime) MarshalText() ([]byte, error) {
 
 // Request variant of https://tools.ietf.org/html/rfc4791#section-9.6
 type calendarDataReq struct {
-	XMLName xml.Name `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
-	Comp    *comp    `xml:"comp,omitempty"`
-	Expand  *expand  `xml:"expand,omitempty"`
-	// TODO: limit-recurrence-set, limit-freebusy-set
+	XMLName     xml.Name `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+	ContentType string   `xml:"content-type,attr,omitempty"`
+	Version     string   `xml:"version,attr,omitempty"`
+	Comp        *comp    `xml:"comp,omitempty"`
+	Expand      *expand  `xml:"expand,omitempty"`
+
+	LimitRecurrenceSet *limitRecurrenceSet `xml:"limit-recurrence-set,omitempty"`
+	LimitFreeBusySet   *limitFreeBusySet   `xml:"limit-freebusy-set,omitempty"`
 }
 
 // https://tools.ietf.org/html/rfc4791#section-9.6.1
@@ -195,12 +231,27 @@ type comp struct {
 	Comp    []comp    `xml:"comp,omitempty"`
 }
 
+// https://tools.ietf.org/html/rfc4791#section-9.6.5
 type expand struct {
 	XMLName xml.Name        `xml:"urn:ietf:params:xml:ns:caldav expand"`
 	Start   dateWithUTCTime `xml:"start,attr"`
 	End     dateWithUTCTime `xml:"end,attr"`
 }
 
+// https://tools.ietf.org/html/rfc4791#section-9.6.6
+type limitRecurrenceSet struct {
+	XMLName xml.Name        `xml:"urn:ietf:params:xml:ns:caldav limit-recurrence-set"`
+	Start   dateWithUTCTime `xml:"start,attr"`
+	End     dateWithUTCTime `xml:"end,attr"`
+}
+
+// https://tools.ietf.org/html/rfc4791#section-9.6.7
+type limitFreeBusySet struct {
+	XMLName xml.Name        `xml:"urn:ietf:params:xml:ns:caldav limit-freebusy-set"`
+	Start   dateWithUTCTime `xml:"start,attr"`
+	End     dateWithUTCTime `xml:"end,attr"`
+}
+
 // https://tools.ietf.org/html/rfc4791#section-9.6.4
 type prop struct {
 	XMLName xml.Name `xml:"urn:ietf:params:xml:ns:caldav prop"`
@@ -210,14 +261,18 @@ type prop struct {
 
 // Response variant of https://tools.ietf.org/html/rfc4791#section-9.6
 type calendarDataResp struct {
-	XMLName xml.Name `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
-	Data    []byte   `xml:",chardata"`
+	XMLName     xml.Name `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+	ContentType string   `xml:"content-type,attr,omitempty"`
+	Version     string   `xml:"version,attr,omitempty"`
+	Data        []byte   `xml:",chardata"`
 }
 
 type reportReq struct {
-	Query    *calendarQuery
-	Multiget *calendarMultiget
-	// TODO: CALDAV:free-busy-query
+	Query          *calendarQuery
+	Multiget       *calendarMultiget
+	ExpandProperty *internal.ExpandProperty
+	SyncCollection *internal.SyncCollectionQuery
+	FreeBusyQuery  *freeBusyQuery
 }
 
 func (r *reportReq) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
@@ -229,6 +284,15 @@ func (r *reportReq) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	case calendarMultigetName:
 		r.Multiget = &calendarMultiget{}
 		v = r.Multiget
+	case internal.ExpandPropertyName:
+		r.ExpandProperty = &internal.ExpandProperty{}
+		v = r.ExpandProperty
+	case internal.SyncCollectionName:
+		r.SyncCollection = &internal.SyncCollectionQuery{}
+		v = r.SyncCollection
+	case freeBusyQueryName:
+		r.FreeBusyQuery = &freeBusyQuery{}
+		v = r.FreeBusyQuery
 	default:
 		return fmt.Errorf("caldav: unsupported REPORT root %q %q", start.Name.Space, start.Name.Local)
 	}
@@ -236,6 +300,50 @@ func (r *reportReq) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	return d.DecodeElement(v, &start)
 }
 
+// https://datatracker.ietf.org/doc/html/rfc6638#section-2.2
+type scheduleInboxURL struct {
+	XMLName xml.Name      `xml:"urn:ietf:params:xml:ns:caldav schedule-inbox-URL"`
+	Href    internal.Href `xml:"DAV: href"`
+}
+
+// https://datatracker.ietf.org/doc/html/rfc6638#section-2.1
+type scheduleOutboxURL struct {
+	XMLName xml.Name      `xml:"urn:ietf:params:xml:ns:caldav schedule-outbox-URL"`
+	Href    internal.Href `xml:"DAV: href"`
+}
+
+// https://datatracker.ietf.org/doc/html/rfc6638#section-2.4.1
+type calendarUserAddressSet struct {
+	XMLName xml.Name        `xml:"urn:ietf:params:xml:ns:caldav calendar-user-address-set"`
+	Hrefs   []internal.Href `xml:"DAV: href"`
+}
+
+// https://datatracker.ietf.org/doc/html/rfc6638#section-2.4.2
+type calendarUserType struct {
+	XMLName xml.Name `xml:"urn:ietf:params:xml:ns:caldav calendar-user-type"`
+	Type    string   `xml:",chardata"`
+}
+
+// https://datatracker.ietf.org/doc/html/rfc6638#section-10.1
+type scheduleResponse struct {
+	XMLName   xml.Name                `xml:"urn:ietf:params:xml:ns:caldav schedule-response"`
+	Responses []scheduleResponseEntry `xml:"response"`
+}
+
+// https://datatracker.ietf.org/doc/html/rfc6638#section-10.2
+type scheduleResponseEntry struct {
+	XMLName       xml.Name          `xml:"urn:ietf:params:xml:ns:caldav response"`
+	Recipient     scheduleRecipient `xml:"recipient"`
+	RequestStatus string            `xml:"request-status"`
+	CalendarData  *calendarDataResp `xml:"calendar-data,omitempty"`
+}
+
+// https://datatracker.ietf.org/doc/html/rfc6638#section-10.3
+type scheduleRecipient struct {
+	XMLName xml.Name      `xml:"urn:ietf:params:xml:ns:caldav recipient"`
+	Href    internal.Href `xml:"DAV: href"`
+}
+
 type mkcolReq struct {
 	XMLName      xml.Name              `xml:"DAV: mkcol"`
 	ResourceType internal.ResourceType `xml:"set>prop>resourcetype"`
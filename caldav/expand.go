@@ -0,0 +1,344 @@
+package caldav
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+// recurrenceInstance identifies an instance of a recurring component.
+type recurrenceInstance struct {
+	name, uid string
+	unix      int64
+}
+
+// overriddenInstances returns the instances overridden by a component with a
+// RECURRENCE-ID. These must be skipped when expanding recurrence rules.
+// Floating times are interpreted in loc.
+func overriddenInstances(cal *ical.Calendar, loc *time.Location) (map[recurrenceInstance]bool, error) {
+	overridden := make(map[recurrenceInstance]bool)
+	for _, child := range cal.Children {
+		if child.Props.Get(ical.PropRecurrenceID) == nil {
+			continue
+		}
+		uid, err := child.Props.Text(ical.PropUID)
+		if err != nil {
+			return nil, err
+		}
+		recurrenceID, err := child.Props.DateTime(ical.PropRecurrenceID, loc)
+		if err != nil {
+			return nil, err
+		}
+		overridden[recurrenceInstance{child.Name, uid, recurrenceID.Unix()}] = true
+	}
+	return overridden, nil
+}
+
+func isDateProp(prop *ical.Prop) bool {
+	switch prop.ValueType() {
+	case ical.ValueDate:
+		return true
+	case ical.ValueDefault:
+		return len(prop.Value) == len("20060102")
+	}
+	return false
+}
+
+// componentTimeRange returns the time range covered by an event, a to-do or a
+// journal entry. Floating times are interpreted in loc. The start and end
+// times are zero if the component isn't scheduled.
+func componentTimeRange(comp *ical.Component, loc *time.Location) (start, end time.Time, err error) {
+	startProp := comp.Props.Get(ical.PropDateTimeStart)
+	if startProp == nil {
+		if due := comp.Props.Get(ical.PropDue); comp.Name == ical.CompToDo && due != nil {
+			t, err := due.DateTime(loc)
+			return t, t, err
+		}
+		return time.Time{}, time.Time{}, nil
+	}
+
+	start, err = startProp.DateTime(loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	switch comp.Name {
+	case ical.CompEvent:
+		end, err = (&ical.Event{comp}).DateTimeEnd(loc)
+	case ical.CompToDo:
+		if due := comp.Props.Get(ical.PropDue); due != nil {
+			end, err = due.DateTime(loc)
+		} else if dur := comp.Props.Get(ical.PropDuration); dur != nil {
+			var d time.Duration
+			d, err = dur.Duration()
+			end = start.Add(d)
+		} else {
+			end = start
+		}
+	default:
+		end = start
+		if isDateProp(startProp) {
+			end = start.Add(24 * time.Hour)
+		}
+	}
+	return start, end, err
+}
+
+// overlapsTimeRange returns true if the period between compStart and compEnd
+// overlaps the time range between start and end. Periods with a zero
+// duration overlap the time range if they start within it.
+func overlapsTimeRange(start, end, compStart, compEnd time.Time) bool {
+	if compStart.IsZero() {
+		return true
+	} else if !compEnd.After(compStart) {
+		return !compStart.Before(start) && compStart.Before(end)
+	}
+	return compStart.Before(end) && compEnd.After(start)
+}
+
+// ExpandCalendarObject returns a copy of a calendar object with recurring
+// components expanded into the instances overlapping the time range of req, as
+// described in RFC 4791 section 9.6.5.
+//
+// Instances overridden by a component with a RECURRENCE-ID are replaced by the
+// overriding component, and excluded dates are skipped. Date-time values of
+// the instances are converted to UTC, and time zone definitions are removed.
+// Floating times are interpreted in req.Timezone, or UTC if it's nil.
+// Expanding calendar data which has already been expanded leaves it unchanged.
+func ExpandCalendarObject(req *CalendarExpandRequest, co *CalendarObject) (*CalendarObject, error) {
+	if co.Data == nil || co.Data.Component == nil {
+		return co, nil
+	}
+
+	loc := req.Timezone
+	if loc == nil {
+		loc = time.UTC
+	}
+	cal, err := expandCalendar(co.Data, req.Start, req.End, loc)
+	if err != nil {
+		return nil, fmt.Errorf("caldav: failed to expand %q: %v", co.Path, err)
+	}
+
+	expanded := *co
+	expanded.Data = cal
+	return &expanded, nil
+}
+
+func expandCalendar(cal *ical.Calendar, start, end time.Time, loc *time.Location) (*ical.Calendar, error) {
+	overridden, err := overriddenInstances(cal, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	expanded := ical.NewCalendar()
+	for name, props := range cal.Props {
+		expanded.Props[name] = props
+	}
+	for _, child := range cal.Children {
+		switch child.Name {
+		case ical.CompTimezone:
+			// All date-time values are converted to UTC
+		case ical.CompEvent, ical.CompToDo, ical.CompJournal:
+			instances, err := expandComponent(child, start, end, loc, overridden)
+			if err != nil {
+				return nil, err
+			}
+			expanded.Children = append(expanded.Children, instances...)
+		default:
+			expanded.Children = append(expanded.Children, child)
+		}
+	}
+	return expanded, nil
+}
+
+func expandComponent(comp *ical.Component, start, end time.Time, loc *time.Location, overridden map[recurrenceInstance]bool) ([]*ical.Component, error) {
+	compStart, compEnd, err := componentTimeRange(comp, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	if comp.Props.Get(ical.PropRecurrenceID) != nil || compStart.IsZero() {
+		return expandSingleComponent(comp, start, end, compStart, compEnd, loc)
+	}
+	rset, err := comp.RecurrenceSet(loc)
+	if err != nil {
+		return nil, err
+	} else if rset == nil {
+		return expandSingleComponent(comp, start, end, compStart, compEnd, loc)
+	}
+
+	uid, err := comp.Props.Text(ical.PropUID)
+	if err != nil {
+		return nil, err
+	}
+	dur := compEnd.Sub(compStart)
+	isDate := isDateProp(comp.Props.Get(ical.PropDateTimeStart))
+
+	var instances []*ical.Component
+	for _, t := range rset.Between(start.Add(-dur), end, true) {
+		if overridden[recurrenceInstance{comp.Name, uid, t.Unix()}] || !overlapsTimeRange(start, end, t, t.Add(dur)) {
+			continue
+		}
+
+		instance := cloneComponent(comp)
+		instance.Props.Del(ical.PropRecurrenceRule)
+		instance.Props.Del(ical.PropRecurrenceDates)
+		instance.Props.Del(ical.PropExceptionDates)
+		setInstanceTime(instance, ical.PropRecurrenceID, t, isDate)
+		setInstanceTime(instance, ical.PropDateTimeStart, t, isDate)
+		if instance.Props.Get(ical.PropDateTimeEnd) != nil {
+			setInstanceTime(instance, ical.PropDateTimeEnd, t.Add(dur), isDate)
+		}
+		if instance.Props.Get(ical.PropDue) != nil {
+			setInstanceTime(instance, ical.PropDue, t.Add(dur), isDate)
+		}
+		instances = append(instances, instance)
+	}
+	return instances, nil
+}
+
+// expandSingleComponent expands a component which doesn't recur, or which
+// overrides a recurrence instance.
+func expandSingleComponent(comp *ical.Component, start, end, compStart, compEnd time.Time, loc *time.Location) ([]*ical.Component, error) {
+	if !overlapsTimeRange(start, end, compStart, compEnd) {
+		return nil, nil
+	}
+	instance := cloneComponent(comp)
+	for _, name := range []string{ical.PropDateTimeStart, ical.PropDateTimeEnd, ical.PropDue, ical.PropRecurrenceID} {
+		if err := convertDateTimeToUTC(instance, name, loc); err != nil {
+			return nil, err
+		}
+	}
+	return []*ical.Component{instance}, nil
+}
+
+func setInstanceTime(comp *ical.Component, name string, t time.Time, isDate bool) {
+	prop := ical.NewProp(name)
+	if isDate {
+		prop.SetDate(t)
+	} else {
+		prop.SetDateTime(t.UTC())
+	}
+	comp.Props.Set(prop)
+}
+
+// convertDateTimeToUTC converts the date-time value of a property to UTC.
+// Floating times are interpreted in loc. Date values are left unchanged.
+func convertDateTimeToUTC(comp *ical.Component, name string, loc *time.Location) error {
+	prop := comp.Props.Get(name)
+	if prop == nil || isDateProp(prop) {
+		return nil
+	}
+	t, err := prop.DateTime(loc)
+	if err != nil {
+		return err
+	}
+	prop.Params.Del(ical.PropTimezoneID)
+	prop.SetDateTime(t.UTC())
+	return nil
+}
+
+// limitCalendarRecurrenceSet returns a copy of a calendar with the overridden
+// recurrence components outside of a time range removed, as described in
+// RFC 4791 section 9.6.6. Floating times are interpreted in loc.
+func limitCalendarRecurrenceSet(cal *ical.Calendar, start, end time.Time, loc *time.Location) (*ical.Calendar, error) {
+	limited := &ical.Calendar{&ical.Component{Name: cal.Name, Props: cal.Props}}
+	for _, child := range cal.Children {
+		if child.Props.Get(ical.PropRecurrenceID) != nil {
+			compStart, compEnd, err := componentTimeRange(child, loc)
+			if err != nil {
+				return nil, err
+			}
+			if !overlapsTimeRange(start, end, compStart, compEnd) {
+				continue
+			}
+		}
+		limited.Children = append(limited.Children, child)
+	}
+	return limited, nil
+}
+
+// limitCalendarFreeBusySet returns a copy of a calendar with the free-busy periods of
+// VFREEBUSY components outside of a time range removed, as described in
+// RFC 4791 section 9.6.7.
+func limitCalendarFreeBusySet(cal *ical.Calendar, start, end time.Time) (*ical.Calendar, error) {
+	limited := &ical.Calendar{&ical.Component{Name: cal.Name, Props: cal.Props}}
+	for _, child := range cal.Children {
+		if child.Name != ical.CompFreeBusy {
+			limited.Children = append(limited.Children, child)
+			continue
+		}
+
+		fb := &ical.Component{Name: child.Name, Props: make(ical.Props), Children: child.Children}
+		for name, props := range child.Props {
+			if name != ical.PropFreeBusy {
+				fb.Props[name] = props
+				continue
+			}
+			for _, prop := range props {
+				var periods []string
+				for _, s := range strings.Split(prop.Value, ",") {
+					periodStart, periodEnd, err := parsePeriod(s)
+					if err != nil {
+						return nil, err
+					}
+					if overlapsTimeRange(start, end, periodStart, periodEnd) {
+						periods = append(periods, s)
+					}
+				}
+				if len(periods) > 0 {
+					prop.Value = strings.Join(periods, ",")
+					fb.Props.Add(&prop)
+				}
+			}
+		}
+		limited.Children = append(limited.Children, fb)
+	}
+	return limited, nil
+}
+
+// applyCalendarDataReq applies a calendar-data request to a calendar object
+// returned by the backend: recurrence sets are expanded or limited, and
+// components and properties which haven't been requested are pruned.
+func applyCalendarDataReq(req *CalendarCompRequest, co *CalendarObject) (*CalendarObject, error) {
+	if co.Data == nil || co.Data.Component == nil {
+		return co, nil
+	}
+
+	var err error
+	if req.Expand != nil {
+		co, err = ExpandCalendarObject(req.Expand, co)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cal := co.Data
+	if l := req.LimitRecurrenceSet; l != nil && req.Expand == nil {
+		loc := l.Timezone
+		if loc == nil {
+			loc = time.UTC
+		}
+		cal, err = limitCalendarRecurrenceSet(cal, l.Start, l.End, loc)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if l := req.LimitFreeBusySet; l != nil {
+		cal, err = limitCalendarFreeBusySet(cal, l.Start, l.End)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cal != co.Data {
+		limited := *co
+		limited.Data = cal
+		co = &limited
+	}
+
+	// Pruning must happen last, since the properties needed to expand
+	// recurrence sets may not have been requested
+	return PruneCalendarObject(req, co), nil
+}
@@ -0,0 +1,277 @@
+package caldav
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+const expandTestData = `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VTIMEZONE
+TZID:America/New_York
+BEGIN:STANDARD
+DTSTART:19671029T020000
+TZOFFSETFROM:-0400
+TZOFFSETTO:-0500
+TZNAME:EST
+END:STANDARD
+END:VTIMEZONE
+BEGIN:VEVENT
+UID:weekly@example.com
+DTSTAMP:20061101T000000Z
+DTSTART;TZID=America/New_York:20061023T100000
+DTEND;TZID=America/New_York:20061023T110000
+RRULE:FREQ=WEEKLY;COUNT=5
+EXDATE;TZID=America/New_York:20061030T100000
+END:VEVENT
+BEGIN:VEVENT
+UID:weekly@example.com
+DTSTAMP:20061101T000000Z
+RECURRENCE-ID;TZID=America/New_York:20061106T100000
+DTSTART;TZID=America/New_York:20061106T140000
+DTEND;TZID=America/New_York:20061106T150000
+END:VEVENT
+BEGIN:VEVENT
+UID:single@example.com
+DTSTAMP:20061101T000000Z
+DTSTART:20060101T100000Z
+DURATION:PT1H
+END:VEVENT
+BEGIN:VTODO
+UID:todo@example.com
+DTSTAMP:20061101T000000Z
+DUE:20061025T120000Z
+END:VTODO
+END:VCALENDAR`
+
+func checkExpandedCalendar(t *testing.T, cal *ical.Calendar) {
+	type instance struct {
+		name, recurrenceID, start, end string
+	}
+	want := []instance{
+		{ical.CompEvent, "20061113T150000Z", "20061113T150000Z", "20061113T160000Z"},
+		{ical.CompEvent, "20061106T150000Z", "20061106T190000Z", "20061106T200000Z"},
+		{ical.CompToDo, "", "", ""},
+	}
+
+	if len(cal.Children) != len(want) {
+		t.Fatalf("got %v components, want %v", len(cal.Children), len(want))
+	}
+	for i, child := range cal.Children {
+		propValue := func(name string) string {
+			if prop := child.Props.Get(name); prop != nil {
+				if prop.Params.Get(ical.PropTimezoneID) != "" {
+					t.Errorf("component #%v: %v has a TZID", i, name)
+				}
+				return prop.Value
+			}
+			return ""
+		}
+		got := instance{
+			name:         child.Name,
+			recurrenceID: propValue(ical.PropRecurrenceID),
+			start:        propValue(ical.PropDateTimeStart),
+			end:          propValue(ical.PropDateTimeEnd),
+		}
+		if got != want[i] {
+			t.Errorf("component #%v = %+v, want %+v", i, got, want[i])
+		}
+		if child.Props.Get(ical.PropRecurrenceRule) != nil || child.Props.Get(ical.PropExceptionDates) != nil {
+			t.Errorf("component #%v has recurrence properties", i)
+		}
+	}
+}
+
+func TestExpandCalendarObject(t *testing.T) {
+	cal, err := ical.NewDecoder(strings.NewReader(expandTestData)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := CalendarExpandRequest{
+		Start: toDate(t, "20061024T000000Z"),
+		End:   toDate(t, "20061114T000000Z"),
+	}
+	co, err := ExpandCalendarObject(&req, &CalendarObject{Path: "/user/calendars/a/weekly.ics", Data: cal})
+	if err != nil {
+		t.Fatalf("ExpandCalendarObject() = %v", err)
+	}
+	checkExpandedCalendar(t, co.Data)
+
+	if len(cal.Children) != 5 || cal.Children[0].Name != ical.CompTimezone {
+		t.Errorf("ExpandCalendarObject() modified the original calendar")
+	}
+
+	co, err = ExpandCalendarObject(&req, co)
+	if err != nil {
+		t.Fatalf("ExpandCalendarObject() = %v", err)
+	}
+	checkExpandedCalendar(t, co.Data)
+}
+
+func TestLimitCalendarRecurrenceSet(t *testing.T) {
+	cal, err := ical.NewDecoder(strings.NewReader(expandTestData)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limited, err := limitCalendarRecurrenceSet(cal, toDate(t, "20061024T000000Z"), toDate(t, "20061101T000000Z"), time.UTC)
+	if err != nil {
+		t.Fatalf("limitCalendarRecurrenceSet() = %v", err)
+	}
+	if len(limited.Children) != 4 {
+		t.Fatalf("got %v components, want 4", len(limited.Children))
+	}
+	for _, child := range limited.Children {
+		if child.Props.Get(ical.PropRecurrenceID) != nil {
+			t.Errorf("overridden instance outside of the time range wasn't removed")
+		}
+	}
+}
+
+func TestClient_QueryCalendar_expand(t *testing.T) {
+	cal, err := ical.NewDecoder(strings.NewReader(expandTestData)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calendar := Calendar{Path: "/user/calendars/a"}
+	handler := Handler{Backend: testBackend{
+		calendars: []Calendar{calendar},
+		objectMap: map[string][]CalendarObject{
+			calendar.Path: {{Path: "/user/calendars/a/weekly.ics", Data: cal}},
+		},
+	}}
+	ts := httptest.NewServer(&handler)
+	defer ts.Close()
+
+	client, err := NewClient(nil, ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := CalendarQuery{
+		CompRequest: CalendarCompRequest{
+			Name:     ical.CompCalendar,
+			AllProps: true,
+			AllComps: true,
+			Expand: &CalendarExpandRequest{
+				Start: toDate(t, "20061024T000000Z"),
+				End:   toDate(t, "20061114T000000Z"),
+			},
+		},
+		CompFilter: CompFilter{Name: ical.CompCalendar},
+	}
+	cos, err := client.QueryCalendar(context.Background(), calendar.Path, &query)
+	if err != nil {
+		t.Fatalf("QueryCalendar() = %v", err)
+	}
+	if len(cos) != 1 {
+		t.Fatalf("QueryCalendar() returned %v calendar objects, want 1", len(cos))
+	}
+	checkExpandedCalendar(t, cos[0].Data)
+}
+
+const expandFloatingTestData = `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VEVENT
+UID:floating@example.com
+DTSTAMP:20061101T000000Z
+DTSTART:20061023T100000
+DTEND:20061023T110000
+RRULE:FREQ=DAILY;COUNT=2
+END:VEVENT
+END:VCALENDAR`
+
+const expandTestTimezone = `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VTIMEZONE
+TZID:Example/Fixed
+BEGIN:STANDARD
+DTSTART:19700101T000000
+TZOFFSETFROM:-0500
+TZOFFSETTO:-0500
+END:STANDARD
+END:VTIMEZONE
+END:VCALENDAR`
+
+func checkExpandedFloatingCalendar(t *testing.T, cal *ical.Calendar) {
+	want := []string{"20061023T150000Z", "20061024T150000Z"}
+	if len(cal.Children) != len(want) {
+		t.Fatalf("got %v components, want %v", len(cal.Children), len(want))
+	}
+	for i, child := range cal.Children {
+		if start := child.Props.Get(ical.PropDateTimeStart); start == nil || start.Value != want[i] {
+			t.Errorf("component #%v: DTSTART = %v, want %v", i, start, want[i])
+		}
+	}
+}
+
+func TestExpandCalendarObject_floating(t *testing.T) {
+	cal, err := ical.NewDecoder(strings.NewReader(expandFloatingTestData)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := CalendarExpandRequest{
+		Start:    toDate(t, "20061023T000000Z"),
+		End:      toDate(t, "20061030T000000Z"),
+		Timezone: time.FixedZone("EST", -5*60*60),
+	}
+	co, err := ExpandCalendarObject(&req, &CalendarObject{Path: "/user/calendars/a/floating.ics", Data: cal})
+	if err != nil {
+		t.Fatalf("ExpandCalendarObject() = %v", err)
+	}
+	checkExpandedFloatingCalendar(t, co.Data)
+}
+
+func TestClient_MultiGetCalendar_expandFloating(t *testing.T) {
+	cal, err := ical.NewDecoder(strings.NewReader(expandFloatingTestData)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calendar := Calendar{Path: "/user/calendars/a", Timezone: expandTestTimezone}
+	handler := Handler{Backend: testBackend{
+		calendars: []Calendar{calendar},
+		objectMap: map[string][]CalendarObject{
+			calendar.Path: {{Path: "/user/calendars/a/floating.ics", Data: cal}},
+		},
+	}}
+	ts := httptest.NewServer(&handler)
+	defer ts.Close()
+
+	client, err := NewClient(nil, ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	multiGet := CalendarMultiGet{
+		Paths: []string{"/user/calendars/a/floating.ics"},
+		CompRequest: CalendarCompRequest{
+			Name:     ical.CompCalendar,
+			AllProps: true,
+			AllComps: true,
+			Expand: &CalendarExpandRequest{
+				Start: toDate(t, "20061023T000000Z"),
+				End:   toDate(t, "20061030T000000Z"),
+			},
+		},
+	}
+	cos, err := client.MultiGetCalendar(context.Background(), calendar.Path, &multiGet)
+	if err != nil {
+		t.Fatalf("MultiGetCalendar() = %v", err)
+	}
+	if len(cos) != 1 {
+		t.Fatalf("MultiGetCalendar() returned %v calendar objects, want 1", len(cos))
+	}
+	checkExpandedFloatingCalendar(t, cos[0].Data)
+}
@@ -0,0 +1,278 @@
+package caldav
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+// productID is the PRODID of calendars generated by the server.
+const productID = "-//emersion.fr//go-webdav//EN"
+
+// ComputeFreeBusy returns the busy periods of the provided calendar objects
+// within the time range of the query, as described in RFC 4791 section 7.10.
+//
+// Events are busy unless they are transparent or cancelled, and tentative
+// events are reported as such. Recurring events are expanded. The FREEBUSY
+// properties of VFREEBUSY components are included as well. Floating times are
+// interpreted in the time zone of the query.
+func ComputeFreeBusy(query *FreeBusyQuery, cos []CalendarObject) (*FreeBusy, error) {
+	fb := &FreeBusy{Start: query.Start, End: query.End}
+	for _, co := range cos {
+		if co.Data == nil || co.Data.Component == nil {
+			continue
+		}
+		periods, err := calendarFreeBusy(co.Data, query.Start, query.End, query.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("caldav: failed to compute free-busy time of %q: %v", co.Path, err)
+		}
+		fb.Periods = append(fb.Periods, periods...)
+	}
+	fb.Periods = mergeFreeBusyPeriods(fb.Periods)
+	return fb, nil
+}
+
+// calendarFreeBusy returns the busy periods of a calendar within a time
+// range. Floating times are interpreted in loc, or UTC if nil.
+func calendarFreeBusy(cal *ical.Calendar, start, end time.Time, loc *time.Location) ([]FreeBusyPeriod, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	overridden, err := overriddenInstances(cal, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	var periods []FreeBusyPeriod
+	add := func(p FreeBusyPeriod) {
+		if p.Start.Before(start) {
+			p.Start = start
+		}
+		if p.End.After(end) {
+			p.End = end
+		}
+		if p.Start.Before(p.End) {
+			periods = append(periods, p)
+		}
+	}
+
+	for _, child := range cal.Children {
+		switch child.Name {
+		case ical.CompEvent:
+			fbType, busy, err := eventFreeBusyType(child)
+			if err != nil {
+				return nil, err
+			} else if !busy {
+				continue
+			}
+
+			event := ical.Event{child}
+			eventStart, err := event.DateTimeStart(loc)
+			if err != nil {
+				return nil, err
+			} else if eventStart.IsZero() {
+				continue
+			}
+			eventEnd, err := event.DateTimeEnd(loc)
+			if err != nil {
+				return nil, err
+			}
+			dur := eventEnd.Sub(eventStart)
+
+			rset, err := child.RecurrenceSet(loc)
+			if err != nil {
+				return nil, err
+			}
+			if rset == nil || child.Props.Get(ical.PropRecurrenceID) != nil {
+				add(FreeBusyPeriod{Start: eventStart, End: eventEnd, Type: fbType})
+				continue
+			}
+
+			uid, err := child.Props.Text(ical.PropUID)
+			if err != nil {
+				return nil, err
+			}
+			for _, t := range rset.Between(start.Add(-dur), end, true) {
+				if overridden[recurrenceInstance{child.Name, uid, t.Unix()}] {
+					continue
+				}
+				add(FreeBusyPeriod{Start: t, End: t.Add(dur), Type: fbType})
+			}
+		case ical.CompFreeBusy:
+			for _, prop := range child.Props.Values(ical.PropFreeBusy) {
+				fbPeriods, err := decodeFreeBusyProp(&prop)
+				if err != nil {
+					return nil, err
+				}
+				for _, p := range fbPeriods {
+					add(p)
+				}
+			}
+		}
+	}
+
+	return periods, nil
+}
+
+// eventFreeBusyType returns the type of busy time consumed by an event, or
+// false if the event doesn't consume any time.
+func eventFreeBusyType(comp *ical.Component) (FreeBusyType, bool, error) {
+	transp, err := comp.Props.Text(ical.PropTransparency)
+	if err != nil {
+		return "", false, err
+	}
+	if strings.EqualFold(transp, "TRANSPARENT") {
+		return "", false, nil
+	}
+
+	status, err := (&ical.Event{comp}).Status()
+	if err != nil {
+		return "", false, err
+	}
+	switch status {
+	case ical.EventCancelled:
+		return "", false, nil
+	case ical.EventTentative:
+		return FreeBusyBusyTentative, true, nil
+	default:
+		return FreeBusyBusy, true, nil
+	}
+}
+
+// mergeFreeBusyPeriods sorts periods and merges the overlapping ones of the
+// same type.
+func mergeFreeBusyPeriods(periods []FreeBusyPeriod) []FreeBusyPeriod {
+	sort.Slice(periods, func(i, j int) bool {
+		if periods[i].Type != periods[j].Type {
+			return periods[i].Type < periods[j].Type
+		}
+		return periods[i].Start.Before(periods[j].Start)
+	})
+
+	var merged []FreeBusyPeriod
+	for _, p := range periods {
+		if n := len(merged); n > 0 && merged[n-1].Type == p.Type && !p.Start.After(merged[n-1].End) {
+			if p.End.After(merged[n-1].End) {
+				merged[n-1].End = p.End
+			}
+			continue
+		}
+		merged = append(merged, p)
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Start.Before(merged[j].Start)
+	})
+	return merged
+}
+
+func encodeFreeBusy(fb *FreeBusy) (*ical.Calendar, error) {
+	var uid [16]byte
+	if _, err := rand.Read(uid[:]); err != nil {
+		return nil, err
+	}
+
+	comp := ical.NewComponent(ical.CompFreeBusy)
+	comp.Props.SetText(ical.PropUID, hex.EncodeToString(uid[:]))
+	comp.Props.SetDateTime(ical.PropDateTimeStamp, time.Now().UTC())
+	comp.Props.SetDateTime(ical.PropDateTimeStart, fb.Start.UTC())
+	comp.Props.SetDateTime(ical.PropDateTimeEnd, fb.End.UTC())
+	for _, p := range fb.Periods {
+		prop := ical.NewProp(ical.PropFreeBusy)
+		if p.Type != "" && p.Type != FreeBusyBusy {
+			prop.Params.Set(ical.ParamFreeBusyType, string(p.Type))
+		}
+		prop.Value = p.Start.UTC().Format(dateWithUTCTimeLayout) + "/" + p.End.UTC().Format(dateWithUTCTimeLayout)
+		comp.Props.Add(prop)
+	}
+
+	cal := ical.NewCalendar()
+	cal.Props.SetText(ical.PropVersion, "2.0")
+	cal.Props.SetText(ical.PropProductID, productID)
+	cal.Children = []*ical.Component{comp}
+	return cal, nil
+}
+
+func decodeFreeBusy(cal *ical.Calendar) (*FreeBusy, error) {
+	for _, child := range cal.Children {
+		if child.Name != ical.CompFreeBusy {
+			continue
+		}
+
+		start, err := child.Props.DateTime(ical.PropDateTimeStart, time.UTC)
+		if err != nil {
+			return nil, err
+		}
+		end, err := child.Props.DateTime(ical.PropDateTimeEnd, time.UTC)
+		if err != nil {
+			return nil, err
+		}
+
+		fb := &FreeBusy{Start: start, End: end}
+		for _, prop := range child.Props.Values(ical.PropFreeBusy) {
+			periods, err := decodeFreeBusyProp(&prop)
+			if err != nil {
+				return nil, err
+			}
+			fb.Periods = append(fb.Periods, periods...)
+		}
+		return fb, nil
+	}
+	return nil, fmt.Errorf("caldav: missing VFREEBUSY component")
+}
+
+// decodeFreeBusyProp decodes the busy periods of a FREEBUSY property. Free
+// periods are ignored.
+func decodeFreeBusyProp(prop *ical.Prop) ([]FreeBusyPeriod, error) {
+	fbType := FreeBusyType(strings.ToUpper(prop.Params.Get(ical.ParamFreeBusyType)))
+	if fbType == "" {
+		fbType = FreeBusyBusy
+	} else if fbType == "FREE" {
+		return nil, nil
+	}
+
+	var periods []FreeBusyPeriod
+	for _, s := range strings.Split(prop.Value, ",") {
+		start, end, err := parsePeriod(s)
+		if err != nil {
+			return nil, err
+		}
+		periods = append(periods, FreeBusyPeriod{Start: start, End: end, Type: fbType})
+	}
+	return periods, nil
+}
+
+// parsePeriod parses a period of time in UTC, as defined in RFC 5545 section
+// 3.3.9.
+func parsePeriod(s string) (start, end time.Time, err error) {
+	i := strings.IndexByte(s, '/')
+	if i < 0 {
+		return time.Time{}, time.Time{}, fmt.Errorf("caldav: malformed period %q", s)
+	}
+
+	start, err = time.Parse(dateWithUTCTimeLayout, s[:i])
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("caldav: malformed period start: %v", err)
+	}
+
+	if v := s[i+1:]; strings.HasPrefix(v, "P") || strings.HasPrefix(v, "+P") {
+		durProp := ical.NewProp(ical.PropDuration)
+		durProp.Value = v
+		dur, err := durProp.Duration()
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("caldav: malformed period duration: %v", err)
+		}
+		end = start.Add(dur)
+	} else {
+		end, err = time.Parse(dateWithUTCTimeLayout, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("caldav: malformed period end: %v", err)
+		}
+	}
+	return start, end, nil
+}
@@ -0,0 +1,129 @@
+package caldav
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+const freeBusyTestData = `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VEVENT
+UID:busy@example.com
+DTSTAMP:20060206T001102Z
+DTSTART:20060102T100000Z
+DTEND:20060102T110000Z
+END:VEVENT
+BEGIN:VEVENT
+UID:overlapping@example.com
+DTSTAMP:20060206T001102Z
+DTSTART:20060102T103000Z
+DURATION:PT1H
+END:VEVENT
+BEGIN:VEVENT
+UID:transparent@example.com
+DTSTAMP:20060206T001102Z
+DTSTART:20060102T120000Z
+DURATION:PT1H
+TRANSP:TRANSPARENT
+END:VEVENT
+BEGIN:VEVENT
+UID:cancelled@example.com
+DTSTAMP:20060206T001102Z
+DTSTART:20060102T140000Z
+DURATION:PT1H
+STATUS:CANCELLED
+END:VEVENT
+BEGIN:VEVENT
+UID:tentative@example.com
+DTSTAMP:20060206T001102Z
+DTSTART:20060102T160000Z
+DURATION:PT1H
+STATUS:TENTATIVE
+END:VEVENT
+BEGIN:VEVENT
+UID:recurring@example.com
+DTSTAMP:20060206T001102Z
+DTSTART:20060101T090000Z
+DURATION:PT30M
+RRULE:FREQ=DAILY;COUNT=5
+END:VEVENT
+BEGIN:VEVENT
+UID:recurring@example.com
+DTSTAMP:20060206T001102Z
+RECURRENCE-ID:20060103T090000Z
+DTSTART:20060103T200000Z
+DURATION:PT1H
+END:VEVENT
+BEGIN:VFREEBUSY
+UID:freebusy@example.com
+DTSTAMP:20060206T001102Z
+FREEBUSY;FBTYPE=BUSY-UNAVAILABLE:20060103T080000Z/PT1H
+FREEBUSY;FBTYPE=FREE:20060103T120000Z/PT1H
+END:VFREEBUSY
+END:VCALENDAR`
+
+func TestComputeFreeBusy(t *testing.T) {
+	cal, err := ical.NewDecoder(strings.NewReader(freeBusyTestData)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := FreeBusyQuery{
+		Start: toDate(t, "20060102T000000Z"),
+		End:   toDate(t, "20060104T000000Z"),
+	}
+	fb, err := ComputeFreeBusy(&query, []CalendarObject{{Data: cal}})
+	if err != nil {
+		t.Fatalf("ComputeFreeBusy() = %v", err)
+	}
+
+	want := []FreeBusyPeriod{
+		{toDate(t, "20060102T090000Z"), toDate(t, "20060102T093000Z"), FreeBusyBusy},
+		{toDate(t, "20060102T100000Z"), toDate(t, "20060102T113000Z"), FreeBusyBusy},
+		{toDate(t, "20060102T160000Z"), toDate(t, "20060102T170000Z"), FreeBusyBusyTentative},
+		{toDate(t, "20060103T080000Z"), toDate(t, "20060103T090000Z"), FreeBusyBusyUnavailable},
+		{toDate(t, "20060103T200000Z"), toDate(t, "20060103T210000Z"), FreeBusyBusy},
+	}
+	if len(fb.Periods) != len(want) {
+		t.Fatalf("ComputeFreeBusy() = %v, want %v", fb.Periods, want)
+	}
+	for i, p := range fb.Periods {
+		if !p.Start.Equal(want[i].Start) || !p.End.Equal(want[i].End) || p.Type != want[i].Type {
+			t.Errorf("period #%v = %v, want %v", i, p, want[i])
+		}
+	}
+}
+
+func TestComputeFreeBusy_timezone(t *testing.T) {
+	cal, err := ical.NewDecoder(strings.NewReader(`BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VEVENT
+UID:floating@example.com
+DTSTAMP:20060206T001102Z
+DTSTART:20060102T100000
+DURATION:PT1H
+END:VEVENT
+END:VCALENDAR`)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := FreeBusyQuery{
+		Start:    toDate(t, "20060102T000000Z"),
+		End:      toDate(t, "20060103T000000Z"),
+		Timezone: time.FixedZone("EST", -5*60*60),
+	}
+	fb, err := ComputeFreeBusy(&query, []CalendarObject{{Data: cal}})
+	if err != nil {
+		t.Fatalf("ComputeFreeBusy() = %v", err)
+	}
+	want := FreeBusyPeriod{toDate(t, "20060102T150000Z"), toDate(t, "20060102T160000Z"), FreeBusyBusy}
+	if len(fb.Periods) != 1 || !fb.Periods[0].Start.Equal(want.Start) || !fb.Periods[0].End.Equal(want.End) {
+		t.Errorf("ComputeFreeBusy() = %v, want %v", fb.Periods, want)
+	}
+}
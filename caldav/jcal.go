@@ -0,0 +1,518 @@
+package caldav
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-ical"
+)
+
+// JCalMIMEType is the media type of jCal, the JSON format for iCalendar data
+// defined in RFC 7265.
+const JCalMIMEType = "application/calendar+json"
+
+// jCalMultiValuedText lists the text properties whose comma-separated values
+// are represented as separate jCal values.
+var jCalMultiValuedText = map[string]bool{
+	ical.PropCategories: true,
+	ical.PropResources:  true,
+}
+
+// jCalRecurNumeric lists the recurrence rule parts with integer values, see
+// RFC 7265 section 3.6.10.
+var jCalRecurNumeric = map[string]bool{
+	"count":      true,
+	"interval":   true,
+	"bysecond":   true,
+	"byminute":   true,
+	"byhour":     true,
+	"bymonthday": true,
+	"byyearday":  true,
+	"byweekno":   true,
+	"bymonth":    true,
+	"bysetpos":   true,
+}
+
+// EncodeJCal writes a calendar in the jCal format.
+func EncodeJCal(w io.Writer, cal *ical.Calendar) error {
+	v, err := encodeJCalComponent(cal.Component)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(v)
+}
+
+func encodeJCalComponent(comp *ical.Component) ([]interface{}, error) {
+	names := make([]string, 0, len(comp.Props))
+	for name := range comp.Props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	props := make([]interface{}, 0, len(comp.Props))
+	for _, name := range names {
+		for i := range comp.Props[name] {
+			prop, err := encodeJCalProp(&comp.Props[name][i])
+			if err != nil {
+				return nil, err
+			}
+			props = append(props, prop)
+		}
+	}
+
+	children := make([]interface{}, 0, len(comp.Children))
+	for _, child := range comp.Children {
+		v, err := encodeJCalComponent(child)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, v)
+	}
+
+	return []interface{}{strings.ToLower(comp.Name), props, children}, nil
+}
+
+func encodeJCalProp(prop *ical.Prop) ([]interface{}, error) {
+	params := make(map[string]interface{}, len(prop.Params))
+	for name, values := range prop.Params {
+		if name == ical.ParamValue {
+			continue
+		}
+		if len(values) == 1 {
+			params[strings.ToLower(name)] = values[0]
+		} else {
+			params[strings.ToLower(name)] = values
+		}
+	}
+
+	t := prop.ValueType()
+	typ := strings.ToLower(string(t))
+	if t == ical.ValueDefault {
+		typ = "unknown"
+	}
+
+	v := []interface{}{strings.ToLower(prop.Name), params, typ}
+	switch prop.Name {
+	case ical.PropGeo:
+		parts := strings.Split(prop.Value, ";")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("caldav: invalid GEO value %q", prop.Value)
+		}
+		var geo [2]float64
+		for i, s := range parts {
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, fmt.Errorf("caldav: invalid GEO value %q: %v", prop.Value, err)
+			}
+			geo[i] = f
+		}
+		return append(v, geo[:]), nil
+	case ical.PropRequestStatus:
+		var parts []string
+		for _, s := range splitEscaped(prop.Value, ';') {
+			parts = append(parts, unescapeText(s))
+		}
+		return append(v, parts), nil
+	}
+
+	var values []string
+	switch t {
+	case ical.ValueText:
+		if jCalMultiValuedText[prop.Name] {
+			values = splitEscaped(prop.Value, ',')
+		} else {
+			values = []string{prop.Value}
+		}
+	case ical.ValueDate, ical.ValueDateTime, ical.ValueTime, ical.ValuePeriod, ical.ValueUTCOffset, ical.ValueInt, ical.ValueFloat:
+		values = strings.Split(prop.Value, ",")
+	default:
+		values = []string{prop.Value}
+	}
+
+	for _, s := range values {
+		value, err := encodeJCalValue(t, s)
+		if err != nil {
+			return nil, fmt.Errorf("caldav: invalid %v value %q: %v", prop.Name, s, err)
+		}
+		v = append(v, value)
+	}
+	return v, nil
+}
+
+func encodeJCalValue(t ical.ValueType, s string) (interface{}, error) {
+	switch t {
+	case ical.ValueText:
+		return unescapeText(s), nil
+	case ical.ValueDate, ical.ValueDateTime, ical.ValueTime:
+		return formatJCalDateTime(s), nil
+	case ical.ValuePeriod:
+		parts := strings.SplitN(s, "/", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid period")
+		}
+		end := parts[1]
+		if !isDuration(end) {
+			end = formatJCalDateTime(end)
+		}
+		return []string{formatJCalDateTime(parts[0]), end}, nil
+	case ical.ValueUTCOffset:
+		if len(s) < 5 {
+			return nil, fmt.Errorf("invalid UTC offset")
+		}
+		offset := s[:3] + ":" + s[3:5]
+		if len(s) == 7 {
+			offset += ":" + s[5:]
+		}
+		return offset, nil
+	case ical.ValueInt:
+		return strconv.Atoi(s)
+	case ical.ValueFloat:
+		return strconv.ParseFloat(s, 64)
+	case ical.ValueBool:
+		switch strings.ToUpper(s) {
+		case "TRUE":
+			return true, nil
+		case "FALSE":
+			return false, nil
+		}
+		return nil, fmt.Errorf("invalid boolean")
+	case ical.ValueRecurrence:
+		return encodeJCalRecur(s)
+	}
+	return s, nil
+}
+
+func encodeJCalRecur(s string) (map[string]interface{}, error) {
+	recur := make(map[string]interface{})
+	for _, part := range strings.Split(s, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid recurrence rule part %q", part)
+		}
+		name := strings.ToLower(kv[0])
+
+		var values []interface{}
+		for _, v := range strings.Split(kv[1], ",") {
+			switch {
+			case name == "until":
+				values = append(values, formatJCalDateTime(v))
+			case jCalRecurNumeric[name]:
+				i, err := strconv.Atoi(v)
+				if err != nil {
+					return nil, err
+				}
+				values = append(values, i)
+			default:
+				values = append(values, v)
+			}
+		}
+		if len(values) == 1 {
+			recur[name] = values[0]
+		} else {
+			recur[name] = values
+		}
+	}
+	return recur, nil
+}
+
+// DecodeJCal reads a calendar in the jCal format.
+func DecodeJCal(r io.Reader) (*ical.Calendar, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("caldav: failed to decode jCal: %v", err)
+	}
+	comp, err := decodeJCalComponent(v)
+	if err != nil {
+		return nil, err
+	}
+	if comp.Name != ical.CompCalendar {
+		return nil, fmt.Errorf("caldav: expected jCal %v component, got %v", ical.CompCalendar, comp.Name)
+	}
+	return &ical.Calendar{comp}, nil
+}
+
+func decodeJCalComponent(v interface{}) (*ical.Component, error) {
+	l, ok := v.([]interface{})
+	if !ok || len(l) != 3 {
+		return nil, fmt.Errorf("caldav: malformed jCal component")
+	}
+	name, ok := l[0].(string)
+	props, ok2 := l[1].([]interface{})
+	children, ok3 := l[2].([]interface{})
+	if !ok || !ok2 || !ok3 {
+		return nil, fmt.Errorf("caldav: malformed jCal component")
+	}
+
+	comp := ical.NewComponent(name)
+	for _, v := range props {
+		prop, err := decodeJCalProp(v)
+		if err != nil {
+			return nil, err
+		}
+		comp.Props.Add(prop)
+	}
+	for _, v := range children {
+		child, err := decodeJCalComponent(v)
+		if err != nil {
+			return nil, err
+		}
+		comp.Children = append(comp.Children, child)
+	}
+	return comp, nil
+}
+
+func decodeJCalProp(v interface{}) (*ical.Prop, error) {
+	l, ok := v.([]interface{})
+	if !ok || len(l) < 4 {
+		return nil, fmt.Errorf("caldav: malformed jCal property")
+	}
+	name, ok := l[0].(string)
+	params, ok2 := l[1].(map[string]interface{})
+	typ, ok3 := l[2].(string)
+	if !ok || !ok2 || !ok3 {
+		return nil, fmt.Errorf("caldav: malformed jCal property")
+	}
+
+	prop := ical.NewProp(name)
+	for k, v := range params {
+		values, err := decodeJSONStrings(v)
+		if err != nil {
+			return nil, fmt.Errorf("caldav: malformed jCal %v parameter %v: %v", prop.Name, k, err)
+		}
+		prop.Params[strings.ToUpper(k)] = values
+	}
+
+	t := ical.ValueType(strings.ToUpper(typ))
+	if typ == "unknown" {
+		t = ical.ValueDefault
+	}
+	prop.SetValueType(t)
+
+	values := make([]string, 0, len(l)-3)
+	for _, v := range l[3:] {
+		var s string
+		var err error
+		switch prop.Name {
+		case ical.PropGeo:
+			s, err = decodeJCalStructured(v, func(v interface{}) (string, error) {
+				n, ok := v.(json.Number)
+				if !ok {
+					return "", fmt.Errorf("expected a number")
+				}
+				return n.String(), nil
+			})
+		case ical.PropRequestStatus:
+			s, err = decodeJCalStructured(v, func(v interface{}) (string, error) {
+				s, ok := v.(string)
+				if !ok {
+					return "", fmt.Errorf("expected a string")
+				}
+				return escapeText(s), nil
+			})
+		default:
+			s, err = decodeJCalValue(t, v)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("caldav: malformed jCal %v value: %v", prop.Name, err)
+		}
+		values = append(values, s)
+	}
+	prop.Value = strings.Join(values, ",")
+
+	return prop, nil
+}
+
+func decodeJCalStructured(v interface{}, f func(v interface{}) (string, error)) (string, error) {
+	l, ok := v.([]interface{})
+	if !ok {
+		return "", fmt.Errorf("expected an array")
+	}
+	parts := make([]string, len(l))
+	for i, v := range l {
+		var err error
+		if parts[i], err = f(v); err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(parts, ";"), nil
+}
+
+func decodeJCalValue(t ical.ValueType, v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		switch t {
+		case ical.ValueText:
+			return escapeText(v), nil
+		case ical.ValueDate, ical.ValueDateTime, ical.ValueTime:
+			return parseJCalDateTime(v), nil
+		case ical.ValueUTCOffset:
+			return strings.Replace(v, ":", "", -1), nil
+		}
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		if v {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case []interface{}:
+		if t != ical.ValuePeriod || len(v) != 2 {
+			return "", fmt.Errorf("unexpected array")
+		}
+		start, ok := v[0].(string)
+		end, ok2 := v[1].(string)
+		if !ok || !ok2 {
+			return "", fmt.Errorf("malformed period")
+		}
+		if !isDuration(end) {
+			end = parseJCalDateTime(end)
+		}
+		return parseJCalDateTime(start) + "/" + end, nil
+	case map[string]interface{}:
+		if t != ical.ValueRecurrence {
+			return "", fmt.Errorf("unexpected object")
+		}
+		return decodeJCalRecur(v)
+	}
+	return "", fmt.Errorf("unexpected value %v", v)
+}
+
+func decodeJCalRecur(recur map[string]interface{}) (string, error) {
+	names := make([]string, 0, len(recur))
+	for name := range recur {
+		if name != "freq" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	// FREQ should be first for compatibility with RFC 2445
+	if _, ok := recur["freq"]; ok {
+		names = append([]string{"freq"}, names...)
+	}
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		v := recur[name]
+		l, ok := v.([]interface{})
+		if !ok {
+			l = []interface{}{v}
+		}
+		values := make([]string, len(l))
+		for j, v := range l {
+			switch v := v.(type) {
+			case string:
+				if name == "until" {
+					v = parseJCalDateTime(v)
+				}
+				values[j] = v
+			case json.Number:
+				values[j] = v.String()
+			default:
+				return "", fmt.Errorf("unexpected recurrence rule value %v", v)
+			}
+		}
+		parts[i] = strings.ToUpper(name) + "=" + strings.Join(values, ",")
+	}
+	return strings.Join(parts, ";"), nil
+}
+
+func decodeJSONStrings(v interface{}) ([]string, error) {
+	switch v := v.(type) {
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		l := make([]string, len(v))
+		for i, v := range v {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected a string")
+			}
+			l[i] = s
+		}
+		return l, nil
+	}
+	return nil, fmt.Errorf("expected a string or an array")
+}
+
+// formatJCalDateTime converts a date, date-time or time from the iCalendar
+// basic format (e.g. "20060102T150405Z") to the extended format used by jCal
+// (e.g. "2006-01-02T15:04:05Z").
+func formatJCalDateTime(s string) string {
+	date, t := s, ""
+	if i := strings.IndexByte(s, 'T'); i >= 0 {
+		date, t = s[:i], s[i+1:]
+	} else if len(s) != 8 {
+		date, t = "", s
+	}
+
+	var sb strings.Builder
+	if len(date) == 8 {
+		sb.WriteString(date[:4] + "-" + date[4:6] + "-" + date[6:])
+	} else {
+		sb.WriteString(date)
+	}
+	if date != "" && t != "" {
+		sb.WriteByte('T')
+	}
+	if len(t) >= 6 {
+		sb.WriteString(t[:2] + ":" + t[2:4] + ":" + t[4:])
+	} else {
+		sb.WriteString(t)
+	}
+	return sb.String()
+}
+
+// parseJCalDateTime is the reverse of formatJCalDateTime.
+func parseJCalDateTime(s string) string {
+	return strings.NewReplacer("-", "", ":", "").Replace(s)
+}
+
+func isDuration(s string) bool {
+	return strings.HasPrefix(strings.TrimLeft(s, "+-"), "P")
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+func unescapeText(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) {
+			i++
+			c = s[i]
+			if c == 'n' || c == 'N' {
+				c = '\n'
+			}
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+// splitEscaped splits an iCalendar value on a separator, ignoring escaped
+// separators. The returned parts are still escaped.
+func splitEscaped(s string, sep byte) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
@@ -0,0 +1,159 @@
+package caldav
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-ical"
+)
+
+var jCalCalendarData = toCRLF(`BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Inc.//Example Calendar//EN
+BEGIN:VEVENT
+UID:2a1e2f4c-7d42-4a7b-8c0e-5d3f2b1a9c8e
+DTSTAMP:20060206T001121Z
+DTSTART;TZID=Europe/Paris:20060102T100000
+DURATION:PT1H
+RRULE:FREQ=WEEKLY;BYDAY=MO,WE;COUNT=5
+EXDATE;VALUE=DATE:20060104
+SUMMARY:Meeting\, with a newline\nand a backslash \\
+CATEGORIES:WORK,MEETING
+GEO:37.386013;-122.082932
+ATTENDEE;CN=Dave;PARTSTAT=ACCEPTED:mailto:dave@example.org
+PRIORITY:1
+X-EXAMPLE-FLAG;VALUE=BOOLEAN:TRUE
+END:VEVENT
+END:VCALENDAR
+`)
+
+func toCRLF(s string) string {
+	return strings.Replace(s, "\n", "\r\n", -1)
+}
+
+func TestJCal(t *testing.T) {
+	cal, err := ical.NewDecoder(strings.NewReader(jCalCalendarData)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeJCal(&buf, cal); err != nil {
+		t.Fatalf("EncodeJCal() = %v", err)
+	}
+	s := buf.String()
+	for _, want := range []string{
+		`["vcalendar",[[`,
+		`["version",{},"text","2.0"]`,
+		`["dtstart",{"tzid":"Europe/Paris"},"date-time","2006-01-02T10:00:00"]`,
+		`["rrule",{},"recur",{"byday":["MO","WE"],"count":5,"freq":"WEEKLY"}]`,
+		`["exdate",{},"date","2006-01-04"]`,
+		`["summary",{},"text","Meeting, with a newline\nand a backslash \\"]`,
+		`["categories",{},"text","WORK","MEETING"]`,
+		`["geo",{},"float",[37.386013,-122.082932]]`,
+		`["priority",{},"integer",1]`,
+		`["x-example-flag",{},"boolean",true]`,
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("jCal doesn't contain %v:\n%v", want, s)
+		}
+	}
+
+	decoded, err := DecodeJCal(&buf)
+	if err != nil {
+		t.Fatalf("DecodeJCal() = %v", err)
+	}
+	var out bytes.Buffer
+	if err := ical.NewEncoder(&out).Encode(decoded); err != nil {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	if err := ical.NewEncoder(&want).Encode(cal); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != want.String() {
+		t.Errorf("round-tripped calendar = \n%v\nwant\n%v", out.String(), want.String())
+	}
+
+	if _, err := DecodeJCal(strings.NewReader(`["vcard",[]]`)); err == nil {
+		t.Errorf("DecodeJCal() succeeded with a jCard object")
+	}
+}
+
+func TestJCalContentNegotiation(t *testing.T) {
+	calendar := Calendar{Path: "/user/calendars/a"}
+	cal, err := ical.NewDecoder(strings.NewReader(jCalCalendarData)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	object := CalendarObject{Path: calendar.Path + "/meeting.ics", Data: cal}
+	handler := Handler{Backend: testBackend{
+		calendars: []Calendar{calendar},
+		objectMap: map[string][]CalendarObject{calendar.Path: {object}},
+	}}
+
+	for _, tc := range []struct {
+		accept, contentType string
+		code                int
+	}{
+		{"", ical.MIMEType, http.StatusOK},
+		{"application/calendar+json", JCalMIMEType, http.StatusOK},
+		{"text/calendar;q=0.5, application/calendar+json", JCalMIMEType, http.StatusOK},
+		{"application/calendar+json;version=1.0, */*;q=0.1", ical.MIMEType, http.StatusOK},
+		{"text/calendar;version=1.0", "", http.StatusNotAcceptable},
+	} {
+		req := httptest.NewRequest(http.MethodGet, object.Path, nil)
+		if tc.accept != "" {
+			req.Header.Set("Accept", tc.accept)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		res := w.Result()
+		if res.StatusCode != tc.code {
+			t.Errorf("GET with Accept %q: status = %v, want %v", tc.accept, res.StatusCode, tc.code)
+			continue
+		}
+		if tc.code != http.StatusOK {
+			continue
+		}
+		if ct := res.Header.Get("Content-Type"); ct != tc.contentType {
+			t.Errorf("GET with Accept %q: Content-Type = %q, want %q", tc.accept, ct, tc.contentType)
+		}
+	}
+
+	ts := httptest.NewServer(&handler)
+	defer ts.Close()
+	client, err := NewClient(nil, ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := CalendarQuery{
+		CompRequest: CalendarCompRequest{
+			Name:        ical.CompCalendar,
+			AllProps:    true,
+			AllComps:    true,
+			ContentType: JCalMIMEType,
+		},
+		CompFilter: CompFilter{Name: ical.CompCalendar},
+	}
+	cos, err := client.QueryCalendar(context.Background(), calendar.Path, &query)
+	if err != nil {
+		t.Fatalf("QueryCalendar() = %v", err)
+	}
+	if len(cos) != 1 {
+		t.Fatalf("QueryCalendar() returned %v objects, want 1", len(cos))
+	}
+	events := cos[0].Data.Events()
+	if len(events) != 1 {
+		t.Fatalf("calendar object has %v events, want 1", len(events))
+	}
+	if summary, err := events[0].Props.Text(ical.PropSummary); err != nil || summary != "Meeting, with a newline\nand a backslash \\" {
+		t.Errorf("SUMMARY = %q, %v", summary, err)
+	}
+}
@@ -1,10 +1,12 @@
 package caldav
 
 import (
+	"fmt"
 	"strings"
 	"time"
 
 	"github.com/emersion/go-ical"
+	"github.com/emersion/go-webdav/internal"
 )
 
 // Filter returns the filtered list of calendar objects matching the provided query.
@@ -17,7 +19,7 @@ func Filter(query *CalendarQuery, cos []CalendarObject) ([]CalendarObject, error
 
 	var out []CalendarObject
 	for _, co := range cos {
-		ok, err := Match(query.CompFilter, &co)
+		ok, err := matchCalendarObject(query.CompFilter, &co, query.Timezone)
 		if err != nil {
 			return nil, err
 		}
@@ -25,28 +27,37 @@ func Filter(query *CalendarQuery, cos []CalendarObject) ([]CalendarObject, error
 			continue
 		}
 
-		// TODO properties are not currently filtered even if requested
-		out = append(out, co)
+		out = append(out, *PruneCalendarObject(&query.CompRequest, &co))
 	}
 	return out, nil
 }
 
 // Match reports whether the provided CalendarObject matches the query.
+// Floating date-times and dates are interpreted as UTC, use Filter to
+// interpret them in the time zone of a calendar.
 func Match(query CompFilter, co *CalendarObject) (matched bool, err error) {
+	return matchCalendarObject(query, co, nil)
+}
+
+func matchCalendarObject(query CompFilter, co *CalendarObject, loc *time.Location) (bool, error) {
 	if co.Data == nil || co.Data.Component == nil {
 		panic("request to process empty calendar object")
 	}
-	return match(query, co.Data.Component)
+	tc, err := newTimeRangeContext(co.Data, loc)
+	if err != nil {
+		return false, err
+	}
+	return match(query, co.Data.Component, nil, tc)
 }
 
-func match(filter CompFilter, comp *ical.Component) (bool, error) {
+func match(filter CompFilter, comp, parent *ical.Component, tc *timeRangeContext) (bool, error) {
 	if comp.Name != filter.Name {
 		return filter.IsNotDefined, nil
 	}
 
-	var zeroDate time.Time
-	if filter.Start != zeroDate {
-		match, err := matchCompTimeRange(filter.Start, filter.End, comp)
+	if !filter.Start.IsZero() || !filter.End.IsZero() {
+		tr := timeRangeFilter{filter.Start, filter.End}
+		match, err := matchCompTimeRange(tr, comp, parent, tc)
 		if err != nil {
 			return false, err
 		}
@@ -55,7 +66,7 @@ func match(filter CompFilter, comp *ical.Component) (bool, error) {
 		}
 	}
 	for _, compFilter := range filter.Comps {
-		match, err := matchCompFilter(compFilter, comp)
+		match, err := matchCompFilter(compFilter, comp, tc)
 		if err != nil {
 			return false, err
 		}
@@ -64,7 +75,7 @@ func match(filter CompFilter, comp *ical.Component) (bool, error) {
 		}
 	}
 	for _, propFilter := range filter.Props {
-		match, err := matchPropFilter(propFilter, comp)
+		match, err := matchPropFilter(propFilter, comp, tc)
 		if err != nil {
 			return false, err
 		}
@@ -75,11 +86,11 @@ func match(filter CompFilter, comp *ical.Component) (bool, error) {
 	return true, nil
 }
 
-func matchCompFilter(filter CompFilter, comp *ical.Component) (bool, error) {
+func matchCompFilter(filter CompFilter, comp *ical.Component, tc *timeRangeContext) (bool, error) {
 	var matches []*ical.Component
 
 	for _, child := range comp.Children {
-		match, err := match(filter, child)
+		match, err := match(filter, child, comp, tc)
 		if err != nil {
 			return false, err
 		} else if match {
@@ -92,114 +103,80 @@ func matchCompFilter(filter CompFilter, comp *ical.Component) (bool, error) {
 	return true, nil
 }
 
-func matchPropFilter(filter PropFilter, comp *ical.Component) (bool, error) {
-	// TODO: this only matches first field, there can be multiple
-	field := comp.Props.Get(filter.Name)
-	if field == nil {
+func matchPropFilter(filter PropFilter, comp *ical.Component, tc *timeRangeContext) (bool, error) {
+	fields := comp.Props.Values(filter.Name)
+	if len(fields) == 0 {
 		return filter.IsNotDefined, nil
+	} else if filter.IsNotDefined {
+		return false, nil
 	}
 
-	for _, paramFilter := range filter.ParamFilter {
-		if !matchParamFilter(paramFilter, field) {
-			return false, nil
+	// The filter matches if any instance of the property matches
+	for i := range fields {
+		match, err := matchPropFilterField(filter, &fields[i], tc)
+		if err != nil || match {
+			return match, err
 		}
 	}
+	return false, nil
+}
 
-	var zeroDate time.Time
-	if filter.Start != zeroDate {
-		match, err := matchPropTimeRange(filter.Start, filter.End, field)
+func matchPropFilterField(filter PropFilter, field *ical.Prop, tc *timeRangeContext) (bool, error) {
+	for _, paramFilter := range filter.ParamFilter {
+		match, err := matchParamFilter(paramFilter, field)
 		if err != nil {
 			return false, err
 		}
 		if !match {
 			return false, nil
 		}
+	}
+
+	if !filter.Start.IsZero() || !filter.End.IsZero() {
+		tr := timeRangeFilter{filter.Start, filter.End}
+		return matchPropTimeRange(tr, field, tc.loc)
 	} else if filter.TextMatch != nil {
-		if !matchTextMatch(*filter.TextMatch, field.Value) {
-			return false, nil
-		}
-		return true, nil
+		return matchTextMatch(*filter.TextMatch, field.Value)
 	}
 	// empty prop-filter, property exists
 	return true, nil
 }
 
-func matchCompTimeRange(start, end time.Time, comp *ical.Component) (bool, error) {
-	// See https://datatracker.ietf.org/doc/html/rfc4791#section-9.9
-
-	// evaluate recurring components
-	rset, err := comp.RecurrenceSet(start.Location())
-	if err != nil {
-		return false, err
-	}
-	if rset != nil {
-		// TODO we can only set inclusive to true or false, but really the
-		// start time is inclusive while the end time is not :/
-		return len(rset.Between(start, end, true)) > 0, nil
-	}
-
-	// TODO handle more than just events
-	if comp.Name != ical.CompEvent {
+func matchParamFilter(filter ParamFilter, field *ical.Prop) (bool, error) {
+	values := field.Params.Values(filter.Name)
+	if len(values) == 0 {
+		return filter.IsNotDefined, nil
+	} else if filter.IsNotDefined {
 		return false, nil
 	}
-	event := ical.Event{comp}
-
-	eventStart, err := event.DateTimeStart(start.Location())
-	if err != nil {
-		return false, err
-	}
-	eventEnd, err := event.DateTimeEnd(end.Location())
-	if err != nil {
-		return false, err
-	}
-
-	// Event starts in time range
-	if eventStart.After(start) && (end.IsZero() || eventStart.Before(end)) {
-		return true, nil
-	}
-	// Event ends in time range
-	if eventEnd.After(start) && (end.IsZero() || eventEnd.Before(end)) {
+	if filter.TextMatch == nil {
 		return true, nil
 	}
-	// Event covers entire time range plus some
-	if eventStart.Before(start) && (!end.IsZero() && eventEnd.After(end)) {
-		return true, nil
-	}
-	return false, nil
-}
 
-func matchPropTimeRange(start, end time.Time, field *ical.Prop) (bool, error) {
-	// See https://datatracker.ietf.org/doc/html/rfc4791#section-9.9
-
-	ptime, err := field.DateTime(start.Location())
-	if err != nil {
-		return false, err
-	}
-	if ptime.After(start) && (end.IsZero() || ptime.Before(end)) {
-		return true, nil
+	// The filter matches if any value of the parameter matches
+	for _, value := range values {
+		match, err := matchTextMatch(*filter.TextMatch, value)
+		if err != nil || match {
+			return match, err
+		}
 	}
 	return false, nil
 }
 
-func matchParamFilter(filter ParamFilter, field *ical.Prop) bool {
-	// TODO there can be multiple values
-	value := field.Params.Get(filter.Name)
-	if value == "" {
-		return filter.IsNotDefined
-	} else if filter.IsNotDefined {
-		return false
+func matchTextMatch(txt TextMatch, value string) (bool, error) {
+	collation := txt.Collation
+	if collation == "" {
+		collation = internal.CollationASCIICasemap
 	}
-	if filter.TextMatch != nil {
-		return matchTextMatch(*filter.TextMatch, value)
+	text, ok := internal.FoldCollation(collation, txt.Text)
+	if !ok {
+		return false, fmt.Errorf("caldav: unsupported collation %q", collation)
 	}
-	return true
-}
+	value, _ = internal.FoldCollation(collation, value)
 
-func matchTextMatch(txt TextMatch, value string) bool {
-	// TODO: handle text-match collation attribute
-	match := strings.Contains(value, txt.Text)
+	match := strings.Contains(value, text)
 	if txt.NegateCondition {
 		match = !match
 	}
-	return match
+	return match, nil
 }
@@ -160,6 +160,114 @@ ACTION:AUDIO
 TRIGGER;RELATED=START:-PT10M
 END:VALARM
 END:VTODO
+END:VCALENDAR`)
+
+	todo2 := newCO(`BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VTODO
+DTSTAMP:20060205T235335Z
+DTSTART:20060106T100000Z
+DUE:20060108T100000Z
+SUMMARY:Task #2
+UID:E10BA47467C5C69BB74E8720@example.com
+END:VTODO
+END:VCALENDAR`)
+
+	todo3 := newCO(`BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VTODO
+DTSTAMP:20060205T235335Z
+CREATED:20060101T100000Z
+COMPLETED:20060103T100000Z
+STATUS:COMPLETED
+SUMMARY:Task #3
+UID:E10BA47467C5C69BB74E8725@example.com
+END:VTODO
+END:VCALENDAR`)
+
+	todo4 := newCO(`BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VTODO
+DTSTAMP:20060205T235335Z
+SUMMARY:Task #4
+UID:E10BA47467C5C69BB74E8727@example.com
+END:VTODO
+END:VCALENDAR`)
+
+	journal1 := newCO(`BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VJOURNAL
+DTSTAMP:20060205T235335Z
+DTSTART;VALUE=DATE:20060105
+SUMMARY:Journal #1
+UID:0F6C1E79D44F5B6C1B4CA1D3@example.com
+END:VJOURNAL
+END:VCALENDAR`)
+
+	freebusy1 := newCO(`BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VFREEBUSY
+DTSTAMP:20060205T235335Z
+FREEBUSY:20060107T100000Z/PT1H
+UID:4A4E6E3E5A8E6DE1B8F7E4F2@example.com
+END:VFREEBUSY
+END:VCALENDAR`)
+
+	event4 := newCO(`BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VEVENT
+DTSTAMP:20060206T001121Z
+DTSTART:20060110T100000Z
+DURATION:PT1H
+RRULE:FREQ=WEEKLY
+SUMMARY:Event #4
+UID:A3E9A0B1E23B4F5A8C1B0D2E@example.com
+BEGIN:VALARM
+ACTION:DISPLAY
+DESCRIPTION:Follow-up
+TRIGGER;RELATED=END:PT5M
+REPEAT:2
+DURATION:PT5M
+END:VALARM
+END:VEVENT
+END:VCALENDAR`)
+
+	event5 := newCO(`BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VEVENT
+DTSTAMP:20060206T001121Z
+DTSTART:20060111T090000
+DURATION:PT1H
+SUMMARY:Floating event
+UID:B52E9A2C7F4D4E1A9C3B8D6F@example.com
+END:VEVENT
+BEGIN:VEVENT
+DTSTAMP:20060206T001121Z
+DTSTART;VALUE=DATE:20060112
+SUMMARY:All-day event
+UID:C63FAB3D8A5E4F2BAD4C9E7A@example.com
+END:VEVENT
+END:VCALENDAR`)
+
+	event6 := newCO(`BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VEVENT
+UID:meeting@example.com
+DTSTAMP:20060206T001102Z
+DTSTART:20060115T100000Z
+DURATION:PT1H
+SUMMARY:Meeting
+ATTENDEE;PARTSTAT=ACCEPTED:mailto:alice@example.com
+ATTENDEE;PARTSTAT=NEEDS-ACTION;DELEGATED-FROM="mailto:carol@example.com","mailto:dave@example.com":mailto:bob@example.com
+END:VEVENT
 END:VCALENDAR`)
 
 	for _, tc := range []struct {
@@ -288,6 +396,233 @@ END:VCALENDAR`)
 			addrs: []CalendarObject{event1, event2, event3, todo1},
 			want:  []CalendarObject{event2},
 		},
+		{
+			// https://datatracker.ietf.org/doc/html/rfc4791#section-7.8.9
+			name: "todos in time range",
+			query: &CalendarQuery{
+				CompFilter: CompFilter{
+					Name: "VCALENDAR",
+					Comps: []CompFilter{{
+						Name:  "VTODO",
+						Start: toDate(t, "20060103T000000Z"),
+						End:   toDate(t, "20060104T000000Z"),
+					}},
+				},
+			},
+			addrs: []CalendarObject{event1, todo1, todo2, todo3, todo4},
+			want:  []CalendarObject{todo1, todo3, todo4},
+		},
+		{
+			name: "todos in open time range (no end date)",
+			query: &CalendarQuery{
+				CompFilter: CompFilter{
+					Name: "VCALENDAR",
+					Comps: []CompFilter{{
+						Name:  "VTODO",
+						Start: toDate(t, "20060107T000000Z"),
+					}},
+				},
+			},
+			addrs: []CalendarObject{event1, todo1, todo2, todo3, todo4},
+			want:  []CalendarObject{todo2, todo4},
+		},
+		{
+			name: "todos in open time range (no start date)",
+			query: &CalendarQuery{
+				CompFilter: CompFilter{
+					Name: "VCALENDAR",
+					Comps: []CompFilter{{
+						Name: "VTODO",
+						End:  toDate(t, "20060102T000000Z"),
+					}},
+				},
+			},
+			addrs: []CalendarObject{event1, todo1, todo2, todo3, todo4},
+			want:  []CalendarObject{todo3, todo4},
+		},
+		{
+			name: "all-day journals in time range",
+			query: &CalendarQuery{
+				CompFilter: CompFilter{
+					Name: "VCALENDAR",
+					Comps: []CompFilter{{
+						Name:  "VJOURNAL",
+						Start: toDate(t, "20060105T120000Z"),
+						End:   toDate(t, "20060106T000000Z"),
+					}},
+				},
+			},
+			addrs: []CalendarObject{event1, todo1, journal1},
+			want:  []CalendarObject{journal1},
+		},
+		{
+			name: "free-busy in time range",
+			query: &CalendarQuery{
+				CompFilter: CompFilter{
+					Name: "VCALENDAR",
+					Comps: []CompFilter{{
+						Name:  "VFREEBUSY",
+						Start: toDate(t, "20060107T103000Z"),
+						End:   toDate(t, "20060107T110000Z"),
+					}},
+				},
+			},
+			addrs: []CalendarObject{event1, freebusy1},
+			want:  []CalendarObject{freebusy1},
+		},
+		{
+			name: "free-busy outside of time range",
+			query: &CalendarQuery{
+				CompFilter: CompFilter{
+					Name: "VCALENDAR",
+					Comps: []CompFilter{{
+						Name:  "VFREEBUSY",
+						Start: toDate(t, "20060107T110000Z"),
+						End:   toDate(t, "20060107T120000Z"),
+					}},
+				},
+			},
+			addrs: []CalendarObject{event1, freebusy1},
+			want:  nil,
+		},
+		{
+			// https://datatracker.ietf.org/doc/html/rfc4791#section-7.8.5
+			name: "repeated alarms of recurring events in time range",
+			query: &CalendarQuery{
+				CompFilter: CompFilter{
+					Name: "VCALENDAR",
+					Comps: []CompFilter{{
+						Name: "VEVENT",
+						Comps: []CompFilter{{
+							Name:  "VALARM",
+							Start: toDate(t, "20060117T111000Z"),
+							End:   toDate(t, "20060117T111100Z"),
+						}},
+					}},
+				},
+			},
+			addrs: []CalendarObject{event1, event4},
+			want:  []CalendarObject{event4},
+		},
+		{
+			name: "alarms outside of time range",
+			query: &CalendarQuery{
+				CompFilter: CompFilter{
+					Name: "VCALENDAR",
+					Comps: []CompFilter{{
+						Name: "VEVENT",
+						Comps: []CompFilter{{
+							Name:  "VALARM",
+							Start: toDate(t, "20060117T111600Z"),
+							End:   toDate(t, "20060117T120000Z"),
+						}},
+					}},
+				},
+			},
+			addrs: []CalendarObject{event1, event4},
+			want:  nil,
+		},
+		{
+			name: "floating events in time range",
+			query: &CalendarQuery{
+				CompFilter: CompFilter{
+					Name: "VCALENDAR",
+					Comps: []CompFilter{{
+						Name:  "VEVENT",
+						Start: toDate(t, "20060111T093000Z"),
+						End:   toDate(t, "20060111T100000Z"),
+					}},
+				},
+			},
+			addrs: []CalendarObject{event1, event5},
+			want:  []CalendarObject{event5},
+		},
+		{
+			name: "all-day events in time range",
+			query: &CalendarQuery{
+				CompFilter: CompFilter{
+					Name: "VCALENDAR",
+					Comps: []CompFilter{{
+						Name:  "VEVENT",
+						Start: toDate(t, "20060112T230000Z"),
+						End:   toDate(t, "20060113T000000Z"),
+					}},
+				},
+			},
+			addrs: []CalendarObject{event1, event5},
+			want:  []CalendarObject{event5},
+		},
+		{
+			name: "events by second attendee",
+			query: &CalendarQuery{
+				CompFilter: CompFilter{
+					Name: "VCALENDAR",
+					Comps: []CompFilter{{
+						Name: "VEVENT",
+						Props: []PropFilter{{
+							Name:      "ATTENDEE",
+							TextMatch: &TextMatch{Text: "mailto:bob@example.com"},
+						}},
+					}},
+				},
+			},
+			addrs: []CalendarObject{event1, event6},
+			want:  []CalendarObject{event6},
+		},
+		{
+			name: "events by attendee parameter",
+			query: &CalendarQuery{
+				CompFilter: CompFilter{
+					Name: "VCALENDAR",
+					Comps: []CompFilter{{
+						Name: "VEVENT",
+						Props: []PropFilter{{
+							Name: "ATTENDEE",
+							ParamFilter: []ParamFilter{{
+								Name:      "PARTSTAT",
+								TextMatch: &TextMatch{Text: "NEEDS-ACTION"},
+							}},
+						}},
+					}},
+				},
+			},
+			addrs: []CalendarObject{event1, event6},
+			want:  []CalendarObject{event6},
+		},
+		{
+			name: "events by second parameter value",
+			query: &CalendarQuery{
+				CompFilter: CompFilter{
+					Name: "VCALENDAR",
+					Comps: []CompFilter{{
+						Name: "VEVENT",
+						Props: []PropFilter{{
+							Name: "ATTENDEE",
+							ParamFilter: []ParamFilter{{
+								Name:      "DELEGATED-FROM",
+								TextMatch: &TextMatch{Text: "dave@example.com"},
+							}},
+						}},
+					}},
+				},
+			},
+			addrs: []CalendarObject{event1, event6},
+			want:  []CalendarObject{event6},
+		},
+		{
+			name: "events with undefined property",
+			query: &CalendarQuery{
+				CompFilter: CompFilter{
+					Name: "VCALENDAR",
+					Comps: []CompFilter{{
+						Name:  "VEVENT",
+						Props: []PropFilter{{Name: "ATTENDEE", IsNotDefined: true}},
+					}},
+				},
+			},
+			addrs: []CalendarObject{event1, event6},
+			want:  []CalendarObject{event1},
+		},
 		// TODO add more examples
 	} {
 		t.Run(tc.name, func(t *testing.T) {
@@ -309,3 +644,113 @@ END:VCALENDAR`)
 		})
 	}
 }
+
+func TestFilter_timezone(t *testing.T) {
+	cal, err := ical.NewDecoder(strings.NewReader(`BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VEVENT
+UID:daily@example.com
+DTSTAMP:20060206T001102Z
+DTSTART:20060102T100000
+DURATION:PT1H
+RRULE:FREQ=DAILY;COUNT=3
+BEGIN:VALARM
+ACTION:DISPLAY
+TRIGGER:-PT15M
+DESCRIPTION:Reminder
+END:VALARM
+END:VEVENT
+BEGIN:VEVENT
+UID:daily@example.com
+DTSTAMP:20060206T001102Z
+RECURRENCE-ID:20060103T100000
+DTSTART:20060103T140000
+DURATION:PT1H
+END:VEVENT
+END:VCALENDAR`)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	co := CalendarObject{Data: cal}
+	eastern := time.FixedZone("EST", -5*60*60)
+
+	event := func(start, end string) CompFilter {
+		return CompFilter{Name: "VEVENT", Start: toDate(t, start), End: toDate(t, end)}
+	}
+	alarm := func(start, end string) CompFilter {
+		return CompFilter{Name: "VEVENT", Comps: []CompFilter{{Name: "VALARM", Start: toDate(t, start), End: toDate(t, end)}}}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		filter CompFilter
+		loc    *time.Location
+		want   bool
+	}{
+		{
+			name:   "floating event in UTC",
+			filter: event("20060102T100000Z", "20060102T110000Z"),
+			want:   true,
+		},
+		{
+			name:   "floating event in calendar time zone",
+			filter: event("20060102T100000Z", "20060102T110000Z"),
+			loc:    eastern,
+			want:   false,
+		},
+		{
+			name:   "floating event shifted to calendar time zone",
+			filter: event("20060102T150000Z", "20060102T160000Z"),
+			loc:    eastern,
+			want:   true,
+		},
+		{
+			name:   "alarm of master instance",
+			filter: alarm("20060104T144000Z", "20060104T145000Z"),
+			loc:    eastern,
+			want:   true,
+		},
+		{
+			name:   "alarm of overridden instance",
+			filter: alarm("20060103T144000Z", "20060103T145000Z"),
+			loc:    eastern,
+			want:   false,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			query := &CalendarQuery{
+				CompFilter: CompFilter{Name: "VCALENDAR", Comps: []CompFilter{tc.filter}},
+				Timezone:   tc.loc,
+			}
+			got, err := Filter(query, []CalendarObject{co})
+			if err != nil {
+				t.Fatalf("Filter() = %v", err)
+			}
+			if (len(got) > 0) != tc.want {
+				t.Errorf("Filter() = %v results, want match = %v", len(got), tc.want)
+			}
+		})
+	}
+}
+
+func TestParseTimezone(t *testing.T) {
+	loc, err := parseTimezone(`BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VTIMEZONE
+TZID:Example/Unknown
+BEGIN:STANDARD
+DTSTART:19671029T020000
+TZOFFSETFROM:-0400
+TZOFFSETTO:-0500
+END:STANDARD
+END:VTIMEZONE
+END:VCALENDAR`)
+	if err != nil {
+		t.Fatalf("parseTimezone() = %v", err)
+	}
+	if _, offset := time.Date(2006, 1, 2, 0, 0, 0, 0, loc).Zone(); offset != -5*60*60 {
+		t.Errorf("parseTimezone() offset = %v, want %v", offset, -5*60*60)
+	}
+}
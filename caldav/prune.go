@@ -0,0 +1,74 @@
+package caldav
+
+import (
+	"strings"
+
+	"github.com/emersion/go-ical"
+)
+
+// requiredProps lists the properties which can't be pruned from a component,
+// because the result would be invalid without them.
+var requiredProps = map[string][]string{
+	ical.CompCalendar:         {ical.PropVersion, ical.PropProductID},
+	ical.CompEvent:            {ical.PropUID, ical.PropDateTimeStamp},
+	ical.CompToDo:             {ical.PropUID, ical.PropDateTimeStamp},
+	ical.CompJournal:          {ical.PropUID, ical.PropDateTimeStamp},
+	ical.CompFreeBusy:         {ical.PropUID, ical.PropDateTimeStamp},
+	ical.CompTimezone:         {ical.PropTimezoneID},
+	ical.CompTimezoneStandard: {ical.PropDateTimeStart, ical.PropTimezoneOffsetFrom, ical.PropTimezoneOffsetTo},
+	ical.CompTimezoneDaylight: {ical.PropDateTimeStart, ical.PropTimezoneOffsetFrom, ical.PropTimezoneOffsetTo},
+}
+
+// PruneCalendarObject returns a copy of a calendar object with only the
+// components and properties selected by req, as described in RFC 4791
+// section 9.6.1.
+//
+// A request which doesn't list any property selects all properties, and a
+// request which doesn't list any component selects all components. Properties
+// required for the calendar data to be valid, such as UID and DTSTAMP, are
+// always kept.
+func PruneCalendarObject(req *CalendarCompRequest, co *CalendarObject) *CalendarObject {
+	if co.Data == nil || co.Data.Component == nil {
+		return co
+	}
+
+	pruned := *co
+	pruned.Data = &ical.Calendar{pruneComponent(co.Data.Component, req)}
+	return &pruned
+}
+
+func pruneComponent(comp *ical.Component, req *CalendarCompRequest) *ical.Component {
+	pruned := &ical.Component{Name: comp.Name}
+
+	if req.AllProps || len(req.Props) == 0 {
+		pruned.Props = comp.Props
+	} else {
+		pruned.Props = make(ical.Props)
+		for _, name := range requiredProps[comp.Name] {
+			if props, ok := comp.Props[name]; ok {
+				pruned.Props[name] = props
+			}
+		}
+		for _, name := range req.Props {
+			name = strings.ToUpper(name)
+			if props, ok := comp.Props[name]; ok {
+				pruned.Props[name] = props
+			}
+		}
+	}
+
+	if req.AllComps || len(req.Comps) == 0 {
+		pruned.Children = comp.Children
+	} else {
+		for _, child := range comp.Children {
+			for i := range req.Comps {
+				if strings.EqualFold(req.Comps[i].Name, child.Name) {
+					pruned.Children = append(pruned.Children, pruneComponent(child, &req.Comps[i]))
+					break
+				}
+			}
+		}
+	}
+
+	return pruned
+}
@@ -0,0 +1,131 @@
+package caldav
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-ical"
+)
+
+const pruneTestData = `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+CALSCALE:GREGORIAN
+BEGIN:VEVENT
+UID:event@example.com
+DTSTAMP:20060206T001102Z
+DTSTART:20060102T100000Z
+DURATION:PT1H
+SUMMARY:Meeting
+DESCRIPTION:A long description
+BEGIN:VALARM
+ACTION:DISPLAY
+TRIGGER:-PT15M
+DESCRIPTION:Reminder
+END:VALARM
+END:VEVENT
+BEGIN:VTODO
+UID:todo@example.com
+DTSTAMP:20060206T001102Z
+SUMMARY:Task
+END:VTODO
+END:VCALENDAR`
+
+var pruneTestRequest = CalendarCompRequest{
+	Name:  ical.CompCalendar,
+	Props: []string{"VERSION"},
+	Comps: []CalendarCompRequest{{
+		Name:  ical.CompEvent,
+		Props: []string{"dtstart", "SUMMARY"},
+		Comps: []CalendarCompRequest{{Name: ical.CompAlarm, Props: []string{"ACTION"}}},
+	}},
+}
+
+func checkPrunedCalendar(t *testing.T, cal *ical.Calendar) {
+	if cal.Props.Get(ical.PropCalendarScale) != nil {
+		t.Errorf("CALSCALE wasn't pruned")
+	}
+	if cal.Props.Get(ical.PropProductID) == nil {
+		t.Errorf("PRODID was pruned")
+	}
+	if len(cal.Children) != 1 || cal.Children[0].Name != ical.CompEvent {
+		t.Fatalf("got %v components, want a single VEVENT", len(cal.Children))
+	}
+
+	event := cal.Children[0]
+	for _, name := range []string{ical.PropUID, ical.PropDateTimeStamp, ical.PropDateTimeStart, ical.PropSummary} {
+		if event.Props.Get(name) == nil {
+			t.Errorf("VEVENT %v was pruned", name)
+		}
+	}
+	for _, name := range []string{ical.PropDuration, ical.PropDescription} {
+		if event.Props.Get(name) != nil {
+			t.Errorf("VEVENT %v wasn't pruned", name)
+		}
+	}
+
+	if len(event.Children) != 1 {
+		t.Fatalf("got %v VEVENT components, want a single VALARM", len(event.Children))
+	}
+	alarm := event.Children[0]
+	if alarm.Props.Get(ical.PropAction) == nil || alarm.Props.Get(ical.PropTrigger) != nil {
+		t.Errorf("VALARM properties weren't pruned")
+	}
+}
+
+func TestPruneCalendarObject(t *testing.T) {
+	cal, err := ical.NewDecoder(strings.NewReader(pruneTestData)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	co := PruneCalendarObject(&pruneTestRequest, &CalendarObject{Data: cal})
+	checkPrunedCalendar(t, co.Data)
+
+	if cal.Props.Get(ical.PropCalendarScale) == nil || len(cal.Children) != 2 {
+		t.Errorf("PruneCalendarObject() modified the original calendar")
+	}
+
+	all := CalendarCompRequest{Name: ical.CompCalendar, AllProps: true, AllComps: true}
+	co = PruneCalendarObject(&all, &CalendarObject{Data: cal})
+	if len(co.Data.Children) != 2 || len(co.Data.Props) != len(cal.Props) {
+		t.Errorf("PruneCalendarObject() pruned data with allprop and allcomp")
+	}
+}
+
+func TestClient_MultiGetCalendar_prune(t *testing.T) {
+	cal, err := ical.NewDecoder(strings.NewReader(pruneTestData)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calendar := Calendar{Path: "/user/calendars/a"}
+	handler := Handler{Backend: testBackend{
+		calendars: []Calendar{calendar},
+		objectMap: map[string][]CalendarObject{
+			calendar.Path: {{Path: "/user/calendars/a/event.ics", Data: cal}},
+		},
+	}}
+	ts := httptest.NewServer(&handler)
+	defer ts.Close()
+
+	client, err := NewClient(nil, ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	multiGet := CalendarMultiGet{
+		Paths:       []string{"/user/calendars/a/event.ics"},
+		CompRequest: pruneTestRequest,
+	}
+	cos, err := client.MultiGetCalendar(context.Background(), calendar.Path, &multiGet)
+	if err != nil {
+		t.Fatalf("MultiGetCalendar() = %v", err)
+	}
+	if len(cos) != 1 {
+		t.Fatalf("MultiGetCalendar() returned %v calendar objects, want 1", len(cos))
+	}
+	checkPrunedCalendar(t, cos[0].Data)
+}
@@ -0,0 +1,749 @@
+package caldav
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/emersion/go-webdav/internal"
+)
+
+// ScheduleBackend is an optional interface which can be implemented by a
+// Backend to support scheduling, as defined in RFC 6638. Handler.Deliverer
+// must be set as well.
+//
+// When scheduling is enabled, the Handler performs implicit scheduling:
+// storing or removing a calendar object sends iTIP messages to the attendees
+// or to the organizer, once the change has succeeded. The results of the
+// deliveries are then recorded with a conditional PutCalendarObject call.
+type ScheduleBackend interface {
+	// CalendarUserAddressSet returns the calendar user addresses of the
+	// current user, for instance "mailto:alice@example.org".
+	CalendarUserAddressSet(ctx context.Context) ([]string, error)
+	// ScheduleInboxPath returns the path of the schedule inbox of the
+	// current user. It must be a member of the calendar home set. Messages in
+	// the inbox are accessed with GetCalendarObject, ListCalendarObjects and
+	// DeleteCalendarObject.
+	ScheduleInboxPath(ctx context.Context) (string, error)
+	// ScheduleOutboxPath returns the path of the schedule outbox of the
+	// current user. It must be a member of the calendar home set.
+	ScheduleOutboxPath(ctx context.Context) (string, error)
+}
+
+// ScheduleDeliverer delivers scheduling messages to calendar users.
+type ScheduleDeliverer interface {
+	// DeliverScheduleMessage delivers an iTIP message, as defined in RFC
+	// 5546, to a recipient identified by its calendar user address. The
+	// METHOD of the message is REQUEST, REPLY or CANCEL.
+	//
+	// Local deliveries typically store the message in the schedule inbox of
+	// the recipient, and update the copy of the recipient with
+	// ApplyScheduleMessage.
+	//
+	// ErrInvalidCalendarUser is returned if the recipient is unknown.
+	DeliverScheduleMessage(ctx context.Context, recipient string, msg *ical.Calendar) error
+	// RecipientFreeBusy returns the busy periods of a recipient, for free-busy
+	// requests sent to the schedule outbox.
+	//
+	// ErrInvalidCalendarUser is returned if the recipient is unknown.
+	RecipientFreeBusy(ctx context.Context, recipient string, query *FreeBusyQuery) (*FreeBusy, error)
+}
+
+// ErrInvalidCalendarUser is returned by a ScheduleDeliverer when a recipient
+// is unknown.
+var ErrInvalidCalendarUser = errors.New("caldav: invalid calendar user")
+
+const (
+	paramScheduleAgent     = "SCHEDULE-AGENT"
+	paramScheduleStatus    = "SCHEDULE-STATUS"
+	paramScheduleForceSend = "SCHEDULE-FORCE-SEND"
+)
+
+const (
+	scheduleMethodRequest = "REQUEST"
+	scheduleMethodReply   = "REPLY"
+	scheduleMethodCancel  = "CANCEL"
+)
+
+// scheduleStatusPending is the SCHEDULE-STATUS value of messages which
+// haven't been delivered yet, as defined in RFC 6638 section 3.2.9.
+const scheduleStatusPending = "1.0"
+
+// scheduleStatus returns the SCHEDULE-STATUS value describing the result of a
+// delivery, as defined in RFC 6638 section 3.2.9.
+func scheduleStatus(err error) string {
+	switch {
+	case err == nil:
+		return "1.2" // delivered
+	case errors.Is(err, ErrInvalidCalendarUser):
+		return "3.7" // invalid calendar user
+	default:
+		return "5.1" // could not complete delivery
+	}
+}
+
+// scheduleRequestStatus returns the CALDAV:request-status value describing
+// the result of a request sent to the schedule outbox.
+func scheduleRequestStatus(err error) string {
+	switch {
+	case err == nil:
+		return "2.0;Success"
+	case errors.Is(err, ErrInvalidCalendarUser):
+		return "3.7;Invalid calendar user"
+	default:
+		return "5.1;Could not complete delivery"
+	}
+}
+
+func sameCalendarUser(a, b string) bool {
+	return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+}
+
+func containsCalendarUser(l []string, addr string) bool {
+	for _, v := range l {
+		if sameCalendarUser(v, addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSchedulingComponent returns true if comp is a component which can be
+// scheduled, i.e. a VEVENT, VTODO or VJOURNAL with an organizer.
+func isSchedulingComponent(comp *ical.Component) bool {
+	switch comp.Name {
+	case ical.CompEvent, ical.CompToDo, ical.CompJournal:
+		return comp.Props.Get(ical.PropOrganizer) != nil
+	default:
+		return false
+	}
+}
+
+// isServerScheduled returns true if the server is responsible for scheduling
+// a calendar user, as indicated by the SCHEDULE-AGENT parameter.
+func isServerScheduled(prop *ical.Prop) bool {
+	agent := prop.Params.Get(paramScheduleAgent)
+	return agent == "" || strings.EqualFold(agent, "SERVER")
+}
+
+// calendarOrganizer returns the ORGANIZER property of a scheduling object, if
+// any.
+func calendarOrganizer(cal *ical.Calendar) *ical.Prop {
+	for _, child := range cal.Children {
+		if isSchedulingComponent(child) {
+			return child.Props.Get(ical.PropOrganizer)
+		}
+	}
+	return nil
+}
+
+// scheduledAttendees returns the attendees of a scheduling object the server
+// needs to send messages to.
+func scheduledAttendees(cal *ical.Calendar, organizer string) []string {
+	var l []string
+	for _, child := range cal.Children {
+		if !isSchedulingComponent(child) {
+			continue
+		}
+		for _, prop := range child.Props.Values(ical.PropAttendee) {
+			if !isServerScheduled(&prop) || sameCalendarUser(prop.Value, organizer) || containsCalendarUser(l, prop.Value) {
+				continue
+			}
+			l = append(l, prop.Value)
+		}
+	}
+	return l
+}
+
+// attendeePartStats returns the participation status of an attendee in each
+// instance of a scheduling object, indexed by RECURRENCE-ID.
+func attendeePartStats(cal *ical.Calendar, attendee string) map[string]string {
+	m := make(map[string]string)
+	for _, child := range cal.Children {
+		if !isSchedulingComponent(child) {
+			continue
+		}
+		var recurrenceID string
+		if prop := child.Props.Get(ical.PropRecurrenceID); prop != nil {
+			recurrenceID = prop.Value
+		}
+		for _, prop := range child.Props.Values(ical.PropAttendee) {
+			if !sameCalendarUser(prop.Value, attendee) {
+				continue
+			}
+			partStat := strings.ToUpper(prop.Params.Get(ical.ParamParticipationStatus))
+			if partStat == "" {
+				partStat = "NEEDS-ACTION"
+			}
+			m[recurrenceID] = partStat
+		}
+	}
+	return m
+}
+
+// setCalendarUserParam sets a parameter on the ORGANIZER or ATTENDEE
+// properties matching a calendar user.
+func setCalendarUserParam(cal *ical.Calendar, propName, addr, param, value string) {
+	for _, child := range cal.Children {
+		if !isSchedulingComponent(child) {
+			continue
+		}
+		props := child.Props[propName]
+		for i := range props {
+			if !sameCalendarUser(props[i].Value, addr) {
+				continue
+			}
+			if props[i].Params == nil {
+				props[i].Params = make(ical.Params)
+			}
+			props[i].Params.Set(param, value)
+		}
+	}
+}
+
+func cloneComponent(comp *ical.Component) *ical.Component {
+	clone := ical.NewComponent(comp.Name)
+	for name, props := range comp.Props {
+		for _, prop := range props {
+			params := make(ical.Params, len(prop.Params))
+			for k, v := range prop.Params {
+				params[k] = append([]string(nil), v...)
+			}
+			prop.Params = params
+			clone.Props[name] = append(clone.Props[name], prop)
+		}
+	}
+	for _, child := range comp.Children {
+		clone.Children = append(clone.Children, cloneComponent(child))
+	}
+	return clone
+}
+
+// newScheduleMessage builds an iTIP message from a scheduling object. For
+// REPLY and CANCEL messages, only the provided attendee is kept.
+func newScheduleMessage(method string, cal *ical.Calendar, attendee string) *ical.Calendar {
+	msg := ical.NewCalendar()
+	msg.Props.SetText(ical.PropVersion, "2.0")
+	if prodID, err := cal.Props.Text(ical.PropProductID); err == nil && prodID != "" {
+		msg.Props.SetText(ical.PropProductID, prodID)
+	} else {
+		msg.Props.SetText(ical.PropProductID, productID)
+	}
+	msg.Props.SetText(ical.PropMethod, method)
+
+	now := time.Now().UTC()
+	for _, child := range cal.Children {
+		if child.Name == ical.CompTimezone {
+			msg.Children = append(msg.Children, cloneComponent(child))
+			continue
+		} else if !isSchedulingComponent(child) {
+			continue
+		}
+
+		comp := cloneComponent(child)
+		// Alarms are specific to each calendar user
+		comp.Children = nil
+		comp.Props.SetDateTime(ical.PropDateTimeStamp, now)
+
+		// Scheduling parameters must not be sent to other calendar users,
+		// see RFC 6638 section 3.2
+		for _, name := range []string{ical.PropOrganizer, ical.PropAttendee} {
+			props := comp.Props[name]
+			for i := range props {
+				props[i].Params.Del(paramScheduleAgent)
+				props[i].Params.Del(paramScheduleStatus)
+				props[i].Params.Del(paramScheduleForceSend)
+			}
+		}
+
+		if method != scheduleMethodRequest {
+			var attendees []ical.Prop
+			for _, prop := range comp.Props[ical.PropAttendee] {
+				if sameCalendarUser(prop.Value, attendee) {
+					attendees = append(attendees, prop)
+				}
+			}
+			comp.Props[ical.PropAttendee] = attendees
+		}
+		if method == scheduleMethodCancel {
+			comp.Props.SetText(ical.PropStatus, string(ical.EventCancelled))
+		}
+
+		msg.Children = append(msg.Children, comp)
+	}
+
+	return msg
+}
+
+// ApplyScheduleMessage applies an iTIP message, as defined in RFC 5546, to the
+// copy of a calendar object owned by the recipient, and returns the updated
+// copy. It can be used by ScheduleDeliverer implementations delivering
+// messages to local calendar users.
+//
+// REQUEST messages replace the calendar object, which may be nil for new
+// invitations. REPLY messages update the participation status of the
+// attendee in the copy of the organizer. CANCEL messages mark the cancelled
+// components as such.
+func ApplyScheduleMessage(cal, msg *ical.Calendar) (*ical.Calendar, error) {
+	method, err := msg.Props.Text(ical.PropMethod)
+	if err != nil {
+		return nil, err
+	}
+	method = strings.ToUpper(method)
+
+	switch method {
+	case scheduleMethodRequest:
+		updated := cloneComponent(msg.Component)
+		updated.Props.Del(ical.PropMethod)
+		return &ical.Calendar{updated}, nil
+	case scheduleMethodReply, scheduleMethodCancel:
+		// handled below
+	default:
+		return nil, fmt.Errorf("caldav: unsupported iTIP method %q", method)
+	}
+
+	if cal == nil {
+		return nil, fmt.Errorf("caldav: cannot apply iTIP %v message to a missing calendar object", method)
+	}
+
+	updated := &ical.Calendar{cloneComponent(cal.Component)}
+	for _, msgComp := range msg.Children {
+		if !isSchedulingComponent(msgComp) {
+			continue
+		}
+		uid, err := msgComp.Props.Text(ical.PropUID)
+		if err != nil {
+			return nil, err
+		}
+		recurrenceID := msgComp.Props.Get(ical.PropRecurrenceID)
+
+		for _, comp := range updated.Children {
+			if comp.Name != msgComp.Name {
+				continue
+			}
+			if compUID, err := comp.Props.Text(ical.PropUID); err != nil || compUID != uid {
+				continue
+			}
+			// Messages without a RECURRENCE-ID apply to the master
+			// component, or to all instances for cancellations
+			compRecurrenceID := comp.Props.Get(ical.PropRecurrenceID)
+			if recurrenceID != nil {
+				if compRecurrenceID == nil || !sameRecurrenceID(compRecurrenceID, recurrenceID) {
+					continue
+				}
+			} else if compRecurrenceID != nil && method != scheduleMethodCancel {
+				continue
+			}
+
+			switch method {
+			case scheduleMethodReply:
+				for _, reply := range msgComp.Props.Values(ical.PropAttendee) {
+					partStat := reply.Params.Get(ical.ParamParticipationStatus)
+					if partStat != "" {
+						setComponentAttendeeParam(comp, reply.Value, ical.ParamParticipationStatus, partStat)
+					}
+				}
+			case scheduleMethodCancel:
+				comp.Props.SetText(ical.PropStatus, string(ical.EventCancelled))
+			}
+		}
+	}
+
+	return updated, nil
+}
+
+func setComponentAttendeeParam(comp *ical.Component, addr, param, value string) {
+	props := comp.Props[ical.PropAttendee]
+	for i := range props {
+		if sameCalendarUser(props[i].Value, addr) {
+			if props[i].Params == nil {
+				props[i].Params = make(ical.Params)
+			}
+			props[i].Params.Set(param, value)
+		}
+	}
+}
+
+func sameRecurrenceID(a, b *ical.Prop) bool {
+	ta, errA := a.DateTime(time.UTC)
+	tb, errB := b.DateTime(time.UTC)
+	if errA != nil || errB != nil {
+		return a.Value == b.Value
+	}
+	return ta.Equal(tb)
+}
+
+// scheduleBackend returns the ScheduleBackend if scheduling is enabled.
+func (b *backend) scheduleBackend() (ScheduleBackend, bool) {
+	sb, ok := b.Backend.(ScheduleBackend)
+	return sb, ok && b.Deliverer != nil
+}
+
+// scheduleBoxName returns the resource type of the schedule inbox or outbox
+// at p, if any.
+func (b *backend) scheduleBoxName(ctx context.Context, sb ScheduleBackend, p string) (xml.Name, bool, error) {
+	p = path.Clean(p)
+	inbox, err := sb.ScheduleInboxPath(ctx)
+	if err != nil {
+		return xml.Name{}, false, err
+	} else if path.Clean(inbox) == p {
+		return scheduleInboxName, true, nil
+	}
+	outbox, err := sb.ScheduleOutboxPath(ctx)
+	if err != nil {
+		return xml.Name{}, false, err
+	} else if path.Clean(outbox) == p {
+		return scheduleOutboxName, true, nil
+	}
+	return xml.Name{}, false, nil
+}
+
+func (b *backend) propFindScheduleBox(ctx context.Context, propfind *internal.PropFind, p string, name xml.Name, depth internal.Depth) ([]internal.Response, error) {
+	props := map[xml.Name]internal.PropFindFunc{
+		internal.CurrentUserPrincipalName: func(*internal.RawXMLValue) (interface{}, error) {
+			principalPath, err := b.Backend.CurrentUserPrincipal(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return &internal.CurrentUserPrincipal{Href: internal.Href{Path: principalPath}}, nil
+		},
+		internal.ResourceTypeName: internal.PropFindValue(internal.NewResourceType(internal.CollectionName, name)),
+	}
+	resp, err := internal.NewPropFindResponse(p, propfind, props)
+	if err != nil {
+		return nil, err
+	}
+	resps := []internal.Response{*resp}
+
+	// The outbox is always empty
+	if depth != internal.DepthZero && name == scheduleInboxName {
+		resps_, err := b.propFindAllCalendarObjects(ctx, propfind, &Calendar{Path: p})
+		if err != nil {
+			return nil, err
+		}
+		resps = append(resps, resps_...)
+	}
+	return resps, nil
+}
+
+func (b *backend) scheduleUserPrincipalProps(ctx context.Context, sb ScheduleBackend, props map[xml.Name]internal.PropFindFunc) {
+	props[scheduleInboxURLName] = func(*internal.RawXMLValue) (interface{}, error) {
+		p, err := sb.ScheduleInboxPath(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &scheduleInboxURL{Href: internal.Href{Path: p}}, nil
+	}
+	props[scheduleOutboxURLName] = func(*internal.RawXMLValue) (interface{}, error) {
+		p, err := sb.ScheduleOutboxPath(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &scheduleOutboxURL{Href: internal.Href{Path: p}}, nil
+	}
+	props[calendarUserAddressSetName] = func(*internal.RawXMLValue) (interface{}, error) {
+		addrs, err := sb.CalendarUserAddressSet(ctx)
+		if err != nil {
+			return nil, err
+		}
+		set := calendarUserAddressSet{Hrefs: make([]internal.Href, 0, len(addrs))}
+		for _, addr := range addrs {
+			u, err := url.Parse(addr)
+			if err != nil {
+				return nil, err
+			}
+			set.Hrefs = append(set.Hrefs, internal.Href(*u))
+		}
+		return &set, nil
+	}
+	props[calendarUserTypeName] = internal.PropFindValue(&calendarUserType{Type: "INDIVIDUAL"})
+}
+
+// getScheduleObject returns the stored copy of a calendar object, or nil if
+// it doesn't exist.
+func (b *backend) getScheduleObject(ctx context.Context, p string) (*CalendarObject, error) {
+	dataReq := CalendarCompRequest{Name: ical.CompCalendar, AllProps: true, AllComps: true}
+	co, err := b.Backend.GetCalendarObject(ctx, p, &dataReq)
+	if internal.IsNotFound(err) {
+		return nil, nil
+	}
+	return co, err
+}
+
+// isScheduleBoxMember returns true if p is a member of the schedule inbox or
+// outbox.
+func (b *backend) isScheduleBoxMember(ctx context.Context, sb ScheduleBackend, p string) (bool, error) {
+	_, ok, err := b.scheduleBoxName(ctx, sb, path.Dir(path.Clean(p)))
+	return ok, err
+}
+
+// checkPutConditions checks the If-Match and If-None-Match conditions of a
+// PUT request against the stored copy of a calendar object, so that no
+// message is sent for requests which will fail.
+func checkPutConditions(co *CalendarObject, opts *PutCalendarObjectOptions) error {
+	if opts.IfNoneMatch.IsWildcard() && co != nil {
+		return internal.HTTPErrorf(http.StatusPreconditionFailed, "caldav: calendar object already exists")
+	}
+	if opts.IfMatch.IsSet() {
+		if co == nil {
+			return internal.HTTPErrorf(http.StatusPreconditionFailed, "caldav: calendar object doesn't exist")
+		}
+		if !opts.IfMatch.IsWildcard() && co.ETag != "" {
+			ok, err := opts.IfMatch.MatchETag(co.ETag)
+			if err != nil {
+				return internal.HTTPErrorf(http.StatusBadRequest, "caldav: invalid If-Match header: %v", err)
+			} else if !ok {
+				return internal.HTTPErrorf(http.StatusPreconditionFailed, "caldav: calendar object has been modified")
+			}
+		}
+	}
+	return nil
+}
+
+// scheduleDelivery is a scheduling message waiting to be delivered.
+type scheduleDelivery struct {
+	recipient string
+	msg       *ical.Calendar
+	// propName is the property of the recipient whose SCHEDULE-STATUS
+	// records the result of the delivery, if any
+	propName string
+}
+
+// schedule prepares implicit scheduling when a calendar object is created,
+// modified or removed, as described in RFC 6638 section 3.2. oldCal is nil
+// when the object is created, and newCal is nil when it's removed.
+//
+// Messages are only delivered with deliver once the calendar object has been
+// stored, so that calendar users aren't notified about changes which failed.
+// In the meantime, SCHEDULE-STATUS parameters are set to pending in newCal.
+func (b *backend) schedule(ctx context.Context, sb ScheduleBackend, oldCal, newCal *ical.Calendar) ([]scheduleDelivery, error) {
+	cal := newCal
+	if cal == nil {
+		cal = oldCal
+	}
+	organizer := calendarOrganizer(cal)
+	if organizer == nil {
+		return nil, nil
+	}
+	if oldCal != nil && newCal != nil {
+		if oldOrganizer := calendarOrganizer(oldCal); oldOrganizer != nil && !sameCalendarUser(oldOrganizer.Value, organizer.Value) {
+			return nil, internal.HTTPErrorf(http.StatusForbidden, "caldav: the organizer of a scheduling object can't be changed")
+		}
+	}
+
+	addrs, err := sb.CalendarUserAddressSet(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var deliveries []scheduleDelivery
+	if containsCalendarUser(addrs, organizer.Value) {
+		deliveries = scheduleAsOrganizer(organizer.Value, oldCal, newCal)
+	} else if isServerScheduled(organizer) {
+		for _, addr := range addrs {
+			if len(attendeePartStats(cal, addr)) > 0 {
+				deliveries = scheduleAsAttendee(addr, organizer.Value, oldCal, newCal)
+				break
+			}
+		}
+	}
+
+	for _, d := range deliveries {
+		if d.propName != "" {
+			setCalendarUserParam(newCal, d.propName, d.recipient, paramScheduleStatus, scheduleStatusPending)
+		}
+	}
+	return deliveries, nil
+}
+
+// isScheduled returns true if the scheduling object is modified to record
+// the results of the deliveries.
+func isScheduled(deliveries []scheduleDelivery) bool {
+	for _, d := range deliveries {
+		if d.propName != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// deliver delivers the messages prepared by schedule, and updates the
+// SCHEDULE-STATUS parameters in cal.
+func (b *backend) deliver(ctx context.Context, cal *ical.Calendar, deliveries []scheduleDelivery) {
+	for _, d := range deliveries {
+		err := b.Deliverer.DeliverScheduleMessage(ctx, d.recipient, d.msg)
+		if d.propName != "" {
+			setCalendarUserParam(cal, d.propName, d.recipient, paramScheduleStatus, scheduleStatus(err))
+		}
+	}
+}
+
+func scheduleAsOrganizer(organizer string, oldCal, newCal *ical.Calendar) []scheduleDelivery {
+	var attendees []string
+	if newCal != nil {
+		attendees = scheduledAttendees(newCal, organizer)
+	}
+
+	// Attendees which have been removed are notified of the cancellation.
+	// Failures can't be reported, since they're not part of the calendar
+	// object anymore.
+	var deliveries []scheduleDelivery
+	if oldCal != nil {
+		for _, attendee := range scheduledAttendees(oldCal, organizer) {
+			if !containsCalendarUser(attendees, attendee) {
+				msg := newScheduleMessage(scheduleMethodCancel, oldCal, attendee)
+				deliveries = append(deliveries, scheduleDelivery{recipient: attendee, msg: msg})
+			}
+		}
+	}
+
+	if len(attendees) == 0 {
+		return deliveries
+	}
+	msg := newScheduleMessage(scheduleMethodRequest, newCal, "")
+	for _, attendee := range attendees {
+		deliveries = append(deliveries, scheduleDelivery{recipient: attendee, msg: msg, propName: ical.PropAttendee})
+	}
+	return deliveries
+}
+
+func scheduleAsAttendee(attendee, organizer string, oldCal, newCal *ical.Calendar) []scheduleDelivery {
+	if newCal == nil {
+		// Removing an invitation declines it
+		msg := newScheduleMessage(scheduleMethodReply, oldCal, attendee)
+		for _, comp := range msg.Children {
+			setComponentAttendeeParam(comp, attendee, ical.ParamParticipationStatus, "DECLINED")
+		}
+		return []scheduleDelivery{{recipient: organizer, msg: msg}}
+	}
+
+	var oldPartStats map[string]string
+	if oldCal != nil {
+		oldPartStats = attendeePartStats(oldCal, attendee)
+	}
+	changed := false
+	for recurrenceID, partStat := range attendeePartStats(newCal, attendee) {
+		oldPartStat := oldPartStats[recurrenceID]
+		if oldPartStat == "" {
+			oldPartStat = "NEEDS-ACTION"
+		}
+		if partStat != oldPartStat {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	msg := newScheduleMessage(scheduleMethodReply, newCal, attendee)
+	return []scheduleDelivery{{recipient: organizer, msg: msg, propName: ical.PropOrganizer}}
+}
+
+// handleSchedulePost replies to a free-busy request sent to the schedule
+// outbox, as defined in RFC 6638 section 5.
+func (h *Handler) handleSchedulePost(w http.ResponseWriter, r *http.Request, b *backend) error {
+	ctx := r.Context()
+	sb, ok := b.scheduleBackend()
+	if !ok {
+		return internal.HTTPErrorf(http.StatusMethodNotAllowed, "caldav: scheduling is not supported")
+	}
+	if name, ok, err := b.scheduleBoxName(ctx, sb, r.URL.Path); err != nil {
+		return err
+	} else if !ok || name != scheduleOutboxName {
+		return internal.HTTPErrorf(http.StatusMethodNotAllowed, "caldav: POST requests are only supported on the schedule outbox")
+	}
+
+	t, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return internal.HTTPErrorf(http.StatusBadRequest, "caldav: malformed Content-Type: %v", err)
+	}
+	if t != ical.MIMEType {
+		return internal.HTTPErrorf(http.StatusUnsupportedMediaType, "caldav: unsupported Content-Type %q", t)
+	}
+	req, err := ical.NewDecoder(r.Body).Decode()
+	if err != nil {
+		return internal.HTTPErrorf(http.StatusBadRequest, "caldav: failed to parse iCalendar: %v", err)
+	}
+
+	method, err := req.Props.Text(ical.PropMethod)
+	if err != nil {
+		return err
+	}
+	var fbReq *ical.Component
+	for _, child := range req.Children {
+		if child.Name == ical.CompFreeBusy {
+			fbReq = child
+			break
+		}
+	}
+	if !strings.EqualFold(method, scheduleMethodRequest) || fbReq == nil {
+		return internal.HTTPErrorf(http.StatusForbidden, "caldav: only free-busy requests can be sent to the schedule outbox")
+	}
+
+	organizer := fbReq.Props.Get(ical.PropOrganizer)
+	if organizer == nil {
+		return internal.HTTPErrorf(http.StatusBadRequest, "caldav: free-busy request is missing ORGANIZER")
+	}
+	addrs, err := sb.CalendarUserAddressSet(ctx)
+	if err != nil {
+		return err
+	}
+	if !containsCalendarUser(addrs, organizer.Value) {
+		return internal.HTTPErrorf(http.StatusForbidden, "caldav: free-busy request organizer doesn't match the current user")
+	}
+
+	var q FreeBusyQuery
+	if q.Start, err = fbReq.Props.DateTime(ical.PropDateTimeStart, time.UTC); err != nil {
+		return internal.HTTPErrorf(http.StatusBadRequest, "caldav: malformed DTSTART: %v", err)
+	}
+	if q.End, err = fbReq.Props.DateTime(ical.PropDateTimeEnd, time.UTC); err != nil {
+		return internal.HTTPErrorf(http.StatusBadRequest, "caldav: malformed DTEND: %v", err)
+	}
+	if q.Start.IsZero() || q.End.IsZero() || !q.Start.Before(q.End) {
+		return internal.HTTPErrorf(http.StatusBadRequest, "caldav: free-busy request requires a valid time range")
+	}
+
+	var resp scheduleResponse
+	for _, attendee := range fbReq.Props.Values(ical.PropAttendee) {
+		u, err := url.Parse(attendee.Value)
+		if err != nil {
+			return internal.HTTPErrorf(http.StatusBadRequest, "caldav: malformed ATTENDEE: %v", err)
+		}
+		entry := scheduleResponseEntry{Recipient: scheduleRecipient{Href: internal.Href(*u)}}
+
+		fb, err := b.Deliverer.RecipientFreeBusy(ctx, attendee.Value, &q)
+		if err == nil {
+			var reply *ical.Calendar
+			reply, err = encodeFreeBusy(fb)
+			if err == nil {
+				comp := reply.Children[0]
+				reply.Props.SetText(ical.PropMethod, scheduleMethodReply)
+				if uid, _ := fbReq.Props.Text(ical.PropUID); uid != "" {
+					comp.Props.SetText(ical.PropUID, uid)
+				}
+				comp.Props.Set(organizer)
+				comp.Props.Set(&attendee)
+
+				var buf bytes.Buffer
+				if err = ical.NewEncoder(&buf).Encode(reply); err == nil {
+					entry.CalendarData = &calendarDataResp{Data: buf.Bytes()}
+				}
+			}
+		}
+		entry.RequestStatus = scheduleRequestStatus(err)
+
+		resp.Responses = append(resp.Responses, entry)
+	}
+
+	return internal.ServeXML(w).Encode(&resp)
+}
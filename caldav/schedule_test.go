@@ -0,0 +1,274 @@
+package caldav
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/emersion/go-webdav"
+)
+
+// testScheduleBackend stores the calendar objects of alice@example.org.
+type testScheduleBackend struct {
+	testBackend
+	objects map[string]*ical.Calendar
+	putErr  error
+}
+
+func (t *testScheduleBackend) CurrentUserPrincipal(ctx context.Context) (string, error) {
+	return "/alice/", nil
+}
+
+func (t *testScheduleBackend) CalendarHomeSetPath(ctx context.Context) (string, error) {
+	return "/alice/calendars/", nil
+}
+
+func (t *testScheduleBackend) CalendarUserAddressSet(ctx context.Context) ([]string, error) {
+	return []string{"mailto:alice@example.org"}, nil
+}
+
+func (t *testScheduleBackend) ScheduleInboxPath(ctx context.Context) (string, error) {
+	return "/alice/calendars/inbox/", nil
+}
+
+func (t *testScheduleBackend) ScheduleOutboxPath(ctx context.Context) (string, error) {
+	return "/alice/calendars/outbox/", nil
+}
+
+func (t *testScheduleBackend) GetCalendarObject(ctx context.Context, path string, req *CalendarCompRequest) (*CalendarObject, error) {
+	cal, ok := t.objects[path]
+	if !ok {
+		return nil, webdav.NewHTTPError(http.StatusNotFound, fmt.Errorf("calendar object %q not found", path))
+	}
+	return &CalendarObject{Path: path, Data: cal}, nil
+}
+
+func (t *testScheduleBackend) PutCalendarObject(ctx context.Context, path string, cal *ical.Calendar, opts *PutCalendarObjectOptions) (*CalendarObject, error) {
+	if t.putErr != nil {
+		return nil, t.putErr
+	}
+	t.objects[path] = cal
+	return &CalendarObject{Path: path, ETag: "etag", Data: cal}, nil
+}
+
+func (t *testScheduleBackend) DeleteCalendarObject(ctx context.Context, path string) error {
+	delete(t.objects, path)
+	return nil
+}
+
+type testScheduleDeliverer struct {
+	messages map[string][]*ical.Calendar
+}
+
+func (d *testScheduleDeliverer) DeliverScheduleMessage(ctx context.Context, recipient string, msg *ical.Calendar) error {
+	if recipient != "mailto:bob@example.org" {
+		return ErrInvalidCalendarUser
+	}
+	d.messages[recipient] = append(d.messages[recipient], msg)
+	return nil
+}
+
+func (d *testScheduleDeliverer) RecipientFreeBusy(ctx context.Context, recipient string, query *FreeBusyQuery) (*FreeBusy, error) {
+	if recipient != "mailto:bob@example.org" {
+		return nil, ErrInvalidCalendarUser
+	}
+	return &FreeBusy{
+		Start:   query.Start,
+		End:     query.End,
+		Periods: []FreeBusyPeriod{{query.Start, query.Start.Add(time.Hour), FreeBusyBusy}},
+	}, nil
+}
+
+// lastMessage returns the last message delivered to a recipient and its
+// method.
+func (d *testScheduleDeliverer) lastMessage(recipient string) (*ical.Calendar, string) {
+	l := d.messages[recipient]
+	if len(l) == 0 {
+		return nil, ""
+	}
+	method, _ := l[len(l)-1].Props.Text(ical.PropMethod)
+	return l[len(l)-1], method
+}
+
+const scheduleTestEvent = `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VEVENT
+UID:meeting@example.org
+DTSTAMP:20060206T001102Z
+DTSTART:20060102T100000Z
+DURATION:PT1H
+SUMMARY:Meeting
+ORGANIZER:mailto:alice@example.org
+ATTENDEE;PARTSTAT=ACCEPTED:mailto:alice@example.org
+%v
+BEGIN:VALARM
+ACTION:DISPLAY
+TRIGGER:-PT15M
+DESCRIPTION:Reminder
+END:VALARM
+END:VEVENT
+END:VCALENDAR`
+
+func TestHandler_schedule(t *testing.T) {
+	backend := &testScheduleBackend{objects: make(map[string]*ical.Calendar)}
+	deliverer := &testScheduleDeliverer{messages: make(map[string][]*ical.Calendar)}
+	handler := Handler{Backend: backend, Deliverer: deliverer}
+
+	serve := func(method, target, contentType, body string) *httptest.ResponseRecorder {
+		var r io.Reader
+		if body != "" {
+			r = strings.NewReader(strings.ReplaceAll(body, "\n", "\r\n"))
+		}
+		req := httptest.NewRequest(method, target, r)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve("PROPFIND", "/alice/", "application/xml", `<d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><d:prop><c:schedule-inbox-URL/><c:schedule-outbox-URL/><c:calendar-user-address-set/></d:prop></d:propfind>`)
+	for _, s := range []string{"/alice/calendars/inbox/", "/alice/calendars/outbox/", "mailto:alice@example.org"} {
+		if !strings.Contains(w.Body.String(), s) {
+			t.Errorf("PROPFIND response doesn't contain %q: %v", s, w.Body.String())
+		}
+	}
+	w = serve("PROPFIND", "/alice/calendars/inbox/", "application/xml", `<d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/></d:prop></d:propfind>`)
+	if !strings.Contains(w.Body.String(), "schedule-inbox") {
+		t.Errorf("PROPFIND response doesn't contain the inbox resource type: %v", w.Body.String())
+	}
+
+	// The organizer invites attendees
+	const eventPath = "/alice/calendars/work/meeting.ics"
+	attendees := "ATTENDEE:mailto:bob@example.org\nATTENDEE:mailto:unknown@example.org"
+	if w := serve(http.MethodPut, eventPath, ical.MIMEType, fmt.Sprintf(scheduleTestEvent, attendees)); w.Code != http.StatusCreated {
+		t.Fatalf("PUT = %v, want %v: %v", w.Code, http.StatusCreated, w.Body.String())
+	} else if w.Header().Get("ETag") != "" {
+		t.Errorf("PUT returned an ETag for a modified calendar object")
+	}
+	msg, method := deliverer.lastMessage("mailto:bob@example.org")
+	if method != "REQUEST" {
+		t.Fatalf("bob received %q message, want REQUEST", method)
+	}
+	if comp := msg.Children[0]; len(comp.Children) != 0 {
+		t.Errorf("REQUEST message contains alarms")
+	}
+	statuses := make(map[string]string)
+	for _, prop := range backend.objects[eventPath].Children[0].Props.Values(ical.PropAttendee) {
+		statuses[prop.Value] = prop.Params.Get("SCHEDULE-STATUS")
+	}
+	if statuses["mailto:bob@example.org"] != "1.2" || statuses["mailto:unknown@example.org"] != "3.7" || statuses["mailto:alice@example.org"] != "" {
+		t.Errorf("SCHEDULE-STATUS = %v", statuses)
+	}
+
+	// Nothing is sent if the calendar object can't be stored
+	backend.putErr = webdav.NewHTTPError(http.StatusInsufficientStorage, fmt.Errorf("quota exceeded"))
+	sent := len(deliverer.messages["mailto:bob@example.org"])
+	if w := serve(http.MethodPut, "/alice/calendars/work/failed.ics", ical.MIMEType, fmt.Sprintf(scheduleTestEvent, attendees)); w.Code != http.StatusInsufficientStorage {
+		t.Fatalf("PUT = %v, want %v: %v", w.Code, http.StatusInsufficientStorage, w.Body.String())
+	}
+	if len(deliverer.messages["mailto:bob@example.org"]) != sent {
+		t.Errorf("a message was sent for a calendar object which failed to be stored")
+	}
+	backend.putErr = nil
+
+	// Bob accepts: the reply updates the copy of the organizer
+	bobCal, err := ApplyScheduleMessage(nil, msg)
+	if err != nil {
+		t.Fatalf("ApplyScheduleMessage(REQUEST) = %v", err)
+	}
+	reply := newScheduleMessage("REPLY", bobCal, "mailto:bob@example.org")
+	setComponentAttendeeParam(reply.Children[0], "mailto:bob@example.org", ical.ParamParticipationStatus, "ACCEPTED")
+	aliceCal, err := ApplyScheduleMessage(backend.objects[eventPath], reply)
+	if err != nil {
+		t.Fatalf("ApplyScheduleMessage(REPLY) = %v", err)
+	}
+	if partStat := attendeePartStats(aliceCal, "mailto:bob@example.org")[""]; partStat != "ACCEPTED" {
+		t.Errorf("PARTSTAT after REPLY = %q, want ACCEPTED", partStat)
+	}
+
+	// Removing an attendee cancels the event for them
+	if w := serve(http.MethodPut, eventPath, ical.MIMEType, fmt.Sprintf(scheduleTestEvent, "ATTENDEE:mailto:unknown@example.org")); w.Code != http.StatusCreated {
+		t.Fatalf("PUT = %v, want %v: %v", w.Code, http.StatusCreated, w.Body.String())
+	}
+	msg, method = deliverer.lastMessage("mailto:bob@example.org")
+	if method != "CANCEL" {
+		t.Fatalf("bob received %q message, want CANCEL", method)
+	}
+	bobCal, err = ApplyScheduleMessage(bobCal, msg)
+	if err != nil {
+		t.Fatalf("ApplyScheduleMessage(CANCEL) = %v", err)
+	}
+	if status, _ := bobCal.Children[0].Props.Text(ical.PropStatus); status != "CANCELLED" {
+		t.Errorf("STATUS after CANCEL = %q, want CANCELLED", status)
+	}
+
+	// Attendee replies are sent to the organizer
+	const invitationPath = "/alice/calendars/work/invitation.ics"
+	invitation := strings.NewReplacer(
+		"ORGANIZER:mailto:alice@example.org", "ORGANIZER:mailto:bob@example.org",
+		"UID:meeting@example.org", "UID:invitation@example.org",
+	).Replace(scheduleTestEvent)
+	backend.objects[invitationPath], err = ical.NewDecoder(strings.NewReader(fmt.Sprintf(strings.ReplaceAll(invitation, "PARTSTAT=ACCEPTED", "PARTSTAT=NEEDS-ACTION"), ""))).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := len(deliverer.messages["mailto:bob@example.org"])
+	if w := serve(http.MethodPut, invitationPath, ical.MIMEType, fmt.Sprintf(invitation, "")); w.Code != http.StatusCreated {
+		t.Fatalf("PUT = %v, want %v: %v", w.Code, http.StatusCreated, w.Body.String())
+	}
+	if len(deliverer.messages["mailto:bob@example.org"]) != n+1 {
+		t.Fatalf("accepting an invitation didn't send a message to the organizer")
+	}
+	msg, method = deliverer.lastMessage("mailto:bob@example.org")
+	if method != "REPLY" || attendeePartStats(msg, "mailto:alice@example.org")[""] != "ACCEPTED" {
+		t.Errorf("organizer received %q message with PARTSTAT %v, want ACCEPTED REPLY", method, attendeePartStats(msg, "mailto:alice@example.org"))
+	}
+	if status := calendarOrganizer(backend.objects[invitationPath]).Params.Get("SCHEDULE-STATUS"); status != "1.2" {
+		t.Errorf("organizer SCHEDULE-STATUS = %q, want 1.2", status)
+	}
+
+	if w := serve(http.MethodDelete, invitationPath, "", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE = %v, want %v: %v", w.Code, http.StatusNoContent, w.Body.String())
+	}
+	msg, method = deliverer.lastMessage("mailto:bob@example.org")
+	if method != "REPLY" || attendeePartStats(msg, "mailto:alice@example.org")[""] != "DECLINED" {
+		t.Errorf("organizer received %q message with PARTSTAT %v, want DECLINED REPLY", method, attendeePartStats(msg, "mailto:alice@example.org"))
+	}
+
+	// Free-busy requests
+	fbReq := `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+METHOD:REQUEST
+BEGIN:VFREEBUSY
+UID:freebusy@example.org
+DTSTAMP:20060206T001102Z
+DTSTART:20060102T000000Z
+DTEND:20060103T000000Z
+ORGANIZER:mailto:alice@example.org
+ATTENDEE:mailto:bob@example.org
+ATTENDEE:mailto:unknown@example.org
+END:VFREEBUSY
+END:VCALENDAR`
+	w = serve(http.MethodPost, "/alice/calendars/outbox/", ical.MIMEType, fbReq)
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST = %v, want %v: %v", w.Code, http.StatusOK, w.Body.String())
+	}
+	for _, s := range []string{"schedule-response", "2.0;Success", "3.7;Invalid calendar user", "FREEBUSY:20060102T000000Z/20060102T010000Z", "METHOD:REPLY"} {
+		if !strings.Contains(w.Body.String(), s) {
+			t.Errorf("POST response doesn't contain %q: %v", s, w.Body.String())
+		}
+	}
+	if w := serve(http.MethodPost, "/alice/calendars/work/", ical.MIMEType, fbReq); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST to a calendar = %v, want %v", w.Code, http.StatusMethodNotAllowed)
+	}
+}
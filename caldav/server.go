@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/xml"
 	"fmt"
+	"io"
 	"mime"
 	"net/http"
 	"path"
@@ -44,11 +45,45 @@ type Backend interface {
 	webdav.UserPrincipalBackend
 }
 
+// SyncBackend is an optional interface which can be implemented by a Backend
+// to support collection synchronization, as defined in RFC 6578. Clients can
+// then fetch the changes to a calendar since their last synchronization with
+// the sync-collection REPORT.
+type SyncBackend interface {
+	// CalendarSyncToken returns the current sync token of a calendar, exposed
+	// via the DAV:sync-token property.
+	CalendarSyncToken(ctx context.Context, path string) (string, error)
+	// SyncCollection returns the calendar objects which changed since
+	// query.SyncToken. An empty token requests all calendar objects.
+	//
+	// webdav.ErrInvalidSyncToken is returned if the token is malformed or has
+	// expired. If more objects than query.Limit changed, the response is
+	// truncated and SyncResponse.Truncated is set. If the response can't be
+	// truncated, a 507 Insufficient Storage HTTP error is returned.
+	SyncCollection(ctx context.Context, path string, query *SyncQuery) (*SyncResponse, error)
+}
+
+// FreeBusyBackend is an optional interface which can be implemented by a
+// Backend to compute busy periods more efficiently. By default, the Handler
+// computes them from all calendar objects returned by ListCalendarObjects.
+type FreeBusyBackend interface {
+	// QueryFreeBusy returns the busy periods of a calendar within the time
+	// range of the query. ComputeFreeBusy can be used to compute them from a
+	// list of calendar objects.
+	QueryFreeBusy(ctx context.Context, path string, query *FreeBusyQuery) (*FreeBusy, error)
+}
+
 // Handler handles CalDAV HTTP requests. It can be used to create a CalDAV
 // server.
 type Handler struct {
 	Backend Backend
 	Prefix  string
+	// Authorizer enables access control, as defined in RFC 3744. If nil,
+	// all requests are allowed.
+	Authorizer webdav.Authorizer
+	// Deliverer enables scheduling, as defined in RFC 6638, if the Backend
+	// implements ScheduleBackend.
+	Deliverer ScheduleDeliverer
 }
 
 // ServeHTTP implements http.Handler.
@@ -69,16 +104,26 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	b := backend{
+		Backend:   h.Backend,
+		Prefix:    strings.TrimSuffix(h.Prefix, "/"),
+		Deliverer: h.Deliverer,
+	}
+	hh := internal.Handler{
+		Backend:    &b,
+		Authorizer: internal.NewAuthorizer(h.Authorizer),
+		Privileges: supportedPrivilegeSet(),
+	}
+
 	var err error
 	switch r.Method {
 	case "REPORT":
-		err = h.handleReport(w, r)
-	default:
-		b := backend{
-			Backend: h.Backend,
-			Prefix:  strings.TrimSuffix(h.Prefix, "/"),
+		err = h.handleReport(w, r, &hh)
+	case http.MethodPost:
+		if err = hh.Authorize(r); err == nil {
+			err = h.handleSchedulePost(w, r, &b)
 		}
-		hh := internal.Handler{Backend: &b}
+	default:
 		hh.ServeHTTP(w, r)
 	}
 
@@ -87,18 +132,44 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *Handler) handleReport(w http.ResponseWriter, r *http.Request) error {
+// supportedPrivilegeSet returns the WebDAV privileges along with the CalDAV
+// ones, see RFC 4791 section 6.1.
+func supportedPrivilegeSet() *internal.SupportedPrivilegeSet {
+	set := internal.NewSupportedPrivilegeSet()
+	set.Add(internal.PrivilegeReadName, xml.Name(PrivilegeReadFreeBusy), "Read free/busy information")
+	return set
+}
+
+func (h *Handler) handleReport(w http.ResponseWriter, r *http.Request, hh *internal.Handler) error {
 	var report reportReq
 	if err := internal.DecodeXMLRequest(r, &report); err != nil {
 		return err
 	}
 
+	// Computing busy periods only requires CALDAV:read-free-busy, see RFC
+	// 4791 section 7.10
+	var err error
+	if report.FreeBusyQuery != nil {
+		err = hh.AuthorizePrivilege(r, r.URL.Path, xml.Name(PrivilegeReadFreeBusy))
+	} else {
+		err = hh.Authorize(r)
+	}
+	if err != nil {
+		return err
+	}
+
 	if report.Query != nil {
-		return h.handleQuery(r, w, report.Query)
+		return h.handleQuery(r, w, hh, report.Query)
 	} else if report.Multiget != nil {
-		return h.handleMultiget(r.Context(), w, report.Multiget)
-	}
-	return internal.HTTPErrorf(http.StatusBadRequest, "caldav: expected calendar-query or calendar-multiget element in REPORT request")
+		return h.handleMultiget(r, w, hh, report.Multiget)
+	} else if report.ExpandProperty != nil {
+		return hh.ServeExpandProperty(w, r, report.ExpandProperty)
+	} else if report.SyncCollection != nil {
+		return hh.ServeSyncCollection(w, r, report.SyncCollection)
+	} else if report.FreeBusyQuery != nil {
+		return h.handleFreeBusyQuery(r, w, report.FreeBusyQuery)
+	}
+	return internal.HTTPErrorf(http.StatusBadRequest, "caldav: expected calendar-query, calendar-multiget, expand-property, sync-collection or free-busy-query element in REPORT request")
 }
 
 func decodeParamFilter(el *paramFilter) (*ParamFilter, error) {
@@ -110,11 +181,26 @@ func decodeParamFilter(el *paramFilter) (*ParamFilter, error) {
 		pf.IsNotDefined = true
 	}
 	if el.TextMatch != nil {
-		pf.TextMatch = &TextMatch{Text: el.TextMatch.Text}
+		tm, err := decodeTextMatch(el.TextMatch)
+		if err != nil {
+			return nil, err
+		}
+		pf.TextMatch = tm
 	}
 	return pf, nil
 }
 
+func decodeTextMatch(el *textMatch) (*TextMatch, error) {
+	if el.Collation != "" && !internal.IsSupportedCollation(el.Collation) {
+		return nil, internal.NewPreconditionError(http.StatusForbidden, &supportedCollation{})
+	}
+	return &TextMatch{
+		Text:            el.Text,
+		NegateCondition: bool(el.NegateCondition),
+		Collation:       el.Collation,
+	}, nil
+}
+
 func decodePropFilter(el *propFilter) (*PropFilter, error) {
 	pf := &PropFilter{Name: el.Name}
 	if el.IsNotDefined != nil {
@@ -124,7 +210,11 @@ func decodePropFilter(el *propFilter) (*PropFilter, error) {
 		pf.IsNotDefined = true
 	}
 	if el.TextMatch != nil {
-		pf.TextMatch = &TextMatch{Text: el.TextMatch.Text}
+		tm, err := decodeTextMatch(el.TextMatch)
+		if err != nil {
+			return nil, err
+		}
+		pf.TextMatch = tm
 	}
 	if el.TimeRange != nil {
 		pf.Start = time.Time(el.TimeRange.Start)
@@ -181,6 +271,7 @@ func decodeComp(comp *comp) (*CalendarCompRequest, error) {
 	}
 
 	req := &CalendarCompRequest{
+		Name:     comp.Name,
 		AllProps: comp.Allprop != nil,
 		AllComps: comp.Allcomp != nil,
 	}
@@ -198,24 +289,185 @@ func decodeComp(comp *comp) (*CalendarCompRequest, error) {
 }
 
 func decodeCalendarDataReq(calendarData *calendarDataReq) (*CalendarCompRequest, error) {
+	var req *CalendarCompRequest
 	if calendarData.Comp == nil {
-		return &CalendarCompRequest{
+		req = &CalendarCompRequest{
 			AllProps: true,
 			AllComps: true,
-		}, nil
+		}
+	} else {
+		var err error
+		req, err = decodeComp(calendarData.Comp)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if calendarData.ContentType != "" || calendarData.Version != "" {
+		// RFC 4791 section 9.6 defines the defaults
+		contentType := strings.ToLower(calendarData.ContentType)
+		if contentType == "" {
+			contentType = ical.MIMEType
+		}
+		if !isSupportedCalendarData(contentType, calendarData.Version) {
+			return nil, internal.NewPreconditionError(http.StatusForbidden, &supportedCalendarData{
+				Types: supportedCalendarDataTypes,
+			})
+		}
+		req.ContentType = contentType
+	}
+
+	if calendarData.Expand != nil && calendarData.LimitRecurrenceSet != nil {
+		return nil, internal.HTTPErrorf(http.StatusBadRequest, "caldav: only one of expand or limit-recurrence-set can be specified in calendar-data")
+	}
+	if e := calendarData.Expand; e != nil {
+		start, end, err := decodeTimeRangeAttrs(e.Start, e.End)
+		if err != nil {
+			return nil, err
+		}
+		req.Expand = &CalendarExpandRequest{Start: start, End: end}
+	}
+	if l := calendarData.LimitRecurrenceSet; l != nil {
+		start, end, err := decodeTimeRangeAttrs(l.Start, l.End)
+		if err != nil {
+			return nil, err
+		}
+		req.LimitRecurrenceSet = &CalendarLimitRequest{Start: start, End: end}
+	}
+	if l := calendarData.LimitFreeBusySet; l != nil {
+		start, end, err := decodeTimeRangeAttrs(l.Start, l.End)
+		if err != nil {
+			return nil, err
+		}
+		req.LimitFreeBusySet = &CalendarLimitRequest{Start: start, End: end}
 	}
-	return decodeComp(calendarData.Comp)
+	return req, nil
+}
+
+// supportedCalendarDataTypes lists the calendar data types the server can
+// return.
+var supportedCalendarDataTypes = []calendarDataType{
+	{ContentType: ical.MIMEType, Version: "2.0"},
+	{ContentType: JCalMIMEType, Version: "2.0"},
+}
+
+func isSupportedCalendarData(contentType, version string) bool {
+	if version == "" {
+		version = "2.0"
+	}
+	for _, t := range supportedCalendarDataTypes {
+		if t.ContentType == contentType && t.Version == version {
+			return true
+		}
+	}
+	return false
 }
 
-func (h *Handler) handleQuery(r *http.Request, w http.ResponseWriter, query *calendarQuery) error {
+// negotiateCalendarData picks the media type returned by a GET request from
+// its Accept header.
+func negotiateCalendarData(accept string) (string, error) {
+	if accept == "" {
+		return ical.MIMEType, nil
+	}
+
+	ranges := internal.ParseAccept(accept)
+	best, bestQ, matched := "", 0.0, false
+	for _, t := range supportedCalendarDataTypes {
+		params := map[string]string{"charset": "utf-8", "version": t.Version}
+		q, ok := internal.AcceptQuality(ranges, t.ContentType, params)
+		matched = matched || ok
+		if q > bestQ {
+			best, bestQ = t.ContentType, q
+		}
+	}
+	if best != "" {
+		return best, nil
+	}
+
+	rejected := matched
+	for _, mr := range ranges {
+		if mr.Type == ical.MIMEType || mr.Type == JCalMIMEType {
+			rejected = true
+		}
+	}
+	if rejected {
+		return "", internal.NewPreconditionError(http.StatusNotAcceptable, &supportedCalendarData{
+			Types: supportedCalendarDataTypes,
+		})
+	}
+	// Be lenient with clients which don't send a proper Accept header
+	return ical.MIMEType, nil
+}
+
+// encodeCalendarData writes a calendar in the provided media type.
+func encodeCalendarData(w io.Writer, cal *ical.Calendar, contentType string) error {
+	if contentType == JCalMIMEType {
+		return EncodeJCal(w, cal)
+	}
+	return ical.NewEncoder(w).Encode(cal)
+}
+
+// decodeTimeRangeAttrs decodes the mandatory start and end attributes of the
+// expand, limit-recurrence-set and limit-freebusy-set elements.
+func decodeTimeRangeAttrs(start, end dateWithUTCTime) (time.Time, time.Time, error) {
+	s, e := time.Time(start), time.Time(end)
+	if s.IsZero() || e.IsZero() || !s.Before(e) {
+		return time.Time{}, time.Time{}, internal.HTTPErrorf(http.StatusBadRequest, "caldav: invalid time range in calendar-data")
+	}
+	return s, e, nil
+}
+
+// decodeCalendarDataProp decodes the CALDAV:calendar-data element of a
+// DAV:prop element, if any.
+func decodeCalendarDataProp(prop *internal.Prop) (*CalendarCompRequest, error) {
+	if prop == nil {
+		return &CalendarCompRequest{}, nil
+	}
+	var calendarData calendarDataReq
+	if err := prop.Decode(&calendarData); err != nil && !internal.IsNotFound(err) {
+		return nil, err
+	}
+	return decodeCalendarDataReq(&calendarData)
+}
+
+// setTimezone sets the time zone used to interpret floating date-times when
+// expanding or limiting recurrence sets.
+func (req *CalendarCompRequest) setTimezone(loc *time.Location) {
+	if req.Expand != nil {
+		req.Expand.Timezone = loc
+	}
+	if req.LimitRecurrenceSet != nil {
+		req.LimitRecurrenceSet.Timezone = loc
+	}
+}
+
+func (h *Handler) handleQuery(r *http.Request, w http.ResponseWriter, hh *internal.Handler, query *calendarQuery) error {
 	var q CalendarQuery
-	// TODO: calendar-data in query.Prop
+	dataReq, err := decodeCalendarDataProp(query.Prop)
+	if err != nil {
+		return err
+	}
 	cf, err := decodeCompFilter(&query.Filter.CompFilter)
 	if err != nil {
 		return err
 	}
 	q.CompFilter = *cf
 
+	b := backend{
+		Backend: h.Backend,
+		Prefix:  strings.TrimSuffix(h.Prefix, "/"),
+	}
+	if query.Timezone != nil {
+		q.Timezone, err = parseTimezone(query.Timezone.Data)
+		if err != nil {
+			return internal.HTTPErrorf(http.StatusBadRequest, "caldav: invalid timezone: %v", err)
+		}
+	} else if q.Timezone, err = b.calendarTimezone(r.Context(), r.URL.Path); err != nil {
+		return err
+	}
+	dataReq.setTimezone(q.Timezone)
+	q.CompRequest = *dataReq
+
 	cos, err := h.Backend.QueryCalendarObjects(r.Context(), r.URL.Path, &q)
 	if err != nil {
 		return err
@@ -223,73 +475,170 @@ func (h *Handler) handleQuery(r *http.Request, w http.ResponseWriter, query *cal
 
 	var resps []internal.Response
 	for _, co := range cos {
-		b := backend{
-			Backend: h.Backend,
-			Prefix:  strings.TrimSuffix(h.Prefix, "/"),
-		}
 		propfind := internal.PropFind{
 			Prop:     query.Prop,
 			AllProp:  query.AllProp,
 			PropName: query.PropName,
 		}
-		resp, err := b.propFindCalendarObject(r.Context(), &propfind, &co)
+		co, err := applyCalendarDataReq(dataReq, &co)
+		if err != nil {
+			return err
+		}
+		resp, err := b.propFindCalendarObject(r.Context(), &propfind, co, dataReq)
 		if err != nil {
 			return err
 		}
 		resps = append(resps, *resp)
 	}
 
+	propfind := internal.PropFind{Prop: query.Prop, AllProp: query.AllProp, PropName: query.PropName}
+	if err := hh.AuthorizeResponses(r, &propfind, resps); err != nil {
+		return err
+	}
+
 	ms := internal.NewMultiStatus(resps...)
 
 	return internal.ServeMultiStatus(w, ms)
 }
 
-func (h *Handler) handleMultiget(ctx context.Context, w http.ResponseWriter, multiget *calendarMultiget) error {
-	var dataReq CalendarCompRequest
-	if multiget.Prop != nil {
-		var calendarData calendarDataReq
-		if err := multiget.Prop.Decode(&calendarData); err != nil && !internal.IsNotFound(err) {
-			return err
-		}
-		decoded, err := decodeCalendarDataReq(&calendarData)
-		if err != nil {
-			return err
-		}
-		dataReq = *decoded
+func (h *Handler) handleMultiget(r *http.Request, w http.ResponseWriter, hh *internal.Handler, multiget *calendarMultiget) error {
+	ctx := r.Context()
+	dataReq, err := decodeCalendarDataProp(multiget.Prop)
+	if err != nil {
+		return err
 	}
 
+	b := backend{
+		Backend: h.Backend,
+		Prefix:  strings.TrimSuffix(h.Prefix, "/"),
+	}
+	// Objects may belong to different calendars, each with its own time zone
+	timezones := make(map[string]*time.Location)
 	var resps []internal.Response
 	for _, href := range multiget.Hrefs {
-		co, err := h.Backend.GetCalendarObject(ctx, href.Path, &dataReq)
+		dir := path.Dir(path.Clean(href.Path))
+		loc, ok := timezones[dir]
+		if !ok {
+			loc, err = b.calendarTimezone(ctx, href.Path)
+			if err != nil {
+				return err
+			}
+			timezones[dir] = loc
+		}
+		dataReq.setTimezone(loc)
+
+		co, err := h.Backend.GetCalendarObject(ctx, href.Path, dataReq)
 		if err != nil {
 			resp := internal.NewErrorResponse(href.Path, err)
 			resps = append(resps, *resp)
 			continue
 		}
-
-		b := backend{
-			Backend: h.Backend,
-			Prefix:  strings.TrimSuffix(h.Prefix, "/"),
+		co, err = applyCalendarDataReq(dataReq, co)
+		if err != nil {
+			return err
 		}
+
 		propfind := internal.PropFind{
 			Prop:     multiget.Prop,
 			AllProp:  multiget.AllProp,
 			PropName: multiget.PropName,
 		}
-		resp, err := b.propFindCalendarObject(ctx, &propfind, co)
+		resp, err := b.propFindCalendarObject(ctx, &propfind, co, dataReq)
 		if err != nil {
 			return err
 		}
 		resps = append(resps, *resp)
 	}
 
+	propfind := internal.PropFind{Prop: multiget.Prop, AllProp: multiget.AllProp, PropName: multiget.PropName}
+	if err := hh.AuthorizeResponses(r, &propfind, resps); err != nil {
+		return err
+	}
+
 	ms := internal.NewMultiStatus(resps...)
 	return internal.ServeMultiStatus(w, ms)
 }
 
+// calendarTimezone returns the time zone of the calendar containing a
+// resource, as specified by its CALDAV:calendar-timezone property. It returns
+// nil if the time zone isn't specified.
+func (b *backend) calendarTimezone(ctx context.Context, p string) (*time.Location, error) {
+	switch b.resourceTypeAtPath(p) {
+	case resourceTypeCalendar:
+	case resourceTypeCalendarObject:
+		p = path.Dir(path.Clean(p))
+	default:
+		return nil, nil
+	}
+
+	cal, err := b.Backend.GetCalendar(ctx, p)
+	if internal.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	} else if cal.Timezone == "" {
+		return nil, nil
+	}
+	loc, err := parseTimezone(cal.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("caldav: invalid timezone of calendar %q: %v", p, err)
+	}
+	return loc, nil
+}
+
+func (h *Handler) handleFreeBusyQuery(r *http.Request, w http.ResponseWriter, query *freeBusyQuery) error {
+	b := backend{
+		Backend: h.Backend,
+		Prefix:  strings.TrimSuffix(h.Prefix, "/"),
+	}
+	if b.resourceTypeAtPath(r.URL.Path) != resourceTypeCalendar {
+		return internal.HTTPErrorf(http.StatusForbidden, "caldav: free-busy-query is only supported on calendars")
+	}
+
+	q := FreeBusyQuery{
+		Start: time.Time(query.TimeRange.Start),
+		End:   time.Time(query.TimeRange.End),
+	}
+	if q.Start.IsZero() || q.End.IsZero() || !q.Start.Before(q.End) {
+		return internal.HTTPErrorf(http.StatusBadRequest, "caldav: free-busy-query requires a valid time range")
+	}
+
+	ctx := r.Context()
+	var err error
+	if q.Timezone, err = b.calendarTimezone(ctx, r.URL.Path); err != nil {
+		return err
+	}
+
+	var fb *FreeBusy
+	if fbb, ok := h.Backend.(FreeBusyBackend); ok {
+		fb, err = fbb.QueryFreeBusy(ctx, r.URL.Path, &q)
+		if err != nil {
+			return err
+		}
+	} else {
+		dataReq := CalendarCompRequest{Name: ical.CompCalendar, AllProps: true, AllComps: true}
+		cos, err := h.Backend.ListCalendarObjects(ctx, r.URL.Path, &dataReq)
+		if err != nil {
+			return err
+		}
+		fb, err = ComputeFreeBusy(&q, cos)
+		if err != nil {
+			return err
+		}
+	}
+
+	cal, err := encodeFreeBusy(fb)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", ical.MIMEType)
+	return ical.NewEncoder(w).Encode(cal)
+}
+
 type backend struct {
-	Backend Backend
-	Prefix  string
+	Backend   Backend
+	Prefix    string
+	Deliverer ScheduleDeliverer
 }
 
 type resourceType int
@@ -317,6 +666,16 @@ func (b *backend) resourceTypeAtPath(reqPath string) resourceType {
 func (b *backend) Options(r *http.Request) (caps []string, allow []string, err error) {
 	caps = []string{"calendar-access"}
 
+	if sb, ok := b.scheduleBackend(); ok {
+		caps = append(caps, "calendar-auto-schedule")
+		name, ok, err := b.scheduleBoxName(r.Context(), sb, r.URL.Path)
+		if err != nil {
+			return nil, nil, err
+		} else if ok && name == scheduleOutboxName {
+			return caps, []string{http.MethodOptions, "PROPFIND", http.MethodPost}, nil
+		}
+	}
+
 	if b.resourceTypeAtPath(r.URL.Path) != resourceTypeCalendarObject {
 		return caps, []string{http.MethodOptions, "PROPFIND", "REPORT", "DELETE", "MKCOL"}, nil
 	}
@@ -339,8 +698,38 @@ func (b *backend) Options(r *http.Request) (caps []string, allow []string, err e
 	}, nil
 }
 
+func (b *backend) ResourceState(r *http.Request, p string) (*internal.ResourceState, error) {
+	ctx := r.Context()
+	var state internal.ResourceState
+	var err error
+	switch b.resourceTypeAtPath(p) {
+	case resourceTypeCalendar:
+		_, err = b.Backend.GetCalendar(ctx, p)
+	case resourceTypeCalendarObject:
+		var o *CalendarObject
+		o, err = b.Backend.GetCalendarObject(ctx, p, &CalendarCompRequest{})
+		if err == nil {
+			state.ETag = o.ETag
+		}
+	default:
+		return &state, nil
+	}
+	if internal.IsNotFound(err) {
+		return &state, nil
+	} else if err != nil {
+		return nil, err
+	}
+	state.Exists = true
+	return &state, nil
+}
+
 func (b *backend) HeadGet(w http.ResponseWriter, r *http.Request) error {
-	var dataReq CalendarCompRequest
+	contentType, err := negotiateCalendarData(r.Header.Get("Accept"))
+	if err != nil {
+		return err
+	}
+
+	dataReq := CalendarCompRequest{ContentType: contentType}
 	if r.Method != http.MethodHead {
 		dataReq.AllProps = true
 	}
@@ -349,8 +738,9 @@ func (b *backend) HeadGet(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
-	w.Header().Set("Content-Type", ical.MIMEType)
-	if co.ContentLength > 0 {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Vary", "Accept")
+	if co.ContentLength > 0 && contentType == ical.MIMEType {
 		w.Header().Set("Content-Length", strconv.FormatInt(co.ContentLength, 10))
 	}
 	if co.ETag != "" {
@@ -361,7 +751,7 @@ func (b *backend) HeadGet(w http.ResponseWriter, r *http.Request) error {
 	}
 
 	if r.Method != http.MethodHead {
-		return ical.NewEncoder(w).Encode(co.Data)
+		return encodeCalendarData(w, co.Data, contentType)
 	}
 	return nil
 }
@@ -372,6 +762,19 @@ func (b *backend) PropFind(r *http.Request, propfind *internal.PropFind, depth i
 	var dataReq CalendarCompRequest
 	var resps []internal.Response
 
+	if sb, ok := b.scheduleBackend(); ok {
+		name, ok, err := b.scheduleBoxName(r.Context(), sb, r.URL.Path)
+		if err != nil {
+			return nil, err
+		} else if ok {
+			resps, err := b.propFindScheduleBox(r.Context(), propfind, r.URL.Path, name, depth)
+			if err != nil {
+				return nil, err
+			}
+			return internal.NewMultiStatus(resps...), nil
+		}
+	}
+
 	switch resType {
 	case resourceTypeRoot:
 		resp, err := b.propFindRoot(r.Context(), propfind)
@@ -448,7 +851,7 @@ func (b *backend) PropFind(r *http.Request, propfind *internal.PropFind, depth i
 			return nil, err
 		}
 
-		resp, err := b.propFindCalendarObject(r.Context(), propfind, ao)
+		resp, err := b.propFindCalendarObject(r.Context(), propfind, ao, &dataReq)
 		if err != nil {
 			return nil, err
 		}
@@ -492,6 +895,9 @@ func (b *backend) propFindUserPrincipal(ctx context.Context, propfind *internal.
 		}),
 		internal.ResourceTypeName: internal.PropFindValue(internal.NewResourceType(internal.CollectionName, internal.PrincipalName)),
 	}
+	if sb, ok := b.scheduleBackend(); ok {
+		b.scheduleUserPrincipalProps(ctx, sb, props)
+	}
 	return internal.NewPropFindResponse(principalPath, propfind, props)
 }
 
@@ -529,9 +935,7 @@ func (b *backend) propFindCalendar(ctx context.Context, propfind *internal.PropF
 			Description: cal.Description,
 		}),
 		supportedCalendarDataName: internal.PropFindValue(&supportedCalendarData{
-			Types: []calendarDataType{
-				{ContentType: ical.MIMEType, Version: "2.0"},
-			},
+			Types: supportedCalendarDataTypes,
 		}),
 		supportedCalendarComponentSetName: func(*internal.RawXMLValue) (interface{}, error) {
 			components := []comp{}
@@ -564,12 +968,89 @@ func (b *backend) propFindCalendar(ctx context.Context, propfind *internal.PropF
 			Size: cal.MaxResourceSize,
 		})
 	}
+	if cal.Timezone != "" {
+		props[calendarTimezoneName] = internal.PropFindValue(&calendarTimezone{
+			Data: cal.Timezone,
+		})
+	}
 
-	// TODO: CALDAV:calendar-timezone, CALDAV:supported-calendar-component-set, CALDAV:min-date-time, CALDAV:max-date-time, CALDAV:max-instances, CALDAV:max-attendees-per-instance
+	// RFC 6578 section 4 excludes the sync token from allprop
+	if sb, ok := b.Backend.(SyncBackend); ok && propfind.AllProp == nil {
+		props[internal.SyncTokenName] = func(*internal.RawXMLValue) (interface{}, error) {
+			token, err := sb.CalendarSyncToken(ctx, cal.Path)
+			if err != nil {
+				return nil, err
+			}
+			return &internal.SyncToken{Token: token}, nil
+		}
+	}
+
+	// TODO: CALDAV:supported-calendar-component-set, CALDAV:min-date-time, CALDAV:max-date-time, CALDAV:max-instances, CALDAV:max-attendees-per-instance
 
 	return internal.NewPropFindResponse(cal.Path, propfind, props)
 }
 
+func (b *backend) SyncCollection(r *http.Request, query *internal.SyncCollectionQuery, level internal.Depth, mw *internal.MultiStatusWriter) (truncated bool, err error) {
+	sb, ok := b.Backend.(SyncBackend)
+	if !ok {
+		return false, internal.HTTPErrorf(http.StatusForbidden, "caldav: sync-collection is not supported")
+	}
+	// Calendars can't contain collections, so all sync levels are equivalent
+	if b.resourceTypeAtPath(r.URL.Path) != resourceTypeCalendar {
+		return false, internal.HTTPErrorf(http.StatusForbidden, "caldav: sync-collection is only supported on calendars")
+	}
+
+	dataReq, err := decodeCalendarDataProp(query.Prop)
+	if err != nil {
+		return false, err
+	}
+	loc, err := b.calendarTimezone(r.Context(), r.URL.Path)
+	if err != nil {
+		return false, err
+	}
+	dataReq.setTimezone(loc)
+	q := SyncQuery{
+		CompRequest: *dataReq,
+		SyncToken:   query.SyncToken,
+	}
+	if query.Limit != nil {
+		q.Limit = int(query.Limit.NResults)
+	}
+
+	ctx := r.Context()
+	resp, err := sb.SyncCollection(ctx, r.URL.Path, &q)
+	if err != nil {
+		return false, err
+	}
+
+	propfind := internal.PropFind{Prop: query.Prop}
+	for i := range resp.Updated {
+		co, err := applyCalendarDataReq(dataReq, &resp.Updated[i])
+		if err != nil {
+			return false, err
+		}
+		objResp, err := b.propFindCalendarObject(ctx, &propfind, co, dataReq)
+		if err != nil {
+			return false, err
+		}
+		if err := mw.WriteResponse(objResp); err != nil {
+			return false, err
+		}
+	}
+	for _, p := range resp.Deleted {
+		objResp := internal.Response{
+			Hrefs:  []internal.Href{{Path: p}},
+			Status: &internal.Status{Code: http.StatusNotFound},
+		}
+		if err := mw.WriteResponse(&objResp); err != nil {
+			return false, err
+		}
+	}
+
+	mw.SyncToken = resp.SyncToken
+	return resp.Truncated, nil
+}
+
 func (b *backend) propFindAllCalendars(ctx context.Context, propfind *internal.PropFind, recurse bool) ([]internal.Response, error) {
 	abs, err := b.Backend.ListCalendars(ctx)
 	if err != nil {
@@ -594,7 +1075,7 @@ func (b *backend) propFindAllCalendars(ctx context.Context, propfind *internal.P
 	return resps, nil
 }
 
-func (b *backend) propFindCalendarObject(ctx context.Context, propfind *internal.PropFind, co *CalendarObject) (*internal.Response, error) {
+func (b *backend) propFindCalendarObject(ctx context.Context, propfind *internal.PropFind, co *CalendarObject, dataReq *CalendarCompRequest) (*internal.Response, error) {
 	props := map[xml.Name]internal.PropFindFunc{
 		internal.CurrentUserPrincipalName: func(*internal.RawXMLValue) (interface{}, error) {
 			path, err := b.Backend.CurrentUserPrincipal(ctx)
@@ -609,11 +1090,16 @@ func (b *backend) propFindCalendarObject(ctx context.Context, propfind *internal
 		// TODO: calendar-data can only be used in REPORT requests
 		calendarDataName: func(*internal.RawXMLValue) (interface{}, error) {
 			var buf bytes.Buffer
-			if err := ical.NewEncoder(&buf).Encode(co.Data); err != nil {
+			if err := encodeCalendarData(&buf, co.Data, dataReq.ContentType); err != nil {
 				return nil, err
 			}
 
-			return &calendarDataResp{Data: buf.Bytes()}, nil
+			resp := &calendarDataResp{Data: buf.Bytes()}
+			if dataReq.ContentType != "" {
+				resp.ContentType = dataReq.ContentType
+				resp.Version = "2.0"
+			}
+			return resp, nil
 		},
 	}
 
@@ -646,7 +1132,7 @@ func (b *backend) propFindAllCalendarObjects(ctx context.Context, propfind *inte
 
 	var resps []internal.Response
 	for _, ao := range aos {
-		resp, err := b.propFindCalendarObject(ctx, propfind, &ao)
+		resp, err := b.propFindCalendarObject(ctx, propfind, &ao, &dataReq)
 		if err != nil {
 			return nil, err
 		}
@@ -672,24 +1158,67 @@ func (b *backend) Put(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return internal.HTTPErrorf(http.StatusBadRequest, "caldav: malformed Content-Type: %v", err)
 	}
-	if t != ical.MIMEType {
+	// TODO: check CALDAV:max-resource-size precondition
+	var cal *ical.Calendar
+	switch t {
+	case ical.MIMEType:
+		cal, err = ical.NewDecoder(r.Body).Decode()
+	case JCalMIMEType:
+		cal, err = DecodeJCal(r.Body)
+	default:
 		// TODO: send CALDAV:supported-calendar-data error
 		return internal.HTTPErrorf(http.StatusBadRequest, "caldav: unsupported Content-Type %q", t)
 	}
-
-	// TODO: check CALDAV:max-resource-size precondition
-	cal, err := ical.NewDecoder(r.Body).Decode()
 	if err != nil {
 		// TODO: send CALDAV:valid-calendar-data error
 		return internal.HTTPErrorf(http.StatusBadRequest, "caldav: failed to parse iCalendar: %v", err)
 	}
 
+	var deliveries []scheduleDelivery
+	if sb, ok := b.scheduleBackend(); ok {
+		if isBoxMember, err := b.isScheduleBoxMember(r.Context(), sb, r.URL.Path); err != nil {
+			return err
+		} else if isBoxMember {
+			return internal.HTTPErrorf(http.StatusForbidden, "caldav: calendar objects can't be stored in the schedule inbox or outbox")
+		}
+
+		old, err := b.getScheduleObject(r.Context(), r.URL.Path)
+		if err != nil {
+			return err
+		}
+		if err := checkPutConditions(old, &opts); err != nil {
+			return err
+		}
+		var oldCal *ical.Calendar
+		if old != nil {
+			oldCal = old.Data
+		}
+		if deliveries, err = b.schedule(r.Context(), sb, oldCal, cal); err != nil {
+			return err
+		}
+	}
+
 	co, err := b.Backend.PutCalendarObject(r.Context(), r.URL.Path, cal, &opts)
 	if err != nil {
 		return err
 	}
 
-	if co.ETag != "" {
+	scheduled := isScheduled(deliveries)
+	b.deliver(r.Context(), cal, deliveries)
+	if scheduled && co.ETag != "" {
+		// Record the results of the deliveries, unless the calendar object
+		// has been modified in the meantime. The request has succeeded
+		// already, so failures are ignored.
+		opts := PutCalendarObjectOptions{IfMatch: webdav.ConditionalMatch(internal.ETag(co.ETag).String())}
+		if updated, err := b.Backend.PutCalendarObject(r.Context(), r.URL.Path, cal, &opts); err == nil {
+			co = updated
+		}
+	}
+
+	// The stored calendar object differs from the request body if
+	// SCHEDULE-STATUS parameters have been added, so the ETag can't be
+	// returned, see RFC 4791 section 5.3.4
+	if co.ETag != "" && !scheduled {
 		w.Header().Set("ETag", internal.ETag(co.ETag).String())
 	}
 	if !co.ModTime.IsZero() {
@@ -706,7 +1235,32 @@ func (b *backend) Put(w http.ResponseWriter, r *http.Request) error {
 }
 
 func (b *backend) Delete(r *http.Request) error {
-	return b.Backend.DeleteCalendarObject(r.Context(), r.URL.Path)
+	sb, ok := b.scheduleBackend()
+	if !ok || b.resourceTypeAtPath(r.URL.Path) != resourceTypeCalendarObject {
+		return b.Backend.DeleteCalendarObject(r.Context(), r.URL.Path)
+	}
+
+	if isBoxMember, err := b.isScheduleBoxMember(r.Context(), sb, r.URL.Path); err != nil {
+		return err
+	} else if isBoxMember {
+		return b.Backend.DeleteCalendarObject(r.Context(), r.URL.Path)
+	}
+
+	old, err := b.getScheduleObject(r.Context(), r.URL.Path)
+	if err != nil {
+		return err
+	}
+	var deliveries []scheduleDelivery
+	if old != nil && old.Data != nil {
+		if deliveries, err = b.schedule(r.Context(), sb, old.Data, nil); err != nil {
+			return err
+		}
+	}
+	if err := b.Backend.DeleteCalendarObject(r.Context(), r.URL.Path); err != nil {
+		return err
+	}
+	b.deliver(r.Context(), nil, deliveries)
+	return nil
 }
 
 func (b *backend) Mkcol(r *http.Request) error {
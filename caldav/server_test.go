@@ -5,12 +5,15 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"net/http/httptest"
+	"path"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/emersion/go-ical"
+	"github.com/emersion/go-webdav"
 )
 
 var propFindSupportedCalendarComponentRequest = `
@@ -177,6 +180,141 @@ func TestMultiCalendarBackend(t *testing.T) {
 	}
 }
 
+var reportExpandProperty = `
+<?xml version="1.0" encoding="UTF-8"?>
+<A:expand-property xmlns:A="DAV:">
+  <A:property name="calendar-home-set" namespace="urn:ietf:params:xml:ns:caldav">
+    <A:property name="resourcetype"/>
+    <A:property name="current-user-principal"/>
+  </A:property>
+  <A:property name="resourcetype"/>
+</A:expand-property>
+`
+
+func TestExpandProperty(t *testing.T) {
+	req := httptest.NewRequest("REPORT", "/user/", strings.NewReader(reportExpandProperty))
+	req.Header.Set("Content-Type", "application/xml")
+	w := httptest.NewRecorder()
+	handler := Handler{Backend: testBackend{}}
+	handler.ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Error(err)
+	}
+	resp := string(data)
+	for _, s := range []string{
+		`<principal xmlns="DAV:"></principal>`,
+		`<calendar-home-set xmlns="urn:ietf:params:xml:ns:caldav"><response xmlns="DAV:"><href>/user/calendars/</href>`,
+		`<current-user-principal xmlns="DAV:"><href>/user/</href></current-user-principal>`,
+	} {
+		if !strings.Contains(resp, s) {
+			t.Errorf("Expected %q in expand-property response:\n%s", s, resp)
+		}
+	}
+}
+
+var reportUnsupportedCollation = `
+<?xml version="1.0" encoding="UTF-8"?>
+<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop>
+    <D:getetag/>
+  </D:prop>
+  <C:filter>
+    <C:comp-filter name="VCALENDAR">
+      <C:comp-filter name="VEVENT">
+        <C:prop-filter name="SUMMARY">
+          <C:text-match collation="i;unknown">meeting</C:text-match>
+        </C:prop-filter>
+      </C:comp-filter>
+    </C:comp-filter>
+  </C:filter>
+</C:calendar-query>
+`
+
+func TestUnsupportedCollation(t *testing.T) {
+	req := httptest.NewRequest("REPORT", "/user/calendars/a", strings.NewReader(reportUnsupportedCollation))
+	req.Header.Set("Content-Type", "application/xml")
+	w := httptest.NewRecorder()
+	handler := Handler{Backend: testBackend{calendars: []Calendar{{Path: "/user/calendars/a"}}}}
+	handler.ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Fatalf("REPORT returned HTTP status %v, want %v", res.StatusCode, http.StatusForbidden)
+	}
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "supported-collation") {
+		t.Errorf("supported-collation precondition not found in response:\n%s", data)
+	}
+}
+
+func TestClient_QueryCalendarIter(t *testing.T) {
+	calendar := Calendar{Path: "/user/calendars/a"}
+	var objects []CalendarObject
+	for i := 0; i < 3; i++ {
+		event := ical.NewEvent()
+		event.Props.SetText(ical.PropUID, fmt.Sprintf("event-%v", i))
+		event.Props.SetDateTime(ical.PropDateTimeStamp, time.Now())
+		cal := ical.NewCalendar()
+		cal.Props.SetText(ical.PropVersion, "2.0")
+		cal.Props.SetText(ical.PropProductID, "-//xyz Corp//NONSGML PDA Calendar Version 1.0//EN")
+		cal.Children = []*ical.Component{event.Component}
+		objects = append(objects, CalendarObject{
+			Path: fmt.Sprintf("%v/event-%v.ics", calendar.Path, i),
+			Data: cal,
+		})
+	}
+
+	handler := Handler{Backend: testBackend{
+		calendars: []Calendar{calendar},
+		objectMap: map[string][]CalendarObject{calendar.Path: objects},
+	}}
+	ts := httptest.NewServer(&handler)
+	defer ts.Close()
+
+	client, err := NewClient(nil, ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := CalendarQuery{
+		CompRequest: CalendarCompRequest{Name: "VCALENDAR", AllProps: true, AllComps: true},
+		CompFilter:  CompFilter{Name: "VCALENDAR"},
+	}
+	it, err := client.QueryCalendarIter(context.Background(), calendar.Path, &query)
+	if err != nil {
+		t.Fatalf("QueryCalendarIter() = %v", err)
+	}
+	defer it.Close()
+
+	var paths []string
+	for it.Next() {
+		co := it.CalendarObject()
+		if co.Data == nil {
+			t.Errorf("calendar object %v has no data", co.Path)
+		}
+		paths = append(paths, co.Path)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("iterator error: %v", err)
+	}
+	if len(paths) != len(objects) {
+		t.Fatalf("got %v calendar objects, want %v", len(paths), len(objects))
+	}
+	for i, p := range paths {
+		if p != objects[i].Path {
+			t.Errorf("calendar object %v: path = %v, want %v", i, p, objects[i].Path)
+		}
+	}
+}
+
 type testBackend struct {
 	calendars []Calendar
 	objectMap map[string][]CalendarObject
@@ -231,5 +369,289 @@ func (t testBackend) ListCalendarObjects(ctx context.Context, path string, req *
 }
 
 func (t testBackend) QueryCalendarObjects(ctx context.Context, path string, query *CalendarQuery) ([]CalendarObject, error) {
+	return t.objectMap[path], nil
+}
+
+type testSyncBackend struct {
+	testBackend
+}
+
+func (t testSyncBackend) CalendarSyncToken(ctx context.Context, path string) (string, error) {
+	return "http://example.org/sync/1", nil
+}
+
+func (t testSyncBackend) SyncCollection(ctx context.Context, path string, query *SyncQuery) (*SyncResponse, error) {
+	objects := t.objectMap[path]
+	switch query.SyncToken {
+	case "":
+		return &SyncResponse{SyncToken: "http://example.org/sync/1", Updated: objects}, nil
+	case "http://example.org/sync/1":
+		resp := &SyncResponse{
+			SyncToken: "http://example.org/sync/2",
+			Updated:   objects[:1],
+			Deleted:   []string{path + "/deleted.ics"},
+		}
+		if query.Limit == 1 {
+			resp.Deleted = nil
+			resp.Truncated = true
+		}
+		return resp, nil
+	}
+	return nil, webdav.ErrInvalidSyncToken
+}
+
+func TestClient_SyncCollection(t *testing.T) {
+	calendar := Calendar{Path: "/user/calendars/a"}
+	var objects []CalendarObject
+	for i := 0; i < 2; i++ {
+		event := ical.NewEvent()
+		event.Props.SetText(ical.PropUID, fmt.Sprintf("event-%v", i))
+		event.Props.SetDateTime(ical.PropDateTimeStamp, time.Now())
+		cal := ical.NewCalendar()
+		cal.Props.SetText(ical.PropVersion, "2.0")
+		cal.Props.SetText(ical.PropProductID, "-//xyz Corp//NONSGML PDA Calendar Version 1.0//EN")
+		cal.Children = []*ical.Component{event.Component}
+		objects = append(objects, CalendarObject{
+			Path: fmt.Sprintf("%v/event-%v.ics", calendar.Path, i),
+			Data: cal,
+		})
+	}
+
+	handler := Handler{Backend: testSyncBackend{testBackend{
+		calendars: []Calendar{calendar},
+		objectMap: map[string][]CalendarObject{calendar.Path: objects},
+	}}}
+	ts := httptest.NewServer(&handler)
+	defer ts.Close()
+
+	client, err := NewClient(nil, ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	compReq := CalendarCompRequest{Name: "VCALENDAR", AllProps: true, AllComps: true}
+
+	resp, err := client.SyncCollection(ctx, calendar.Path, &SyncQuery{CompRequest: compReq})
+	if err != nil {
+		t.Fatalf("SyncCollection() = %v", err)
+	}
+	if resp.SyncToken != "http://example.org/sync/1" || len(resp.Updated) != 2 || len(resp.Deleted) != 0 {
+		t.Errorf("initial SyncCollection() = %+v", resp)
+	}
+	for _, co := range resp.Updated {
+		if co.Data == nil {
+			t.Errorf("calendar object %v has no data", co.Path)
+		}
+	}
+
+	resp, err = client.SyncCollection(ctx, calendar.Path, &SyncQuery{CompRequest: compReq, SyncToken: "http://example.org/sync/1"})
+	if err != nil {
+		t.Fatalf("SyncCollection() = %v", err)
+	}
+	if resp.SyncToken != "http://example.org/sync/2" || len(resp.Updated) != 1 || len(resp.Deleted) != 1 || resp.Deleted[0] != calendar.Path+"/deleted.ics" {
+		t.Errorf("incremental SyncCollection() = %+v", resp)
+	}
+
+	resp, err = client.SyncCollection(ctx, calendar.Path, &SyncQuery{SyncToken: "http://example.org/sync/1", Limit: 1})
+	if err != nil {
+		t.Fatalf("SyncCollection() = %v", err)
+	}
+	if !resp.Truncated || len(resp.Updated) != 1 {
+		t.Errorf("truncated SyncCollection() = %+v", resp)
+	}
+
+	if _, err := client.SyncCollection(ctx, calendar.Path, &SyncQuery{SyncToken: "http://example.org/sync/invalid"}); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("SyncCollection() with invalid token = %v, want 403 error", err)
+	}
+
+	req := httptest.NewRequest("PROPFIND", calendar.Path, strings.NewReader(`<d:propfind xmlns:d="DAV:"><d:prop><d:sync-token/></d:prop></d:propfind>`))
+	req.Header.Set("Content-Type", "application/xml")
+	req.Header.Set("Depth", "0")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), "<sync-token xmlns=\"DAV:\">http://example.org/sync/1</sync-token>") {
+		t.Errorf("PROPFIND response doesn't contain the sync token:\n%v", w.Body.String())
+	}
+}
+
+func TestClient_QueryFreeBusy(t *testing.T) {
+	cal, err := ical.NewDecoder(strings.NewReader(freeBusyTestData)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	calendar := Calendar{Path: "/user/calendars/a"}
+	handler := Handler{Backend: testBackend{
+		calendars: []Calendar{calendar},
+		objectMap: map[string][]CalendarObject{
+			calendar.Path: {{Path: calendar.Path + "/events.ics", Data: cal}},
+		},
+	}}
+	ts := httptest.NewServer(&handler)
+	defer ts.Close()
+
+	client, err := NewClient(nil, ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := FreeBusyQuery{
+		Start: toDate(t, "20060102T000000Z"),
+		End:   toDate(t, "20060103T000000Z"),
+	}
+	fb, err := client.QueryFreeBusy(context.Background(), calendar.Path, &query)
+	if err != nil {
+		t.Fatalf("QueryFreeBusy() = %v", err)
+	}
+	if !fb.Start.Equal(query.Start) || !fb.End.Equal(query.End) {
+		t.Errorf("QueryFreeBusy() range = %v-%v, want %v-%v", fb.Start, fb.End, query.Start, query.End)
+	}
+	if len(fb.Periods) != 3 {
+		t.Fatalf("QueryFreeBusy() returned %v periods, want 3: %v", len(fb.Periods), fb.Periods)
+	}
+	want := FreeBusyPeriod{toDate(t, "20060102T160000Z"), toDate(t, "20060102T170000Z"), FreeBusyBusyTentative}
+	if p := fb.Periods[2]; !p.Start.Equal(want.Start) || !p.End.Equal(want.End) || p.Type != want.Type {
+		t.Errorf("QueryFreeBusy() period = %v, want %v", p, want)
+	}
+}
+
+// testAuthorizer grants privileges per path. Paths without an entry inherit
+// the privileges of their parent.
+type testAuthorizer struct {
+	privileges map[string][]webdav.Privilege
+}
+
+func (a testAuthorizer) CurrentUserPrivileges(ctx context.Context, name string) ([]webdav.Privilege, error) {
+	name = path.Clean(name)
+	for {
+		if privs, ok := a.privileges[name]; ok {
+			return privs, nil
+		}
+		if name == "/" {
+			return nil, nil
+		}
+		name = path.Dir(name)
+	}
+}
+
+func (a testAuthorizer) ACL(ctx context.Context, name string) ([]webdav.ACE, error) {
 	return nil, nil
 }
+
+func (a testAuthorizer) SetACL(ctx context.Context, name string, aces []webdav.ACE) error {
+	return webdav.NewHTTPError(http.StatusForbidden, fmt.Errorf("read-only ACL"))
+}
+
+const reportMultigetTwo = `<?xml version="1.0" encoding="UTF-8"?>
+<C:calendar-multiget xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop>
+    <C:calendar-data/>
+  </D:prop>
+  <D:href>/user/calendars/a/public.ics</D:href>
+  <D:href>/user/calendars/a/private.ics</D:href>
+</C:calendar-multiget>`
+
+const reportQueryAll = `<?xml version="1.0" encoding="UTF-8"?>
+<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop>
+    <C:calendar-data/>
+  </D:prop>
+  <C:filter>
+    <C:comp-filter name="VCALENDAR"/>
+  </C:filter>
+</C:calendar-query>`
+
+const reportFreeBusy = `<?xml version="1.0" encoding="UTF-8"?>
+<C:free-busy-query xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <C:time-range start="20060102T000000Z" end="20060103T000000Z"/>
+</C:free-busy-query>`
+
+func TestHandler_authorization(t *testing.T) {
+	cal, err := ical.NewDecoder(strings.NewReader(freeBusyTestData)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	calendarA := Calendar{Path: "/user/calendars/a"}
+	calendarB := Calendar{Path: "/user/calendars/b"}
+	handler := Handler{
+		Backend: testBackend{
+			calendars: []Calendar{calendarA, calendarB},
+			objectMap: map[string][]CalendarObject{
+				calendarA.Path: {
+					{Path: calendarA.Path + "/public.ics", Data: cal},
+					{Path: calendarA.Path + "/private.ics", Data: cal},
+				},
+				calendarB.Path: {{Path: calendarB.Path + "/events.ics", Data: cal}},
+			},
+		},
+		Authorizer: testAuthorizer{privileges: map[string][]webdav.Privilege{
+			"/":                             {webdav.PrivilegeRead},
+			"/user/calendars/a/private.ics": nil,
+			"/user/calendars/b":             {PrivilegeReadFreeBusy},
+		}},
+	}
+
+	report := func(target, body string) (int, string) {
+		req := httptest.NewRequest("REPORT", target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/xml")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+
+	for _, body := range []string{reportMultigetTwo, reportQueryAll} {
+		code, resp := report(calendarA.Path, body)
+		if code != http.StatusMultiStatus {
+			t.Fatalf("REPORT = %v, want %v:\n%v", code, http.StatusMultiStatus, resp)
+		}
+		if !strings.Contains(resp, "public.ics</href><propstat") {
+			t.Errorf("REPORT is missing the readable calendar object:\n%v", resp)
+		}
+		if !strings.Contains(resp, "<status>HTTP/1.1 403 Forbidden</status>") || !strings.Contains(resp, "need-privileges") {
+			t.Errorf("REPORT didn't deny the unreadable calendar object:\n%v", resp)
+		}
+		if n := strings.Count(resp, "BEGIN:VCALENDAR"); n != 1 {
+			t.Errorf("REPORT returned %v calendar objects, want 1:\n%v", n, resp)
+		}
+	}
+
+	if code, resp := report(calendarB.Path, reportQueryAll); code != http.StatusForbidden {
+		t.Errorf("calendar-query with read-free-busy only = %v, want %v:\n%v", code, http.StatusForbidden, resp)
+	}
+	if code, resp := report(calendarB.Path, reportFreeBusy); code != http.StatusOK {
+		t.Errorf("free-busy-query with read-free-busy = %v, want %v:\n%v", code, http.StatusOK, resp)
+	}
+	if code, resp := report(calendarA.Path+"/private.ics", reportFreeBusy); code != http.StatusForbidden {
+		t.Errorf("free-busy-query without privileges = %v, want %v:\n%v", code, http.StatusForbidden, resp)
+	}
+}
+
+func TestHandler_if(t *testing.T) {
+	calendar := Calendar{Path: "/user/calendars/a"}
+	handler := Handler{Backend: testBackend{
+		calendars: []Calendar{calendar},
+		objectMap: map[string][]CalendarObject{
+			calendar.Path: {{Path: calendar.Path + "/event.ics", ETag: "abc"}},
+		},
+	}}
+
+	del := func(ifHeader string) int {
+		req := httptest.NewRequest(http.MethodDelete, calendar.Path+"/event.ics", nil)
+		req.Header.Set("If", ifHeader)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := del(`(["xyz"])`); code != http.StatusPreconditionFailed {
+		t.Errorf("DELETE with a mismatched ETag = %v, want %v", code, http.StatusPreconditionFailed)
+	}
+	if code := del(`(<urn:uuid:181d4fae-7d8c-11d0-a765-00a0c91e6bf2>)`); code != http.StatusPreconditionFailed {
+		t.Errorf("DELETE with an unknown lock token = %v, want %v", code, http.StatusPreconditionFailed)
+	}
+	if code := del(`(["abc"])`); code/100 != 2 {
+		t.Errorf("DELETE with a matching ETag = %v, want 2xx", code)
+	}
+	if code := del(`(Not <urn:uuid:181d4fae-7d8c-11d0-a765-00a0c91e6bf2>)`); code/100 != 2 {
+		t.Errorf("DELETE with a negated lock token = %v, want 2xx", code)
+	}
+}
@@ -0,0 +1,432 @@
+package caldav
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+// See https://datatracker.ietf.org/doc/html/rfc4791#section-9.9
+//
+// Floating date-times and dates are interpreted in the time zone of the
+// query. Recurring components match if any of their instances matches.
+
+// timeRangeFilter is the time range of a comp-filter or prop-filter. Zero
+// start and end times mean that the time range is unbounded.
+type timeRangeFilter struct {
+	start, end time.Time
+}
+
+// startsBefore returns true if start < t.
+func (tr timeRangeFilter) startsBefore(t time.Time) bool {
+	return tr.start.IsZero() || tr.start.Before(t)
+}
+
+// startsBeforeOrAt returns true if start <= t.
+func (tr timeRangeFilter) startsBeforeOrAt(t time.Time) bool {
+	return tr.start.IsZero() || !tr.start.After(t)
+}
+
+// endsAfter returns true if end > t.
+func (tr timeRangeFilter) endsAfter(t time.Time) bool {
+	return tr.end.IsZero() || tr.end.After(t)
+}
+
+// endsAfterOrAt returns true if end >= t.
+func (tr timeRangeFilter) endsAfterOrAt(t time.Time) bool {
+	return tr.end.IsZero() || !tr.end.Before(t)
+}
+
+// timeRangeContext describes the calendar object evaluated against time
+// ranges.
+type timeRangeContext struct {
+	// loc is used to interpret floating date-times and dates
+	loc *time.Location
+	// overridden lists the instances overridden by a component with a
+	// RECURRENCE-ID
+	overridden map[recurrenceInstance]bool
+}
+
+func newTimeRangeContext(cal *ical.Calendar, loc *time.Location) (*timeRangeContext, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	overridden, err := overriddenInstances(cal, loc)
+	if err != nil {
+		return nil, err
+	}
+	return &timeRangeContext{loc: loc, overridden: overridden}, nil
+}
+
+// matchCompTimeRange evaluates a time range against a component. VALARM
+// components are evaluated against the instances of their parent: the alarms
+// of overridden instances are the ones of the overriding component.
+func matchCompTimeRange(tr timeRangeFilter, comp, parent *ical.Component, tc *timeRangeContext) (bool, error) {
+	switch comp.Name {
+	case ical.CompEvent, ical.CompToDo, ical.CompJournal:
+		return matchInstances(tr, comp, tc, func(offset time.Duration) (bool, error) {
+			return matchInstanceTimeRange(tr, comp, offset, tc.loc)
+		})
+	case ical.CompFreeBusy:
+		return matchFreeBusyTimeRange(tr, comp, tc.loc)
+	case ical.CompAlarm:
+		if parent == nil {
+			return false, nil
+		}
+		return matchInstances(tr, parent, tc, func(offset time.Duration) (bool, error) {
+			return matchAlarmTimeRange(tr, comp, parent, offset, tc.loc)
+		})
+	}
+	return false, nil
+}
+
+// matchInstances calls f with the offset from DTSTART of each instance of a
+// component which may overlap the time range, until f returns true.
+// Instances overridden by another component are skipped.
+func matchInstances(tr timeRangeFilter, comp *ical.Component, tc *timeRangeContext, f func(offset time.Duration) (bool, error)) (bool, error) {
+	if comp.Props.Get(ical.PropRecurrenceID) != nil || comp.Props.Get(ical.PropDateTimeStart) == nil {
+		return f(0)
+	}
+	rset, err := comp.RecurrenceSet(tc.loc)
+	if err != nil {
+		return false, err
+	} else if rset == nil {
+		return f(0)
+	}
+
+	uid, err := comp.Props.Text(ical.PropUID)
+	if err != nil {
+		return false, err
+	}
+	margin, err := instanceMargin(comp, tc.loc)
+	if err != nil {
+		return false, err
+	}
+
+	dtstart := rset.GetDTStart()
+	check := func(t time.Time) (bool, error) {
+		if tc.overridden[recurrenceInstance{comp.Name, uid, t.Unix()}] {
+			return false, nil
+		}
+		return f(t.Sub(dtstart))
+	}
+
+	if !tr.end.IsZero() {
+		for _, t := range rset.Between(tr.start.Add(-margin), tr.end.Add(margin), true) {
+			if ok, err := check(t); err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	}
+
+	for t := rset.After(tr.start.Add(-margin), true); !t.IsZero(); t = rset.After(t, false) {
+		if ok, err := check(t); err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+// instanceMargin returns a duration such that the times evaluated for an
+// instance of a component are within the margin of the instance start time.
+func instanceMargin(comp *ical.Component, loc *time.Location) (time.Duration, error) {
+	start, end, err := componentTimeRange(comp, loc)
+	if err != nil {
+		return 0, err
+	}
+	margin := end.Sub(start)
+
+	for _, child := range comp.Children {
+		if child.Name != ical.CompAlarm {
+			continue
+		}
+		times, err := alarmTimes(child, comp, 0, loc)
+		if err != nil {
+			return 0, err
+		}
+		for _, t := range times {
+			d := t.Sub(start)
+			if d < 0 {
+				d = -d
+			}
+			if d > margin {
+				margin = d
+			}
+		}
+	}
+
+	// Leave room for all-day values
+	return margin + 24*time.Hour, nil
+}
+
+// propDateTime parses a date-time property of a component, shifted by
+// offset. ok is false if the property is missing.
+func propDateTime(comp *ical.Component, name string, offset time.Duration, loc *time.Location) (t time.Time, ok bool, err error) {
+	prop := comp.Props.Get(name)
+	if prop == nil {
+		return time.Time{}, false, nil
+	}
+	t, err = prop.DateTime(loc)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return t.Add(offset), true, nil
+}
+
+func matchInstanceTimeRange(tr timeRangeFilter, comp *ical.Component, offset time.Duration, loc *time.Location) (bool, error) {
+	start, hasStart, err := propDateTime(comp, ical.PropDateTimeStart, offset, loc)
+	if err != nil {
+		return false, err
+	}
+
+	var dur time.Duration
+	durProp := comp.Props.Get(ical.PropDuration)
+	if durProp != nil {
+		dur, err = durProp.Duration()
+		if err != nil {
+			return false, err
+		}
+	}
+
+	switch comp.Name {
+	case ical.CompEvent:
+		if !hasStart {
+			return false, nil
+		}
+		end, hasEnd, err := propDateTime(comp, ical.PropDateTimeEnd, offset, loc)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case hasEnd:
+			return tr.startsBefore(end) && tr.endsAfter(start), nil
+		case durProp != nil && dur > 0:
+			return tr.startsBefore(start.Add(dur)) && tr.endsAfter(start), nil
+		case durProp != nil:
+			return tr.startsBeforeOrAt(start) && tr.endsAfter(start), nil
+		case isDateProp(comp.Props.Get(ical.PropDateTimeStart)):
+			return tr.startsBefore(start.Add(24*time.Hour)) && tr.endsAfter(start), nil
+		default:
+			return tr.startsBeforeOrAt(start) && tr.endsAfter(start), nil
+		}
+	case ical.CompToDo:
+		due, hasDue, err := propDateTime(comp, ical.PropDue, offset, loc)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case hasStart && durProp != nil:
+			end := start.Add(dur)
+			return tr.startsBeforeOrAt(end) && (tr.endsAfter(start) || tr.endsAfterOrAt(end)), nil
+		case hasStart && hasDue:
+			return (tr.startsBefore(due) || tr.startsBeforeOrAt(start)) && (tr.endsAfter(start) || tr.endsAfterOrAt(due)), nil
+		case hasStart:
+			return tr.startsBeforeOrAt(start) && tr.endsAfter(start), nil
+		case hasDue:
+			return tr.startsBefore(due) && tr.endsAfterOrAt(due), nil
+		}
+
+		completed, hasCompleted, err := propDateTime(comp, ical.PropCompleted, 0, loc)
+		if err != nil {
+			return false, err
+		}
+		created, hasCreated, err := propDateTime(comp, ical.PropCreated, 0, loc)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case hasCompleted && hasCreated:
+			return (tr.startsBeforeOrAt(created) || tr.startsBeforeOrAt(completed)) && (tr.endsAfterOrAt(created) || tr.endsAfterOrAt(completed)), nil
+		case hasCompleted:
+			return tr.startsBeforeOrAt(completed) && tr.endsAfterOrAt(completed), nil
+		case hasCreated:
+			return tr.endsAfter(created), nil
+		default:
+			return true, nil
+		}
+	case ical.CompJournal:
+		if !hasStart {
+			return false, nil
+		} else if isDateProp(comp.Props.Get(ical.PropDateTimeStart)) {
+			return tr.startsBefore(start.Add(24*time.Hour)) && tr.endsAfter(start), nil
+		}
+		return tr.startsBeforeOrAt(start) && tr.endsAfter(start), nil
+	}
+	return false, nil
+}
+
+func matchFreeBusyTimeRange(tr timeRangeFilter, comp *ical.Component, loc *time.Location) (bool, error) {
+	start, hasStart, err := propDateTime(comp, ical.PropDateTimeStart, 0, loc)
+	if err != nil {
+		return false, err
+	}
+	end, hasEnd, err := propDateTime(comp, ical.PropDateTimeEnd, 0, loc)
+	if err != nil {
+		return false, err
+	}
+	if hasStart && hasEnd {
+		return tr.startsBeforeOrAt(end) && tr.endsAfter(start), nil
+	}
+
+	for _, prop := range comp.Props.Values(ical.PropFreeBusy) {
+		for _, s := range strings.Split(prop.Value, ",") {
+			periodStart, periodEnd, err := parsePeriod(s)
+			if err != nil {
+				return false, err
+			}
+			if tr.startsBefore(periodEnd) && tr.endsAfter(periodStart) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func matchAlarmTimeRange(tr timeRangeFilter, alarm, parent *ical.Component, offset time.Duration, loc *time.Location) (bool, error) {
+	times, err := alarmTimes(alarm, parent, offset, loc)
+	if err != nil {
+		return false, err
+	}
+	for _, t := range times {
+		if tr.startsBeforeOrAt(t) && tr.endsAfter(t) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// alarmTimes returns the times at which an alarm is triggered, including
+// repetitions, for the instance of its parent starting at offset from
+// DTSTART.
+func alarmTimes(alarm, parent *ical.Component, offset time.Duration, loc *time.Location) ([]time.Time, error) {
+	trigger := alarm.Props.Get(ical.PropTrigger)
+	if trigger == nil {
+		return nil, nil
+	}
+
+	var t time.Time
+	if trigger.ValueType() == ical.ValueDateTime {
+		var err error
+		t, err = trigger.DateTime(loc)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		d, err := trigger.Duration()
+		if err != nil {
+			return nil, err
+		}
+		start, end, err := componentTimeRange(parent, loc)
+		if err != nil {
+			return nil, err
+		}
+		related := start
+		if strings.EqualFold(trigger.Params.Get(ical.ParamRelated), "END") {
+			related = end
+		}
+		if related.IsZero() {
+			return nil, nil
+		}
+		t = related.Add(offset + d)
+	}
+
+	times := []time.Time{t}
+	repeatProp, durProp := alarm.Props.Get(ical.PropRepeat), alarm.Props.Get(ical.PropDuration)
+	if repeatProp != nil && durProp != nil {
+		repeat, err := repeatProp.Int()
+		if err != nil {
+			return nil, err
+		}
+		dur, err := durProp.Duration()
+		if err != nil {
+			return nil, err
+		}
+		for i := 1; i <= repeat; i++ {
+			times = append(times, t.Add(time.Duration(i)*dur))
+		}
+	}
+	return times, nil
+}
+
+func matchPropTimeRange(tr timeRangeFilter, prop *ical.Prop, loc *time.Location) (bool, error) {
+	t, err := prop.DateTime(loc)
+	if err != nil {
+		return false, err
+	}
+	if isDateProp(prop) {
+		return tr.startsBefore(t.Add(24*time.Hour)) && tr.endsAfter(t), nil
+	}
+	return tr.startsBeforeOrAt(t) && tr.endsAfter(t), nil
+}
+
+// parseTimezone parses an iCalendar object containing a VTIMEZONE component,
+// as used by the CALDAV:calendar-timezone property and the CALDAV:timezone
+// element. Time zones are looked up by TZID. Unknown time zones fall back to
+// the offset of their standard time.
+func parseTimezone(data string) (*time.Location, error) {
+	cal, err := ical.NewDecoder(strings.NewReader(data)).Decode()
+	if err != nil {
+		return nil, err
+	}
+	for _, child := range cal.Children {
+		if child.Name != ical.CompTimezone {
+			continue
+		}
+
+		tzid, err := child.Props.Text(ical.PropTimezoneID)
+		if err != nil {
+			return nil, err
+		} else if tzid == "" {
+			return nil, fmt.Errorf("missing TZID")
+		}
+		if loc, err := time.LoadLocation(tzid); err == nil {
+			return loc, nil
+		}
+
+		for _, name := range []string{ical.CompTimezoneStandard, ical.CompTimezoneDaylight} {
+			for _, obs := range child.Children {
+				if obs.Name != name {
+					continue
+				}
+				offset := obs.Props.Get(ical.PropTimezoneOffsetTo)
+				if offset == nil {
+					return nil, fmt.Errorf("missing TZOFFSETTO")
+				}
+				secs, err := parseUTCOffset(offset.Value)
+				if err != nil {
+					return nil, err
+				}
+				return time.FixedZone(tzid, secs), nil
+			}
+		}
+		return nil, fmt.Errorf("unknown time zone %q", tzid)
+	}
+	return nil, fmt.Errorf("missing VTIMEZONE component")
+}
+
+// parseUTCOffset parses a UTC offset value, as defined in RFC 5545 section
+// 3.3.14, and returns it in seconds.
+func parseUTCOffset(s string) (int, error) {
+	if (len(s) != len("+0000") && len(s) != len("+000000")) || (s[0] != '+' && s[0] != '-') {
+		return 0, fmt.Errorf("malformed UTC offset %q", s)
+	}
+	var secs int
+	for i, mul := range []int{3600, 60, 1} {
+		if 1+2*i >= len(s) {
+			break
+		}
+		v, err := strconv.Atoi(s[1+2*i : 3+2*i])
+		if err != nil {
+			return 0, fmt.Errorf("malformed UTC offset %q", s)
+		}
+		secs += v * mul
+	}
+	if s[0] == '-' {
+		secs = -secs
+	}
+	return secs, nil
+}
@@ -22,6 +22,15 @@ type AddressDataType struct {
 	Version     string
 }
 
+// defaultSupportedAddressData lists the address data types supported by
+// address books which don't specify any, i.e. the types the server can
+// convert between.
+var defaultSupportedAddressData = []AddressDataType{
+	{ContentType: vcard.MIMEType, Version: "3.0"},
+	{ContentType: vcard.MIMEType, Version: "4.0"},
+	{ContentType: JCardMIMEType, Version: "4.0"},
+}
+
 type AddressBook struct {
 	Path                 string
 	Name                 string
@@ -33,11 +42,16 @@ type AddressBook struct {
 	ReadOnly bool
 }
 
+// SupportsAddressData returns true if the address book can store address data
+// of the provided type. If SupportedAddressData is empty, vCard 3.0 and 4.0
+// and jCard are supported.
+//
+// SupportedAddressData only restricts the types stored by the backend: the
+// server converts cards in other vCard versions before storing them, and
+// advertises all the types it can convert to in the
+// CARDDAV:supported-address-data property.
 func (ab *AddressBook) SupportsAddressData(contentType, version string) bool {
-	if len(ab.SupportedAddressData) == 0 {
-		return contentType == "text/vcard" && version == "3.0"
-	}
-	for _, t := range ab.SupportedAddressData {
+	for _, t := range ab.supportedAddressData() {
 		if t.ContentType == contentType && t.Version == version {
 			return true
 		}
@@ -45,6 +59,24 @@ func (ab *AddressBook) SupportsAddressData(contentType, version string) bool {
 	return false
 }
 
+func (ab *AddressBook) supportedAddressData() []AddressDataType {
+	if len(ab.SupportedAddressData) == 0 {
+		return defaultSupportedAddressData
+	}
+	return ab.SupportedAddressData
+}
+
+// storageVersion returns the vCard version cards are converted to before being
+// stored, when the version they have been sent in isn't supported.
+func (ab *AddressBook) storageVersion() (string, bool) {
+	for _, t := range ab.supportedAddressData() {
+		if isSupportedVersion(t.Version) {
+			return t.Version, true
+		}
+	}
+	return "", false
+}
+
 type AddressBookQuery struct {
 	DataRequest AddressDataRequest
 
@@ -57,6 +89,12 @@ type AddressBookQuery struct {
 type AddressDataRequest struct {
 	Props   []string
 	AllProp bool
+
+	// ContentType and Version select the media type and version of the
+	// returned address data, either "text/vcard" or JCardMIMEType. If
+	// Version is empty, address data is returned as stored.
+	ContentType string // defaults to "text/vcard"
+	Version     string
 }
 
 type PropFilter struct {
@@ -81,6 +119,7 @@ type TextMatch struct {
 	Text            string
 	NegateCondition bool
 	MatchType       MatchType // defaults to MatchContains
+	Collation       string    // defaults to "i;ascii-casemap"
 }
 
 type FilterTest string
@@ -124,4 +163,7 @@ type SyncResponse struct {
 	SyncToken string
 	Updated   []AddressObject
 	Deleted   []string
+	// Truncated is set if more changes than SyncQuery.Limit are available.
+	// SyncToken can then be used to fetch the remaining changes.
+	Truncated bool
 }
@@ -3,6 +3,7 @@ package carddav
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -145,7 +146,7 @@ func TestAddressBookDiscovery(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			ctx := context.Background()
 
-			h := Handler{&testBackend{}, tc.prefix}
+			h := Handler{Backend: &testBackend{}, Prefix: tc.prefix}
 			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				ctx := r.Context()
 				ctx = context.WithValue(ctx, currentUserPrincipalKey, tc.currentUserPrincipal)
@@ -240,3 +241,301 @@ func TestCreateAddressbookMinimalBody(t *testing.T) {
 		t.Fatalf("Address book sdscription is '%s', expected 'My primary address book.'", c.Description)
 	}
 }
+
+type testSyncBackend struct {
+	*testBackend
+}
+
+func (testSyncBackend) AddressBookSyncToken(ctx context.Context, path string) (string, error) {
+	return "http://example.org/sync/1", nil
+}
+
+func (b testSyncBackend) SyncCollection(ctx context.Context, path string, query *SyncQuery) (*SyncResponse, error) {
+	alice, err := b.GetAddressObject(ctx, alicePath, &query.DataRequest)
+	if err != nil {
+		return nil, err
+	}
+	alice.Path = path + "/alice.vcf"
+
+	switch query.SyncToken {
+	case "":
+		return &SyncResponse{SyncToken: "http://example.org/sync/1", Updated: []AddressObject{*alice}}, nil
+	case "http://example.org/sync/1":
+		resp := &SyncResponse{
+			SyncToken: "http://example.org/sync/2",
+			Updated:   []AddressObject{*alice},
+			Deleted:   []string{path + "/bob.vcf"},
+		}
+		if query.Limit == 1 {
+			resp.Deleted = nil
+			resp.Truncated = true
+		}
+		return resp, nil
+	}
+	return nil, webdav.ErrInvalidSyncToken
+}
+
+func TestSyncCollection(t *testing.T) {
+	const addressBookPath = "/test/contacts/private"
+
+	h := Handler{Backend: testSyncBackend{&testBackend{}}}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		ctx = context.WithValue(ctx, currentUserPrincipalKey, "/test/")
+		ctx = context.WithValue(ctx, homeSetPathKey, "/test/contacts/")
+		ctx = context.WithValue(ctx, addressBookPathKey, addressBookPath)
+		r = r.WithContext(ctx)
+		(&h).ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	report := `<?xml version="1.0" encoding="utf-8" ?>
+<D:sync-collection xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:carddav">
+  <D:sync-token/>
+  <D:sync-level>1</D:sync-level>
+  <D:prop>
+    <D:getetag/>
+    <C:address-data><C:prop name="FN"/></C:address-data>
+  </D:prop>
+</D:sync-collection>`
+	req, err := http.NewRequest("REPORT", ts.URL+addressBookPath, strings.NewReader(report))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/xml")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sb strings.Builder
+	if _, err := io.Copy(&sb, resp.Body); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	body := sb.String()
+	if resp.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("REPORT = %v, want %v: %v", resp.StatusCode, http.StatusMultiStatus, body)
+	}
+	for _, s := range []string{addressBookPath + "/alice.vcf", "FN;PID=1.1:Alice Gopher", "VERSION:4.0", "http://example.org/sync/1"} {
+		if !strings.Contains(body, s) {
+			t.Errorf("REPORT response doesn't contain %q: %v", s, body)
+		}
+	}
+	if strings.Contains(body, "EMAIL") {
+		t.Errorf("REPORT response contains unrequested vCard properties: %v", body)
+	}
+
+	ctx := context.Background()
+	client, err := NewClient(nil, ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ret, err := client.SyncCollection(ctx, addressBookPath, &SyncQuery{SyncToken: "http://example.org/sync/1"})
+	if err != nil {
+		t.Fatalf("SyncCollection() = %v", err)
+	}
+	if ret.SyncToken != "http://example.org/sync/2" || len(ret.Updated) != 1 || len(ret.Deleted) != 1 || ret.Deleted[0] != addressBookPath+"/bob.vcf" || ret.Truncated {
+		t.Errorf("SyncCollection() = %+v", ret)
+	}
+
+	ret, err = client.SyncCollection(ctx, addressBookPath, &SyncQuery{SyncToken: "http://example.org/sync/1", Limit: 1})
+	if err != nil {
+		t.Fatalf("SyncCollection() = %v", err)
+	}
+	if !ret.Truncated || len(ret.Updated) != 1 || len(ret.Deleted) != 0 {
+		t.Errorf("truncated SyncCollection() = %+v", ret)
+	}
+
+	if _, err := client.SyncCollection(ctx, addressBookPath, &SyncQuery{SyncToken: "http://example.org/sync/invalid"}); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("SyncCollection() with invalid token = %v, want 403 error", err)
+	}
+
+	if _, err := client.SyncCollection(ctx, "/test/contacts/", &SyncQuery{}); err == nil {
+		t.Errorf("SyncCollection() on the home set succeeded")
+	}
+}
+
+// testVersionBackend serves Alice's card at any path.
+type testVersionBackend struct {
+	*testBackend
+}
+
+func (b testVersionBackend) GetAddressObject(ctx context.Context, path string, req *AddressDataRequest) (*AddressObject, error) {
+	ao, err := b.testBackend.GetAddressObject(ctx, alicePath, req)
+	if err != nil {
+		return nil, err
+	}
+	ao.Path = path
+	return ao, nil
+}
+
+func (testVersionBackend) PutAddressObject(ctx context.Context, path string, card vcard.Card, opts *PutAddressObjectOptions) (*AddressObject, error) {
+	return &AddressObject{Path: path, Card: card}, nil
+}
+
+func TestAddressDataVersion(t *testing.T) {
+	const addressBookPath = "/test/contacts/private"
+	const objectPath = addressBookPath + "/alice.vcf"
+
+	h := Handler{Backend: testVersionBackend{&testBackend{}}}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		ctx = context.WithValue(ctx, currentUserPrincipalKey, "/test/")
+		ctx = context.WithValue(ctx, homeSetPathKey, "/test/contacts/")
+		ctx = context.WithValue(ctx, addressBookPathKey, addressBookPath)
+		r = r.WithContext(ctx)
+		(&h).ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	get := func(accept string) (*http.Response, string) {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+objectPath, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var sb strings.Builder
+		if _, err := io.Copy(&sb, resp.Body); err != nil {
+			t.Fatal(err)
+		}
+		return resp, sb.String()
+	}
+
+	resp, body := get("")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "VERSION:4.0") {
+		t.Errorf("GET without Accept = %v: %v", resp.StatusCode, body)
+	}
+	resp, body = get("text/vcard; version=3.0, text/vcard; version=4.0; q=0.5")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "VERSION:3.0") || strings.Contains(body, "CLIENTPIDMAP") {
+		t.Errorf("GET with vCard 3.0 Accept = %v: %v", resp.StatusCode, body)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/vcard; version=3.0" {
+		t.Errorf("GET with vCard 3.0 Accept returned Content-Type %q", ct)
+	}
+	resp, body = get("text/vcard; q=0, */*")
+	if ct := resp.Header.Get("Content-Type"); resp.StatusCode != http.StatusOK || !strings.HasPrefix(ct, JCardMIMEType) {
+		t.Errorf("GET with text/vcard excluded = %v: %v: %v", resp.StatusCode, ct, body)
+	}
+	resp, body = get("text/vcard; version=2.1")
+	if resp.StatusCode != http.StatusNotAcceptable || !strings.Contains(body, "supported-address-data") {
+		t.Errorf("GET with vCard 2.1 Accept = %v: %v", resp.StatusCode, body)
+	}
+
+	ctx := context.Background()
+	client, err := NewClient(nil, ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aos, err := client.MultiGetAddressBook(ctx, addressBookPath, &AddressBookMultiGet{
+		Paths:       []string{objectPath},
+		DataRequest: AddressDataRequest{AllProp: true, Version: "3.0"},
+	})
+	if err != nil {
+		t.Fatalf("MultiGetAddressBook() = %v", err)
+	}
+	if len(aos) != 1 || aos[0].Card.Value(vcard.FieldVersion) != "3.0" {
+		t.Errorf("MultiGetAddressBook() = %+v, want a vCard 3.0 address object", aos)
+	}
+
+	_, err = client.MultiGetAddressBook(ctx, addressBookPath, &AddressBookMultiGet{
+		Paths:       []string{objectPath},
+		DataRequest: AddressDataRequest{AllProp: true, Version: "2.1"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("MultiGetAddressBook() with vCard 2.1 = %v, want 403 error", err)
+	}
+
+	card, err := vcard.NewDecoder(strings.NewReader(v3CardData)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.PutAddressObject(ctx, addressBookPath+"/dave.vcf", card); err != nil {
+		t.Errorf("PutAddressObject() with vCard 3.0 = %v", err)
+	}
+	card.SetValue(vcard.FieldVersion, "2.1")
+	if _, err := client.PutAddressObject(ctx, addressBookPath+"/dave.vcf", card); err == nil || !strings.Contains(err.Error(), "409") {
+		t.Errorf("PutAddressObject() with vCard 2.1 = %v, want 409 error", err)
+	}
+}
+
+// testV4Backend stores vCard 4.0 only, and records the last stored card.
+type testV4Backend struct {
+	testVersionBackend
+	stored *vcard.Card
+}
+
+func (b testV4Backend) ListAddressBooks(ctx context.Context) ([]AddressBook, error) {
+	abs, err := b.testBackend.ListAddressBooks(ctx)
+	for i := range abs {
+		abs[i].SupportedAddressData = []AddressDataType{{ContentType: vcard.MIMEType, Version: "4.0"}}
+	}
+	return abs, err
+}
+
+func (b testV4Backend) GetAddressBook(ctx context.Context, path string) (*AddressBook, error) {
+	abs, err := b.ListAddressBooks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, ab := range abs {
+		if ab.Path == path {
+			return &ab, nil
+		}
+	}
+	return nil, webdav.NewHTTPError(404, fmt.Errorf("Not found"))
+}
+
+func (b testV4Backend) PutAddressObject(ctx context.Context, path string, card vcard.Card, opts *PutAddressObjectOptions) (*AddressObject, error) {
+	*b.stored = card
+	return &AddressObject{Path: path, Card: card}, nil
+}
+
+func TestAddressDataConversion(t *testing.T) {
+	const addressBookPath = "/test/contacts/private"
+
+	var stored vcard.Card
+	h := Handler{Backend: testV4Backend{testVersionBackend{&testBackend{}}, &stored}}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		ctx = context.WithValue(ctx, currentUserPrincipalKey, "/test/")
+		ctx = context.WithValue(ctx, homeSetPathKey, "/test/contacts/")
+		ctx = context.WithValue(ctx, addressBookPathKey, addressBookPath)
+		r = r.WithContext(ctx)
+		(&h).ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	client, err := NewClient(nil, ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	abs, err := client.FindAddressBooks(ctx, "/test/contacts/")
+	if err != nil {
+		t.Fatalf("FindAddressBooks() = %v", err)
+	}
+	if len(abs) != 1 || !abs[0].SupportsAddressData(vcard.MIMEType, "3.0") || !abs[0].SupportsAddressData(vcard.MIMEType, "4.0") {
+		t.Errorf("FindAddressBooks() = %+v, want vCard 3.0 and 4.0 to be supported", abs)
+	}
+
+	card, err := vcard.NewDecoder(strings.NewReader(v3CardData)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.PutAddressObject(ctx, addressBookPath+"/dave.vcf", card); err != nil {
+		t.Fatalf("PutAddressObject() with vCard 3.0 = %v", err)
+	}
+	if v := stored.Value(vcard.FieldVersion); v != "4.0" {
+		t.Errorf("PutAddressObject() with vCard 3.0 stored version %q, want 4.0", v)
+	}
+}
@@ -126,7 +126,11 @@ func (c *Client) FindAddressBooks(ctx context.Context, addressBookHomeSet string
 		}
 
 		var supported supportedAddressData
-		if err := resp.DecodeProp(&supported); err != nil && !internal.IsNotFound(err) {
+		if err := resp.DecodeProp(&supported); internal.IsNotFound(err) {
+			// RFC 6352 section 6.2.2: only vCard 3.0 is supported if the
+			// property isn't defined
+			supported.Types = []addressDataType{{ContentType: vcard.MIMEType, Version: "3.0"}}
+		} else if err != nil {
 			return nil, err
 		}
 
@@ -143,7 +147,13 @@ func (c *Client) FindAddressBooks(ctx context.Context, addressBookHomeSet string
 }
 
 func encodeAddressPropReq(req *AddressDataRequest) (*internal.Prop, error) {
-	var addrDataReq addressDataReq
+	addrDataReq := addressDataReq{
+		ContentType: req.ContentType,
+		Version:     req.Version,
+	}
+	if addrDataReq.Version != "" && addrDataReq.ContentType == "" {
+		addrDataReq.ContentType = vcard.MIMEType
+	}
 	if req.AllProp {
 		addrDataReq.Allprop = &struct{}{}
 	} else {
@@ -195,6 +205,7 @@ func encodeParamFilter(pf *ParamFilter) (*paramFilter, error) {
 func encodeTextMatch(tm *TextMatch) *textMatch {
 	return &textMatch{
 		Text:            tm.Text,
+		Collation:       tm.Collation,
 		NegateCondition: negateCondition(tm.NegateCondition),
 		MatchType:       matchType(tm.MatchType),
 	}
@@ -210,45 +221,59 @@ func decodeAddressList(ms *internal.MultiStatus) ([]AddressObject, error) {
 			continue
 		}
 
-		var addrData addressDataResp
-		if err := resp.DecodeProp(&addrData); err != nil {
+		ao, err := decodeAddressObject(path, &resp)
+		if err != nil {
 			return nil, err
 		}
+		addrs = append(addrs, *ao)
+	}
 
-		var getLastMod internal.GetLastModified
-		if err := resp.DecodeProp(&getLastMod); err != nil && !internal.IsNotFound(err) {
-			return nil, err
-		}
+	return addrs, errors.Join(errs...)
+}
 
-		var getETag internal.GetETag
-		if err := resp.DecodeProp(&getETag); err != nil && !internal.IsNotFound(err) {
-			return nil, err
-		}
+func decodeAddressObject(path string, resp *internal.Response) (*AddressObject, error) {
+	var addrData addressDataResp
+	if err := resp.DecodeProp(&addrData); err != nil {
+		return nil, err
+	}
 
-		var getContentLength internal.GetContentLength
-		if err := resp.DecodeProp(&getContentLength); err != nil && !internal.IsNotFound(err) {
-			return nil, err
-		}
+	var getLastMod internal.GetLastModified
+	if err := resp.DecodeProp(&getLastMod); err != nil && !internal.IsNotFound(err) {
+		return nil, err
+	}
 
-		r := bytes.NewReader(addrData.Data)
-		card, err := vcard.NewDecoder(r).Decode()
-		if err != nil {
-			return nil, err
-		}
+	var getETag internal.GetETag
+	if err := resp.DecodeProp(&getETag); err != nil && !internal.IsNotFound(err) {
+		return nil, err
+	}
 
-		addrs = append(addrs, AddressObject{
-			Path:          path,
-			ModTime:       time.Time(getLastMod.LastModified),
-			ContentLength: getContentLength.Length,
-			ETag:          string(getETag.ETag),
-			Card:          card,
-		})
+	var getContentLength internal.GetContentLength
+	if err := resp.DecodeProp(&getContentLength); err != nil && !internal.IsNotFound(err) {
+		return nil, err
 	}
 
-	return addrs, errors.Join(errs...)
+	r := bytes.NewReader(addrData.Data)
+	var card vcard.Card
+	var err error
+	if strings.EqualFold(addrData.ContentType, JCardMIMEType) {
+		card, err = DecodeJCard(r)
+	} else {
+		card, err = vcard.NewDecoder(r).Decode()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &AddressObject{
+		Path:          path,
+		ModTime:       time.Time(getLastMod.LastModified),
+		ContentLength: getContentLength.Length,
+		ETag:          string(getETag.ETag),
+		Card:          card,
+	}, nil
 }
 
-func (c *Client) QueryAddressBook(ctx context.Context, addressBook string, query *AddressBookQuery) ([]AddressObject, error) {
+func (c *Client) newAddressBookQueryRequest(ctx context.Context, addressBook string, query *AddressBookQuery) (*http.Request, error) {
 	propReq, err := encodeAddressPropReq(&query.DataRequest)
 	if err != nil {
 		return nil, err
@@ -274,7 +299,16 @@ func (c *Client) QueryAddressBook(ctx context.Context, addressBook string, query
 
 	req.Header.Add("Depth", "1")
 
-	ms, err := c.ic.DoMultiStatus(req.WithContext(ctx))
+	return req.WithContext(ctx), nil
+}
+
+func (c *Client) QueryAddressBook(ctx context.Context, addressBook string, query *AddressBookQuery) ([]AddressObject, error) {
+	req, err := c.newAddressBookQueryRequest(ctx, addressBook, query)
+	if err != nil {
+		return nil, err
+	}
+
+	ms, err := c.ic.DoMultiStatus(req)
 	if err != nil {
 		return nil, err
 	}
@@ -282,6 +316,71 @@ func (c *Client) QueryAddressBook(ctx context.Context, addressBook string, query
 	return decodeAddressList(ms)
 }
 
+// QueryAddressBookIter is like QueryAddressBook, but decodes address objects
+// incrementally instead of loading the whole response in memory. The returned
+// iterator must be closed.
+func (c *Client) QueryAddressBookIter(ctx context.Context, addressBook string, query *AddressBookQuery) (*AddressObjectIterator, error) {
+	req, err := c.newAddressBookQueryRequest(ctx, addressBook, query)
+	if err != nil {
+		return nil, err
+	}
+
+	mr, err := c.ic.DoMultiStatusReader(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AddressObjectIterator{mr: mr}, nil
+}
+
+// AddressObjectIterator iterates over address objects returned by the
+// server.
+type AddressObjectIterator struct {
+	mr   *internal.MultiStatusReader
+	ao   *AddressObject
+	errs []error
+	err  error
+}
+
+// Next advances to the next address object. It returns false when there are
+// no more objects or when an error occurs.
+func (it *AddressObjectIterator) Next() bool {
+	it.ao = nil
+	if it.err != nil {
+		return false
+	}
+
+	for it.mr.Next() {
+		resp := it.mr.Response()
+		path, err := resp.Path()
+		if err != nil {
+			it.errs = append(it.errs, err)
+			continue
+		}
+
+		it.ao, it.err = decodeAddressObject(path, resp)
+		return it.err == nil
+	}
+	it.err = it.mr.Err()
+	return false
+}
+
+// AddressObject returns the current address object.
+func (it *AddressObjectIterator) AddressObject() *AddressObject {
+	return it.ao
+}
+
+// Err returns the error which stopped the iteration, joined with errors
+// reported by the server for individual objects.
+func (it *AddressObjectIterator) Err() error {
+	return errors.Join(append(it.errs, it.err)...)
+}
+
+// Close releases the resources held by the iterator.
+func (it *AddressObjectIterator) Close() error {
+	return it.mr.Close()
+}
+
 func (c *Client) MultiGetAddressBook(ctx context.Context, path string, multiGet *AddressBookMultiGet) ([]AddressObject, error) {
 	propReq, err := encodeAddressPropReq(&multiGet.DataRequest)
 	if err != nil {
@@ -365,11 +464,15 @@ func (c *Client) GetAddressObject(ctx context.Context, path string) (*AddressObj
 	if err != nil {
 		return nil, err
 	}
-	if !strings.EqualFold(mediaType, vcard.MIMEType) {
+	var card vcard.Card
+	switch strings.ToLower(mediaType) {
+	case vcard.MIMEType:
+		card, err = vcard.NewDecoder(resp.Body).Decode()
+	case JCardMIMEType:
+		card, err = DecodeJCard(resp.Body)
+	default:
 		return nil, fmt.Errorf("carddav: expected Content-Type %q, got %q", vcard.MIMEType, mediaType)
 	}
-
-	card, err := vcard.NewDecoder(resp.Body).Decode()
 	if err != nil {
 		return nil, err
 	}
@@ -445,7 +548,12 @@ func (c *Client) SyncCollection(ctx context.Context, path string, query *SyncQue
 	for _, resp := range ms.Responses {
 		p, err := resp.Path()
 		if err != nil {
-			if err, ok := err.(*internal.HTTPError); ok && err.Code == http.StatusNotFound {
+			var httpErr *internal.HTTPError
+			hasStatus := errors.As(err, &httpErr)
+			if hasStatus && httpErr.Code == http.StatusInsufficientStorage && (p == path || path == fmt.Sprintf("%s/", p)) {
+				// The server truncated the results, see RFC 6578 section 3.6
+				ret.Truncated = true
+			} else if hasStatus && httpErr.Code == http.StatusNotFound {
 				ret.Deleted = append(ret.Deleted, p)
 			} else {
 				errs = append(errs, err)
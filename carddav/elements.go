@@ -105,6 +105,11 @@ type textMatch struct {
 	MatchType       matchType       `xml:"match-type,attr,omitempty"`
 }
 
+// https://tools.ietf.org/html/rfc6352#section-8.6
+type supportedCollation struct {
+	XMLName xml.Name `xml:"urn:ietf:params:xml:ns:carddav supported-collation"`
+}
+
 type negateCondition bool
 
 func (nc *negateCondition) UnmarshalText(b []byte) error {
@@ -173,9 +178,11 @@ func newProp(name string, noValue bool) *internal.RawXMLValue {
 
 // https://tools.ietf.org/html/rfc6352#section-10.4
 type addressDataReq struct {
-	XMLName xml.Name  `xml:"urn:ietf:params:xml:ns:carddav address-data"`
-	Props   []prop    `xml:"prop"`
-	Allprop *struct{} `xml:"allprop"`
+	XMLName     xml.Name  `xml:"urn:ietf:params:xml:ns:carddav address-data"`
+	ContentType string    `xml:"content-type,attr,omitempty"`
+	Version     string    `xml:"version,attr,omitempty"`
+	Props       []prop    `xml:"prop"`
+	Allprop     *struct{} `xml:"allprop"`
 }
 
 // https://tools.ietf.org/html/rfc6352#section-10.4.2
@@ -187,13 +194,17 @@ type prop struct {
 
 // https://tools.ietf.org/html/rfc6352#section-10.4
 type addressDataResp struct {
-	XMLName xml.Name `xml:"urn:ietf:params:xml:ns:carddav address-data"`
-	Data    []byte   `xml:",chardata"`
+	XMLName     xml.Name `xml:"urn:ietf:params:xml:ns:carddav address-data"`
+	ContentType string   `xml:"content-type,attr,omitempty"`
+	Version     string   `xml:"version,attr,omitempty"`
+	Data        []byte   `xml:",chardata"`
 }
 
 type reportReq struct {
-	Query    *addressbookQuery
-	Multiget *addressbookMultiget
+	Query          *addressbookQuery
+	Multiget       *addressbookMultiget
+	ExpandProperty *internal.ExpandProperty
+	SyncCollection *internal.SyncCollectionQuery
 }
 
 func (r *reportReq) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
@@ -205,6 +216,12 @@ func (r *reportReq) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	case addressBookMultigetName:
 		r.Multiget = &addressbookMultiget{}
 		v = r.Multiget
+	case internal.ExpandPropertyName:
+		r.ExpandProperty = &internal.ExpandProperty{}
+		v = r.ExpandProperty
+	case internal.SyncCollectionName:
+		r.SyncCollection = &internal.SyncCollectionQuery{}
+		v = r.SyncCollection
 	default:
 		return fmt.Errorf("carddav: unsupported REPORT root %q %q", start.Name.Space, start.Name.Local)
 	}
@@ -0,0 +1,359 @@
+package carddav
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-vcard"
+)
+
+// JCardMIMEType is the media type of jCard, the JSON format for vCard data
+// defined in RFC 7095.
+const JCardMIMEType = "application/vcard+json"
+
+const (
+	jCardText           = "text"
+	jCardURI            = "uri"
+	jCardDateAndOrTime  = "date-and-or-time"
+	jCardDate           = "date"
+	jCardTime           = "time"
+	jCardDateTime       = "date-time"
+	jCardTimestamp      = "timestamp"
+	jCardLanguageTag    = "language-tag"
+	jCardUnknown        = "unknown"
+	jCardParamGroupName = "group"
+)
+
+// jCardDefaultTypes lists the default value types of vCard 4.0 properties,
+// see RFC 6350 section 6. Other properties have the text type.
+var jCardDefaultTypes = map[string]string{
+	vcard.FieldSource:             jCardURI,
+	vcard.FieldPhoto:              jCardURI,
+	vcard.FieldBirthday:           jCardDateAndOrTime,
+	vcard.FieldAnniversary:        jCardDateAndOrTime,
+	vcard.FieldIMPP:               jCardURI,
+	vcard.FieldLanguage:           jCardLanguageTag,
+	vcard.FieldGeolocation:        jCardURI,
+	vcard.FieldLogo:               jCardURI,
+	vcard.FieldMember:             jCardURI,
+	vcard.FieldRelated:            jCardURI,
+	vcard.FieldRevision:           jCardTimestamp,
+	vcard.FieldSound:              jCardURI,
+	vcard.FieldUID:                jCardURI,
+	vcard.FieldURL:                jCardURI,
+	vcard.FieldKey:                jCardURI,
+	vcard.FieldFreeOrBusyURL:      jCardURI,
+	vcard.FieldCalendarAddressURI: jCardURI,
+	vcard.FieldCalendarURI:        jCardURI,
+}
+
+// jCardStructured lists the properties with structured values, which are
+// represented as arrays, see RFC 7095 section 3.3.1.3.
+var jCardStructured = map[string]bool{
+	vcard.FieldName:         true,
+	vcard.FieldAddress:      true,
+	vcard.FieldOrganization: true,
+	vcard.FieldGender:       true,
+	vcard.FieldClientPIDMap: true,
+}
+
+// jCardMultiValued lists the properties whose comma-separated values are
+// represented as separate jCard values.
+var jCardMultiValued = map[string]bool{
+	vcard.FieldNickname:   true,
+	vcard.FieldCategories: true,
+}
+
+func jCardDefaultType(name string) string {
+	if t, ok := jCardDefaultTypes[name]; ok {
+		return t
+	} else if strings.HasPrefix(name, "X-") {
+		return jCardUnknown
+	}
+	return jCardText
+}
+
+// EncodeJCard writes a card in the jCard format. Cards which aren't vCard 4.0
+// are converted with ConvertCard first.
+func EncodeJCard(w io.Writer, card vcard.Card) error {
+	if card.Value(vcard.FieldVersion) != "4.0" {
+		var err error
+		if card, err = ConvertCard(card, "4.0"); err != nil {
+			return err
+		}
+	}
+
+	// VERSION is the first property, see RFC 7095 section 3.3.1.1
+	names := make([]string, 0, len(card))
+	for name := range card {
+		if name != vcard.FieldVersion {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	names = append([]string{vcard.FieldVersion}, names...)
+
+	props := make([]interface{}, 0, len(card))
+	for _, name := range names {
+		for _, field := range card[name] {
+			prop, err := encodeJCardProp(name, field)
+			if err != nil {
+				return err
+			}
+			props = append(props, prop)
+		}
+	}
+
+	return json.NewEncoder(w).Encode([]interface{}{"vcard", props})
+}
+
+func encodeJCardProp(name string, field *vcard.Field) ([]interface{}, error) {
+	params := make(map[string]interface{}, len(field.Params))
+	for k, values := range field.Params {
+		if k == vcard.ParamValue {
+			continue
+		}
+		if len(values) == 1 {
+			params[strings.ToLower(k)] = values[0]
+		} else {
+			params[strings.ToLower(k)] = values
+		}
+	}
+	if field.Group != "" {
+		params[jCardParamGroupName] = field.Group
+	}
+
+	typ := strings.ToLower(field.Params.Get(vcard.ParamValue))
+	if typ == "" {
+		typ = jCardDefaultType(name)
+	}
+
+	var values []interface{}
+	switch {
+	case jCardStructured[name] && typ == jCardText:
+		values = []interface{}{encodeJCardStructured(name, field.Value)}
+	case jCardMultiValued[name] && typ == jCardText:
+		for _, s := range strings.Split(field.Value, ",") {
+			values = append(values, s)
+		}
+	default:
+		var value interface{}
+		var err error
+		typ, value, err = encodeJCardValue(typ, field.Value)
+		if err != nil {
+			return nil, fmt.Errorf("carddav: invalid %v value %q: %v", name, field.Value, err)
+		}
+		values = []interface{}{value}
+	}
+
+	return append([]interface{}{strings.ToLower(name), params, typ}, values...), nil
+}
+
+func encodeJCardStructured(name, s string) interface{} {
+	parts := splitStructured(s)
+	if len(parts) == 1 && name != vcard.FieldName && name != vcard.FieldAddress {
+		return parts[0]
+	}
+
+	l := make([]interface{}, len(parts))
+	for i, part := range parts {
+		if values := strings.Split(part, ","); len(values) > 1 {
+			l[i] = values
+		} else {
+			l[i] = part
+		}
+	}
+	return l
+}
+
+// encodeJCardValue converts a vCard value to a jCard value. The type of
+// date-and-or-time values is resolved to the actual type of the value.
+func encodeJCardValue(typ, s string) (string, interface{}, error) {
+	switch typ {
+	case jCardDateAndOrTime, jCardDate, jCardTime, jCardDateTime, jCardTimestamp:
+		if typ == jCardTime && !strings.HasPrefix(s, "T") {
+			s = "T" + s
+		}
+		v := formatExtendedDateTime(s)
+		if typ == jCardDateAndOrTime {
+			switch {
+			case strings.HasPrefix(v, "T"):
+				typ = jCardTime
+			case strings.Contains(v, "T"):
+				typ = jCardDateTime
+			default:
+				typ = jCardDate
+			}
+		}
+		return typ, strings.TrimPrefix(v, "T"), nil
+	case "utc-offset":
+		if len(s) == 5 && (s[0] == '+' || s[0] == '-') {
+			s = s[:3] + ":" + s[3:]
+		}
+		return typ, s, nil
+	case "integer":
+		i, err := strconv.ParseInt(s, 10, 64)
+		return typ, i, err
+	case "float":
+		f, err := strconv.ParseFloat(s, 64)
+		return typ, f, err
+	case "boolean":
+		b, err := strconv.ParseBool(strings.ToLower(s))
+		return typ, b, err
+	}
+	return typ, s, nil
+}
+
+// DecodeJCard reads a card in the jCard format.
+func DecodeJCard(r io.Reader) (vcard.Card, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var v []interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("carddav: failed to decode jCard: %v", err)
+	}
+	if len(v) != 2 || v[0] != "vcard" {
+		return nil, fmt.Errorf("carddav: malformed jCard")
+	}
+	props, ok := v[1].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("carddav: malformed jCard")
+	}
+
+	card := make(vcard.Card)
+	for _, v := range props {
+		name, field, err := decodeJCardProp(v)
+		if err != nil {
+			return nil, err
+		}
+		card.Add(name, field)
+	}
+	return card, nil
+}
+
+func decodeJCardProp(v interface{}) (string, *vcard.Field, error) {
+	l, ok := v.([]interface{})
+	if !ok || len(l) < 4 {
+		return "", nil, fmt.Errorf("carddav: malformed jCard property")
+	}
+	name, ok := l[0].(string)
+	params, ok2 := l[1].(map[string]interface{})
+	typ, ok3 := l[2].(string)
+	if !ok || !ok2 || !ok3 {
+		return "", nil, fmt.Errorf("carddav: malformed jCard property")
+	}
+	name = strings.ToUpper(name)
+
+	field := &vcard.Field{Params: make(vcard.Params)}
+	for k, v := range params {
+		values, err := decodeJCardStrings(v)
+		if err != nil {
+			return "", nil, fmt.Errorf("carddav: malformed jCard %v parameter %v: %v", name, k, err)
+		}
+		if k == jCardParamGroupName {
+			field.Group = strings.Join(values, ",")
+		} else {
+			field.Params[strings.ToUpper(k)] = values
+		}
+	}
+
+	defaultType := jCardDefaultType(name)
+	switch {
+	case typ == defaultType || typ == jCardUnknown:
+	case defaultType == jCardDateAndOrTime && (typ == jCardDate || typ == jCardTime || typ == jCardDateTime):
+	default:
+		field.Params.Set(vcard.ParamValue, typ)
+	}
+
+	values := make([]string, 0, len(l)-3)
+	for _, v := range l[3:] {
+		s, err := decodeJCardValue(typ, defaultType, v)
+		if err != nil {
+			return "", nil, fmt.Errorf("carddav: malformed jCard %v value: %v", name, err)
+		}
+		values = append(values, s)
+	}
+	field.Value = strings.Join(values, ",")
+
+	return name, field, nil
+}
+
+func decodeJCardValue(typ, defaultType string, v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		switch typ {
+		case jCardDate, jCardDateTime, jCardTimestamp:
+			return formatBasicDateTime(v), nil
+		case jCardTime:
+			s := formatBasicDateTime("T" + v)
+			if defaultType != jCardDateAndOrTime {
+				// Times are only prefixed in date-and-or-time values
+				s = strings.TrimPrefix(s, "T")
+			}
+			return s, nil
+		case "utc-offset":
+			return strings.Replace(v, ":", "", -1), nil
+		}
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, v := range v {
+			values, err := decodeJCardStrings(v)
+			if err != nil {
+				return "", err
+			}
+			for j, s := range values {
+				values[j] = strings.Replace(s, ";", `\;`, -1)
+			}
+			parts[i] = strings.Join(values, ",")
+		}
+		return strings.Join(parts, ";"), nil
+	}
+	return "", fmt.Errorf("unexpected value %v", v)
+}
+
+func decodeJCardStrings(v interface{}) ([]string, error) {
+	switch v := v.(type) {
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		l := make([]string, len(v))
+		for i, v := range v {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected a string")
+			}
+			l[i] = s
+		}
+		return l, nil
+	}
+	return nil, fmt.Errorf("expected a string or an array")
+}
+
+// splitStructured splits a structured vCard value on semicolons, ignoring
+// escaped semicolons.
+func splitStructured(s string) []string {
+	var parts []string
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && i+1 < len(s) && s[i+1] == ';':
+			sb.WriteByte(';')
+			i++
+		case c == ';':
+			parts = append(parts, sb.String())
+			sb.Reset()
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return append(parts, sb.String())
+}
@@ -0,0 +1,172 @@
+package carddav
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-vcard"
+)
+
+const jCardData = `BEGIN:VCARD
+VERSION:4.0
+UID:urn:uuid:4fbe8971-0bc3-424c-9c26-36c3e1eff6b4
+FN:Dave Gopher
+N:Gopher;Dave;;Dr.,Prof.;
+NICKNAME:Dave,Gophy
+ORG:Example Inc.;Research\; Development
+GENDER:M
+BDAY:--0412
+ANNIVERSARY:20090808T1430-0500
+REV:20230101T120000Z
+TEL;VALUE=uri;TYPE=work,voice;PREF=1:tel:+1-555-555-5555
+item1.EMAIL:dave@example.org
+ADR;TYPE=work:;;100 Waters Edge;Baytown;LA;30314;United States of America
+NOTE:Likes burrowing\, and digging
+X-EXAMPLE-FLAG:on
+END:VCARD`
+
+func TestJCard(t *testing.T) {
+	card, err := vcard.NewDecoder(strings.NewReader(jCardData)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeJCard(&buf, card); err != nil {
+		t.Fatalf("EncodeJCard() = %v", err)
+	}
+	s := buf.String()
+	for _, want := range []string{
+		`["vcard",[["version",{},"text","4.0"]`,
+		`["n",{},"text",["Gopher","Dave","",["Dr.","Prof."],""]]`,
+		`["nickname",{},"text","Dave","Gophy"]`,
+		`["org",{},"text",["Example Inc.","Research; Development"]]`,
+		`["gender",{},"text","M"]`,
+		`["bday",{},"date","--04-12"]`,
+		`["anniversary",{},"date-time","2009-08-08T14:30-05:00"]`,
+		`["rev",{},"timestamp","2023-01-01T12:00:00Z"]`,
+		`["tel",{"pref":"1","type":["work","voice"]},"uri","tel:+1-555-555-5555"]`,
+		`["email",{"group":"item1"},"text","dave@example.org"]`,
+		`["note",{},"text","Likes burrowing, and digging"]`,
+		`["x-example-flag",{},"unknown","on"]`,
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("jCard doesn't contain %v:\n%v", want, s)
+		}
+	}
+
+	decoded, err := DecodeJCard(&buf)
+	if err != nil {
+		t.Fatalf("DecodeJCard() = %v", err)
+	}
+	var out, want bytes.Buffer
+	if err := vcard.NewEncoder(&out).Encode(decoded); err != nil {
+		t.Fatal(err)
+	}
+	if err := vcard.NewEncoder(&want).Encode(card); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != want.String() {
+		t.Errorf("round-tripped card = \n%v\nwant\n%v", out.String(), want.String())
+	}
+}
+
+func TestJCard_v3(t *testing.T) {
+	card, err := vcard.NewDecoder(strings.NewReader(v3CardData)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeJCard(&buf, card); err != nil {
+		t.Fatalf("EncodeJCard() = %v", err)
+	}
+	decoded, err := DecodeJCard(&buf)
+	if err != nil {
+		t.Fatalf("DecodeJCard() = %v", err)
+	}
+	if v := decoded.Value(vcard.FieldVersion); v != "4.0" {
+		t.Errorf("VERSION = %q, want 4.0", v)
+	}
+	if v := decoded.Value(vcard.FieldGeolocation); v != "geo:37.386013,-122.082932" {
+		t.Errorf("GEO = %q", v)
+	}
+}
+
+func TestJCardContentNegotiation(t *testing.T) {
+	const addressBookPath = "/test/contacts/private"
+	const objectPath = addressBookPath + "/alice.vcf"
+
+	h := Handler{Backend: testVersionBackend{&testBackend{}}}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		ctx = context.WithValue(ctx, currentUserPrincipalKey, "/test/")
+		ctx = context.WithValue(ctx, homeSetPathKey, "/test/contacts/")
+		ctx = context.WithValue(ctx, addressBookPathKey, addressBookPath)
+		r = r.WithContext(ctx)
+		(&h).ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+objectPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "text/vcard;q=0.5, application/vcard+json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); resp.StatusCode != http.StatusOK || ct != JCardMIMEType {
+		t.Fatalf("GET with jCard Accept = %v, Content-Type %q", resp.StatusCode, ct)
+	}
+	card, err := DecodeJCard(resp.Body)
+	if err != nil {
+		t.Fatalf("DecodeJCard() = %v", err)
+	}
+	if v := card.Value(vcard.FieldFormattedName); v != "Alice Gopher" {
+		t.Errorf("FN = %q, want %q", v, "Alice Gopher")
+	}
+
+	ctx := context.Background()
+	client, err := NewClient(nil, ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aos, err := client.MultiGetAddressBook(ctx, addressBookPath, &AddressBookMultiGet{
+		Paths:       []string{objectPath},
+		DataRequest: AddressDataRequest{AllProp: true, ContentType: JCardMIMEType},
+	})
+	if err != nil {
+		t.Fatalf("MultiGetAddressBook() = %v", err)
+	}
+	if len(aos) != 1 || aos[0].Card.Value(vcard.FieldFormattedName) != "Alice Gopher" {
+		t.Errorf("MultiGetAddressBook() = %+v, want Alice's address object", aos)
+	}
+
+	var body bytes.Buffer
+	if err := EncodeJCard(&body, card); err != nil {
+		t.Fatal(err)
+	}
+	req, err = http.NewRequest(http.MethodPut, ts.URL+addressBookPath+"/bob.vcf", &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", JCardMIMEType)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("PUT with jCard = %v, want %v", resp.StatusCode, http.StatusCreated)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/emersion/go-vcard"
+	"github.com/emersion/go-webdav/internal"
 )
 
 func filterProperties(req AddressDataRequest, ao AddressObject) AddressObject {
@@ -102,26 +103,53 @@ func Match(query *AddressBookQuery, ao *AddressObject) (matched bool, err error)
 }
 
 func matchPropFilter(prop PropFilter, ao *AddressObject) (bool, error) {
-	// TODO: this only matches first field, there could be multiple
-	field := ao.Card.Get(prop.Name)
-	if field == nil {
+	fields := ao.Card[strings.ToUpper(prop.Name)]
+	if len(fields) == 0 {
 		return prop.IsNotDefined, nil
 	} else if prop.IsNotDefined {
 		return false, nil
 	}
 
-	// TODO: handle carddav.PropFilter.Params.
-	if len(prop.TextMatches) == 0 {
+	if len(prop.TextMatches) == 0 && len(prop.Params) == 0 {
 		return true, nil
 	}
 
+	// The filter matches if any instance of the property matches
+	for _, field := range fields {
+		ok, err := matchPropFilterField(prop, field)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func matchPropFilterField(prop PropFilter, field *vcard.Field) (bool, error) {
+	// The test applies to both text-match and param-filter elements
+	var tests []func() (bool, error)
+	for _, txt := range prop.TextMatches {
+		txt := txt
+		tests = append(tests, func() (bool, error) {
+			return matchTextMatch(txt, field.Value)
+		})
+	}
+	for _, param := range prop.Params {
+		param := param
+		tests = append(tests, func() (bool, error) {
+			return matchParamFilter(param, field)
+		})
+	}
+
 	switch prop.Test {
 	default:
 		return false, fmt.Errorf("unknown property filter test %q", prop.Test)
 
 	case FilterAnyOf, "":
-		for _, txt := range prop.TextMatches {
-			ok, err := matchTextMatch(txt, field)
+		for _, test := range tests {
+			ok, err := test()
 			if err != nil {
 				return false, err
 			}
@@ -132,8 +160,8 @@ func matchPropFilter(prop PropFilter, ao *AddressObject) (bool, error) {
 		return false, nil
 
 	case FilterAllOf:
-		for _, txt := range prop.TextMatches {
-			ok, err := matchTextMatch(txt, field)
+		for _, test := range tests {
+			ok, err := test()
 			if err != nil {
 				return false, err
 			}
@@ -145,24 +173,56 @@ func matchPropFilter(prop PropFilter, ao *AddressObject) (bool, error) {
 	}
 }
 
-func matchTextMatch(txt TextMatch, field *vcard.Field) (bool, error) {
-	// TODO: handle text-match collation attribute
-	var ok bool
+func matchParamFilter(param ParamFilter, field *vcard.Field) (bool, error) {
+	values := field.Params[strings.ToUpper(param.Name)]
+	if len(values) == 0 {
+		return param.IsNotDefined, nil
+	} else if param.IsNotDefined {
+		return false, nil
+	}
+	if param.TextMatch == nil {
+		return true, nil
+	}
+
+	// The filter matches if any value of the parameter matches
+	for _, value := range values {
+		ok, err := matchTextMatch(*param.TextMatch, value)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func matchTextMatch(txt TextMatch, value string) (bool, error) {
+	collation := txt.Collation
+	if collation == "" {
+		collation = internal.CollationASCIICasemap
+	}
+	text, ok := internal.FoldCollation(collation, txt.Text)
+	if !ok {
+		return false, fmt.Errorf("unknown textmatch collation %q", collation)
+	}
+	value, _ = internal.FoldCollation(collation, value)
+
 	switch txt.MatchType {
 	default:
 		return false, fmt.Errorf("unknown textmatch type %q", txt.MatchType)
 
 	case MatchEquals:
-		ok = txt.Text == field.Value
+		ok = text == value
 
 	case MatchContains, "":
-		ok = strings.Contains(field.Value, txt.Text)
+		ok = strings.Contains(value, text)
 
 	case MatchStartsWith:
-		ok = strings.HasPrefix(field.Value, txt.Text)
+		ok = strings.HasPrefix(value, text)
 
 	case MatchEndsWith:
-		ok = strings.HasSuffix(field.Value, txt.Text)
+		ok = strings.HasSuffix(value, text)
 	}
 
 	if txt.NegateCondition {
@@ -260,6 +260,14 @@ FN;PID=1.1:Alice Gopher
 N:Gopher;Alice;;;
 EMAIL;PID=1.1:alice@example.com
 CLIENTPIDMAP:1;urn:uuid:53e374d9-337e-4727-8803-a1e9c14e0556
+END:VCARD`)
+
+	dave := newAO(`BEGIN:VCARD
+VERSION:4.0
+UID:urn:uuid:4fbe8971-0bc3-424c-9c26-36c3e1eff6b4
+FN:Dave Gopher
+EMAIL;TYPE=home:dave@example.com
+EMAIL;TYPE=work,pref:dave@example.org
 END:VCARD`)
 
 	for _, tc := range []struct {
@@ -590,6 +598,151 @@ END:VCARD`)
 			addr: alice,
 			want: true,
 		},
+		{
+			name: "match-name-contains-default-collation-ok",
+			query: &AddressBookQuery{
+				PropFilters: []PropFilter{
+					{
+						Name:        vcard.FieldFormattedName,
+						TextMatches: []TextMatch{{Text: "gopher"}},
+					},
+				},
+			},
+			addr: alice,
+			want: true,
+		},
+		{
+			name: "match-name-contains-octet-not",
+			query: &AddressBookQuery{
+				PropFilters: []PropFilter{
+					{
+						Name:        vcard.FieldFormattedName,
+						TextMatches: []TextMatch{{Text: "gopher", Collation: "i;octet"}},
+					},
+				},
+			},
+			addr: alice,
+			want: false,
+		},
+		{
+			name: "match-name-equals-ascii-casemap-ok",
+			query: &AddressBookQuery{
+				PropFilters: []PropFilter{
+					{
+						Name: vcard.FieldFormattedName,
+						TextMatches: []TextMatch{{
+							Text:      "ALICE GOPHER",
+							MatchType: MatchEquals,
+							Collation: "i;ascii-casemap",
+						}},
+					},
+				},
+			},
+			addr: alice,
+			want: true,
+		},
+		{
+			name: "unknown-collation",
+			query: &AddressBookQuery{
+				PropFilters: []PropFilter{
+					{
+						Name:        vcard.FieldFormattedName,
+						TextMatches: []TextMatch{{Text: "gopher", Collation: "i;xxx"}},
+					},
+				},
+			},
+			addr: alice,
+			err:  fmt.Errorf("unknown textmatch collation \"i;xxx\""),
+		},
+		{
+			name: "unsupported-unicode-casemap-collation",
+			query: &AddressBookQuery{
+				PropFilters: []PropFilter{
+					{
+						Name:        vcard.FieldFormattedName,
+						TextMatches: []TextMatch{{Text: "gopher", Collation: "i;unicode-casemap"}},
+					},
+				},
+			},
+			addr: alice,
+			err:  fmt.Errorf("unknown textmatch collation \"i;unicode-casemap\""),
+		},
+		{
+			name: "match-second-email",
+			query: &AddressBookQuery{
+				PropFilters: []PropFilter{
+					{
+						Name:        vcard.FieldEmail,
+						TextMatches: []TextMatch{{Text: "example.org"}},
+					},
+				},
+			},
+			addr: dave,
+			want: true,
+		},
+		{
+			name: "match-param-second-value",
+			query: &AddressBookQuery{
+				PropFilters: []PropFilter{
+					{
+						Name: vcard.FieldEmail,
+						Params: []ParamFilter{{
+							Name:      "TYPE",
+							TextMatch: &TextMatch{Text: "pref", MatchType: MatchEquals},
+						}},
+					},
+				},
+			},
+			addr: dave,
+			want: true,
+		},
+		{
+			name: "match-param-not",
+			query: &AddressBookQuery{
+				PropFilters: []PropFilter{
+					{
+						Name: vcard.FieldEmail,
+						Params: []ParamFilter{{
+							Name:      "type",
+							TextMatch: &TextMatch{Text: "cell", MatchType: MatchEquals},
+						}},
+					},
+				},
+			},
+			addr: dave,
+			want: false,
+		},
+		{
+			name: "match-param-is-not-defined",
+			query: &AddressBookQuery{
+				PropFilters: []PropFilter{
+					{
+						Name:   vcard.FieldEmail,
+						Params: []ParamFilter{{Name: "TYPE", IsNotDefined: true}},
+					},
+				},
+			},
+			addr: alice,
+			want: true,
+		},
+		{
+			name: "match-allof-same-instance",
+			query: &AddressBookQuery{
+				PropFilters: []PropFilter{
+					{
+						Name:        vcard.FieldEmail,
+						Test:        FilterAllOf,
+						TextMatches: []TextMatch{{Text: "example.com"}},
+						Params: []ParamFilter{{
+							Name:      "TYPE",
+							TextMatch: &TextMatch{Text: "work", MatchType: MatchEquals},
+						}},
+					},
+				},
+			},
+			addr: dave,
+			want: false,
+		},
 		{
 			name: "invalid-query-filter",
 			query: &AddressBookQuery{
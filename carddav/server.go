@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/xml"
 	"fmt"
+	"io"
 	"mime"
 	"net/http"
 	"path"
@@ -41,11 +42,32 @@ type Backend interface {
 	webdav.UserPrincipalBackend
 }
 
+// SyncBackend is an optional interface which can be implemented by a Backend
+// to support collection synchronization, as defined in RFC 6578. Clients can
+// then fetch the changes to an address book since their last synchronization
+// with the sync-collection REPORT.
+type SyncBackend interface {
+	// AddressBookSyncToken returns the current sync token of an address book,
+	// exposed via the DAV:sync-token property.
+	AddressBookSyncToken(ctx context.Context, path string) (string, error)
+	// SyncCollection returns the address objects which changed since
+	// query.SyncToken. An empty token requests all address objects.
+	//
+	// webdav.ErrInvalidSyncToken is returned if the token is malformed or has
+	// expired. If more objects than query.Limit changed, the response is
+	// truncated and SyncResponse.Truncated is set. If the response can't be
+	// truncated, a 507 Insufficient Storage HTTP error is returned.
+	SyncCollection(ctx context.Context, path string, query *SyncQuery) (*SyncResponse, error)
+}
+
 // Handler handles CardDAV HTTP requests. It can be used to create a CardDAV
 // server.
 type Handler struct {
 	Backend Backend
 	Prefix  string
+	// Authorizer enables access control, as defined in RFC 3744. If nil,
+	// all requests are allowed.
+	Authorizer webdav.Authorizer
 }
 
 // ServeHTTP implements http.Handler.
@@ -66,16 +88,22 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	b := backend{
+		Backend: h.Backend,
+		Prefix:  strings.TrimSuffix(h.Prefix, "/"),
+	}
+	hh := internal.Handler{
+		Backend:    &b,
+		Authorizer: internal.NewAuthorizer(h.Authorizer),
+	}
+
 	var err error
 	switch r.Method {
 	case "REPORT":
-		err = h.handleReport(w, r)
-	default:
-		b := backend{
-			Backend: h.Backend,
-			Prefix:  strings.TrimSuffix(h.Prefix, "/"),
+		if err = hh.Authorize(r); err == nil {
+			err = h.handleReport(w, r, &hh)
 		}
-		hh := internal.Handler{Backend: &b}
+	default:
 		hh.ServeHTTP(w, r)
 	}
 
@@ -84,18 +112,22 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *Handler) handleReport(w http.ResponseWriter, r *http.Request) error {
+func (h *Handler) handleReport(w http.ResponseWriter, r *http.Request, hh *internal.Handler) error {
 	var report reportReq
 	if err := internal.DecodeXMLRequest(r, &report); err != nil {
 		return err
 	}
 
 	if report.Query != nil {
-		return h.handleQuery(r, w, report.Query)
+		return h.handleQuery(r, w, hh, report.Query)
 	} else if report.Multiget != nil {
-		return h.handleMultiget(r.Context(), w, report.Multiget)
+		return h.handleMultiget(r, w, hh, report.Multiget)
+	} else if report.ExpandProperty != nil {
+		return hh.ServeExpandProperty(w, r, report.ExpandProperty)
+	} else if report.SyncCollection != nil {
+		return hh.ServeSyncCollection(w, r, report.SyncCollection)
 	}
-	return internal.HTTPErrorf(http.StatusBadRequest, "carddav: expected addressbook-query or addressbook-multiget element in REPORT request")
+	return internal.HTTPErrorf(http.StatusBadRequest, "carddav: expected addressbook-query, addressbook-multiget, expand-property or sync-collection element in REPORT request")
 }
 
 func decodePropFilter(el *propFilter) (*PropFilter, error) {
@@ -106,8 +138,12 @@ func decodePropFilter(el *propFilter) (*PropFilter, error) {
 		}
 		pf.IsNotDefined = true
 	}
-	for _, tm := range el.TextMatches {
-		pf.TextMatches = append(pf.TextMatches, *decodeTextMatch(&tm))
+	for _, el := range el.TextMatches {
+		tm, err := decodeTextMatch(&el)
+		if err != nil {
+			return nil, err
+		}
+		pf.TextMatches = append(pf.TextMatches, *tm)
 	}
 	for _, paramEl := range el.Params {
 		param, err := decodeParamFilter(&paramEl)
@@ -128,17 +164,25 @@ func decodeParamFilter(el *paramFilter) (*ParamFilter, error) {
 		pf.IsNotDefined = true
 	}
 	if el.TextMatch != nil {
-		pf.TextMatch = decodeTextMatch(el.TextMatch)
+		tm, err := decodeTextMatch(el.TextMatch)
+		if err != nil {
+			return nil, err
+		}
+		pf.TextMatch = tm
 	}
 	return pf, nil
 }
 
-func decodeTextMatch(tm *textMatch) *TextMatch {
+func decodeTextMatch(tm *textMatch) (*TextMatch, error) {
+	if tm.Collation != "" && !internal.IsSupportedCollation(tm.Collation) {
+		return nil, internal.NewPreconditionError(http.StatusForbidden, &supportedCollation{})
+	}
 	return &TextMatch{
 		Text:            tm.Text,
 		NegateCondition: bool(tm.NegateCondition),
 		MatchType:       MatchType(tm.MatchType),
-	}
+		Collation:       tm.Collation,
+	}, nil
 }
 
 func decodeAddressDataReq(addressData *addressDataReq) (*AddressDataRequest, error) {
@@ -150,10 +194,159 @@ func decodeAddressDataReq(addressData *addressDataReq) (*AddressDataRequest, err
 	for _, p := range addressData.Props {
 		req.Props = append(req.Props, p.Name)
 	}
+
+	if addressData.ContentType != "" || addressData.Version != "" {
+		// RFC 6352 section 10.4 defines the defaults
+		contentType, version := strings.ToLower(addressData.ContentType), addressData.Version
+		if contentType == "" {
+			contentType = vcard.MIMEType
+		}
+		if version == "" {
+			if contentType == JCardMIMEType {
+				version = "4.0"
+			} else {
+				version = "3.0"
+			}
+		}
+		if !isSupportedAddressData(contentType, version) {
+			return nil, internal.NewPreconditionError(http.StatusForbidden, &supportedAddressData{
+				Types: encodeSupportedAddressData(defaultSupportedAddressData),
+			})
+		}
+		req.ContentType = contentType
+		req.Version = version
+	}
+
 	return req, nil
 }
 
-func (h *Handler) handleQuery(r *http.Request, w http.ResponseWriter, query *addressbookQuery) error {
+func encodeSupportedAddressData(types []AddressDataType) []addressDataType {
+	l := make([]addressDataType, len(types))
+	for i, t := range types {
+		l[i] = addressDataType{ContentType: t.ContentType, Version: t.Version}
+	}
+	return l
+}
+
+// convertAddressObject converts the card of an address object to the version
+// requested by req, if any. The original address object isn't modified.
+func convertAddressObject(ao *AddressObject, req *AddressDataRequest) (*AddressObject, error) {
+	if req.Version == "" || len(ao.Card) == 0 || ao.Card.Value(vcard.FieldVersion) == req.Version {
+		return ao, nil
+	}
+	card, err := ConvertCard(ao.Card, req.Version)
+	if err != nil {
+		return nil, err
+	}
+	converted := *ao
+	converted.Card = card
+	// The length of the stored card doesn't apply to the converted one
+	converted.ContentLength = 0
+	return &converted, nil
+}
+
+// isSupportedAddressData returns true if the server can return address data
+// of the provided type.
+func isSupportedAddressData(contentType, version string) bool {
+	switch contentType {
+	case vcard.MIMEType:
+		return isSupportedVersion(version)
+	case JCardMIMEType:
+		return version == "4.0"
+	}
+	return false
+}
+
+// negotiateAddressData picks the media type and vCard version returned by a
+// GET request from its Accept header. An empty version means that the card is
+// returned as stored.
+func negotiateAddressData(accept string) (*AddressDataRequest, error) {
+	if accept == "" {
+		return &AddressDataRequest{}, nil
+	}
+
+	// Cards are returned as stored unless a specific version is preferred
+	candidates := []AddressDataType{{ContentType: vcard.MIMEType}}
+	candidates = append(candidates, defaultSupportedAddressData...)
+
+	ranges := internal.ParseAccept(accept)
+	var best *AddressDataRequest
+	bestQ, matched := 0.0, false
+	for _, t := range candidates {
+		params := map[string]string{"charset": "utf-8"}
+		if t.Version != "" {
+			params["version"] = t.Version
+		}
+		q, ok := internal.AcceptQuality(ranges, t.ContentType, params)
+		matched = matched || ok
+		if q > bestQ {
+			best, bestQ = &AddressDataRequest{ContentType: t.ContentType, Version: t.Version}, q
+		}
+	}
+	if best != nil {
+		if best.Version == "" {
+			best.ContentType = ""
+		}
+		return best, nil
+	}
+
+	rejected := matched
+	for _, mr := range ranges {
+		if mr.Type == vcard.MIMEType || mr.Type == JCardMIMEType {
+			rejected = true
+		}
+	}
+	if rejected {
+		return nil, internal.NewPreconditionError(http.StatusNotAcceptable, &supportedAddressData{
+			Types: encodeSupportedAddressData(defaultSupportedAddressData),
+		})
+	}
+	// Be lenient with clients which don't send a proper Accept header
+	return &AddressDataRequest{}, nil
+}
+
+// encodeAddressData writes a card in the media type requested by req.
+func encodeAddressData(w io.Writer, card vcard.Card, req *AddressDataRequest) error {
+	if req.ContentType == JCardMIMEType {
+		return EncodeJCard(w, card)
+	}
+	return vcard.NewEncoder(w).Encode(card)
+}
+
+// decodeAddressDataProp decodes the CARDDAV:address-data element of a
+// DAV:prop element, if any.
+func decodeAddressDataProp(prop *internal.Prop) (*AddressDataRequest, error) {
+	if prop == nil {
+		return &AddressDataRequest{}, nil
+	}
+	var addressData addressDataReq
+	if err := prop.Decode(&addressData); err != nil && !internal.IsNotFound(err) {
+		return nil, err
+	}
+	return decodeAddressDataReq(&addressData)
+}
+
+// filterCard returns a card containing only the properties requested by req.
+// VERSION is always included, since it's mandatory.
+func filterCard(card vcard.Card, req *AddressDataRequest) vcard.Card {
+	if req.AllProp || len(req.Props) == 0 {
+		return card
+	}
+
+	filtered := make(vcard.Card)
+	if fields, ok := card[vcard.FieldVersion]; ok {
+		filtered[vcard.FieldVersion] = fields
+	}
+	for _, name := range req.Props {
+		name = strings.ToUpper(name)
+		if fields, ok := card[name]; ok {
+			filtered[name] = fields
+		}
+	}
+	return filtered
+}
+
+func (h *Handler) handleQuery(r *http.Request, w http.ResponseWriter, hh *internal.Handler, query *addressbookQuery) error {
 	var q AddressBookQuery
 	if query.Prop != nil {
 		var addressData addressDataReq
@@ -197,34 +390,39 @@ func (h *Handler) handleQuery(r *http.Request, w http.ResponseWriter, query *add
 			AllProp:  query.AllProp,
 			PropName: query.PropName,
 		}
-		resp, err := b.propFindAddressObject(r.Context(), &propfind, &ao)
+		converted, err := convertAddressObject(&ao, &q.DataRequest)
+		if err != nil {
+			return err
+		}
+		resp, err := b.propFindAddressObject(r.Context(), &propfind, converted, &q.DataRequest)
 		if err != nil {
 			return err
 		}
 		resps = append(resps, *resp)
 	}
 
+	propfind := internal.PropFind{Prop: query.Prop, AllProp: query.AllProp, PropName: query.PropName}
+	if err := hh.AuthorizeResponses(r, &propfind, resps); err != nil {
+		return err
+	}
+
 	ms := internal.NewMultiStatus(resps...)
 	return internal.ServeMultiStatus(w, ms)
 }
 
-func (h *Handler) handleMultiget(ctx context.Context, w http.ResponseWriter, multiget *addressbookMultiget) error {
-	var dataReq AddressDataRequest
-	if multiget.Prop != nil {
-		var addressData addressDataReq
-		if err := multiget.Prop.Decode(&addressData); err != nil && !internal.IsNotFound(err) {
-			return err
-		}
-		decoded, err := decodeAddressDataReq(&addressData)
-		if err != nil {
-			return err
-		}
-		dataReq = *decoded
+func (h *Handler) handleMultiget(r *http.Request, w http.ResponseWriter, hh *internal.Handler, multiget *addressbookMultiget) error {
+	ctx := r.Context()
+	dataReq, err := decodeAddressDataProp(multiget.Prop)
+	if err != nil {
+		return err
 	}
 
 	var resps []internal.Response
 	for _, href := range multiget.Hrefs {
-		ao, err := h.Backend.GetAddressObject(ctx, href.Path, &dataReq)
+		ao, err := h.Backend.GetAddressObject(ctx, href.Path, dataReq)
+		if err == nil {
+			ao, err = convertAddressObject(ao, dataReq)
+		}
 		if err != nil {
 			resp := internal.NewErrorResponse(href.Path, err)
 			resps = append(resps, *resp)
@@ -240,13 +438,18 @@ func (h *Handler) handleMultiget(ctx context.Context, w http.ResponseWriter, mul
 			AllProp:  multiget.AllProp,
 			PropName: multiget.PropName,
 		}
-		resp, err := b.propFindAddressObject(ctx, &propfind, ao)
+		resp, err := b.propFindAddressObject(ctx, &propfind, ao, dataReq)
 		if err != nil {
 			return err
 		}
 		resps = append(resps, *resp)
 	}
 
+	propfind := internal.PropFind{Prop: multiget.Prop, AllProp: multiget.AllProp, PropName: multiget.PropName}
+	if err := hh.AuthorizeResponses(r, &propfind, resps); err != nil {
+		return err
+	}
+
 	ms := internal.NewMultiStatus(resps...)
 	return internal.ServeMultiStatus(w, ms)
 }
@@ -305,17 +508,56 @@ func (b *backend) Options(r *http.Request) (caps []string, allow []string, err e
 	}, nil
 }
 
+func (b *backend) ResourceState(r *http.Request, p string) (*internal.ResourceState, error) {
+	ctx := r.Context()
+	var state internal.ResourceState
+	var err error
+	switch b.resourceTypeAtPath(p) {
+	case resourceTypeAddressBook:
+		_, err = b.Backend.GetAddressBook(ctx, p)
+	case resourceTypeAddressObject:
+		var o *AddressObject
+		o, err = b.Backend.GetAddressObject(ctx, p, &AddressDataRequest{})
+		if err == nil {
+			state.ETag = o.ETag
+		}
+	default:
+		return &state, nil
+	}
+	if internal.IsNotFound(err) {
+		return &state, nil
+	} else if err != nil {
+		return nil, err
+	}
+	state.Exists = true
+	return &state, nil
+}
+
 func (b *backend) HeadGet(w http.ResponseWriter, r *http.Request) error {
-	var dataReq AddressDataRequest
+	dataReq, err := negotiateAddressData(r.Header.Get("Accept"))
+	if err != nil {
+		return err
+	}
 	if r.Method != http.MethodHead {
 		dataReq.AllProp = true
 	}
-	ao, err := b.Backend.GetAddressObject(r.Context(), r.URL.Path, &dataReq)
+	ao, err := b.Backend.GetAddressObject(r.Context(), r.URL.Path, dataReq)
 	if err != nil {
 		return err
 	}
+	if ao, err = convertAddressObject(ao, dataReq); err != nil {
+		return err
+	}
 
-	w.Header().Set("Content-Type", vcard.MIMEType)
+	switch {
+	case dataReq.ContentType == JCardMIMEType:
+		w.Header().Set("Content-Type", JCardMIMEType)
+	case dataReq.Version != "":
+		w.Header().Set("Content-Type", mime.FormatMediaType(vcard.MIMEType, map[string]string{"version": dataReq.Version}))
+	default:
+		w.Header().Set("Content-Type", vcard.MIMEType)
+	}
+	w.Header().Set("Vary", "Accept")
 	if ao.ContentLength > 0 {
 		w.Header().Set("Content-Length", strconv.FormatInt(ao.ContentLength, 10))
 	}
@@ -327,7 +569,7 @@ func (b *backend) HeadGet(w http.ResponseWriter, r *http.Request) error {
 	}
 
 	if r.Method != http.MethodHead {
-		return vcard.NewEncoder(w).Encode(ao.Card)
+		return encodeAddressData(w, ao.Card, dataReq)
 	}
 	return nil
 }
@@ -414,7 +656,7 @@ func (b *backend) PropFind(r *http.Request, propfind *internal.PropFind, depth i
 			return nil, err
 		}
 
-		resp, err := b.propFindAddressObject(r.Context(), propfind, ao)
+		resp, err := b.propFindAddressObject(r.Context(), propfind, ao, &dataReq)
 		if err != nil {
 			return nil, err
 		}
@@ -492,10 +734,7 @@ func (b *backend) propFindAddressBook(ctx context.Context, propfind *internal.Pr
 		},
 		internal.ResourceTypeName: internal.PropFindValue(internal.NewResourceType(internal.CollectionName, addressBookName)),
 		supportedAddressDataName: internal.PropFindValue(&supportedAddressData{
-			Types: []addressDataType{
-				{ContentType: vcard.MIMEType, Version: "3.0"},
-				{ContentType: vcard.MIMEType, Version: "4.0"},
-			},
+			Types: encodeSupportedAddressData(defaultSupportedAddressData),
 		}),
 		internal.CurrentUserPrivilegeSetName: internal.PropFindValue(internal.NewCurrentUserPrivilegeSet(ab.ReadOnly)),
 	}
@@ -516,9 +755,79 @@ func (b *backend) propFindAddressBook(ctx context.Context, propfind *internal.Pr
 		})
 	}
 
+	// RFC 6578 section 4 excludes the sync token from allprop
+	if sb, ok := b.Backend.(SyncBackend); ok && propfind.AllProp == nil {
+		props[internal.SyncTokenName] = func(*internal.RawXMLValue) (interface{}, error) {
+			token, err := sb.AddressBookSyncToken(ctx, ab.Path)
+			if err != nil {
+				return nil, err
+			}
+			return &internal.SyncToken{Token: token}, nil
+		}
+	}
+
 	return internal.NewPropFindResponse(ab.Path, propfind, props)
 }
 
+func (b *backend) SyncCollection(r *http.Request, query *internal.SyncCollectionQuery, level internal.Depth, mw *internal.MultiStatusWriter) (truncated bool, err error) {
+	sb, ok := b.Backend.(SyncBackend)
+	if !ok {
+		return false, internal.HTTPErrorf(http.StatusForbidden, "carddav: sync-collection is not supported")
+	}
+	// Address books can't contain collections, so all sync levels are
+	// equivalent
+	if b.resourceTypeAtPath(r.URL.Path) != resourceTypeAddressBook {
+		return false, internal.HTTPErrorf(http.StatusForbidden, "carddav: sync-collection is only supported on address books")
+	}
+
+	dataReq, err := decodeAddressDataProp(query.Prop)
+	if err != nil {
+		return false, err
+	}
+	q := SyncQuery{
+		DataRequest: *dataReq,
+		SyncToken:   query.SyncToken,
+	}
+	if query.Limit != nil {
+		q.Limit = int(query.Limit.NResults)
+	}
+
+	ctx := r.Context()
+	resp, err := sb.SyncCollection(ctx, r.URL.Path, &q)
+	if err != nil {
+		return false, err
+	}
+
+	propfind := internal.PropFind{Prop: query.Prop}
+	for _, ao := range resp.Updated {
+		converted, err := convertAddressObject(&ao, dataReq)
+		if err != nil {
+			return false, err
+		}
+		ao = *converted
+		ao.Card = filterCard(ao.Card, dataReq)
+		objResp, err := b.propFindAddressObject(ctx, &propfind, &ao, dataReq)
+		if err != nil {
+			return false, err
+		}
+		if err := mw.WriteResponse(objResp); err != nil {
+			return false, err
+		}
+	}
+	for _, p := range resp.Deleted {
+		objResp := internal.Response{
+			Hrefs:  []internal.Href{{Path: p}},
+			Status: &internal.Status{Code: http.StatusNotFound},
+		}
+		if err := mw.WriteResponse(&objResp); err != nil {
+			return false, err
+		}
+	}
+
+	mw.SyncToken = resp.SyncToken
+	return resp.Truncated, nil
+}
+
 func (b *backend) propFindAllAddressBooks(ctx context.Context, propfind *internal.PropFind, recurse bool) ([]internal.Response, error) {
 	abs, err := b.Backend.ListAddressBooks(ctx)
 	if err != nil {
@@ -543,7 +852,7 @@ func (b *backend) propFindAllAddressBooks(ctx context.Context, propfind *interna
 	return resps, nil
 }
 
-func (b *backend) propFindAddressObject(ctx context.Context, propfind *internal.PropFind, ao *AddressObject) (*internal.Response, error) {
+func (b *backend) propFindAddressObject(ctx context.Context, propfind *internal.PropFind, ao *AddressObject, dataReq *AddressDataRequest) (*internal.Response, error) {
 	props := map[xml.Name]internal.PropFindFunc{
 		internal.CurrentUserPrincipalName: func(*internal.RawXMLValue) (interface{}, error) {
 			path, err := b.Backend.CurrentUserPrincipal(ctx)
@@ -558,11 +867,15 @@ func (b *backend) propFindAddressObject(ctx context.Context, propfind *internal.
 		// TODO: address-data can only be used in REPORT requests
 		addressDataName: func(*internal.RawXMLValue) (interface{}, error) {
 			var buf bytes.Buffer
-			if err := vcard.NewEncoder(&buf).Encode(ao.Card); err != nil {
+			if err := encodeAddressData(&buf, ao.Card, dataReq); err != nil {
 				return nil, err
 			}
 
-			return &addressDataResp{Data: buf.Bytes()}, nil
+			return &addressDataResp{
+				ContentType: dataReq.ContentType,
+				Version:     dataReq.Version,
+				Data:        buf.Bytes(),
+			}, nil
 		},
 	}
 
@@ -595,7 +908,7 @@ func (b *backend) propFindAllAddressObjects(ctx context.Context, propfind *inter
 
 	var resps []internal.Response
 	for _, ao := range aos {
-		resp, err := b.propFindAddressObject(ctx, propfind, &ao)
+		resp, err := b.propFindAddressObject(ctx, propfind, &ao, &dataReq)
 		if err != nil {
 			return nil, err
 		}
@@ -657,18 +970,36 @@ func (b *backend) Put(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return internal.HTTPErrorf(http.StatusBadRequest, "carddav: malformed Content-Type: %v", err)
 	}
-	if t != vcard.MIMEType {
-		// TODO: send CARDDAV:supported-address-data error
-		return internal.HTTPErrorf(http.StatusBadRequest, "carddav: unsupporetd Content-Type %q", t)
-	}
-
 	// TODO: check CARDDAV:max-resource-size precondition
-	card, err := vcard.NewDecoder(r.Body).Decode()
+	var card vcard.Card
+	switch t {
+	case vcard.MIMEType:
+		card, err = vcard.NewDecoder(r.Body).Decode()
+	case JCardMIMEType:
+		card, err = DecodeJCard(r.Body)
+	default:
+		return NewPreconditionError(PreconditionSupportedAddressData)
+	}
 	if err != nil {
 		// TODO: send CARDDAV:valid-address-data error
 		return internal.HTTPErrorf(http.StatusBadRequest, "carddav: failed to parse vCard: %v", err)
 	}
 
+	ab, err := b.Backend.GetAddressBook(r.Context(), path.Dir(r.URL.Path))
+	if err != nil {
+		return err
+	}
+	if version := card.Value(vcard.FieldVersion); !ab.SupportsAddressData(t, version) {
+		storageVersion, ok := ab.storageVersion()
+		if !ok || !isSupportedVersion(version) {
+			return NewPreconditionError(PreconditionSupportedAddressData)
+		}
+		card, err = ConvertCard(card, storageVersion)
+		if err != nil {
+			return internal.HTTPErrorf(http.StatusBadRequest, "carddav: failed to convert vCard: %v", err)
+		}
+	}
+
 	// TODO: add support for the CARDDAV:no-uid-conflict error
 	ao, err := b.Backend.PutAddressObject(r.Context(), r.URL.Path, card, &opts)
 	if err != nil {
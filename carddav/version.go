@@ -0,0 +1,381 @@
+package carddav
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/emersion/go-vcard"
+)
+
+// See https://datatracker.ietf.org/doc/html/rfc6350#appendix-A and
+// https://github.com/mangstadt/ez-vcard/wiki/Version-differences
+
+func isSupportedVersion(version string) bool {
+	return version == "3.0" || version == "4.0"
+}
+
+// v3ExtensionFields maps vCard 4.0 properties to the extension properties
+// commonly used to represent them in vCard 3.0.
+var v3ExtensionFields = map[string]string{
+	vcard.FieldKind:        "X-ADDRESSBOOKSERVER-KIND",
+	vcard.FieldMember:      "X-ADDRESSBOOKSERVER-MEMBER",
+	vcard.FieldAnniversary: "X-ANNIVERSARY",
+}
+
+// binaryFields lists the properties which can hold inline binary data, with
+// the top-level media type used when the vCard 3.0 type isn't a media type.
+var binaryFields = map[string]string{
+	vcard.FieldPhoto: "image",
+	vcard.FieldLogo:  "image",
+	vcard.FieldSound: "audio",
+	vcard.FieldKey:   "application",
+}
+
+const (
+	fieldLabel      = "LABEL"
+	fieldSortString = "SORT-STRING"
+	paramEncoding   = "ENCODING"
+	paramLabel      = "LABEL"
+)
+
+// ConvertCard returns a copy of a card converted to a vCard version, either
+// "3.0" or "4.0". The original card isn't modified.
+//
+// Properties and parameters are translated when vCard 3.0 and 4.0 represent
+// the same data differently: preferences, inline binary data, dates,
+// geographic positions, address labels and groups. Properties which only
+// exist in vCard 3.0 and have no equivalent in vCard 4.0 (NAME, MAILER, CLASS,
+// AGENT and PROFILE) are dropped.
+func ConvertCard(card vcard.Card, version string) (vcard.Card, error) {
+	if !isSupportedVersion(version) {
+		return nil, fmt.Errorf("carddav: unsupported vCard version %q", version)
+	}
+	from := card.Value(vcard.FieldVersion)
+	if !isSupportedVersion(from) {
+		return nil, fmt.Errorf("carddav: cannot convert from vCard version %q", from)
+	}
+
+	var converted vcard.Card
+	switch {
+	case from == version:
+		converted = copyCard(card)
+	case version == "4.0":
+		converted = convertCardToV4(card)
+	default:
+		converted = convertCardToV3(card)
+	}
+	converted.SetValue(vcard.FieldVersion, version)
+	return converted, nil
+}
+
+func copyCard(card vcard.Card) vcard.Card {
+	copied := make(vcard.Card, len(card))
+	for name, fields := range card {
+		for _, field := range fields {
+			copied[name] = append(copied[name], copyField(field))
+		}
+	}
+	return copied
+}
+
+func copyField(field *vcard.Field) *vcard.Field {
+	params := make(vcard.Params, len(field.Params))
+	for k, values := range field.Params {
+		params[k] = append([]string(nil), values...)
+	}
+	return &vcard.Field{Value: field.Value, Params: params, Group: field.Group}
+}
+
+func convertCardToV4(card vcard.Card) vcard.Card {
+	converted := make(vcard.Card, len(card))
+	var labels, sortStrings []*vcard.Field
+	for name, fields := range card {
+		for _, field := range fields {
+			field = copyField(field)
+
+			if field.Params.HasType("pref") {
+				removeType(field.Params, "pref")
+				if field.Params.Get(vcard.ParamPreferred) == "" {
+					field.Params.Set(vcard.ParamPreferred, "1")
+				}
+			}
+
+			v4Name := name
+			switch name {
+			case "NAME", "MAILER", "CLASS", "AGENT", "PROFILE":
+				continue
+			case fieldLabel:
+				labels = append(labels, field)
+				continue
+			case fieldSortString:
+				sortStrings = append(sortStrings, field)
+				continue
+			case v3ExtensionFields[vcard.FieldKind]:
+				v4Name = vcard.FieldKind
+			case v3ExtensionFields[vcard.FieldMember]:
+				v4Name = vcard.FieldMember
+			case v3ExtensionFields[vcard.FieldAnniversary]:
+				v4Name = vcard.FieldAnniversary
+			}
+
+			switch v4Name {
+			case vcard.FieldPhoto, vcard.FieldLogo, vcard.FieldSound, vcard.FieldKey:
+				convertBinaryToV4(v4Name, field)
+			case vcard.FieldBirthday, vcard.FieldAnniversary:
+				if !strings.EqualFold(field.Params.Get(vcard.ParamValue), "text") {
+					field.Value = formatBasicDateTime(field.Value)
+				}
+			case vcard.FieldGeolocation:
+				if !strings.HasPrefix(field.Value, "geo:") {
+					field.Value = "geo:" + strings.Replace(field.Value, ";", ",", 1)
+				}
+			}
+
+			converted[v4Name] = append(converted[v4Name], field)
+		}
+	}
+
+	// vCard 4.0 attaches labels to addresses
+	for _, label := range labels {
+		for _, adr := range converted[vcard.FieldAddress] {
+			if _, ok := adr.Params[paramLabel]; !ok && sameTypes(adr.Params, label.Params) {
+				adr.Params.Set(paramLabel, label.Value)
+				break
+			}
+		}
+	}
+	if len(sortStrings) > 0 {
+		if n := converted.Get(vcard.FieldName); n != nil && n.Params.Get(vcard.ParamSortAs) == "" {
+			n.Params.Set(vcard.ParamSortAs, sortStrings[0].Value)
+		}
+	}
+
+	return converted
+}
+
+func convertCardToV3(card vcard.Card) vcard.Card {
+	converted := make(vcard.Card, len(card))
+	for name, fields := range card {
+		switch name {
+		case vcard.FieldClientPIDMap, vcard.FieldXML:
+			continue
+		}
+
+		for _, field := range fields {
+			field = copyField(field)
+
+			if pref := field.Params.Get(vcard.ParamPreferred); pref != "" {
+				if pref == "1" && !field.Params.HasType("pref") {
+					field.Params.Add(vcard.ParamType, "pref")
+				}
+				delete(field.Params, vcard.ParamPreferred)
+			}
+			delete(field.Params, vcard.ParamPID)
+			delete(field.Params, vcard.ParamAltID)
+
+			switch name {
+			case vcard.FieldPhoto, vcard.FieldLogo, vcard.FieldSound, vcard.FieldKey:
+				convertBinaryToV3(field)
+			case vcard.FieldBirthday, vcard.FieldAnniversary:
+				if !strings.EqualFold(field.Params.Get(vcard.ParamValue), "text") {
+					field.Value = formatExtendedDateTime(field.Value)
+				}
+			case vcard.FieldGeolocation:
+				if strings.HasPrefix(field.Value, "geo:") {
+					coords := strings.TrimPrefix(field.Value, "geo:")
+					if i := strings.IndexByte(coords, ';'); i >= 0 {
+						coords = coords[:i]
+					}
+					field.Value = strings.Replace(coords, ",", ";", 1)
+				}
+			case vcard.FieldTelephone:
+				if strings.EqualFold(field.Params.Get(vcard.ParamValue), "uri") && strings.HasPrefix(field.Value, "tel:") {
+					field.Value = strings.TrimPrefix(field.Value, "tel:")
+					delete(field.Params, vcard.ParamValue)
+				}
+			case vcard.FieldAddress:
+				// vCard 3.0 has a separate property for labels
+				if label := field.Params.Get(paramLabel); label != "" {
+					labelField := &vcard.Field{Value: label, Params: make(vcard.Params), Group: field.Group}
+					if types := field.Params[vcard.ParamType]; len(types) > 0 {
+						labelField.Params[vcard.ParamType] = append([]string(nil), types...)
+					}
+					converted.Add(fieldLabel, labelField)
+				}
+				delete(field.Params, paramLabel)
+			case vcard.FieldName:
+				if sortAs := field.Params.Get(vcard.ParamSortAs); sortAs != "" {
+					converted.SetValue(fieldSortString, sortAs)
+				}
+				delete(field.Params, vcard.ParamSortAs)
+			}
+
+			v3Name := name
+			if extName, ok := v3ExtensionFields[name]; ok {
+				v3Name = extName
+			}
+			converted[v3Name] = append(converted[v3Name], field)
+		}
+	}
+
+	// N is mandatory in vCard 3.0
+	if converted.Get(vcard.FieldName) == nil {
+		converted.SetValue(vcard.FieldName, ";;;;")
+	}
+
+	return converted
+}
+
+// convertBinaryToV4 converts vCard 3.0 inline binary data to a data URI.
+func convertBinaryToV4(name string, field *vcard.Field) {
+	mediaType := ""
+	if t := field.Params.Get(vcard.ParamType); t != "" {
+		mediaType = strings.ToLower(t)
+		if !strings.Contains(mediaType, "/") {
+			mediaType = binaryFields[name] + "/" + mediaType
+		}
+	}
+
+	switch enc := field.Params.Get(paramEncoding); {
+	case strings.EqualFold(enc, "b"), strings.EqualFold(enc, "base64"):
+		field.Value = "data:" + mediaType + ";base64," + field.Value
+		delete(field.Params, paramEncoding)
+		delete(field.Params, vcard.ParamType)
+	case strings.EqualFold(field.Params.Get(vcard.ParamValue), "uri"):
+		if mediaType != "" {
+			field.Params.Set(vcard.ParamMediaType, mediaType)
+		}
+		delete(field.Params, vcard.ParamType)
+		delete(field.Params, vcard.ParamValue)
+	}
+}
+
+// convertBinaryToV3 converts a base64 data URI to vCard 3.0 inline binary
+// data. Other URIs are kept as is.
+func convertBinaryToV3(field *vcard.Field) {
+	mediaType := field.Params.Get(vcard.ParamMediaType)
+	delete(field.Params, vcard.ParamMediaType)
+
+	if strings.HasPrefix(field.Value, "data:") {
+		if i := strings.IndexByte(field.Value, ','); i >= 0 && strings.HasSuffix(field.Value[:i], ";base64") {
+			mediaType = strings.TrimSuffix(strings.TrimPrefix(field.Value[:i], "data:"), ";base64")
+			field.Value = field.Value[i+1:]
+			field.Params.Set(paramEncoding, "b")
+			delete(field.Params, vcard.ParamValue)
+			if mediaType != "" {
+				field.Params.Set(vcard.ParamType, mediaSubtype(mediaType))
+			}
+			return
+		}
+	}
+
+	field.Params.Set(vcard.ParamValue, "uri")
+	if mediaType != "" {
+		field.Params.Set(vcard.ParamType, mediaSubtype(mediaType))
+	}
+}
+
+func mediaSubtype(mediaType string) string {
+	if i := strings.IndexByte(mediaType, '/'); i >= 0 {
+		mediaType = mediaType[i+1:]
+	}
+	return strings.ToUpper(mediaType)
+}
+
+func removeType(params vcard.Params, t string) {
+	var types []string
+	for _, tt := range params[vcard.ParamType] {
+		if !strings.EqualFold(tt, t) {
+			types = append(types, tt)
+		}
+	}
+	if len(types) > 0 {
+		params[vcard.ParamType] = types
+	} else {
+		delete(params, vcard.ParamType)
+	}
+}
+
+// sameTypes returns true if both parameter sets have the same types, ignoring
+// preferences.
+func sameTypes(a, b vcard.Params) bool {
+	count := func(params vcard.Params) map[string]bool {
+		m := make(map[string]bool)
+		for _, t := range params.Types() {
+			if t != "pref" {
+				m[t] = true
+			}
+		}
+		return m
+	}
+	ta, tb := count(a), count(b)
+	if len(ta) != len(tb) {
+		return false
+	}
+	for t := range ta {
+		if !tb[t] {
+			return false
+		}
+	}
+	return true
+}
+
+// formatBasicDateTime converts an ISO 8601 date-time in the extended format
+// used by vCard 3.0 (e.g. "1985-04-12T10:22:00Z") to the basic format used
+// by vCard 4.0 (e.g. "19850412T102200Z").
+func formatBasicDateTime(s string) string {
+	date, t := s, ""
+	if i := strings.IndexByte(s, 'T'); i >= 0 {
+		date, t = s[:i], s[i:]
+	}
+
+	prefix := ""
+	if strings.HasPrefix(date, "--") {
+		prefix, date = "--", date[2:]
+	}
+	return prefix + strings.Replace(date, "-", "", -1) + strings.Replace(t, ":", "", -1)
+}
+
+// formatExtendedDateTime is the reverse of formatBasicDateTime. Values which
+// aren't complete dates, such as "--0412", are converted on a best-effort
+// basis.
+func formatExtendedDateTime(s string) string {
+	date, t := s, ""
+	if i := strings.IndexByte(s, 'T'); i >= 0 {
+		date, t = s[:i], s[i+1:]
+	}
+
+	switch {
+	case len(date) == 8 && isDigits(date):
+		date = date[:4] + "-" + date[4:6] + "-" + date[6:]
+	case len(date) == 6 && strings.HasPrefix(date, "--") && isDigits(date[2:]):
+		date = "--" + date[2:4] + "-" + date[4:]
+	}
+	if t == "" {
+		return date
+	}
+
+	zone := ""
+	if i := strings.IndexAny(t, "Z+-"); i >= 0 {
+		t, zone = t[:i], t[i:]
+	}
+	switch {
+	case len(t) == 6 && isDigits(t):
+		t = t[:2] + ":" + t[2:4] + ":" + t[4:]
+	case len(t) == 4 && isDigits(t):
+		t = t[:2] + ":" + t[2:]
+	}
+	if len(zone) == 5 && isDigits(zone[1:]) {
+		zone = zone[:3] + ":" + zone[3:]
+	}
+	return date + "T" + t + zone
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,130 @@
+package carddav
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-vcard"
+)
+
+const v3CardData = `BEGIN:VCARD
+VERSION:3.0
+UID:urn:uuid:4fbe8971-0bc3-424c-9c26-36c3e1eff6b4
+FN:Dave Gopher
+N:Gopher;Dave;;;
+SORT-STRING:Gopher
+EMAIL;TYPE=work,pref:dave@example.org
+EMAIL;TYPE=home:dave@example.com
+PHOTO;ENCODING=b;TYPE=JPEG:MIICajCCAdOgAwIBAgICBEUwDQYJKoZIhvcN
+BDAY:1985-04-12
+GEO:37.386013;-122.082932
+ADR;TYPE=work:;;100 Waters Edge;Baytown;LA;30314;United States of America
+LABEL;TYPE=work:100 Waters Edge\nBaytown\, LA 30314\nUnited States of America
+MAILER:PigeonMail 2.1
+X-ADDRESSBOOKSERVER-KIND:individual
+END:VCARD`
+
+func TestConvertCard(t *testing.T) {
+	card, err := vcard.NewDecoder(strings.NewReader(v3CardData)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v4, err := ConvertCard(card, "4.0")
+	if err != nil {
+		t.Fatalf("ConvertCard(4.0) = %v", err)
+	}
+	if v := card.Value(vcard.FieldVersion); v != "3.0" {
+		t.Errorf("ConvertCard() modified the original card")
+	}
+
+	for _, tc := range []struct {
+		name, value string
+	}{
+		{vcard.FieldVersion, "4.0"},
+		{vcard.FieldPhoto, "data:image/jpeg;base64,MIICajCCAdOgAwIBAgICBEUwDQYJKoZIhvcN"},
+		{vcard.FieldBirthday, "19850412"},
+		{vcard.FieldGeolocation, "geo:37.386013,-122.082932"},
+		{vcard.FieldKind, "individual"},
+	} {
+		if got := v4.Value(tc.name); got != tc.value {
+			t.Errorf("vCard 4.0 %v = %q, want %q", tc.name, got, tc.value)
+		}
+	}
+	if pref := v4.Preferred(vcard.FieldEmail); pref == nil || pref.Value != "dave@example.org" || pref.Params.HasType("pref") {
+		t.Errorf("vCard 4.0 preferred EMAIL = %+v", pref)
+	}
+	if adr := v4.Get(vcard.FieldAddress); adr == nil || !strings.HasPrefix(adr.Params.Get("LABEL"), "100 Waters Edge\n") {
+		t.Errorf("vCard 4.0 ADR = %+v, want LABEL parameter", adr)
+	}
+	if n := v4.Get(vcard.FieldName); n == nil || n.Params.Get(vcard.ParamSortAs) != "Gopher" {
+		t.Errorf("vCard 4.0 N = %+v, want SORT-AS parameter", n)
+	}
+	for _, name := range []string{"MAILER", "LABEL", "SORT-STRING", "X-ADDRESSBOOKSERVER-KIND"} {
+		if v4.Get(name) != nil {
+			t.Errorf("vCard 4.0 contains %v", name)
+		}
+	}
+
+	v3, err := ConvertCard(v4, "3.0")
+	if err != nil {
+		t.Fatalf("ConvertCard(3.0) = %v", err)
+	}
+	for _, name := range []string{vcard.FieldVersion, vcard.FieldPhoto, vcard.FieldBirthday, vcard.FieldGeolocation, "LABEL", "SORT-STRING", "X-ADDRESSBOOKSERVER-KIND"} {
+		if got, want := v3.Value(name), card.Value(name); got != want {
+			t.Errorf("vCard 3.0 %v = %q, want %q", name, got, want)
+		}
+	}
+	if photo := v3.Get(vcard.FieldPhoto); photo == nil || photo.Params.Get("ENCODING") != "b" || photo.Params.Get(vcard.ParamType) != "JPEG" {
+		t.Errorf("vCard 3.0 PHOTO = %+v", photo)
+	}
+	for _, email := range v3[vcard.FieldEmail] {
+		if pref := email.Params.HasType("pref"); pref != (email.Value == "dave@example.org") || email.Params.Get(vcard.ParamPreferred) != "" {
+			t.Errorf("vCard 3.0 EMAIL = %+v", email)
+		}
+	}
+
+	if _, err := ConvertCard(card, "2.1"); err == nil {
+		t.Errorf("ConvertCard(2.1) succeeded")
+	}
+}
+
+func TestConvertCard_v4(t *testing.T) {
+	card, err := vcard.NewDecoder(strings.NewReader(aliceData)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	card.SetValue(vcard.FieldBirthday, "--0412")
+	card.Add(vcard.FieldTelephone, &vcard.Field{
+		Value:  "tel:+1-555-555-5555",
+		Params: vcard.Params{vcard.ParamValue: {"uri"}, vcard.ParamPreferred: {"1"}},
+	})
+	delete(card, vcard.FieldName)
+
+	v3, err := ConvertCard(card, "3.0")
+	if err != nil {
+		t.Fatalf("ConvertCard(3.0) = %v", err)
+	}
+	for _, tc := range []struct {
+		name, value string
+	}{
+		{vcard.FieldVersion, "3.0"},
+		{vcard.FieldFormattedName, "Alice Gopher"},
+		{vcard.FieldName, ";;;;"},
+		{vcard.FieldBirthday, "--04-12"},
+		{vcard.FieldTelephone, "+1-555-555-5555"},
+	} {
+		if got := v3.Value(tc.name); got != tc.value {
+			t.Errorf("vCard 3.0 %v = %q, want %q", tc.name, got, tc.value)
+		}
+	}
+	if fn := v3.Get(vcard.FieldFormattedName); len(fn.Params) != 0 {
+		t.Errorf("vCard 3.0 FN has parameters: %v", fn.Params)
+	}
+	if tel := v3.Get(vcard.FieldTelephone); !tel.Params.HasType("pref") {
+		t.Errorf("vCard 3.0 TEL = %+v, want pref type", tel)
+	}
+	if v3.Get(vcard.FieldClientPIDMap) != nil {
+		t.Errorf("vCard 3.0 contains CLIENTPIDMAP")
+	}
+}
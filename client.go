@@ -179,6 +179,55 @@ func (c *Client) ReadDir(ctx context.Context, name string, recursive bool) ([]Fi
 	return l, errors.Join(errs...)
 }
 
+// Walk lists files in a directory, like ReadDir. Responses are decoded
+// incrementally, so that large directories don't need to be held in memory.
+// Files which can't be decoded are skipped and reported by the iterator's Err
+// method. The returned iterator must be closed.
+func (c *Client) Walk(ctx context.Context, name string, recursive bool) (FileIterator, error) {
+	depth := internal.DepthOne
+	if recursive {
+		depth = internal.DepthInfinity
+	}
+
+	mr, err := c.ic.PropFindReader(ctx, name, depth, fileInfoPropFind)
+	if err != nil {
+		return nil, err
+	}
+	return &clientFileIterator{mr: mr}, nil
+}
+
+type clientFileIterator struct {
+	mr   *internal.MultiStatusReader
+	fi   *FileInfo
+	errs []error
+}
+
+func (it *clientFileIterator) Next() bool {
+	for it.mr.Next() {
+		fi, err := fileInfoFromResponse(it.mr.Response())
+		if err != nil {
+			it.errs = append(it.errs, err)
+			continue
+		}
+		it.fi = fi
+		return true
+	}
+	it.fi = nil
+	return false
+}
+
+func (it *clientFileIterator) FileInfo() *FileInfo {
+	return it.fi
+}
+
+func (it *clientFileIterator) Err() error {
+	return errors.Join(append(it.errs, it.mr.Err())...)
+}
+
+func (it *clientFileIterator) Close() error {
+	return it.mr.Close()
+}
+
 type fileWriter struct {
 	pw   *io.PipeWriter
 	done <-chan error
@@ -220,19 +269,15 @@ func (c *Client) Create(ctx context.Context, name string) (io.WriteCloser, error
 }
 
 // RemoveAll deletes a file. If the file is a directory, all of its descendants
-// are recursively deleted as well.
+// are recursively deleted as well. If only some descendants couldn't be
+// deleted, a *PartialError listing them is returned.
 func (c *Client) RemoveAll(ctx context.Context, name string) error {
 	req, err := c.ic.NewRequest(http.MethodDelete, name, nil)
 	if err != nil {
 		return err
 	}
 
-	resp, err := c.ic.Do(req.WithContext(ctx))
-	if err != nil {
-		return err
-	}
-	resp.Body.Close()
-	return nil
+	return c.doPartial(req.WithContext(ctx))
 }
 
 // Mkdir creates a new directory.
@@ -253,7 +298,8 @@ func (c *Client) Mkdir(ctx context.Context, name string) error {
 // Copy copies a file.
 //
 // By default, if the file is a directory, all descendants are recursively
-// copied as well.
+// copied as well. If only some descendants couldn't be copied, a
+// *PartialError listing them is returned.
 func (c *Client) Copy(ctx context.Context, name, dest string, options *CopyOptions) error {
 	if options == nil {
 		options = new(CopyOptions)
@@ -273,15 +319,11 @@ func (c *Client) Copy(ctx context.Context, name, dest string, options *CopyOptio
 	req.Header.Set("Overwrite", internal.FormatOverwrite(!options.NoOverwrite))
 	req.Header.Set("Depth", depth.String())
 
-	resp, err := c.ic.Do(req.WithContext(ctx))
-	if err != nil {
-		return err
-	}
-	resp.Body.Close()
-	return nil
+	return c.doPartial(req.WithContext(ctx))
 }
 
-// Move moves a file.
+// Move moves a file. If only some descendants couldn't be moved, a
+// *PartialError listing them is returned.
 func (c *Client) Move(ctx context.Context, name, dest string, options *MoveOptions) error {
 	if options == nil {
 		options = new(MoveOptions)
@@ -295,10 +337,26 @@ func (c *Client) Move(ctx context.Context, name, dest string, options *MoveOptio
 	req.Header.Set("Destination", c.ic.ResolveHref(dest).String())
 	req.Header.Set("Overwrite", internal.FormatOverwrite(!options.NoOverwrite))
 
-	resp, err := c.ic.Do(req.WithContext(ctx))
-	if err != nil {
+	return c.doPartial(req.WithContext(ctx))
+}
+
+// doPartial sends a request which may fail on individual members of a
+// collection, converting the resulting error into a *PartialError.
+func (c *Client) doPartial(req *http.Request) error {
+	err := c.ic.DoPartial(req)
+	var ipartial *internal.PartialError
+	if !errors.As(err, &ipartial) {
 		return err
 	}
-	resp.Body.Close()
-	return nil
+
+	partial := &PartialError{Errors: make([]MemberError, len(ipartial.Errors))}
+	for i, merr := range ipartial.Errors {
+		code := http.StatusInternalServerError
+		var httpErr *internal.HTTPError
+		if errors.As(merr.Err, &httpErr) {
+			code = httpErr.Code
+		}
+		partial.Errors[i] = MemberError{Path: merr.Path, StatusCode: code, Err: merr.Err}
+	}
+	return partial
 }
@@ -11,8 +11,9 @@ import (
 )
 
 func main() {
-	var addr string
+	var addr, journal string
 	flag.StringVar(&addr, "addr", ":8080", "listening address")
+	flag.StringVar(&journal, "sync-journal", "", "path of the journal file enabling incremental synchronization")
 	flag.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [options...] [directory]\n", os.Args[0])
 		flag.PrintDefaults()
@@ -24,8 +25,12 @@ func main() {
 		path = "."
 	}
 
+	var fs webdav.FileSystem = webdav.LocalFileSystem(path)
+	if journal != "" {
+		fs = webdav.NewLocalSyncFileSystem(path, journal)
+	}
 	handler := webdav.Handler{
-		FileSystem: webdav.LocalFileSystem(path),
+		FileSystem: fs,
 	}
 	log.Printf("WebDAV server listening on %v", addr)
 	log.Fatal(http.ListenAndServe(addr, &handler))
@@ -2,6 +2,7 @@ package webdav
 
 import (
 	"encoding/xml"
+	"fmt"
 
 	"github.com/emersion/go-webdav/internal"
 )
@@ -10,6 +11,9 @@ var (
 	principalAlternateURISetName = xml.Name{"DAV:", "alternate-URI-set"}
 	principalURLName             = xml.Name{"DAV:", "principal-URL"}
 	groupMembershipName          = xml.Name{"DAV:", "group-membership"}
+
+	principalPropertySearchName    = xml.Name{"DAV:", "principal-property-search"}
+	principalSearchPropertySetName = xml.Name{"DAV:", "principal-search-property-set"}
 )
 
 // https://datatracker.ietf.org/doc/html/rfc3744#section-4.1
@@ -29,3 +33,60 @@ type groupMembership struct {
 	XMLName xml.Name        `xml:"DAV: group-membership"`
 	Hrefs   []internal.Href `xml:"href"`
 }
+
+type principalReportReq struct {
+	PropertySearch    *principalPropertySearch
+	SearchPropertySet *struct{}
+	ExpandProperty    *internal.ExpandProperty
+}
+
+func (r *principalReportReq) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var v interface{}
+	switch start.Name {
+	case principalPropertySearchName:
+		r.PropertySearch = &principalPropertySearch{}
+		v = r.PropertySearch
+	case principalSearchPropertySetName:
+		r.SearchPropertySet = &struct{}{}
+		v = r.SearchPropertySet
+	case internal.ExpandPropertyName:
+		r.ExpandProperty = &internal.ExpandProperty{}
+		v = r.ExpandProperty
+	default:
+		return fmt.Errorf("webdav: unsupported REPORT root %q %q", start.Name.Space, start.Name.Local)
+	}
+
+	return d.DecodeElement(v, &start)
+}
+
+// https://datatracker.ietf.org/doc/html/rfc3744#section-9.4
+type principalPropertySearch struct {
+	XMLName                       xml.Name         `xml:"DAV: principal-property-search"`
+	Test                          string           `xml:"test,attr,omitempty"`
+	PropertySearch                []propertySearch `xml:"property-search"`
+	Prop                          *internal.Prop   `xml:"prop,omitempty"`
+	ApplyToPrincipalCollectionSet *struct{}        `xml:"apply-to-principal-collection-set,omitempty"`
+}
+
+type propertySearch struct {
+	XMLName xml.Name      `xml:"DAV: property-search"`
+	Prop    internal.Prop `xml:"prop"`
+	Match   string        `xml:"match"`
+}
+
+// https://datatracker.ietf.org/doc/html/rfc3744#section-9.5
+type principalSearchPropertySet struct {
+	XMLName                 xml.Name                  `xml:"DAV: principal-search-property-set"`
+	PrincipalSearchProperty []principalSearchProperty `xml:"principal-search-property"`
+}
+
+type principalSearchProperty struct {
+	XMLName     xml.Name      `xml:"DAV: principal-search-property"`
+	Prop        internal.Prop `xml:"prop"`
+	Description description   `xml:"description"`
+}
+
+type description struct {
+	Lang string `xml:"http://www.w3.org/XML/1998/namespace lang,attr,omitempty"`
+	Text string `xml:",chardata"`
+}
@@ -12,6 +12,7 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"syscall"
 
 	"github.com/emersion/go-webdav/internal"
 )
@@ -29,6 +30,16 @@ func (fs LocalFileSystem) localPath(name string) (string, error) {
 	if !path.IsAbs(name) {
 		return "", internal.HTTPErrorf(http.StatusBadRequest, "webdav: expected absolute path, got %q", name)
 	}
+	p := string(fs)
+	for _, elem := range strings.Split(name, "/") {
+		if elem == "" {
+			continue
+		}
+		p = filepath.Join(p, elem)
+		if isLocalReserved(p) {
+			return "", internal.HTTPErrorf(http.StatusForbidden, "webdav: reserved file name %q", elem)
+		}
+	}
 	return filepath.Join(string(fs), filepath.FromSlash(name)), nil
 }
 
@@ -78,6 +89,8 @@ func errFromOS(err error) error {
 		return NewHTTPError(http.StatusForbidden, err)
 	} else if errors.Is(err, os.ErrDeadlineExceeded) {
 		return NewHTTPError(http.StatusServiceUnavailable, err)
+	} else if errors.Is(err, syscall.ENOSPC) {
+		return NewHTTPError(http.StatusInsufficientStorage, err)
 	} else {
 		return err
 	}
@@ -109,6 +122,12 @@ func (fs LocalFileSystem) ReadDir(ctx context.Context, name string, recursive bo
 		if fi == nil {
 			return nil
 		}
+		if isLocalReserved(p) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
 
 		href, err := fs.externalPath(p)
 		if err != nil {
@@ -125,6 +144,143 @@ func (fs LocalFileSystem) ReadDir(ctx context.Context, name string, recursive bo
 	return l, errFromOS(err)
 }
 
+var _ WalkFileSystem = LocalFileSystem("")
+
+func (fs LocalFileSystem) Walk(ctx context.Context, name string, recursive bool) (FileIterator, error) {
+	p, err := fs.localPath(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(p)
+	if err != nil {
+		return nil, errFromOS(err)
+	}
+
+	return &localFileIterator{
+		ctx:       ctx,
+		fs:        fs,
+		recursive: recursive,
+		next:      fileInfoFromOS(name, fi),
+		nextPath:  p,
+	}, nil
+}
+
+// localDirBatchSize is the number of directory entries read at once by
+// localFileIterator.
+const localDirBatchSize = 128
+
+type localDir struct {
+	f       *os.File
+	path    string
+	entries []os.FileInfo
+}
+
+// localFileIterator walks a local directory tree in pre-order. Only the
+// directories on the path to the current file are kept open.
+type localFileIterator struct {
+	ctx       context.Context
+	fs        LocalFileSystem
+	recursive bool
+	stack     []*localDir
+	next      *FileInfo
+	nextPath  string
+	cur       *FileInfo
+	err       error
+}
+
+func (it *localFileIterator) push(p string) error {
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrPermission) {
+		// Skip directories we can't read, like ReadDir does
+		return nil
+	} else if err != nil {
+		return errFromOS(err)
+	}
+	it.stack = append(it.stack, &localDir{f: f, path: p})
+	return nil
+}
+
+func (it *localFileIterator) pop() {
+	d := it.stack[len(it.stack)-1]
+	d.f.Close()
+	it.stack = it.stack[:len(it.stack)-1]
+}
+
+func (it *localFileIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if err := it.ctx.Err(); err != nil {
+		it.err = err
+		return false
+	}
+
+	if it.next != nil {
+		// The root of the walk
+		it.cur, it.next = it.next, nil
+		if it.cur.IsDir {
+			if it.err = it.push(it.nextPath); it.err != nil {
+				return false
+			}
+		}
+		return true
+	}
+
+	for len(it.stack) > 0 {
+		d := it.stack[len(it.stack)-1]
+		if len(d.entries) == 0 {
+			entries, err := d.f.Readdir(localDirBatchSize)
+			if err == io.EOF || (err == nil && len(entries) == 0) {
+				it.pop()
+				continue
+			} else if err != nil {
+				it.err = errFromOS(err)
+				return false
+			}
+			d.entries = entries
+		}
+
+		fi := d.entries[0]
+		d.entries = d.entries[1:]
+		p := filepath.Join(d.path, fi.Name())
+		if isLocalReserved(p) {
+			continue
+		}
+
+		href, err := it.fs.externalPath(p)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.cur = fileInfoFromOS(href, fi)
+
+		if it.recursive && fi.IsDir() {
+			if it.err = it.push(p); it.err != nil {
+				return false
+			}
+		}
+		return true
+	}
+
+	it.cur = nil
+	return false
+}
+
+func (it *localFileIterator) FileInfo() *FileInfo {
+	return it.cur
+}
+
+func (it *localFileIterator) Err() error {
+	return it.err
+}
+
+func (it *localFileIterator) Close() error {
+	for len(it.stack) > 0 {
+		it.pop()
+	}
+	return nil
+}
+
 func checkConditionalMatches(fi *FileInfo, ifMatch, ifNoneMatch ConditionalMatch) error {
 	etag := ""
 	if fi != nil {
@@ -170,11 +326,11 @@ func (fs LocalFileSystem) Create(ctx context.Context, name string, body io.ReadC
 
 	if _, err := io.Copy(wc, body); err != nil {
 		os.Remove(p)
-		return nil, false, err
+		return nil, false, errFromOS(err)
 	}
 	if err := wc.Close(); err != nil {
 		os.Remove(p)
-		return nil, false, err
+		return nil, false, errFromOS(err)
 	}
 
 	fi, err = fs.Stat(ctx, name)
@@ -202,7 +358,77 @@ func (fs LocalFileSystem) RemoveAll(ctx context.Context, name string, opts *Remo
 		return err
 	}
 
-	return errFromOS(os.RemoveAll(p))
+	errs := make(map[string]error)
+	if fs.removeAll(p, errs) {
+		return nil
+	}
+	if err, ok := errs[path.Clean(name)]; ok && len(errs) == 1 {
+		return err
+	}
+	return NewPartialError(errs)
+}
+
+// removeAll removes the local file p and its members, along with their
+// properties. Failures are recorded in errs, keyed by external path. Parents
+// of members which couldn't be removed aren't recorded, as required by RFC
+// 4918 section 9.6.1. It returns false if anything couldn't be removed.
+func (fs LocalFileSystem) removeAll(p string, errs map[string]error) bool {
+	fail := func(err error) bool {
+		if href, herr := fs.externalPath(p); herr == nil {
+			errs[href] = errFromOS(err)
+		}
+		return false
+	}
+
+	fi, err := os.Lstat(p)
+	if os.IsNotExist(err) {
+		return true
+	} else if err != nil {
+		return fail(err)
+	}
+
+	if fi.IsDir() {
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			return fail(err)
+		}
+		ok := true
+		for _, entry := range entries {
+			if isLocalReserved(filepath.Join(p, entry.Name())) {
+				continue
+			}
+			if !fs.removeAll(filepath.Join(p, entry.Name()), errs) {
+				ok = false
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	if err := os.RemoveAll(p); err != nil {
+		return fail(err)
+	}
+	if err := fs.removeProps(p); err != nil {
+		return fail(err)
+	}
+	return true
+}
+
+var _ QuotaFileSystem = LocalFileSystem("")
+
+// QuotaAvailable reports the space available on the filesystem holding the
+// resource.
+func (fs LocalFileSystem) QuotaAvailable(ctx context.Context, name string) (int64, error) {
+	p, err := fs.localPath(name)
+	if err != nil {
+		return 0, err
+	}
+	available, err := statAvailable(p)
+	if err != nil {
+		return 0, errFromOS(err)
+	}
+	return available, nil
 }
 
 func (fs LocalFileSystem) Mkdir(ctx context.Context, name string) error {
@@ -212,9 +438,10 @@ func (fs LocalFileSystem) Mkdir(ctx context.Context, name string) error {
 	}
 	if err := os.Mkdir(p, 0755); os.IsExist(err) {
 		return NewHTTPError(http.StatusMethodNotAllowed, err)
-	} else {
+	} else if err != nil {
 		return errFromOS(err)
 	}
+	return nil
 }
 
 func copyRegularFile(src, dst string, perm os.FileMode) error {
@@ -249,14 +476,16 @@ func (fs LocalFileSystem) Copy(ctx context.Context, src, dst string, options *Co
 		return false, err
 	}
 
-	// TODO: "Note that an infinite-depth COPY of /A/ into /A/B/ could lead to
-	// infinite recursion if not handled correctly"
+	if srcPath == dstPath {
+		return false, NewHTTPError(http.StatusForbidden, fmt.Errorf("webdav: source and destination are the same"))
+	} else if isLocalDescendant(dstPath, srcPath) {
+		// Overwriting the destination would delete the source
+		return false, NewHTTPError(http.StatusForbidden, fmt.Errorf("webdav: destination contains the source"))
+	}
 
-	srcInfo, err := os.Stat(srcPath)
-	if err != nil {
+	if _, err := os.Stat(srcPath); err != nil {
 		return false, errFromOS(err)
 	}
-	srcPerm := srcInfo.Mode() & os.ModePerm
 
 	if _, err := os.Stat(dstPath); err != nil {
 		if !os.IsNotExist(err) {
@@ -270,35 +499,112 @@ func (fs LocalFileSystem) Copy(ctx context.Context, src, dst string, options *Co
 		if err := os.RemoveAll(dstPath); err != nil {
 			return false, errFromOS(err)
 		}
+		if err := fs.removeProps(dstPath); err != nil {
+			return false, errFromOS(err)
+		}
+	}
+
+	// Directory permissions and modification times are applied once their
+	// contents have been copied
+	type copiedDir struct {
+		path string
+		info os.FileInfo
 	}
+	var dirs []copiedDir
 
+	errs := make(map[string]error)
 	err = filepath.Walk(srcPath, func(p string, fi os.FileInfo, err error) error {
-		if err != nil {
-			return err
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if fi != nil && isLocalReserved(p) {
+			return nil
 		}
 
-		if fi.IsDir() {
-			if err := os.Mkdir(dstPath, srcPerm); err != nil {
-				return errFromOS(err)
-			}
-		} else {
-			if err := copyRegularFile(srcPath, dstPath, srcPerm); err != nil {
+		// When copying a directory into one of its members, don't descend
+		// into the copy being created
+		if p == dstPath {
+			return filepath.SkipDir
+		}
+
+		rel, relErr := filepath.Rel(srcPath, p)
+		if relErr != nil {
+			return relErr
+		}
+		target := filepath.Join(dstPath, rel)
+
+		if err == nil {
+			err = fs.copyLocalFile(p, target, fi)
+		}
+		if err != nil {
+			if p == srcPath {
 				return err
 			}
+			href, hrefErr := fs.externalPath(target)
+			if hrefErr != nil {
+				return hrefErr
+			}
+			errs[href] = errFromOS(err)
+			if fi != nil && fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
 		}
 
-		if fi.IsDir() && options.NoRecursive {
-			return filepath.SkipDir
+		if fi.IsDir() {
+			dirs = append(dirs, copiedDir{target, fi})
+			if options.NoRecursive {
+				return filepath.SkipDir
+			}
 		}
 		return nil
 	})
+	for i := len(dirs) - 1; i >= 0; i-- {
+		d := dirs[i]
+		os.Chmod(d.path, d.info.Mode()&os.ModePerm)
+		os.Chtimes(d.path, d.info.ModTime(), d.info.ModTime())
+	}
 	if err != nil {
 		return false, errFromOS(err)
 	}
 
+	if len(errs) > 0 {
+		return created, NewPartialError(errs)
+	}
 	return created, nil
 }
 
+// copyLocalFile copies the local file src to dst, along with its properties.
+// Directories are created empty.
+func (fs LocalFileSystem) copyLocalFile(src, dst string, fi os.FileInfo) error {
+	perm := fi.Mode() & os.ModePerm
+	if fi.IsDir() {
+		// Keep the directory writable until its contents have been copied
+		if err := os.Mkdir(dst, perm|0700); os.IsNotExist(err) {
+			return NewHTTPError(http.StatusConflict, err)
+		} else if err != nil {
+			return errFromOS(err)
+		}
+	} else {
+		if err := copyRegularFile(src, dst, perm); err != nil {
+			return err
+		}
+		// The permissions passed when creating the file are subject to umask
+		os.Chmod(dst, perm)
+		os.Chtimes(dst, fi.ModTime(), fi.ModTime())
+	}
+	return fs.copyProps(src, dst)
+}
+
+// isLocalDescendant returns true if the local path name is a member of root.
+func isLocalDescendant(root, name string) bool {
+	rel, err := filepath.Rel(root, name)
+	if err != nil || rel == "." {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
 func (fs LocalFileSystem) Move(ctx context.Context, src, dst string, options *MoveOptions) (created bool, err error) {
 	srcPath, err := fs.localPath(src)
 	if err != nil {
@@ -321,11 +627,17 @@ func (fs LocalFileSystem) Move(ctx context.Context, src, dst string, options *Mo
 		if err := os.RemoveAll(dstPath); err != nil {
 			return false, errFromOS(err)
 		}
+		if err := fs.removeProps(dstPath); err != nil {
+			return false, errFromOS(err)
+		}
 	}
 
 	if err := os.Rename(srcPath, dstPath); err != nil {
 		return false, errFromOS(err)
 	}
+	if err := fs.moveProps(srcPath, dstPath); err != nil {
+		return false, errFromOS(err)
+	}
 
 	return created, nil
 }
@@ -0,0 +1,365 @@
+package webdav
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/emersion/go-webdav/internal"
+)
+
+// Dead properties are stored in "user." extended attributes, one per
+// property. When the underlying filesystem doesn't support extended
+// attributes, or when a value is too large for an extended attribute,
+// properties are stored in hidden sidecar files instead.
+//
+// Sidecar file names are only reserved on filesystems without extended
+// attribute support. Elsewhere, sidecar files are marked with an extended
+// attribute, and other files with a sidecar-like name belong to clients.
+
+var _ PropertyStore = LocalFileSystem("")
+
+const (
+	xattrPropPrefix    = "user.webdav."
+	xattrSidecarMarker = "user.webdav-sidecar"
+	propsSidecarSuffix = ".webdav-props"
+)
+
+// xattrPropName formats a property name in Clark notation, e.g.
+// "user.webdav.{DAV:}displayname".
+func xattrPropName(name xml.Name) string {
+	return xattrPropPrefix + "{" + name.Space + "}" + name.Local
+}
+
+func parseXattrPropName(attr string) (xml.Name, bool) {
+	if !strings.HasPrefix(attr, xattrPropPrefix) {
+		return xml.Name{}, false
+	}
+	s := strings.TrimPrefix(attr, xattrPropPrefix)
+	if !strings.HasPrefix(s, "{") {
+		return xml.Name{}, false
+	}
+	i := strings.IndexByte(s, '}')
+	if i < 0 || i == len(s)-1 {
+		return xml.Name{}, false
+	}
+	return xml.Name{s[1:i], s[i+1:]}, true
+}
+
+// isPropsSidecar returns true if a local file name has the form of a sidecar
+// file name, see sidecarPath.
+func isPropsSidecar(name string) bool {
+	if name == propsSidecarSuffix {
+		return true
+	}
+	return len(name) > len(propsSidecarSuffix)+1 && strings.HasPrefix(name, ".") && strings.HasSuffix(name, propsSidecarSuffix)
+}
+
+// isSidecar returns true if the local file p is a sidecar file, or would be
+// one if it existed.
+func isSidecar(p string) bool {
+	if !isPropsSidecar(filepath.Base(p)) {
+		return false
+	}
+	_, err := getXattr(p, xattrSidecarMarker)
+	if os.IsNotExist(err) {
+		_, err = listXattr(filepath.Dir(p))
+		return isXattrUnsupported(err)
+	}
+	return err == nil || isXattrUnsupported(err)
+}
+
+// sidecarPath returns the path of the sidecar file holding the properties of
+// the resource at the local path p.
+func (fs LocalFileSystem) sidecarPath(p string) string {
+	if p == filepath.Clean(string(fs)) {
+		return filepath.Join(p, propsSidecarSuffix)
+	}
+	dir, base := filepath.Split(p)
+	return filepath.Join(dir, "."+base+propsSidecarSuffix)
+}
+
+type sidecarProps struct {
+	XMLName xml.Name               `xml:"props"`
+	Raw     []internal.RawXMLValue `xml:",any"`
+}
+
+func (fs LocalFileSystem) readSidecar(p string) (map[xml.Name][]byte, error) {
+	sidecar := fs.sidecarPath(p)
+	if _, err := os.Lstat(sidecar); os.IsNotExist(err) || !isSidecar(sidecar) {
+		return nil, nil
+	}
+
+	f, err := os.Open(sidecar)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var sp sidecarProps
+	if err := xml.NewDecoder(f).Decode(&sp); err != nil {
+		return nil, fmt.Errorf("webdav: failed to decode properties sidecar file: %v", err)
+	}
+
+	props := make(map[xml.Name][]byte, len(sp.Raw))
+	for i := range sp.Raw {
+		name, ok := sp.Raw[i].XMLName()
+		if !ok {
+			continue
+		}
+		b, err := xml.Marshal(&sp.Raw[i])
+		if err != nil {
+			return nil, err
+		}
+		props[name] = b
+	}
+	return props, nil
+}
+
+func (fs LocalFileSystem) writeSidecar(p string, props map[xml.Name][]byte) error {
+	sidecar := fs.sidecarPath(p)
+	if _, err := os.Lstat(sidecar); err == nil && !isSidecar(sidecar) {
+		return NewHTTPError(http.StatusInsufficientStorage, fmt.Errorf("webdav: properties sidecar file name used by another file"))
+	}
+	if len(props) == 0 {
+		if err := os.Remove(sidecar); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	var sp sidecarProps
+	for _, b := range props {
+		var raw internal.RawXMLValue
+		if err := xml.Unmarshal(b, &raw); err != nil {
+			return err
+		}
+		sp.Raw = append(sp.Raw, raw)
+	}
+	b, err := xml.Marshal(&sp)
+	if err != nil {
+		return err
+	}
+
+	// Preserve the modification time of the parent directory, so that its
+	// ETag doesn't change
+	dir := filepath.Dir(sidecar)
+	dirInfo, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+
+	tmp := strings.TrimSuffix(sidecar, propsSidecarSuffix) + ".tmp" + propsSidecarSuffix
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	if err := setXattr(tmp, xattrSidecarMarker, nil); err != nil && !isXattrUnsupported(err) {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, sidecar); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Chtimes(dir, dirInfo.ModTime(), dirInfo.ModTime())
+}
+
+// statProps checks that the resource exists, returning its local path.
+func (fs LocalFileSystem) statProps(name string) (string, error) {
+	p, err := fs.localPath(name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(p); err != nil {
+		return "", errFromOS(err)
+	}
+	return p, nil
+}
+
+func (fs LocalFileSystem) ListProps(ctx context.Context, name string) ([]xml.Name, error) {
+	p, err := fs.statProps(name)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs, err := listXattr(p)
+	if err != nil && !isXattrUnsupported(err) {
+		return nil, errFromOS(err)
+	}
+	props, err := fs.readSidecar(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []xml.Name
+	for _, attr := range attrs {
+		if name, ok := parseXattrPropName(attr); ok {
+			names = append(names, name)
+		}
+	}
+	for name := range props {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (fs LocalFileSystem) GetProp(ctx context.Context, name string, prop xml.Name) ([]byte, error) {
+	p, err := fs.statProps(name)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := getXattr(p, xattrPropName(prop))
+	if isXattrUnsupported(err) || isXattrNotFound(err) {
+		var props map[xml.Name][]byte
+		props, err = fs.readSidecar(p)
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		if v, ok = props[prop]; !ok {
+			err = os.ErrNotExist
+		}
+	}
+	if isXattrNotFound(err) || os.IsNotExist(err) {
+		return nil, NewHTTPError(http.StatusNotFound, fmt.Errorf("webdav: property %v not found", prop))
+	} else if err != nil {
+		return nil, errFromOS(err)
+	}
+	return v, nil
+}
+
+func (fs LocalFileSystem) SetProp(ctx context.Context, name string, prop xml.Name, value []byte) error {
+	p, err := fs.statProps(name)
+	if err != nil {
+		return err
+	}
+	return fs.setProp(p, prop, value)
+}
+
+func (fs LocalFileSystem) setProp(p string, prop xml.Name, value []byte) error {
+	attr := xattrPropName(prop)
+	err := setXattr(p, attr, value)
+	if isXattrTooLarge(err) {
+		// Drop the previous value, if any, so that it doesn't shadow the
+		// sidecar file
+		if err := removeXattr(p, attr); err != nil && !isXattrNotFound(err) {
+			return errFromOS(err)
+		}
+	} else if !isXattrUnsupported(err) {
+		if err != nil {
+			return errFromOS(err)
+		}
+		// Drop the previous value from the sidecar file, if any
+		return fs.removeSidecarProp(p, prop)
+	}
+
+	props, err := fs.readSidecar(p)
+	if err != nil {
+		return err
+	}
+	if props == nil {
+		props = make(map[xml.Name][]byte)
+	}
+	props[prop] = value
+	return fs.writeSidecar(p, props)
+}
+
+func (fs LocalFileSystem) RemoveProp(ctx context.Context, name string, prop xml.Name) error {
+	p, err := fs.statProps(name)
+	if err != nil {
+		return err
+	}
+	return fs.removeProp(p, prop)
+}
+
+func (fs LocalFileSystem) removeProp(p string, prop xml.Name) error {
+	err := removeXattr(p, xattrPropName(prop))
+	if err != nil && !isXattrUnsupported(err) && !isXattrNotFound(err) {
+		return errFromOS(err)
+	}
+	return fs.removeSidecarProp(p, prop)
+}
+
+func (fs LocalFileSystem) removeSidecarProp(p string, prop xml.Name) error {
+	props, err := fs.readSidecar(p)
+	if err != nil {
+		return err
+	}
+	if _, ok := props[prop]; !ok {
+		return nil
+	}
+	delete(props, prop)
+	return fs.writeSidecar(p, props)
+}
+
+// copyProps copies the dead properties of the local file src to dst.
+func (fs LocalFileSystem) copyProps(src, dst string) error {
+	props, err := fs.readSidecar(src)
+	if err != nil {
+		return err
+	}
+	if err := fs.writeSidecar(dst, props); err != nil {
+		return err
+	}
+
+	attrs, err := listXattr(src)
+	if isXattrUnsupported(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, attr := range attrs {
+		if _, ok := parseXattrPropName(attr); !ok {
+			continue
+		}
+		v, err := getXattr(src, attr)
+		if isXattrNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := setXattr(dst, attr, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveProps moves the sidecar file of the local file src, if any. Extended
+// attributes are moved along with the file itself.
+func (fs LocalFileSystem) moveProps(src, dst string) error {
+	srcSidecar, dstSidecar := fs.sidecarPath(src), fs.sidecarPath(dst)
+	if _, err := os.Lstat(dstSidecar); err == nil && !isSidecar(dstSidecar) {
+		return NewHTTPError(http.StatusInsufficientStorage, fmt.Errorf("webdav: properties sidecar file name used by another file"))
+	}
+	if !isSidecar(srcSidecar) {
+		return nil
+	}
+	err := os.Rename(srcSidecar, dstSidecar)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// removeProps removes the sidecar file of the local file p, if any.
+func (fs LocalFileSystem) removeProps(p string) error {
+	sidecar := fs.sidecarPath(p)
+	if !isSidecar(sidecar) {
+		return nil
+	}
+	err := os.Remove(sidecar)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
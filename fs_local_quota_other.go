@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package webdav
+
+import (
+	"fmt"
+	"net/http"
+)
+
+func statAvailable(p string) (int64, error) {
+	return 0, NewHTTPError(http.StatusNotFound, fmt.Errorf("webdav: quota not supported on this platform"))
+}
@@ -0,0 +1,18 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package webdav
+
+import (
+	"syscall"
+)
+
+// statAvailable returns the number of bytes available to unprivileged users
+// on the filesystem holding the local file p.
+func statAvailable(p string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(p, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
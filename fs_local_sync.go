@@ -0,0 +1,569 @@
+package webdav
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/emersion/go-webdav/internal"
+)
+
+// Changes made through LocalSyncFileSystem are recorded in a journal file, so
+// that clients can synchronize incrementally. The journal is stored outside
+// of the tree, so that no name is reserved in it. It's created by the first
+// call to SyncToken or SyncCollection: changes made before that, or by other
+// programs, aren't recorded. If the journal is removed, sync tokens expire and
+// clients synchronize from scratch.
+//
+// The journal starts with a header line containing a random identifier,
+// followed by one line per change: an operation and a quoted path. Sync
+// tokens contain the journal identifier and an offset in the journal. Tokens
+// of truncated initial synchronizations also contain the path of the last
+// member listed, members being listed in path order.
+//
+// The journal is removed when it grows past maxSyncJournalSize, or when a
+// change can't be recorded, so that clients don't miss changes.
+
+const (
+	syncJournalHeader  = "webdav-sync "
+	syncTokenPrefix    = "data:,"
+	maxSyncJournalSize = 16 << 20
+)
+
+var errStaleSyncJournal = fmt.Errorf("webdav: failed to reset the sync journal")
+
+type journalOp byte
+
+const (
+	journalUpdate journalOp = 'u'
+	journalDelete journalOp = 'd'
+)
+
+// isLocalReserved returns true if the local file p is used to store
+// metadata, and must be hidden from clients.
+func isLocalReserved(p string) bool {
+	return isSidecar(p)
+}
+
+// LocalSyncFileSystem is a LocalFileSystem supporting incremental
+// synchronization, as defined in RFC 6578. Changes made through it are
+// recorded in a journal file.
+type LocalSyncFileSystem struct {
+	LocalFileSystem
+
+	journalPath string
+
+	mutex sync.Mutex
+	// stale is set when the journal couldn't be reset after a change failed
+	// to be recorded
+	stale bool
+}
+
+var _ SyncFileSystem = (*LocalSyncFileSystem)(nil)
+
+// NewLocalSyncFileSystem returns a LocalSyncFileSystem serving the directory
+// root. The journal is stored at journalPath, which must be outside of root
+// and only writable by the server: anyone able to modify the journal can
+// alter synchronization results.
+func NewLocalSyncFileSystem(root, journalPath string) *LocalSyncFileSystem {
+	return &LocalSyncFileSystem{
+		LocalFileSystem: LocalFileSystem(root),
+		journalPath:     journalPath,
+	}
+}
+
+// journal records changes to local paths. It does nothing if the journal
+// hasn't been created yet. The changes have already been applied, so if they
+// can't be recorded, the journal is reset to invalidate all sync tokens.
+func (fs *LocalSyncFileSystem) journal(op journalOp, paths ...string) {
+	if len(paths) == 0 {
+		return
+	}
+
+	var buf bytes.Buffer
+	for _, p := range paths {
+		href, err := fs.externalPath(p)
+		if err != nil {
+			continue
+		}
+		buf.WriteByte(byte(op))
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.Quote(path.Clean(href)))
+		buf.WriteByte('\n')
+	}
+
+	f, err := os.OpenFile(fs.journalPath, os.O_WRONLY|os.O_APPEND, 0)
+	if os.IsNotExist(err) {
+		return
+	} else if err == nil {
+		// Write all entries at once, so that concurrent writers don't
+		// interleave
+		var fi os.FileInfo
+		if _, err = f.Write(buf.Bytes()); err == nil {
+			fi, err = f.Stat()
+		}
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil && fi.Size() <= maxSyncJournalSize {
+			return
+		}
+	}
+	fs.resetJournal()
+}
+
+// resetJournal removes the journal, invalidating all sync tokens.
+func (fs *LocalSyncFileSystem) resetJournal() {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	err := os.Remove(fs.journalPath)
+	fs.stale = err != nil && !os.IsNotExist(err)
+}
+
+// journalTree lists the local file p and all of its members, for use with
+// journal. It returns nil if the journal hasn't been created yet.
+func (fs *LocalSyncFileSystem) journalTree(p string) []string {
+	if _, err := os.Stat(fs.journalPath); err != nil {
+		return nil
+	}
+
+	var paths []string
+	filepath.Walk(p, func(p string, fi os.FileInfo, err error) error {
+		if fi == nil {
+			return nil
+		}
+		if isLocalReserved(p) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		paths = append(paths, p)
+		return nil
+	})
+	return paths
+}
+
+// track runs op and records the changes it made: members of the trees rooted
+// at the local paths watched which don't exist anymore are recorded as
+// deleted, and members of the trees rooted at the local paths updated as
+// updated, unless op failed altogether.
+func (fs *LocalSyncFileSystem) track(watched, updated []string, op func() error) error {
+	var before []string
+	for _, p := range watched {
+		before = append(before, fs.journalTree(p)...)
+	}
+
+	err := op()
+
+	var deleted []string
+	for _, p := range before {
+		if _, err := os.Lstat(p); os.IsNotExist(err) {
+			deleted = append(deleted, p)
+		}
+	}
+	fs.journal(journalDelete, deleted...)
+
+	var partial *internal.PartialError
+	if err == nil || errors.As(err, &partial) {
+		for _, p := range updated {
+			fs.journal(journalUpdate, fs.journalTree(p)...)
+		}
+	}
+	return err
+}
+
+func (fs *LocalSyncFileSystem) Create(ctx context.Context, name string, body io.ReadCloser, opts *CreateOptions) (fi *FileInfo, created bool, err error) {
+	p, err := fs.localPath(name)
+	if err != nil {
+		return nil, false, err
+	}
+	err = fs.track([]string{p}, []string{p}, func() error {
+		fi, created, err = fs.LocalFileSystem.Create(ctx, name, body, opts)
+		return err
+	})
+	return fi, created, err
+}
+
+func (fs *LocalSyncFileSystem) RemoveAll(ctx context.Context, name string, opts *RemoveAllOptions) error {
+	p, err := fs.localPath(name)
+	if err != nil {
+		return err
+	}
+	return fs.track([]string{p}, nil, func() error {
+		return fs.LocalFileSystem.RemoveAll(ctx, name, opts)
+	})
+}
+
+func (fs *LocalSyncFileSystem) Mkdir(ctx context.Context, name string) error {
+	p, err := fs.localPath(name)
+	if err != nil {
+		return err
+	}
+	return fs.track(nil, []string{p}, func() error {
+		return fs.LocalFileSystem.Mkdir(ctx, name)
+	})
+}
+
+func (fs *LocalSyncFileSystem) Copy(ctx context.Context, src, dst string, options *CopyOptions) (created bool, err error) {
+	dstPath, err := fs.localPath(dst)
+	if err != nil {
+		return false, err
+	}
+	err = fs.track([]string{dstPath}, []string{dstPath}, func() error {
+		created, err = fs.LocalFileSystem.Copy(ctx, src, dst, options)
+		return err
+	})
+	return created, err
+}
+
+func (fs *LocalSyncFileSystem) Move(ctx context.Context, src, dst string, options *MoveOptions) (created bool, err error) {
+	srcPath, err := fs.localPath(src)
+	if err != nil {
+		return false, err
+	}
+	dstPath, err := fs.localPath(dst)
+	if err != nil {
+		return false, err
+	}
+	err = fs.track([]string{srcPath, dstPath}, []string{dstPath}, func() error {
+		created, err = fs.LocalFileSystem.Move(ctx, src, dst, options)
+		return err
+	})
+	return created, err
+}
+
+func (fs *LocalSyncFileSystem) SetProp(ctx context.Context, name string, prop xml.Name, value []byte) error {
+	if err := fs.LocalFileSystem.SetProp(ctx, name, prop, value); err != nil {
+		return err
+	}
+	if p, err := fs.localPath(name); err == nil {
+		fs.journal(journalUpdate, p)
+	}
+	return nil
+}
+
+func (fs *LocalSyncFileSystem) RemoveProp(ctx context.Context, name string, prop xml.Name) error {
+	if err := fs.LocalFileSystem.RemoveProp(ctx, name, prop); err != nil {
+		return err
+	}
+	if p, err := fs.localPath(name); err == nil {
+		fs.journal(journalUpdate, p)
+	}
+	return nil
+}
+
+// openJournal opens the journal, creating it if necessary. It returns the
+// journal identifier and the offset of the first entry.
+func (fs *LocalSyncFileSystem) openJournal() (f *os.File, id string, start int64, err error) {
+	p := fs.journalPath
+
+	fs.mutex.Lock()
+	if fs.stale {
+		// Retry resetting the journal
+		err := os.Remove(p)
+		fs.stale = err != nil && !os.IsNotExist(err)
+	}
+	stale := fs.stale
+	fs.mutex.Unlock()
+	if stale {
+		return nil, "", 0, errStaleSyncJournal
+	}
+
+	f, err = os.Open(p)
+	if os.IsNotExist(err) {
+		var b [16]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return nil, "", 0, err
+		}
+		header := syncJournalHeader + hex.EncodeToString(b[:]) + "\n"
+
+		if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+			return nil, "", 0, errFromOS(err)
+		}
+		if err := createJournal(p, header); err != nil && !os.IsExist(err) {
+			return nil, "", 0, errFromOS(err)
+		}
+		// Either we've created the journal, or someone else did concurrently
+
+		f, err = os.Open(p)
+	}
+	if err != nil {
+		return nil, "", 0, errFromOS(err)
+	}
+
+	header, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil || !strings.HasPrefix(header, syncJournalHeader) {
+		f.Close()
+		return nil, "", 0, fmt.Errorf("webdav: malformed sync journal header")
+	}
+	id = strings.TrimSuffix(strings.TrimPrefix(header, syncJournalHeader), "\n")
+	return f, id, int64(len(header)), nil
+}
+
+func createJournal(p, header string) error {
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(header)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(p)
+	}
+	return err
+}
+
+// formatSyncToken formats a sync token. cursor is the last member listed by
+// a truncated initial synchronization, if any.
+func formatSyncToken(id string, offset int64, cursor string) string {
+	token := fmt.Sprintf("%v%v-%v", syncTokenPrefix, id, offset)
+	if cursor != "" {
+		token += "-" + url.PathEscape(cursor)
+	}
+	return token
+}
+
+func parseSyncToken(token string) (id string, offset int64, cursor string, ok bool) {
+	if !strings.HasPrefix(token, syncTokenPrefix) {
+		return "", 0, "", false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(token, syncTokenPrefix), "-", 3)
+	if len(parts) < 2 {
+		return "", 0, "", false
+	}
+	offset, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", 0, "", false
+	}
+	if len(parts) == 3 {
+		cursor, err = url.PathUnescape(parts[2])
+		if err != nil || !strings.HasPrefix(cursor, "/") {
+			return "", 0, "", false
+		}
+	}
+	return parts[0], offset, cursor, true
+}
+
+func (fs *LocalSyncFileSystem) SyncToken(ctx context.Context, name string) (string, error) {
+	if _, err := fs.localPath(name); err != nil {
+		return "", err
+	}
+
+	f, id, _, err := fs.openJournal()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return "", errFromOS(err)
+	}
+	return formatSyncToken(id, fi.Size(), ""), nil
+}
+
+func (fs *LocalSyncFileSystem) SyncCollection(ctx context.Context, name string, opts *SyncOptions) (*SyncResponse, error) {
+	if _, err := fs.localPath(name); err != nil {
+		return nil, err
+	}
+	name = path.Clean(name)
+
+	f, id, start, err := fs.openJournal()
+	if err == errStaleSyncJournal && opts.SyncToken != "" {
+		// Changes may have been missed
+		return nil, ErrInvalidSyncToken
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, errFromOS(err)
+	}
+	size := fi.Size()
+
+	if opts.SyncToken == "" {
+		return fs.syncAll(ctx, name, opts, id, size, "")
+	}
+
+	tokenID, offset, cursor, ok := parseSyncToken(opts.SyncToken)
+	if !ok || tokenID != id || offset < start || offset > size {
+		return nil, ErrInvalidSyncToken
+	}
+	// The offset must point to the start of an entry
+	var b [1]byte
+	if _, err := f.ReadAt(b[:], offset-1); err != nil {
+		return nil, errFromOS(err)
+	} else if b[0] != '\n' {
+		return nil, ErrInvalidSyncToken
+	}
+
+	if cursor != "" {
+		// Changes made while the initial synchronization is in progress are
+		// fetched once it's complete
+		return fs.syncAll(ctx, name, opts, id, offset, cursor)
+	}
+
+	// Collect the last operation on each member, stopping before a new
+	// member would exceed the limit
+	changes := make(map[string]journalOp)
+	truncated := false
+	end := offset
+	br := bufio.NewReader(io.NewSectionReader(f, offset, size-offset))
+	for {
+		line, err := br.ReadString('\n')
+		if err == io.EOF {
+			// Ignore incomplete entries being written concurrently
+			break
+		} else if err != nil {
+			return nil, errFromOS(err)
+		}
+
+		op, href, err := parseJournalEntry(line)
+		if err != nil {
+			return nil, err
+		}
+		if isSyncMember(name, href, opts.Recursive) {
+			if _, ok := changes[href]; !ok && opts.Limit > 0 && len(changes) >= opts.Limit {
+				truncated = true
+				break
+			}
+			changes[href] = op
+		}
+		end += int64(len(line))
+	}
+
+	hrefs := make([]string, 0, len(changes))
+	for href := range changes {
+		hrefs = append(hrefs, href)
+	}
+	sort.Strings(hrefs)
+
+	resp := &SyncResponse{
+		SyncToken: formatSyncToken(id, end, ""),
+		Truncated: truncated,
+	}
+	for _, href := range hrefs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// Members of removed directories are implicitly removed
+		removedParent := false
+		for dir := path.Dir(href); isSyncMember(name, dir, true); dir = path.Dir(dir) {
+			if changes[dir] == journalDelete {
+				removedParent = true
+				break
+			}
+		}
+		if removedParent {
+			continue
+		}
+
+		if changes[href] == journalUpdate {
+			fi, err := fs.Stat(ctx, href)
+			if err == nil {
+				resp.Updated = append(resp.Updated, *fi)
+				continue
+			} else if !internal.IsNotFound(err) {
+				return nil, err
+			}
+		}
+		resp.Deleted = append(resp.Deleted, href)
+	}
+	return resp, nil
+}
+
+// syncAll lists all members of a directory, for an initial synchronization.
+// Members are listed in path order, starting after cursor. offset is the
+// position in the journal when the initial synchronization started.
+func (fs *LocalSyncFileSystem) syncAll(ctx context.Context, name string, opts *SyncOptions, id string, offset int64, cursor string) (*SyncResponse, error) {
+	it, err := fs.Walk(ctx, name, opts.Recursive)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	var members []FileInfo
+	for it.Next() {
+		fi := it.FileInfo()
+		if path.Clean(fi.Path) == name {
+			continue
+		} else if cursor != "" && !syncPathLess(cursor, fi.Path) {
+			continue
+		}
+		members = append(members, *fi)
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return syncPathLess(members[i].Path, members[j].Path)
+	})
+
+	resp := &SyncResponse{
+		SyncToken: formatSyncToken(id, offset, ""),
+		Updated:   members,
+	}
+	if opts.Limit > 0 && len(members) > opts.Limit {
+		resp.Updated = members[:opts.Limit]
+		resp.Truncated = true
+		resp.SyncToken = formatSyncToken(id, offset, path.Clean(resp.Updated[opts.Limit-1].Path))
+	}
+	return resp, nil
+}
+
+// syncPathLess orders paths such that directories are immediately followed
+// by their members.
+func syncPathLess(a, b string) bool {
+	a = strings.ReplaceAll(path.Clean(a), "/", "\x00")
+	b = strings.ReplaceAll(path.Clean(b), "/", "\x00")
+	return a < b
+}
+
+func parseJournalEntry(line string) (journalOp, string, error) {
+	line = strings.TrimSuffix(line, "\n")
+	if len(line) < 2 || line[1] != ' ' {
+		return 0, "", fmt.Errorf("webdav: malformed sync journal entry")
+	}
+	op := journalOp(line[0])
+	if op != journalUpdate && op != journalDelete {
+		return 0, "", fmt.Errorf("webdav: unknown sync journal operation %q", line[0])
+	}
+	href, err := strconv.Unquote(line[2:])
+	if err != nil {
+		return 0, "", fmt.Errorf("webdav: malformed sync journal entry: %v", err)
+	}
+	return op, href, nil
+}
+
+// isSyncMember returns true if p is a member of the directory dir. If
+// recursive is false, only direct members are considered.
+func isSyncMember(dir, p string, recursive bool) bool {
+	if p == dir {
+		return false
+	} else if !recursive {
+		return path.Dir(p) == dir
+	} else if dir == "/" {
+		return strings.HasPrefix(p, "/")
+	}
+	return strings.HasPrefix(p, dir+"/")
+}
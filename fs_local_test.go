@@ -0,0 +1,559 @@
+package webdav
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-webdav/internal"
+)
+
+func TestLocalFileSystem_props(t *testing.T) {
+	dir, err := os.MkdirTemp("", "webdav-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	fs := LocalFileSystem(dir)
+
+	fi, _, err := fs.Create(ctx, "/file.txt", io.NopCloser(strings.NewReader("hello")), &CreateOptions{})
+	if err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+
+	colorName := xml.Name{"http://example.org/ns", "color"}
+	color := []byte(`<color xmlns="http://example.org/ns">red</color>`)
+	if err := fs.SetProp(ctx, "/file.txt", colorName, color); err != nil {
+		t.Fatalf("SetProp() = %v", err)
+	}
+
+	if v, err := fs.GetProp(ctx, "/file.txt", colorName); err != nil {
+		t.Errorf("GetProp() = %v", err)
+	} else if !bytes.Equal(v, color) {
+		t.Errorf("GetProp() = %q, want %q", v, color)
+	}
+	if names, err := fs.ListProps(ctx, "/file.txt"); err != nil {
+		t.Errorf("ListProps() = %v", err)
+	} else if len(names) != 1 || names[0] != colorName {
+		t.Errorf("ListProps() = %v, want [%v]", names, colorName)
+	}
+
+	if newFI, err := fs.Stat(ctx, "/file.txt"); err != nil {
+		t.Fatalf("Stat() = %v", err)
+	} else if newFI.ETag != fi.ETag {
+		t.Errorf("ETag changed after setting a property: %q, want %q", newFI.ETag, fi.ETag)
+	}
+
+	if _, err := fs.Copy(ctx, "/file.txt", "/copy.txt", &CopyOptions{}); err != nil {
+		t.Fatalf("Copy() = %v", err)
+	}
+	if _, err := fs.GetProp(ctx, "/copy.txt", colorName); err != nil {
+		t.Errorf("GetProp() after Copy = %v", err)
+	}
+
+	if _, err := fs.Move(ctx, "/copy.txt", "/moved.txt", &MoveOptions{}); err != nil {
+		t.Fatalf("Move() = %v", err)
+	}
+	if _, err := fs.GetProp(ctx, "/moved.txt", colorName); err != nil {
+		t.Errorf("GetProp() after Move = %v", err)
+	}
+
+	if err := fs.RemoveProp(ctx, "/file.txt", colorName); err != nil {
+		t.Fatalf("RemoveProp() = %v", err)
+	}
+	if _, err := fs.GetProp(ctx, "/file.txt", colorName); !internal.IsNotFound(err) {
+		t.Errorf("GetProp() after RemoveProp = %v, want 404", err)
+	}
+	if err := fs.RemoveProp(ctx, "/file.txt", colorName); err != nil {
+		t.Errorf("RemoveProp() on missing property = %v", err)
+	}
+}
+
+func TestLocalFileSystem_sidecar(t *testing.T) {
+	dir, err := os.MkdirTemp("", "webdav-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	fs := LocalFileSystem(dir)
+
+	if _, _, err := fs.Create(ctx, "/file.txt", io.NopCloser(strings.NewReader("hello")), &CreateOptions{}); err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	p, err := fs.localPath("/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	colorName := xml.Name{"http://example.org/ns", "color"}
+	color := []byte(`<color xmlns="http://example.org/ns">red</color>`)
+	if err := fs.writeSidecar(p, map[xml.Name][]byte{colorName: color}); err != nil {
+		t.Fatalf("writeSidecar() = %v", err)
+	}
+
+	props, err := fs.readSidecar(p)
+	if err != nil {
+		t.Fatalf("readSidecar() = %v", err)
+	} else if !bytes.Equal(props[colorName], color) {
+		t.Errorf("readSidecar() = %q, want %q", props[colorName], color)
+	}
+
+	l, err := fs.ReadDir(ctx, "/", true)
+	if err != nil {
+		t.Fatalf("ReadDir() = %v", err)
+	}
+	for _, fi := range l {
+		if isPropsSidecar(fi.Path) {
+			t.Errorf("ReadDir() returned sidecar file %q", fi.Path)
+		}
+	}
+	if _, err := fs.Stat(ctx, "/.file.txt"+propsSidecarSuffix); err == nil {
+		t.Errorf("Stat() on sidecar file succeeded")
+	}
+}
+
+func TestLocalFileSystem_largeProp(t *testing.T) {
+	dir, err := os.MkdirTemp("", "webdav-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	fs := LocalFileSystem(dir)
+
+	if _, _, err := fs.Create(ctx, "/file.txt", io.NopCloser(strings.NewReader("hello")), &CreateOptions{}); err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+
+	// Larger than the maximum extended attribute size on Linux
+	notesName := xml.Name{"http://example.org/ns", "notes"}
+	notes := []byte(`<notes xmlns="http://example.org/ns">` + strings.Repeat("a", 128*1024) + `</notes>`)
+	if err := fs.SetProp(ctx, "/file.txt", notesName, notes); err != nil {
+		t.Fatalf("SetProp() = %v", err)
+	}
+	if v, err := fs.GetProp(ctx, "/file.txt", notesName); err != nil {
+		t.Errorf("GetProp() = %v", err)
+	} else if !bytes.Equal(v, notes) {
+		t.Errorf("GetProp() returned %v bytes, want %v", len(v), len(notes))
+	}
+	if names, err := fs.ListProps(ctx, "/file.txt"); err != nil {
+		t.Errorf("ListProps() = %v", err)
+	} else if len(names) != 1 || names[0] != notesName {
+		t.Errorf("ListProps() = %v, want [%v]", names, notesName)
+	}
+	if _, err := fs.Stat(ctx, "/.file.txt"+propsSidecarSuffix); err == nil {
+		t.Errorf("Stat() on sidecar file succeeded")
+	}
+
+	if err := fs.RemoveProp(ctx, "/file.txt", notesName); err != nil {
+		t.Fatalf("RemoveProp() = %v", err)
+	}
+	if _, err := fs.GetProp(ctx, "/file.txt", notesName); !internal.IsNotFound(err) {
+		t.Errorf("GetProp() after RemoveProp = %v, want 404", err)
+	}
+
+	if _, err := listXattr(dir); isXattrUnsupported(err) {
+		return
+	}
+
+	// Sidecar file names aren't reserved when extended attributes are
+	// supported
+	name := "/.notes" + propsSidecarSuffix
+	if _, _, err := fs.Create(ctx, name, io.NopCloser(strings.NewReader("hello")), &CreateOptions{}); err != nil {
+		t.Fatalf("Create(%q) = %v", name, err)
+	}
+	if _, err := fs.Stat(ctx, name); err != nil {
+		t.Errorf("Stat(%q) = %v", name, err)
+	}
+}
+
+func TestLocalFileSystem_Walk(t *testing.T) {
+	dir, err := os.MkdirTemp("", "webdav-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	fs := LocalFileSystem(dir)
+
+	for _, name := range []string{"/a", "/a/b", "/c"} {
+		if err := fs.Mkdir(ctx, name); err != nil {
+			t.Fatalf("Mkdir(%q) = %v", name, err)
+		}
+	}
+	for _, name := range []string{"/file.txt", "/a/file.txt", "/a/b/file.txt"} {
+		if _, _, err := fs.Create(ctx, name, io.NopCloser(strings.NewReader(name)), &CreateOptions{}); err != nil {
+			t.Fatalf("Create(%q) = %v", name, err)
+		}
+	}
+
+	for _, recursive := range []bool{false, true} {
+		want, err := fs.ReadDir(ctx, "/", recursive)
+		if err != nil {
+			t.Fatalf("ReadDir() = %v", err)
+		}
+
+		it, err := fs.Walk(ctx, "/", recursive)
+		if err != nil {
+			t.Fatalf("Walk() = %v", err)
+		}
+		got := make(map[string]bool)
+		for it.Next() {
+			got[path.Clean(it.FileInfo().Path)] = true
+		}
+		if err := it.Err(); err != nil {
+			t.Errorf("Walk(): iterator error: %v", err)
+		}
+		it.Close()
+
+		if len(got) != len(want) {
+			t.Errorf("Walk(recursive=%v) returned %v files, want %v", recursive, len(got), len(want))
+		}
+		for _, fi := range want {
+			if !got[path.Clean(fi.Path)] {
+				t.Errorf("Walk(recursive=%v) is missing %q", recursive, fi.Path)
+			}
+		}
+	}
+}
+
+func TestLocalFileSystem_RemoveAll_partial(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permissions aren't enforced for root")
+	}
+
+	dir, err := os.MkdirTemp("", "webdav-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	fs := LocalFileSystem(dir)
+
+	for _, name := range []string{"/a", "/a/ro"} {
+		if err := fs.Mkdir(ctx, name); err != nil {
+			t.Fatalf("Mkdir(%q) = %v", name, err)
+		}
+	}
+	for _, name := range []string{"/a/file.txt", "/a/ro/file.txt"} {
+		if _, _, err := fs.Create(ctx, name, io.NopCloser(strings.NewReader(name)), &CreateOptions{}); err != nil {
+			t.Fatalf("Create(%q) = %v", name, err)
+		}
+	}
+
+	ro, err := fs.localPath("/a/ro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(ro, 0555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(ro, 0755)
+
+	err = fs.RemoveAll(ctx, "/a", &RemoveAllOptions{})
+	var partial *PartialError
+	if !errors.As(err, &partial) {
+		t.Fatalf("RemoveAll() = %v, want a partial error", err)
+	}
+	if len(partial.Errors) != 1 || partial.Errors[0].Path != "/a/ro/file.txt" {
+		t.Errorf("RemoveAll() failed on %v, want /a/ro/file.txt", partial.Errors)
+	}
+	if _, err := fs.Stat(ctx, "/a/file.txt"); err == nil {
+		t.Errorf("RemoveAll() didn't remove /a/file.txt")
+	}
+}
+
+func TestLocalFileSystem_Copy(t *testing.T) {
+	dir, err := os.MkdirTemp("", "webdav-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	fs := LocalFileSystem(dir)
+
+	for _, name := range []string{"/a", "/a/b"} {
+		if err := fs.Mkdir(ctx, name); err != nil {
+			t.Fatalf("Mkdir(%q) = %v", name, err)
+		}
+	}
+	files := []string{"/a/file.txt", "/a/b/file.txt"}
+	for _, name := range files {
+		if _, _, err := fs.Create(ctx, name, io.NopCloser(strings.NewReader(name)), &CreateOptions{}); err != nil {
+			t.Fatalf("Create(%q) = %v", name, err)
+		}
+	}
+
+	p, err := fs.localPath("/a/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(p, 0600); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(p, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	checkCopy := func(dst string) {
+		t.Helper()
+		for _, name := range files {
+			copyName := dst + strings.TrimPrefix(name, "/a")
+			rc, err := fs.Open(ctx, copyName)
+			if err != nil {
+				t.Errorf("Open(%q) = %v", copyName, err)
+				continue
+			}
+			b, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatal(err)
+			} else if string(b) != name {
+				t.Errorf("%q contains %q, want %q", copyName, b, name)
+			}
+		}
+
+		p, err := fs.localPath(dst + "/file.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fi, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := fi.Mode() & os.ModePerm; perm != 0600 {
+			t.Errorf("%v/file.txt has permissions %v, want %v", dst, perm, os.FileMode(0600))
+		}
+		if !fi.ModTime().Equal(mtime) {
+			t.Errorf("%v/file.txt has modification time %v, want %v", dst, fi.ModTime(), mtime)
+		}
+	}
+
+	if created, err := fs.Copy(ctx, "/a", "/c", &CopyOptions{}); err != nil {
+		t.Fatalf("Copy() = %v", err)
+	} else if !created {
+		t.Errorf("Copy() didn't create the destination")
+	}
+	checkCopy("/c")
+
+	// Copying a directory into one of its members must terminate
+	if _, err := fs.Copy(ctx, "/a", "/a/b/copy", &CopyOptions{}); err != nil {
+		t.Fatalf("Copy() into a member = %v", err)
+	}
+	checkCopy("/a/b/copy")
+	if _, err := fs.Stat(ctx, "/a/b/copy/b/copy"); err == nil {
+		t.Errorf("Copy() into a member recursed into the destination")
+	}
+
+	if _, err := fs.Copy(ctx, "/a/b", "/a", &CopyOptions{}); err == nil {
+		t.Errorf("Copy() into a parent succeeded")
+	}
+	if _, err := fs.Copy(ctx, "/a", "/a", &CopyOptions{}); err == nil {
+		t.Errorf("Copy() onto itself succeeded")
+	}
+
+	if _, err := fs.Copy(ctx, "/a", "/shallow", &CopyOptions{NoRecursive: true}); err != nil {
+		t.Fatalf("Copy() without recursion = %v", err)
+	}
+	if l, err := fs.ReadDir(ctx, "/shallow", true); err != nil {
+		t.Errorf("ReadDir() = %v", err)
+	} else if len(l) != 1 {
+		t.Errorf("Copy() without recursion copied %v files, want 1", len(l))
+	}
+
+	cancelCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := fs.Copy(cancelCtx, "/a", "/canceled", &CopyOptions{}); err == nil {
+		t.Errorf("Copy() with a canceled context succeeded")
+	}
+}
+
+func TestLocalFileSystem_Quota(t *testing.T) {
+	dir, err := os.MkdirTemp("", "webdav-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	fs := LocalFileSystem(dir)
+	if err := fs.Mkdir(ctx, "/dir"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/a.txt", "/dir/b.txt"} {
+		if _, _, err := fs.Create(ctx, name, io.NopCloser(strings.NewReader("hello")), &CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	available, err := fs.QuotaAvailable(ctx, "/dir")
+	if internal.IsNotFound(err) {
+		t.Skip("quota not supported on this platform")
+	} else if err != nil {
+		t.Fatalf("QuotaAvailable() = %v", err)
+	}
+	if available < 0 {
+		t.Errorf("QuotaAvailable() = %v, want a positive value", available)
+	}
+}
+
+func TestLocalFileSystem_SyncCollection(t *testing.T) {
+	dir, err := os.MkdirTemp("", "webdav-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	fs := NewLocalSyncFileSystem(dir, filepath.Join(t.TempDir(), "journal"))
+
+	create := func(name string) {
+		if _, _, err := fs.Create(ctx, name, io.NopCloser(strings.NewReader(name)), &CreateOptions{}); err != nil {
+			t.Fatalf("Create(%q) = %v", name, err)
+		}
+	}
+	paths := func(l []FileInfo) string {
+		var s []string
+		for _, fi := range l {
+			s = append(s, fi.Path)
+		}
+		return strings.Join(s, " ")
+	}
+
+	if err := fs.Mkdir(ctx, "/dir"); err != nil {
+		t.Fatal(err)
+	}
+	create("/dir/a.txt")
+	create("/b.txt")
+
+	// Changes made before the journal is created aren't recorded, but are
+	// part of the initial synchronization
+	resp, err := fs.SyncCollection(ctx, "/", &SyncOptions{Recursive: true})
+	if err != nil {
+		t.Fatalf("SyncCollection() = %v", err)
+	}
+	if got, want := paths(resp.Updated), "/b.txt /dir /dir/a.txt"; got != want {
+		t.Errorf("SyncCollection().Updated = %q, want %q", got, want)
+	}
+	token := resp.SyncToken
+
+	if entries, err := os.ReadDir(dir); err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 2 {
+		t.Errorf("ReadDir() = %v, want no file besides the members", entries)
+	}
+
+	// Initial synchronizations can be truncated
+	resp, err = fs.SyncCollection(ctx, "/", &SyncOptions{Recursive: true, Limit: 2})
+	if err != nil {
+		t.Fatalf("SyncCollection() = %v", err)
+	} else if got, want := paths(resp.Updated), "/b.txt /dir"; !resp.Truncated || got != want {
+		t.Errorf("SyncCollection() = %+v, want %q truncated", resp, want)
+	}
+	resp, err = fs.SyncCollection(ctx, "/", &SyncOptions{SyncToken: resp.SyncToken, Recursive: true, Limit: 2})
+	if err != nil {
+		t.Fatalf("SyncCollection() = %v", err)
+	} else if got, want := paths(resp.Updated), "/dir/a.txt"; resp.Truncated || got != want {
+		t.Errorf("SyncCollection() = %+v, want %q", resp, want)
+	} else if resp.SyncToken != token {
+		t.Errorf("SyncCollection().SyncToken = %q, want %q", resp.SyncToken, token)
+	}
+
+	create("/dir/c.txt")
+	if err := fs.RemoveAll(ctx, "/b.txt", &RemoveAllOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Move(ctx, "/dir", "/moved", &MoveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err = fs.SyncCollection(ctx, "/", &SyncOptions{SyncToken: token})
+	if err != nil {
+		t.Fatalf("SyncCollection() = %v", err)
+	}
+	if got, want := paths(resp.Updated), "/moved"; got != want {
+		t.Errorf("SyncCollection().Updated = %q, want %q", got, want)
+	}
+	if got, want := strings.Join(resp.Deleted, " "), "/b.txt /dir"; got != want {
+		t.Errorf("SyncCollection().Deleted = %q, want %q", got, want)
+	}
+
+	resp, err = fs.SyncCollection(ctx, "/", &SyncOptions{SyncToken: token, Recursive: true, Limit: 2})
+	if err != nil {
+		t.Fatalf("SyncCollection() = %v", err)
+	} else if !resp.Truncated || len(resp.Updated)+len(resp.Deleted) != 2 {
+		t.Errorf("SyncCollection() = %+v, want 2 truncated changes", resp)
+	}
+	resp, err = fs.SyncCollection(ctx, "/", &SyncOptions{SyncToken: resp.SyncToken, Recursive: true})
+	if err != nil {
+		t.Fatalf("SyncCollection() = %v", err)
+	}
+	if got, want := paths(resp.Updated), "/moved /moved/a.txt /moved/c.txt"; got != want {
+		t.Errorf("SyncCollection().Updated = %q, want %q", got, want)
+	}
+	if got, want := strings.Join(resp.Deleted, " "), "/dir"; got != want {
+		t.Errorf("SyncCollection().Deleted = %q, want %q", got, want)
+	}
+
+	_, err = fs.SyncCollection(ctx, "/", &SyncOptions{SyncToken: token + "0"})
+	if !errors.Is(err, ErrInvalidSyncToken) {
+		t.Errorf("SyncCollection() with invalid token = %v, want %v", err, ErrInvalidSyncToken)
+	}
+}
+
+func TestLocalSyncFileSystem_journalFailure(t *testing.T) {
+	dir, err := os.MkdirTemp("", "webdav-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	journalPath := filepath.Join(t.TempDir(), "journal")
+	fs := NewLocalSyncFileSystem(dir, journalPath)
+
+	token, err := fs.SyncToken(ctx, "/")
+	if err != nil {
+		t.Fatalf("SyncToken() = %v", err)
+	}
+
+	// Replace the journal with a directory which can't be written to nor
+	// removed
+	if err := os.Remove(journalPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(journalPath, "busy"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := fs.Create(ctx, "/a.txt", io.NopCloser(strings.NewReader("a")), &CreateOptions{}); err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	if _, err := fs.SyncCollection(ctx, "/", &SyncOptions{SyncToken: token}); err != ErrInvalidSyncToken {
+		t.Errorf("SyncCollection() after a journal failure = %v, want %v", err, ErrInvalidSyncToken)
+	}
+
+	if err := os.Remove(filepath.Join(journalPath, "busy")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.SyncToken(ctx, "/"); err != nil {
+		t.Errorf("SyncToken() once the journal can be reset = %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+//go:build linux
+// +build linux
+
+package webdav
+
+import (
+	"bytes"
+	"errors"
+	"syscall"
+)
+
+func getXattr(p, attr string) ([]byte, error) {
+	for {
+		n, err := syscall.Getxattr(p, attr, nil)
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, n)
+		n, err = syscall.Getxattr(p, attr, buf)
+		if errors.Is(err, syscall.ERANGE) {
+			// The value grew in-between the two calls
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+}
+
+func setXattr(p, attr string, value []byte) error {
+	return syscall.Setxattr(p, attr, value, 0)
+}
+
+func removeXattr(p, attr string) error {
+	return syscall.Removexattr(p, attr)
+}
+
+func listXattr(p string) ([]string, error) {
+	for {
+		n, err := syscall.Listxattr(p, nil)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n)
+		n, err = syscall.Listxattr(p, buf)
+		if errors.Is(err, syscall.ERANGE) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		var l []string
+		for _, b := range bytes.Split(buf[:n], []byte{0}) {
+			if len(b) > 0 {
+				l = append(l, string(b))
+			}
+		}
+		return l, nil
+	}
+}
+
+func isXattrUnsupported(err error) bool {
+	return errors.Is(err, syscall.ENOTSUP) || errors.Is(err, syscall.EOPNOTSUPP)
+}
+
+// isXattrTooLarge returns true if a value doesn't fit in an extended
+// attribute.
+func isXattrTooLarge(err error) bool {
+	return errors.Is(err, syscall.E2BIG) || errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.ERANGE)
+}
+
+func isXattrNotFound(err error) bool {
+	return errors.Is(err, syscall.ENODATA)
+}
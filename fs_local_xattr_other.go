@@ -0,0 +1,38 @@
+//go:build !linux
+// +build !linux
+
+package webdav
+
+import (
+	"errors"
+)
+
+var errXattrUnsupported = errors.New("webdav: extended attributes not supported")
+
+func getXattr(p, attr string) ([]byte, error) {
+	return nil, errXattrUnsupported
+}
+
+func setXattr(p, attr string, value []byte) error {
+	return errXattrUnsupported
+}
+
+func removeXattr(p, attr string) error {
+	return errXattrUnsupported
+}
+
+func listXattr(p string) ([]string, error) {
+	return nil, errXattrUnsupported
+}
+
+func isXattrUnsupported(err error) bool {
+	return errors.Is(err, errXattrUnsupported)
+}
+
+func isXattrTooLarge(err error) bool {
+	return false
+}
+
+func isXattrNotFound(err error) bool {
+	return false
+}
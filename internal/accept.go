@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MediaRange is a media range of an Accept header field.
+type MediaRange struct {
+	Type   string
+	Params map[string]string
+	Q      float64
+}
+
+// Match returns true if the media range includes the media type.
+func (mr *MediaRange) Match(mediaType string) bool {
+	switch {
+	case mr.Type == "*/*":
+		return true
+	case strings.HasSuffix(mr.Type, "/*"):
+		return strings.HasPrefix(mediaType, strings.TrimSuffix(mr.Type, "*"))
+	default:
+		return strings.EqualFold(mr.Type, mediaType)
+	}
+}
+
+// matchParams returns true if the media range includes the media type with
+// the provided parameters: all parameters of the media range must be present.
+func (mr *MediaRange) matchParams(mediaType string, params map[string]string) bool {
+	if !mr.Match(mediaType) {
+		return false
+	}
+	for k, v := range mr.Params {
+		if !strings.EqualFold(params[k], v) {
+			return false
+		}
+	}
+	return true
+}
+
+// specificity returns a value which increases with the specificity of the
+// media range: media ranges with parameters override media ranges without,
+// which override type/* ranges, which override */*.
+func (mr *MediaRange) specificity() int {
+	switch {
+	case mr.Type == "*/*":
+		return 0
+	case strings.HasSuffix(mr.Type, "/*"):
+		return 1
+	default:
+		return 2 + len(mr.Params)
+	}
+}
+
+// ParseAccept parses an Accept header field, as defined in RFC 9110 section
+// 12.5.1. The media ranges are sorted by decreasing preference, then by
+// decreasing specificity. Malformed media ranges are ignored. Unacceptable
+// (q=0) media ranges are kept, since they exclude media types matched by less
+// specific media ranges: use AcceptQuality to check a media type.
+func ParseAccept(accept string) []MediaRange {
+	var l []MediaRange
+	for _, s := range strings.Split(accept, ",") {
+		t, params, err := mime.ParseMediaType(strings.TrimSpace(s))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil || q < 0 || q > 1 {
+				continue
+			}
+			delete(params, "q")
+		}
+		l = append(l, MediaRange{Type: t, Params: params, Q: q})
+	}
+	sort.SliceStable(l, func(i, j int) bool {
+		if l[i].Q != l[j].Q {
+			return l[i].Q > l[j].Q
+		}
+		return l[i].specificity() > l[j].specificity()
+	})
+	return l
+}
+
+// AcceptQuality returns the quality value assigned to a media type with the
+// provided parameters by the most specific matching media range, as described
+// in RFC 9110 section 12.5.1. ok is false if no media range matches.
+func AcceptQuality(ranges []MediaRange, mediaType string, params map[string]string) (q float64, ok bool) {
+	best := -1
+	for i := range ranges {
+		mr := &ranges[i]
+		if s := mr.specificity(); s > best && mr.matchParams(mediaType, params) {
+			best, q = s, mr.Q
+		}
+	}
+	return q, best >= 0
+}
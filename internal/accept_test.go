@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"testing"
+)
+
+func TestParseAccept(t *testing.T) {
+	l := ParseAccept("*/*; q=0.5, text/*, text/vcard; version=4.0, text/vcard, invalid; q=2")
+	var got []string
+	for _, mr := range l {
+		got = append(got, mr.Type)
+	}
+	want := []string{"text/vcard", "text/vcard", "text/*", "*/*"}
+	if len(got) != len(want) {
+		t.Fatalf("ParseAccept() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("ParseAccept() = %v, want %v", got, want)
+		}
+	}
+	if l[0].Params["version"] != "4.0" {
+		t.Errorf("ParseAccept() returned %v first, want the media range with parameters", l[0])
+	}
+}
+
+func TestAcceptQuality(t *testing.T) {
+	for _, tc := range []struct {
+		accept    string
+		mediaType string
+		params    map[string]string
+		q         float64
+		ok        bool
+	}{
+		{"text/vcard", "text/vcard", nil, 1, true},
+		{"text/vcard", "text/calendar", nil, 0, false},
+		{"text/vcard; q=0, */*", "text/vcard", nil, 0, true},
+		{"text/vcard; q=0, */*", "application/vcard+json", nil, 1, true},
+		{"text/*; q=0.3, text/vcard; version=4.0", "text/vcard", map[string]string{"version": "3.0"}, 0.3, true},
+		{"text/*; q=0.3, text/vcard; version=4.0", "text/vcard", map[string]string{"version": "4.0"}, 1, true},
+		{"text/vcard; version=4.0", "text/vcard", nil, 0, false},
+	} {
+		q, ok := AcceptQuality(ParseAccept(tc.accept), tc.mediaType, tc.params)
+		if q != tc.q || ok != tc.ok {
+			t.Errorf("AcceptQuality(%q, %q, %v) = %v, %v, want %v, %v", tc.accept, tc.mediaType, tc.params, q, ok, tc.q, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,585 @@
+package internal
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"path"
+)
+
+// Access control is defined in RFC 3744.
+
+var (
+	ACLName                   = xml.Name{Namespace, "acl"}
+	SupportedPrivilegeSetName = xml.Name{Namespace, "supported-privilege-set"}
+
+	PrivilegeAllName                         = xml.Name{Namespace, "all"}
+	PrivilegeReadName                        = xml.Name{Namespace, "read"}
+	PrivilegeWriteName                       = xml.Name{Namespace, "write"}
+	PrivilegeWritePropertiesName             = xml.Name{Namespace, "write-properties"}
+	PrivilegeWriteContentName                = xml.Name{Namespace, "write-content"}
+	PrivilegeUnlockName                      = xml.Name{Namespace, "unlock"}
+	PrivilegeReadACLName                     = xml.Name{Namespace, "read-acl"}
+	PrivilegeReadCurrentUserPrivilegeSetName = xml.Name{Namespace, "read-current-user-privilege-set"}
+	PrivilegeWriteACLName                    = xml.Name{Namespace, "write-acl"}
+	PrivilegeBindName                        = xml.Name{Namespace, "bind"}
+	PrivilegeUnbindName                      = xml.Name{Namespace, "unbind"}
+)
+
+// https://tools.ietf.org/html/rfc3744#section-5.3
+type SupportedPrivilegeSet struct {
+	XMLName            xml.Name             `xml:"DAV: supported-privilege-set"`
+	SupportedPrivilege []SupportedPrivilege `xml:"supported-privilege"`
+}
+
+// https://tools.ietf.org/html/rfc3744#section-5.3
+type SupportedPrivilege struct {
+	XMLName            xml.Name             `xml:"DAV: supported-privilege"`
+	Privilege          Privilege            `xml:"privilege"`
+	Abstract           *struct{}            `xml:"abstract,omitempty"`
+	Description        string               `xml:"description"`
+	SupportedPrivilege []SupportedPrivilege `xml:"supported-privilege,omitempty"`
+}
+
+func newSupportedPrivilege(name xml.Name, desc string, children ...SupportedPrivilege) SupportedPrivilege {
+	return SupportedPrivilege{
+		Privilege:          NewPrivilege(name),
+		Description:        desc,
+		SupportedPrivilege: children,
+	}
+}
+
+// NewSupportedPrivilegeSet returns the privileges defined in RFC 3744 section
+// 3, arranged as in the example of section 3.12.
+func NewSupportedPrivilegeSet() *SupportedPrivilegeSet {
+	return &SupportedPrivilegeSet{SupportedPrivilege: []SupportedPrivilege{
+		newSupportedPrivilege(PrivilegeAllName, "Any operation",
+			newSupportedPrivilege(PrivilegeReadName, "Read any object"),
+			newSupportedPrivilege(PrivilegeWriteName, "Write any object",
+				newSupportedPrivilege(PrivilegeWritePropertiesName, "Write properties"),
+				newSupportedPrivilege(PrivilegeWriteContentName, "Write resource content"),
+				newSupportedPrivilege(PrivilegeBindName, "Add new members to a collection"),
+				newSupportedPrivilege(PrivilegeUnbindName, "Remove members from a collection"),
+			),
+			newSupportedPrivilege(PrivilegeUnlockName, "Unlock resource"),
+			newSupportedPrivilege(PrivilegeReadACLName, "Read ACL"),
+			newSupportedPrivilege(PrivilegeReadCurrentUserPrivilegeSetName, "Read current user privilege set property"),
+			newSupportedPrivilege(PrivilegeWriteACLName, "Write ACL"),
+		),
+	}}
+}
+
+// Add adds a privilege contained in the aggregate privilege parent. It
+// returns false if parent isn't supported.
+func (set *SupportedPrivilegeSet) Add(parent, name xml.Name, desc string) bool {
+	sp, ok := set.lookup(set.SupportedPrivilege, parent)
+	if !ok {
+		return false
+	}
+	sp.SupportedPrivilege = append(sp.SupportedPrivilege, newSupportedPrivilege(name, desc))
+	return true
+}
+
+// Names returns the names of all supported privileges, aggregate privileges
+// first.
+func (set *SupportedPrivilegeSet) Names() []xml.Name {
+	var names []xml.Name
+	var walk func(l []SupportedPrivilege)
+	walk = func(l []SupportedPrivilege) {
+		for i := range l {
+			names = append(names, l[i].Privilege.Names()...)
+			walk(l[i].SupportedPrivilege)
+		}
+	}
+	walk(set.SupportedPrivilege)
+	return names
+}
+
+// Contains returns true if the privilege is supported.
+func (set *SupportedPrivilegeSet) Contains(name xml.Name) bool {
+	_, ok := set.lookup(set.SupportedPrivilege, name)
+	return ok
+}
+
+func (set *SupportedPrivilegeSet) lookup(l []SupportedPrivilege, name xml.Name) (*SupportedPrivilege, bool) {
+	for i := range l {
+		sp := &l[i]
+		for _, n := range sp.Privilege.Names() {
+			if n == name {
+				return sp, true
+			}
+		}
+		if found, ok := set.lookup(sp.SupportedPrivilege, name); ok {
+			return found, true
+		}
+	}
+	return nil, false
+}
+
+// Expand returns the privileges granted by a list of privileges: aggregate
+// privileges grant all of the privileges they contain.
+func (set *SupportedPrivilegeSet) Expand(names []xml.Name) map[xml.Name]bool {
+	m := make(map[xml.Name]bool)
+	var add func(sp *SupportedPrivilege)
+	add = func(sp *SupportedPrivilege) {
+		for _, n := range sp.Privilege.Names() {
+			m[n] = true
+		}
+		for i := range sp.SupportedPrivilege {
+			add(&sp.SupportedPrivilege[i])
+		}
+	}
+	for _, name := range names {
+		m[name] = true
+		if sp, ok := set.lookup(set.SupportedPrivilege, name); ok {
+			add(sp)
+		}
+	}
+	return m
+}
+
+// https://tools.ietf.org/html/rfc3744#section-5.5
+type ACL struct {
+	XMLName xml.Name `xml:"DAV: acl"`
+	ACEs    []ACE    `xml:"ace"`
+}
+
+// https://tools.ietf.org/html/rfc3744#section-5.5
+type ACE struct {
+	XMLName   xml.Name   `xml:"DAV: ace"`
+	Principal *Principal `xml:"principal,omitempty"`
+	Invert    *Invert    `xml:"invert,omitempty"`
+	Grant     *Grant     `xml:"grant,omitempty"`
+	Deny      *Deny      `xml:"deny,omitempty"`
+	Protected *struct{}  `xml:"protected,omitempty"`
+	Inherited *Inherited `xml:"inherited,omitempty"`
+}
+
+// https://tools.ietf.org/html/rfc3744#section-5.5.1
+type Principal struct {
+	XMLName         xml.Name  `xml:"DAV: principal"`
+	Href            *Href     `xml:"href,omitempty"`
+	All             *struct{} `xml:"all,omitempty"`
+	Authenticated   *struct{} `xml:"authenticated,omitempty"`
+	Unauthenticated *struct{} `xml:"unauthenticated,omitempty"`
+	Property        *struct {
+		Raw []RawXMLValue `xml:",any"`
+	} `xml:"property,omitempty"`
+	Self *struct{} `xml:"self,omitempty"`
+}
+
+// https://tools.ietf.org/html/rfc3744#section-5.5.1
+type Invert struct {
+	XMLName   xml.Name  `xml:"DAV: invert"`
+	Principal Principal `xml:"principal"`
+}
+
+// https://tools.ietf.org/html/rfc3744#section-5.5.2
+type Grant struct {
+	XMLName   xml.Name    `xml:"DAV: grant"`
+	Privilege []Privilege `xml:"privilege"`
+}
+
+// https://tools.ietf.org/html/rfc3744#section-5.5.2
+type Deny struct {
+	XMLName   xml.Name    `xml:"DAV: deny"`
+	Privilege []Privilege `xml:"privilege"`
+}
+
+// https://tools.ietf.org/html/rfc3744#section-5.5.4
+type Inherited struct {
+	XMLName xml.Name `xml:"DAV: inherited"`
+	Href    Href     `xml:"href"`
+}
+
+// https://tools.ietf.org/html/rfc3744#section-7.1.1
+type NeedPrivileges struct {
+	XMLName  xml.Name                 `xml:"DAV: need-privileges"`
+	Resource []NeedPrivilegesResource `xml:"resource"`
+}
+
+// https://tools.ietf.org/html/rfc3744#section-7.1.1
+type NeedPrivilegesResource struct {
+	XMLName   xml.Name  `xml:"DAV: resource"`
+	Href      Href      `xml:"href"`
+	Privilege Privilege `xml:"privilege"`
+}
+
+// https://tools.ietf.org/html/rfc3744#section-8.1.1
+type NoProtectedACEConflict struct {
+	XMLName xml.Name `xml:"DAV: no-protected-ace-conflict"`
+}
+
+// https://tools.ietf.org/html/rfc3744#section-8.1.1
+type NoInheritedACEConflict struct {
+	XMLName xml.Name `xml:"DAV: no-inherited-ace-conflict"`
+}
+
+// https://tools.ietf.org/html/rfc3744#section-8.1.1
+type NoInvert struct {
+	XMLName xml.Name `xml:"DAV: no-invert"`
+}
+
+// https://tools.ietf.org/html/rfc3744#section-8.1.1
+type NotSupportedPrivilege struct {
+	XMLName xml.Name `xml:"DAV: not-supported-privilege"`
+}
+
+// https://tools.ietf.org/html/rfc3744#section-8.1.1
+type RecognizedPrincipal struct {
+	XMLName xml.Name `xml:"DAV: recognized-principal"`
+}
+
+// Authorizer decides which privileges are granted to the user sending a
+// request, as defined in RFC 3744.
+type Authorizer interface {
+	// CurrentUserPrivileges returns the privileges granted on a resource.
+	// Aggregate privileges grant the privileges they contain.
+	CurrentUserPrivileges(r *http.Request, path string) ([]xml.Name, error)
+	// ACL returns the access control list of a resource.
+	ACL(r *http.Request, path string) (*ACL, error)
+	// SetACL replaces the ACEs of a resource which are neither protected
+	// nor inherited.
+	SetACL(r *http.Request, path string, acl *ACL) error
+}
+
+type privilegeCheck struct {
+	path      string
+	privilege xml.Name
+}
+
+func parentPath(p string) string {
+	return path.Dir(path.Clean(p))
+}
+
+// resourceExists returns true if the backend knows about the resource. If
+// the backend can't tell, the resource is assumed not to exist, so that
+// creating it requires DAV:bind on the parent collection.
+func (h *Handler) resourceExists(r *http.Request, p string) (bool, error) {
+	cb, ok := h.Backend.(ConditionalBackend)
+	if !ok {
+		return false, nil
+	}
+	st, err := cb.ResourceState(r, p)
+	if IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return st != nil && st.Exists, nil
+}
+
+// requiredPrivileges lists the privileges needed to perform a request, as
+// described in RFC 3744 appendix B.
+func (h *Handler) requiredPrivileges(r *http.Request) ([]privilegeCheck, error) {
+	p := r.URL.Path
+
+	// Creating a resource requires DAV:bind on the parent collection,
+	// writing to an existing one requires DAV:write-content
+	writeContent := func(p string) ([]privilegeCheck, error) {
+		exists, err := h.resourceExists(r, p)
+		if err != nil {
+			return nil, err
+		} else if exists {
+			return []privilegeCheck{{p, PrivilegeWriteContentName}}, nil
+		}
+		return []privilegeCheck{{parentPath(p), PrivilegeBindName}}, nil
+	}
+
+	switch r.Method {
+	case http.MethodOptions, http.MethodGet, http.MethodHead, "PROPFIND", "REPORT":
+		return []privilegeCheck{{p, PrivilegeReadName}}, nil
+	case http.MethodPut, "LOCK":
+		return writeContent(p)
+	case "PROPPATCH":
+		return []privilegeCheck{{p, PrivilegeWritePropertiesName}}, nil
+	case "MKCOL":
+		return []privilegeCheck{{parentPath(p), PrivilegeBindName}}, nil
+	case http.MethodPost:
+		// CalDAV scheduling privileges are aggregated under DAV:bind, see
+		// RFC 6638 section 6.1
+		return []privilegeCheck{{p, PrivilegeBindName}}, nil
+	case http.MethodDelete:
+		return []privilegeCheck{{parentPath(p), PrivilegeUnbindName}}, nil
+	case "UNLOCK":
+		return []privilegeCheck{{p, PrivilegeUnlockName}}, nil
+	case "ACL":
+		return []privilegeCheck{{p, PrivilegeWriteACLName}}, nil
+	case "COPY", "MOVE":
+		dest, err := parseDestination(r.Header)
+		if err != nil {
+			return nil, err
+		}
+		var checks []privilegeCheck
+		if r.Method == "COPY" {
+			checks = append(checks, privilegeCheck{p, PrivilegeReadName})
+		} else {
+			checks = append(checks, privilegeCheck{parentPath(p), PrivilegeUnbindName})
+		}
+		exists, err := h.resourceExists(r, dest.Path)
+		if err != nil {
+			return nil, err
+		}
+		if exists && r.Method == "COPY" {
+			checks = append(checks, privilegeCheck{dest.Path, PrivilegeWriteContentName})
+		} else if exists {
+			checks = append(checks, privilegeCheck{parentPath(dest.Path), PrivilegeUnbindName})
+		}
+		if !exists || r.Method == "MOVE" {
+			checks = append(checks, privilegeCheck{parentPath(dest.Path), PrivilegeBindName})
+		}
+		return checks, nil
+	default:
+		return nil, nil
+	}
+}
+
+func (h *Handler) supportedPrivileges() *SupportedPrivilegeSet {
+	if h.Privileges != nil {
+		return h.Privileges
+	}
+	return NewSupportedPrivilegeSet()
+}
+
+// currentUserPrivileges returns the privileges granted on a resource,
+// including the ones contained in aggregate privileges.
+func (h *Handler) currentUserPrivileges(r *http.Request, p string) (map[xml.Name]bool, error) {
+	names, err := h.Authorizer.CurrentUserPrivileges(r, p)
+	if err != nil {
+		return nil, err
+	}
+	return h.supportedPrivileges().Expand(names), nil
+}
+
+func newNeedPrivilegesError(checks []privilegeCheck) error {
+	var np NeedPrivileges
+	for _, check := range checks {
+		np.Resource = append(np.Resource, NeedPrivilegesResource{
+			Href:      Href{Path: check.path},
+			Privilege: NewPrivilege(check.privilege),
+		})
+	}
+	return NewPreconditionError(http.StatusForbidden, &np)
+}
+
+// Authorize checks that the current user has been granted the privileges
+// required by a request. A 403 Forbidden HTTP error with a DAV:need-privileges
+// precondition is returned otherwise. It's a no-op if the handler has no
+// Authorizer.
+func (h *Handler) Authorize(r *http.Request) error {
+	if h.Authorizer == nil {
+		return nil
+	}
+
+	checks, err := h.requiredPrivileges(r)
+	if err != nil {
+		return err
+	}
+
+	granted := make(map[string]map[xml.Name]bool)
+	var missing []privilegeCheck
+	for _, check := range checks {
+		privs, ok := granted[check.path]
+		if !ok {
+			privs, err = h.currentUserPrivileges(r, check.path)
+			if err != nil {
+				return err
+			}
+			granted[check.path] = privs
+		}
+		if !privs[check.privilege] {
+			missing = append(missing, check)
+		}
+	}
+	if len(missing) > 0 {
+		return newNeedPrivilegesError(missing)
+	}
+	return nil
+}
+
+// AuthorizePrivilege checks that the current user has been granted a
+// privilege on a resource, for requests whose privileges can't be derived
+// from the method alone. It's a no-op if the handler has no Authorizer.
+func (h *Handler) AuthorizePrivilege(r *http.Request, p string, privilege xml.Name) error {
+	if h.Authorizer == nil {
+		return nil
+	}
+	privs, err := h.currentUserPrivileges(r, p)
+	if err != nil {
+		return err
+	}
+	if !privs[privilege] {
+		return newNeedPrivilegesError([]privilegeCheck{{p, privilege}})
+	}
+	return nil
+}
+
+// AuthorizeResponses checks that the current user can read the resources
+// listed in the responses of a REPORT request. Responses for resources which
+// can't be read are replaced with a 403 Forbidden DAV:need-privileges error.
+// Access control properties are filled in as for PROPFIND. It's a no-op if
+// the handler has no Authorizer.
+func (h *Handler) AuthorizeResponses(r *http.Request, propfind *PropFind, resps []Response) error {
+	if h.Authorizer == nil {
+		return nil
+	}
+	pf := aclPropFinder{h: h, r: r, propfind: propfind, target: r.URL.Path}
+	for i := range resps {
+		if err := pf.transform(&resps[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *Handler) handleACL(w http.ResponseWriter, r *http.Request) error {
+	if h.Authorizer == nil {
+		return HTTPErrorf(http.StatusMethodNotAllowed, "webdav: access control not supported")
+	}
+
+	var acl ACL
+	if err := DecodeXMLRequest(r, &acl); err != nil {
+		return err
+	}
+
+	supported := h.supportedPrivileges()
+	for _, ace := range acl.ACEs {
+		if ace.Invert != nil {
+			return NewPreconditionError(http.StatusForbidden, &NoInvert{})
+		} else if ace.Protected != nil {
+			return NewPreconditionError(http.StatusForbidden, &NoProtectedACEConflict{})
+		} else if ace.Inherited != nil {
+			return NewPreconditionError(http.StatusForbidden, &NoInheritedACEConflict{})
+		}
+
+		if ace.Principal == nil || ace.Principal.Property != nil {
+			return NewPreconditionError(http.StatusForbidden, &RecognizedPrincipal{})
+		}
+		if (ace.Grant == nil) == (ace.Deny == nil) {
+			return HTTPErrorf(http.StatusBadRequest, "webdav: ACE must contain exactly one of grant or deny")
+		}
+
+		var privs []Privilege
+		if ace.Grant != nil {
+			privs = ace.Grant.Privilege
+		} else {
+			privs = ace.Deny.Privilege
+		}
+		for _, priv := range privs {
+			for _, name := range priv.Names() {
+				if !supported.Contains(name) {
+					return NewPreconditionError(http.StatusForbidden, &NotSupportedPrivilege{})
+				}
+			}
+		}
+	}
+
+	if err := h.Authorizer.SetACL(r, r.URL.Path, &acl); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// aclPropFinder computes the access control properties of PROPFIND
+// responses. Backends don't know about the Authorizer, so these properties
+// are filled in by the handler.
+type aclPropFinder struct {
+	h        *Handler
+	r        *http.Request
+	propfind *PropFind
+	target   string
+}
+
+var aclProps = []xml.Name{ACLName, SupportedPrivilegeSetName, CurrentUserPrivilegeSetName}
+
+func (pf *aclPropFinder) requested(name xml.Name, resp *Response) bool {
+	if pf.propfind.PropName != nil {
+		return true
+	} else if prop := pf.propfind.Prop; prop != nil {
+		return prop.Get(name) != nil
+	}
+	// RFC 3744 section 5 properties are expensive and aren't returned for
+	// allprop, unless the backend already did
+	for _, propstat := range resp.PropStats {
+		if propstat.Prop.Get(name) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (pf *aclPropFinder) propValue(name xml.Name, p string, privs map[xml.Name]bool) (interface{}, error) {
+	switch name {
+	case ACLName:
+		if !privs[PrivilegeReadACLName] {
+			return nil, newNeedPrivilegesError([]privilegeCheck{{p, PrivilegeReadACLName}})
+		}
+		return pf.h.Authorizer.ACL(pf.r, p)
+	case SupportedPrivilegeSetName:
+		return pf.h.supportedPrivileges(), nil
+	case CurrentUserPrivilegeSetName:
+		if !privs[PrivilegeReadCurrentUserPrivilegeSetName] {
+			return nil, newNeedPrivilegesError([]privilegeCheck{{p, PrivilegeReadCurrentUserPrivilegeSetName}})
+		}
+		var set CurrentUserPrivilegeSet
+		for _, priv := range pf.h.supportedPrivileges().Names() {
+			if privs[priv] {
+				set.Privilege = append(set.Privilege, NewPrivilege(priv))
+			}
+		}
+		return &set, nil
+	default:
+		panic(fmt.Sprintf("webdav: unknown access control property %v", name))
+	}
+}
+
+// transform updates a PROPFIND response. Members which can't be read are
+// replaced with an error.
+func (pf *aclPropFinder) transform(resp *Response) error {
+	if len(resp.Hrefs) != 1 {
+		return nil
+	}
+	p := resp.Hrefs[0].Path
+
+	privs, err := pf.h.currentUserPrivileges(pf.r, p)
+	if err != nil {
+		return err
+	}
+	if !privs[PrivilegeReadName] {
+		if path.Clean(p) == path.Clean(pf.target) {
+			return nil
+		}
+		*resp = *NewErrorResponse(p, newNeedPrivilegesError([]privilegeCheck{{p, PrivilegeReadName}}))
+		return nil
+	}
+	if resp.Status != nil {
+		// Errors don't carry properties
+		return nil
+	}
+
+	for _, name := range aclProps {
+		if !pf.requested(name, resp) {
+			continue
+		}
+		resp.removeProp(name)
+
+		if pf.propfind.PropName != nil {
+			if err := resp.EncodeProp(http.StatusOK, NewRawXMLElement(name, nil, nil)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		code := http.StatusOK
+		val, err := pf.propValue(name, p, privs)
+		if err != nil {
+			code = HTTPErrorFromError(err).Code
+			val = NewRawXMLElement(name, nil, nil)
+		}
+		if err := resp.EncodeProp(code, val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package internal
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+func TestSupportedPrivilegeSet_Expand(t *testing.T) {
+	set := NewSupportedPrivilegeSet()
+
+	privs := set.Expand([]xml.Name{PrivilegeWriteName, PrivilegeReadName})
+	for _, name := range []xml.Name{PrivilegeReadName, PrivilegeWriteName, PrivilegeWriteContentName, PrivilegeBindName, PrivilegeUnbindName} {
+		if !privs[name] {
+			t.Errorf("Expand() is missing %v", name)
+		}
+	}
+	for _, name := range []xml.Name{PrivilegeAllName, PrivilegeWriteACLName} {
+		if privs[name] {
+			t.Errorf("Expand() unexpectedly grants %v", name)
+		}
+	}
+
+	privs = set.Expand([]xml.Name{PrivilegeAllName})
+	for _, name := range set.Names() {
+		if !privs[name] {
+			t.Errorf("Expand(all) is missing %v", name)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package internal
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+)
+
+// This file holds the access control types exposed by the webdav package,
+// which are shared with the caldav and carddav packages.
+
+// AccessPrivilege is an access control privilege, as defined in RFC 3744
+// section 3.
+type AccessPrivilege xml.Name
+
+// AccessPrincipal describes the principals an ACE applies to. Exactly one of
+// the fields is set.
+type AccessPrincipal struct {
+	// Href is the URL of a principal.
+	Href            string
+	All             bool
+	Authenticated   bool
+	Unauthenticated bool
+	Self            bool
+}
+
+// AccessEntry is an access control entry, as defined in RFC 3744 section 5.5.
+type AccessEntry struct {
+	Principal AccessPrincipal
+	Grant     []AccessPrivilege
+	Deny      []AccessPrivilege
+	// Protected ACEs can't be modified with the ACL method.
+	Protected bool
+	// Inherited is the path of the resource the ACE is inherited from, if
+	// any. Inherited ACEs can't be modified with the ACL method.
+	Inherited string
+}
+
+// AccessAuthorizer decides which privileges are granted to the current user,
+// for instance based on the request context.
+type AccessAuthorizer interface {
+	// CurrentUserPrivileges returns the privileges granted on a resource.
+	// Aggregate privileges grant all of the privileges they contain.
+	//
+	// Creating a resource requires DAV:bind on the parent collection, so the
+	// path may not exist.
+	CurrentUserPrivileges(ctx context.Context, name string) ([]AccessPrivilege, error)
+	// ACL returns the access control list of a resource.
+	ACL(ctx context.Context, name string) ([]AccessEntry, error)
+	// SetACL replaces the ACEs of a resource which are neither protected nor
+	// inherited. A 403 Forbidden HTTP error can be returned to reject the
+	// ACL.
+	SetACL(ctx context.Context, name string, aces []AccessEntry) error
+}
+
+// NewAuthorizer adapts an AccessAuthorizer for Handler. It returns nil if a
+// is nil.
+func NewAuthorizer(a AccessAuthorizer) Authorizer {
+	if a == nil {
+		return nil
+	}
+	return &accessAuthorizer{a}
+}
+
+type accessAuthorizer struct {
+	AccessAuthorizer
+}
+
+func (a *accessAuthorizer) CurrentUserPrivileges(r *http.Request, name string) ([]xml.Name, error) {
+	privs, err := a.AccessAuthorizer.CurrentUserPrivileges(r.Context(), name)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]xml.Name, len(privs))
+	for i, priv := range privs {
+		names[i] = xml.Name(priv)
+	}
+	return names, nil
+}
+
+func (a *accessAuthorizer) ACL(r *http.Request, name string) (*ACL, error) {
+	aces, err := a.AccessAuthorizer.ACL(r.Context(), name)
+	if err != nil {
+		return nil, err
+	}
+	acl := &ACL{ACEs: make([]ACE, len(aces))}
+	for i, ace := range aces {
+		acl.ACEs[i] = encodeACE(&ace)
+	}
+	return acl, nil
+}
+
+func (a *accessAuthorizer) SetACL(r *http.Request, name string, acl *ACL) error {
+	aces := make([]AccessEntry, len(acl.ACEs))
+	for i := range acl.ACEs {
+		aces[i] = decodeACE(&acl.ACEs[i])
+	}
+	return a.AccessAuthorizer.SetACL(r.Context(), name, aces)
+}
+
+func encodePrivileges(privs []AccessPrivilege) []Privilege {
+	l := make([]Privilege, len(privs))
+	for i, priv := range privs {
+		l[i] = NewPrivilege(xml.Name(priv))
+	}
+	return l
+}
+
+func decodePrivileges(l []Privilege) []AccessPrivilege {
+	var privs []AccessPrivilege
+	for _, priv := range l {
+		for _, name := range priv.Names() {
+			privs = append(privs, AccessPrivilege(name))
+		}
+	}
+	return privs
+}
+
+func encodeACE(ace *AccessEntry) ACE {
+	var principal Principal
+	switch p := &ace.Principal; {
+	case p.Href != "":
+		principal.Href = &Href{Path: p.Href}
+	case p.All:
+		principal.All = &struct{}{}
+	case p.Authenticated:
+		principal.Authenticated = &struct{}{}
+	case p.Unauthenticated:
+		principal.Unauthenticated = &struct{}{}
+	case p.Self:
+		principal.Self = &struct{}{}
+	}
+
+	out := ACE{Principal: &principal}
+	if len(ace.Grant) > 0 {
+		out.Grant = &Grant{Privilege: encodePrivileges(ace.Grant)}
+	}
+	if len(ace.Deny) > 0 {
+		out.Deny = &Deny{Privilege: encodePrivileges(ace.Deny)}
+	}
+	if ace.Protected {
+		out.Protected = &struct{}{}
+	}
+	if ace.Inherited != "" {
+		out.Inherited = &Inherited{Href: Href{Path: ace.Inherited}}
+	}
+	return out
+}
+
+func decodeACE(ace *ACE) AccessEntry {
+	var out AccessEntry
+	if p := ace.Principal; p != nil {
+		out.Principal = AccessPrincipal{
+			All:             p.All != nil,
+			Authenticated:   p.Authenticated != nil,
+			Unauthenticated: p.Unauthenticated != nil,
+			Self:            p.Self != nil,
+		}
+		if p.Href != nil {
+			out.Principal.Href = p.Href.Path
+		}
+	}
+	if ace.Grant != nil {
+		out.Grant = decodePrivileges(ace.Grant.Privilege)
+	}
+	if ace.Deny != nil {
+		out.Deny = decodePrivileges(ace.Deny.Privilege)
+	}
+	return out
+}
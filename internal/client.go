@@ -189,23 +189,170 @@ func (c *Client) Do(req *http.Request) (*http.Response, error) {
 }
 
 func (c *Client) DoMultiStatus(req *http.Request) (*MultiStatus, error) {
+	mr, err := c.DoMultiStatusReader(req)
+	if err != nil {
+		return nil, err
+	}
+	defer mr.Close()
+
+	var ms MultiStatus
+	for mr.Next() {
+		ms.Responses = append(ms.Responses, *mr.Response())
+	}
+	if err := mr.Err(); err != nil {
+		return nil, err
+	}
+	ms.ResponseDescription = mr.ResponseDescription
+	ms.SyncToken = mr.SyncToken
+
+	return &ms, nil
+}
+
+// DoPartial sends a request which may fail on individual members of a
+// collection, such as DELETE, COPY or MOVE. A 207 Multi-Status response is
+// turned into a *PartialError.
+func (c *Client) DoPartial(req *http.Request) error {
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusMultiStatus {
+		resp.Body.Close()
+		return nil
+	}
+
+	mr := NewMultiStatusReader(resp.Body)
+	defer mr.Close()
+
+	var partial PartialError
+	for mr.Next() {
+		resp := mr.Response()
+		err := resp.Err()
+		if err == nil {
+			continue
+		}
+		for _, href := range resp.Hrefs {
+			partial.Errors = append(partial.Errors, MemberError{Path: href.Path, Err: err})
+		}
+	}
+	if err := mr.Err(); err != nil {
+		return err
+	}
+	if len(partial.Errors) == 0 {
+		return nil
+	}
+	return &partial
+}
+
+// DoMultiStatusReader sends a request expecting a multistatus response. The
+// response is decoded incrementally by the returned reader, which must be
+// closed.
+func (c *Client) DoMultiStatusReader(req *http.Request) (*MultiStatusReader, error) {
 	resp, err := c.Do(req)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusMultiStatus {
+		resp.Body.Close()
 		return nil, fmt.Errorf("HTTP multi-status request failed: %v", resp.Status)
 	}
 
-	// TODO: the response can be quite large, support streaming Response elements
-	var ms MultiStatus
-	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
-		return nil, err
+	return NewMultiStatusReader(resp.Body), nil
+}
+
+// MultiStatusReader decodes a multistatus response one Response at a time.
+type MultiStatusReader struct {
+	// ResponseDescription and SyncToken are populated once Next returns
+	// false.
+	ResponseDescription string
+	SyncToken           string
+
+	rc      io.ReadCloser
+	dec     *xml.Decoder
+	started bool
+	done    bool
+	resp    *Response
+	err     error
+}
+
+// NewMultiStatusReader creates a new multistatus reader.
+func NewMultiStatusReader(rc io.ReadCloser) *MultiStatusReader {
+	return &MultiStatusReader{rc: rc, dec: xml.NewDecoder(rc)}
+}
+
+// Next decodes the next Response. It returns false when the end of the
+// multistatus has been reached or when an error occurs.
+func (mr *MultiStatusReader) Next() bool {
+	mr.resp = nil
+	if mr.done || mr.err != nil {
+		return false
 	}
 
-	return &ms, nil
+	for {
+		tok, err := mr.dec.Token()
+		if err == io.EOF && mr.started {
+			mr.err = fmt.Errorf("webdav: unexpected EOF in multistatus")
+			return false
+		} else if err != nil {
+			mr.err = err
+			return false
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if !mr.started {
+				if tok.Name != multiStatusStart.Name {
+					mr.err = fmt.Errorf("webdav: expected multistatus element, got <%v %v>", tok.Name.Space, tok.Name.Local)
+					return false
+				}
+				mr.started = true
+				continue
+			}
+
+			var err error
+			switch tok.Name {
+			case xml.Name{Namespace, "response"}:
+				var resp Response
+				if err := mr.dec.DecodeElement(&resp, &tok); err != nil {
+					mr.err = err
+					return false
+				}
+				mr.resp = &resp
+				return true
+			case xml.Name{Namespace, "responsedescription"}:
+				err = mr.dec.DecodeElement(&mr.ResponseDescription, &tok)
+			case xml.Name{Namespace, "sync-token"}:
+				err = mr.dec.DecodeElement(&mr.SyncToken, &tok)
+			default:
+				err = mr.dec.Skip()
+			}
+			if err != nil {
+				mr.err = err
+				return false
+			}
+		case xml.EndElement:
+			if mr.started {
+				mr.done = true
+				return false
+			}
+		}
+	}
+}
+
+// Response returns the current Response.
+func (mr *MultiStatusReader) Response() *Response {
+	return mr.resp
+}
+
+// Err returns the error which stopped decoding, if any.
+func (mr *MultiStatusReader) Err() error {
+	return mr.err
+}
+
+// Close closes the underlying response body.
+func (mr *MultiStatusReader) Close() error {
+	return mr.rc.Close()
 }
 
 func (c *Client) PropFind(ctx context.Context, path string, depth Depth, propfind *PropFind) (*MultiStatus, error) {
@@ -219,6 +366,19 @@ func (c *Client) PropFind(ctx context.Context, path string, depth Depth, propfin
 	return c.DoMultiStatus(req.WithContext(ctx))
 }
 
+// PropFindReader performs a PROPFIND request, decoding the responses
+// incrementally.
+func (c *Client) PropFindReader(ctx context.Context, path string, depth Depth, propfind *PropFind) (*MultiStatusReader, error) {
+	req, err := c.NewXMLRequest("PROPFIND", path, propfind)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("Depth", depth.String())
+
+	return c.DoMultiStatusReader(req.WithContext(ctx))
+}
+
 // PropfindFlat performs a PROPFIND request with a zero depth.
 func (c *Client) PropFindFlat(ctx context.Context, path string, propfind *PropFind) (*Response, error) {
 	ms, err := c.PropFind(ctx, path, DepthZero, propfind)
@@ -276,7 +436,7 @@ func (c *Client) Options(ctx context.Context, path string) (classes map[string]b
 func (c *Client) SyncCollection(ctx context.Context, path, syncToken string, level Depth, limit *Limit, prop *Prop) (*MultiStatus, error) {
 	q := SyncCollectionQuery{
 		SyncToken: syncToken,
-		SyncLevel: level.String(),
+		SyncLevel: formatSyncLevel(level),
 		Limit:     limit,
 		Prop:      prop,
 	}
@@ -0,0 +1,44 @@
+package internal
+
+import "strings"
+
+// Collations used to compare text, as defined in RFC 4790 section 9.
+//
+// i;unicode-casemap (RFC 5051) isn't supported: it requires titlecase mapping
+// and NFKD decomposition, which need Unicode tables the standard library
+// doesn't provide.
+const (
+	CollationOctet        = "i;octet"
+	CollationASCIICasemap = "i;ascii-casemap"
+)
+
+// IsSupportedCollation returns true if the collation is supported by
+// FoldCollation.
+func IsSupportedCollation(collation string) bool {
+	switch collation {
+	case CollationOctet, CollationASCIICasemap:
+		return true
+	}
+	return false
+}
+
+// FoldCollation maps a string to its canonical form for a collation: two
+// strings are equal under the collation if their canonical forms are equal,
+// and substring matching can be performed on the canonical forms. False is
+// returned if the collation isn't supported.
+func FoldCollation(collation, s string) (string, bool) {
+	switch collation {
+	case CollationOctet:
+		return s, true
+	case CollationASCIICasemap:
+		return strings.Map(foldASCII, s), true
+	}
+	return "", false
+}
+
+func foldASCII(r rune) rune {
+	if 'a' <= r && r <= 'z' {
+		return r - 'a' + 'A'
+	}
+	return r
+}
@@ -0,0 +1,33 @@
+package internal
+
+import (
+	"testing"
+)
+
+func TestFoldCollation(t *testing.T) {
+	for _, tc := range []struct {
+		collation string
+		a, b      string
+		equal     bool
+	}{
+		{CollationOctet, "Smith", "Smith", true},
+		{CollationOctet, "Smith", "smith", false},
+		{CollationASCIICasemap, "Smith", "sMITH", true},
+		{CollationASCIICasemap, "École", "école", false},
+	} {
+		a, ok := FoldCollation(tc.collation, tc.a)
+		if !ok {
+			t.Fatalf("FoldCollation(%q) reported an unsupported collation", tc.collation)
+		}
+		b, _ := FoldCollation(tc.collation, tc.b)
+		if equal := a == b; equal != tc.equal {
+			t.Errorf("%v: %q == %q: got %v, want %v", tc.collation, tc.a, tc.b, equal, tc.equal)
+		}
+	}
+
+	for _, collation := range []string{"i;unknown", "i;unicode-casemap"} {
+		if _, ok := FoldCollation(collation, "Smith"); ok {
+			t.Errorf("FoldCollation() accepted unsupported collation %q", collation)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"bytes"
 	"encoding/xml"
 	"errors"
 	"fmt"
@@ -26,6 +27,19 @@ var (
 
 	CurrentUserPrincipalName    = xml.Name{Namespace, "current-user-principal"}
 	CurrentUserPrivilegeSetName = xml.Name{Namespace, "current-user-privilege-set"}
+
+	LockDiscoveryName = xml.Name{Namespace, "lockdiscovery"}
+	SupportedLockName = xml.Name{Namespace, "supportedlock"}
+
+	SyncCollectionName = xml.Name{Namespace, "sync-collection"}
+	SyncTokenName      = xml.Name{Namespace, "sync-token"}
+
+	QuotaAvailableBytesName = xml.Name{Namespace, "quota-available-bytes"}
+	QuotaUsedBytesName      = xml.Name{Namespace, "quota-used-bytes"}
+
+	propertyUpdateName = xml.Name{Namespace, "propertyupdate"}
+	removeName         = xml.Name{Namespace, "remove"}
+	setName            = xml.Name{Namespace, "set"}
 )
 
 type Status struct {
@@ -218,6 +232,24 @@ func newPropError(name xml.Name, err error) error {
 	return fmt.Errorf("property <%v %v>: %w", name.Space, name.Local, err)
 }
 
+// removeProp removes a property from all propstat elements.
+func (resp *Response) removeProp(name xml.Name) {
+	propstats := resp.PropStats[:0]
+	for _, propstat := range resp.PropStats {
+		raw := propstat.Prop.Raw[:0]
+		for _, v := range propstat.Prop.Raw {
+			if n, ok := v.XMLName(); !ok || n != name {
+				raw = append(raw, v)
+			}
+		}
+		propstat.Prop.Raw = raw
+		if len(raw) > 0 {
+			propstats = append(propstats, propstat)
+		}
+	}
+	resp.PropStats = propstats
+}
+
 func (resp *Response) EncodeProp(code int, v interface{}) error {
 	raw, err := EncodeRawXMLElement(v)
 	if err != nil {
@@ -430,6 +462,58 @@ type PropertyUpdate struct {
 	XMLName xml.Name `xml:"DAV: propertyupdate"`
 	Remove  []Remove `xml:"remove"`
 	Set     []Set    `xml:"set"`
+
+	// Instructions holds the set and remove instructions in document order.
+	// It's only populated when decoding.
+	Instructions []PropertyInstruction `xml:"-"`
+}
+
+// PropertyInstruction is a single set or remove instruction of a
+// PropertyUpdate. Exactly one of Remove and Set is non-nil.
+type PropertyInstruction struct {
+	Remove *Remove
+	Set    *Set
+}
+
+// UnmarshalXML implements xml.Unmarshaler. Instructions must be applied in
+// document order, see RFC 4918 section 9.2.
+func (pu *PropertyUpdate) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	if start.Name != propertyUpdateName {
+		return fmt.Errorf("webdav: expected element %q %q, got %q %q", propertyUpdateName.Space, propertyUpdateName.Local, start.Name.Space, start.Name.Local)
+	}
+	*pu = PropertyUpdate{XMLName: start.Name}
+
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			switch tok.Name {
+			case removeName:
+				remove := new(Remove)
+				if err := d.DecodeElement(remove, &tok); err != nil {
+					return err
+				}
+				pu.Remove = append(pu.Remove, *remove)
+				pu.Instructions = append(pu.Instructions, PropertyInstruction{Remove: remove})
+			case setName:
+				set := new(Set)
+				if err := d.DecodeElement(set, &tok); err != nil {
+					return err
+				}
+				pu.Set = append(pu.Set, *set)
+				pu.Instructions = append(pu.Instructions, PropertyInstruction{Set: set})
+			default:
+				if err := d.Skip(); err != nil {
+					return err
+				}
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
 }
 
 // https://tools.ietf.org/html/rfc4918#section-14.23
@@ -444,6 +528,22 @@ type Set struct {
 	Prop    Prop     `xml:"prop"`
 }
 
+// https://tools.ietf.org/html/rfc6578#section-6.2
+type SyncToken struct {
+	XMLName xml.Name `xml:"DAV: sync-token"`
+	Token   string   `xml:",chardata"`
+}
+
+// https://tools.ietf.org/html/rfc6578#section-3.2
+type ValidSyncToken struct {
+	XMLName xml.Name `xml:"DAV: valid-sync-token"`
+}
+
+// https://tools.ietf.org/html/rfc6578#section-3.7
+type NumberOfMatchesWithinLimits struct {
+	XMLName xml.Name `xml:"DAV: number-of-matches-within-limits"`
+}
+
 // https://tools.ietf.org/html/rfc6578#section-6.1
 type SyncCollectionQuery struct {
 	XMLName   xml.Name `xml:"DAV: sync-collection"`
@@ -461,23 +561,184 @@ type Limit struct {
 
 // https://tools.ietf.org/html/rfc3744#section-5.4
 type CurrentUserPrivilegeSet struct {
-	XMLName   xml.Name `xml:"DAV: current-user-privilege-set"`
-	Privilege []Privilege
+	XMLName   xml.Name    `xml:"DAV: current-user-privilege-set"`
+	Privilege []Privilege `xml:"privilege"`
 }
 
 // https://tools.ietf.org/html/rfc3744#section-5.4
 type Privilege struct {
-	XMLName xml.Name  `xml:"DAV: privilege"`
-	Read    *struct{} `xml:"DAV: read,omitempty"`
-	Write   *struct{} `xml:"DAV: write,omitempty"`
+	XMLName xml.Name      `xml:"DAV: privilege"`
+	Raw     []RawXMLValue `xml:",any"`
+}
+
+// NewPrivilege creates a DAV:privilege element containing the privilege
+// name.
+func NewPrivilege(name xml.Name) Privilege {
+	return Privilege{Raw: []RawXMLValue{*NewRawXMLElement(name, nil, nil)}}
+}
+
+// Names returns the names of the privileges contained in the element.
+func (p *Privilege) Names() []xml.Name {
+	var names []xml.Name
+	for _, raw := range p.Raw {
+		if name, ok := raw.XMLName(); ok {
+			names = append(names, name)
+		}
+	}
+	return names
 }
 
 // NewCurrentUserPrivilegeSet returns a privilege set granting DAV:read, plus
 // DAV:write unless readOnly is set.
 func NewCurrentUserPrivilegeSet(readOnly bool) *CurrentUserPrivilegeSet {
-	priv := Privilege{Read: &struct{}{}}
+	privs := []Privilege{NewPrivilege(PrivilegeReadName)}
 	if !readOnly {
-		priv.Write = &struct{}{}
+		privs = append(privs, NewPrivilege(PrivilegeWriteName))
+	}
+	return &CurrentUserPrivilegeSet{Privilege: privs}
+}
+
+// https://tools.ietf.org/html/rfc4918#section-14.11
+type LockInfo struct {
+	XMLName   xml.Name     `xml:"DAV: lockinfo"`
+	LockScope LockScope    `xml:"lockscope"`
+	LockType  LockType     `xml:"locktype"`
+	Owner     *RawXMLValue `xml:"owner,omitempty"`
+}
+
+// https://tools.ietf.org/html/rfc4918#section-14.13
+type LockScope struct {
+	XMLName   xml.Name  `xml:"DAV: lockscope"`
+	Exclusive *struct{} `xml:"exclusive,omitempty"`
+	Shared    *struct{} `xml:"shared,omitempty"`
+}
+
+// https://tools.ietf.org/html/rfc4918#section-14.15
+type LockType struct {
+	XMLName xml.Name  `xml:"DAV: locktype"`
+	Write   *struct{} `xml:"write,omitempty"`
+}
+
+// https://tools.ietf.org/html/rfc4918#section-14.17
+type Owner struct {
+	XMLName  xml.Name `xml:"DAV: owner"`
+	InnerXML string   `xml:",innerxml"`
+}
+
+// NewOwner creates a DAV:owner element from a decoded one. Namespaces of
+// child elements are preserved.
+func NewOwner(raw *RawXMLValue) (*Owner, error) {
+	var buf bytes.Buffer
+	enc := xml.NewEncoder(&buf)
+	for _, child := range raw.children {
+		if err := child.MarshalXML(enc, xml.StartElement{}); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+	return &Owner{InnerXML: buf.String()}, nil
+}
+
+// https://tools.ietf.org/html/rfc4918#section-14.1
+type ActiveLock struct {
+	XMLName   xml.Name   `xml:"DAV: activelock"`
+	LockScope LockScope  `xml:"lockscope"`
+	LockType  LockType   `xml:"locktype"`
+	Depth     Depth      `xml:"depth"`
+	Owner     *Owner     `xml:"owner,omitempty"`
+	Timeout   Timeout    `xml:"timeout"`
+	LockToken *LockToken `xml:"locktoken,omitempty"`
+	LockRoot  LockRoot   `xml:"lockroot"`
+}
+
+// https://tools.ietf.org/html/rfc4918#section-14.14
+type LockToken struct {
+	XMLName xml.Name `xml:"DAV: locktoken"`
+	Href    Href     `xml:"href"`
+}
+
+// https://tools.ietf.org/html/rfc4918#section-14.12
+type LockRoot struct {
+	XMLName xml.Name `xml:"DAV: lockroot"`
+	Href    Href     `xml:"href"`
+}
+
+// https://tools.ietf.org/html/rfc4918#section-15.8
+type LockDiscovery struct {
+	XMLName    xml.Name     `xml:"DAV: lockdiscovery"`
+	ActiveLock []ActiveLock `xml:"activelock"`
+}
+
+// https://tools.ietf.org/html/rfc4918#section-15.10
+type SupportedLock struct {
+	XMLName   xml.Name    `xml:"DAV: supportedlock"`
+	LockEntry []LockEntry `xml:"lockentry"`
+}
+
+// https://tools.ietf.org/html/rfc4918#section-14.10
+type LockEntry struct {
+	XMLName   xml.Name  `xml:"DAV: lockentry"`
+	LockScope LockScope `xml:"lockscope"`
+	LockType  LockType  `xml:"locktype"`
+}
+
+// NewSupportedLock returns a lock capability set advertising exclusive and
+// shared write locks.
+func NewSupportedLock() *SupportedLock {
+	return &SupportedLock{LockEntry: []LockEntry{
+		{LockScope: LockScope{Exclusive: &struct{}{}}, LockType: LockType{Write: &struct{}{}}},
+		{LockScope: LockScope{Shared: &struct{}{}}, LockType: LockType{Write: &struct{}{}}},
+	}}
+}
+
+// https://tools.ietf.org/html/rfc4918#section-16
+type LockTokenSubmitted struct {
+	XMLName xml.Name `xml:"DAV: lock-token-submitted"`
+	Hrefs   []Href   `xml:"href"`
+}
+
+// https://tools.ietf.org/html/rfc4918#section-16
+type NoConflictingLock struct {
+	XMLName xml.Name `xml:"DAV: no-conflicting-lock"`
+	Hrefs   []Href   `xml:"href"`
+}
+
+// https://tools.ietf.org/html/rfc4918#section-16
+type LockTokenMatchesRequestURI struct {
+	XMLName xml.Name `xml:"DAV: lock-token-matches-request-uri"`
+}
+
+// https://tools.ietf.org/html/rfc4918#section-16
+type CannotModifyProtectedProperty struct {
+	XMLName xml.Name `xml:"DAV: cannot-modify-protected-property"`
+}
+
+// https://tools.ietf.org/html/rfc4331#section-3
+type QuotaAvailableBytes struct {
+	XMLName xml.Name `xml:"DAV: quota-available-bytes"`
+	Bytes   int64    `xml:",chardata"`
+}
+
+// https://tools.ietf.org/html/rfc4331#section-4
+type QuotaUsedBytes struct {
+	XMLName xml.Name `xml:"DAV: quota-used-bytes"`
+	Bytes   int64    `xml:",chardata"`
+}
+
+// https://tools.ietf.org/html/rfc4331#section-6
+type QuotaNotExceeded struct {
+	XMLName xml.Name `xml:"DAV: quota-not-exceeded"`
+}
+
+// NewPreconditionError creates an HTTP error carrying a DAV:error element
+// with the provided pre- or postcondition elements.
+func NewPreconditionError(code int, conditions ...interface{}) *HTTPError {
+	raw := make([]RawXMLValue, len(conditions))
+	for i, v := range conditions {
+		r, _ := EncodeRawXMLElement(v)
+		raw[i] = *r
 	}
-	return &CurrentUserPrivilegeSet{Privilege: []Privilege{priv}}
+	return &HTTPError{Code: code, Err: &Error{Raw: raw}}
 }
@@ -65,3 +65,29 @@ func TestTimeRoundTrip(t *testing.T) {
 		t.Fatalf("invalid round-trip:\ngot= %s\nwant=%s", got, want)
 	}
 }
+
+func TestParseTimeout(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want Timeout
+		err  bool
+	}{
+		{s: "Infinite", want: 0},
+		{s: "Second-4100000000", want: Timeout(4100000000 * time.Second)},
+		{s: "Second-3600", want: Timeout(time.Hour)},
+		{s: "Infinite, Second-3600", want: 0},
+		{s: "Foo, Second-60", want: Timeout(time.Minute)},
+		{s: "Foo", err: true},
+	} {
+		got, err := ParseTimeout(tc.s)
+		if tc.err {
+			if err == nil {
+				t.Errorf("ParseTimeout(%q) = %v, want an error", tc.s, got)
+			}
+		} else if err != nil {
+			t.Errorf("ParseTimeout(%q) = %v", tc.s, err)
+		} else if got != tc.want {
+			t.Errorf("ParseTimeout(%q) = %v, want %v", tc.s, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+)
+
+var ExpandPropertyName = xml.Name{Namespace, "expand-property"}
+
+// https://datatracker.ietf.org/doc/html/rfc3253#section-3.8
+type ExpandProperty struct {
+	XMLName  xml.Name   `xml:"DAV: expand-property"`
+	Property []Property `xml:"property"`
+}
+
+type Property struct {
+	XMLName   xml.Name   `xml:"DAV: property"`
+	Name      string     `xml:"name,attr"`
+	Namespace string     `xml:"namespace,attr,omitempty"`
+	Property  []Property `xml:"property"`
+}
+
+func (p *Property) xmlName() xml.Name {
+	ns := p.Namespace
+	if ns == "" {
+		ns = Namespace
+	}
+	return xml.Name{ns, p.Name}
+}
+
+// ExpandPropertyFunc returns the properties of a single resource, as requested
+// by a PROPFIND with Depth: 0.
+type ExpandPropertyFunc func(path string, propfind *PropFind) (*Response, error)
+
+// NewExpandPropertyResponse builds the response to an expand-property REPORT request for
+// a resource. The DAV:href elements of properties with nested DAV:property
+// elements are replaced with the response for the referenced resource, and so
+// on recursively.
+func NewExpandPropertyResponse(path string, props []Property, f ExpandPropertyFunc) (*Response, error) {
+	propfind := PropFind{Prop: &Prop{Raw: make([]RawXMLValue, len(props))}}
+	nested := make(map[xml.Name][]Property)
+	for i := range props {
+		name := props[i].xmlName()
+		propfind.Prop.Raw[i] = *NewRawXMLElement(name, nil, nil)
+		if len(props[i].Property) > 0 {
+			nested[name] = props[i].Property
+		}
+	}
+
+	resp, err := f(path, &propfind)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range resp.PropStats {
+		propstat := &resp.PropStats[i]
+		if propstat.Status.Code != http.StatusOK {
+			continue
+		}
+		for j := range propstat.Prop.Raw {
+			raw := &propstat.Prop.Raw[j]
+			name, ok := raw.XMLName()
+			if !ok || len(nested[name]) == 0 {
+				continue
+			}
+
+			hrefs, err := decodeHrefs(raw)
+			if err != nil {
+				return nil, err
+			} else if len(hrefs) == 0 {
+				continue
+			}
+
+			children := make([]RawXMLValue, len(hrefs))
+			for k, href := range hrefs {
+				child, err := NewExpandPropertyResponse(href.Path, nested[name], f)
+				if err != nil {
+					child = NewErrorResponse(href.Path, err)
+				}
+				v, err := EncodeRawXMLElement(child)
+				if err != nil {
+					return nil, err
+				}
+				children[k] = *v
+			}
+			*raw = *NewRawXMLElement(name, nil, children)
+		}
+	}
+
+	return resp, nil
+}
+
+// decodeHrefs returns the DAV:href elements contained in a property.
+func decodeHrefs(raw *RawXMLValue) ([]Href, error) {
+	// Property values returned by backends are marshal-only
+	b, err := xml.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var v struct {
+		Hrefs []Href `xml:"DAV: href"`
+	}
+	if err := xml.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	return v.Hrefs, nil
+}
+
+// ServeExpandProperty replies to an expand-property REPORT request, as defined
+// in RFC 3253 section 3.8. Referenced resources are looked up with
+// Backend.PropFind.
+func (h *Handler) ServeExpandProperty(w http.ResponseWriter, r *http.Request, ep *ExpandProperty) error {
+	if s := r.Header.Get("Depth"); s != "" && s != "0" {
+		return HTTPErrorf(http.StatusBadRequest, "webdav: expand-property REPORT requests require Depth: 0")
+	}
+
+	resp, err := NewExpandPropertyResponse(r.URL.Path, ep.Property, func(p string, propfind *PropFind) (*Response, error) {
+		req := r
+		if p != r.URL.Path {
+			req = r.Clone(r.Context())
+			req.URL.Path = p
+			req.URL.RawPath = ""
+		}
+
+		ms, err := h.Backend.PropFind(req, propfind, DepthZero)
+		if err != nil {
+			return nil, err
+		} else if len(ms.Responses) != 1 {
+			return nil, fmt.Errorf("webdav: expected exactly one PROPFIND response, got %v", len(ms.Responses))
+		}
+		resp := &ms.Responses[0]
+
+		if h.Authorizer != nil {
+			pf := aclPropFinder{h: h, r: r, propfind: propfind, target: r.URL.Path}
+			if err := pf.transform(resp); err != nil {
+				return nil, err
+			}
+		}
+		return resp, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return ServeMultiStatus(w, NewMultiStatus(*resp))
+}
@@ -0,0 +1,329 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// IfCondition is a single condition in an If header list. Exactly one of
+// StateToken or ETag is set.
+type IfCondition struct {
+	Not        bool
+	StateToken string
+	ETag       ETag
+}
+
+// IfList is a list of conditions in an If header. The list evaluates to true
+// if all of its conditions are true.
+type IfList struct {
+	// Resource is the resource tag of a tagged list. It's empty for
+	// untagged lists, which apply to the request URI.
+	Resource   string
+	Conditions []IfCondition
+}
+
+// IfHeader is a parsed If header, as defined in RFC 4918 section 10.4.
+type IfHeader struct {
+	Lists []IfList
+}
+
+// ParseIf parses an If header. An empty string results in a nil IfHeader.
+func ParseIf(s string) (*IfHeader, error) {
+	p := ifParser{s: s}
+	p.skipSpace()
+	if p.empty() {
+		return nil, nil
+	}
+
+	var h IfHeader
+	var tagged bool
+	for !p.empty() {
+		var resource string
+		if p.peek() == '<' {
+			if len(h.Lists) > 0 && !tagged {
+				return nil, fmt.Errorf("webdav: invalid If header: mixed tagged and untagged lists")
+			}
+			tagged = true
+
+			ref, err := p.codedURL()
+			if err != nil {
+				return nil, err
+			}
+			u, err := url.Parse(ref)
+			if err != nil {
+				return nil, fmt.Errorf("webdav: invalid If header: malformed resource tag: %v", err)
+			}
+			resource = u.Path
+			if resource == "" {
+				return nil, fmt.Errorf("webdav: invalid If header: empty resource tag")
+			}
+			p.skipSpace()
+		} else if tagged {
+			return nil, fmt.Errorf("webdav: invalid If header: mixed tagged and untagged lists")
+		}
+
+		n := 0
+		for !p.empty() && p.peek() == '(' {
+			l, err := p.list()
+			if err != nil {
+				return nil, err
+			}
+			l.Resource = resource
+			h.Lists = append(h.Lists, *l)
+			n++
+			p.skipSpace()
+		}
+		if n == 0 {
+			return nil, fmt.Errorf("webdav: invalid If header: expected list")
+		}
+	}
+	return &h, nil
+}
+
+type ifParser struct {
+	s string
+}
+
+func (p *ifParser) empty() bool {
+	return len(p.s) == 0
+}
+
+func (p *ifParser) peek() byte {
+	return p.s[0]
+}
+
+func (p *ifParser) skipSpace() {
+	p.s = strings.TrimLeft(p.s, " \t")
+}
+
+func (p *ifParser) delimited(start, end byte) (string, error) {
+	if p.empty() || p.peek() != start {
+		return "", fmt.Errorf("webdav: invalid If header: expected %q", start)
+	}
+	i := strings.IndexByte(p.s, end)
+	if i < 0 {
+		return "", fmt.Errorf("webdav: invalid If header: missing %q", end)
+	}
+	v := p.s[1:i]
+	p.s = p.s[i+1:]
+	return v, nil
+}
+
+func (p *ifParser) codedURL() (string, error) {
+	return p.delimited('<', '>')
+}
+
+func (p *ifParser) list() (*IfList, error) {
+	p.s = p.s[1:] // consume "("
+
+	var l IfList
+	for {
+		p.skipSpace()
+		if p.empty() {
+			return nil, fmt.Errorf("webdav: invalid If header: unterminated list")
+		}
+		if p.peek() == ')' {
+			p.s = p.s[1:]
+			break
+		}
+
+		var cond IfCondition
+		if strings.HasPrefix(p.s, "Not") {
+			cond.Not = true
+			p.s = p.s[len("Not"):]
+			p.skipSpace()
+		}
+
+		if p.empty() {
+			return nil, fmt.Errorf("webdav: invalid If header: unterminated list")
+		}
+		switch p.peek() {
+		case '<':
+			token, err := p.codedURL()
+			if err != nil {
+				return nil, err
+			}
+			if token == "" {
+				return nil, fmt.Errorf("webdav: invalid If header: empty state token")
+			}
+			cond.StateToken = token
+		case '[':
+			s, err := p.delimited('[', ']')
+			if err != nil {
+				return nil, err
+			}
+			s = strings.TrimPrefix(strings.TrimSpace(s), "W/")
+			if err := cond.ETag.UnmarshalText([]byte(s)); err != nil {
+				return nil, fmt.Errorf("webdav: invalid If header: %v", err)
+			}
+		default:
+			return nil, fmt.Errorf("webdav: invalid If header: unexpected character %q", p.peek())
+		}
+		l.Conditions = append(l.Conditions, cond)
+	}
+
+	if len(l.Conditions) == 0 {
+		return nil, fmt.Errorf("webdav: invalid If header: empty list")
+	}
+	return &l, nil
+}
+
+// LockTokens returns the state tokens submitted in the header. Negated
+// tokens aren't considered submitted.
+func (h *IfHeader) LockTokens() []string {
+	if h == nil {
+		return nil
+	}
+	var tokens []string
+	for _, l := range h.Lists {
+		for _, cond := range l.Conditions {
+			if cond.StateToken != "" && !cond.Not {
+				tokens = append(tokens, cond.StateToken)
+			}
+		}
+	}
+	return tokens
+}
+
+// ResourceState describes the current state of a resource, used to evaluate
+// If header conditions.
+type ResourceState struct {
+	// Exists is false for unmapped URLs.
+	Exists bool
+	// ETag is empty if the resource doesn't exist or has no entity tag.
+	ETag string
+	// LockTokens contains the tokens of the locks applying to the resource.
+	LockTokens []string
+}
+
+func (state *ResourceState) match(cond *IfCondition) bool {
+	var ok bool
+	if cond.StateToken != "" {
+		for _, token := range state.LockTokens {
+			if token == cond.StateToken {
+				ok = true
+				break
+			}
+		}
+	} else {
+		ok = state.ETag != "" && string(cond.ETag) == state.ETag
+	}
+	if cond.Not {
+		ok = !ok
+	}
+	return ok
+}
+
+// Evaluate evaluates the If header for a request on reqPath. The header
+// evaluates to true if at least one of its lists evaluates to true. The state
+// function is called to look up the state of resources; it may return a nil
+// state for missing resources.
+func (h *IfHeader) Evaluate(reqPath string, state func(p string) (*ResourceState, error)) (bool, error) {
+	if h == nil {
+		return true, nil
+	}
+
+	cache := make(map[string]*ResourceState)
+	for _, l := range h.Lists {
+		p := reqPath
+		if l.Resource != "" {
+			p = l.Resource
+		}
+		p = path.Clean(p)
+
+		st, ok := cache[p]
+		if !ok {
+			var err error
+			st, err = state(p)
+			if err != nil {
+				return false, err
+			}
+			if st == nil {
+				st = &ResourceState{}
+			}
+			cache[p] = st
+		}
+
+		match := true
+		for i := range l.Conditions {
+			if !st.match(&l.Conditions[i]) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ConditionalBackend is implemented by backends able to report the state of
+// their resources. Handlers evaluate If headers for such backends, and reject
+// requests with an If header for other backends.
+type ConditionalBackend interface {
+	ResourceState(r *http.Request, path string) (*ResourceState, error)
+}
+
+// checkIf evaluates the If header of requests with a method modifying
+// resources.
+func (h *Handler) checkIf(r *http.Request) error {
+	switch r.Method {
+	case http.MethodPut, http.MethodDelete, http.MethodPost, "PROPPATCH", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK", "ACL":
+		// ok
+	default:
+		return nil
+	}
+
+	ifHeader, err := ParseIf(r.Header.Get("If"))
+	if err != nil {
+		return &HTTPError{http.StatusBadRequest, err}
+	}
+
+	if ifHeader == nil {
+		return nil
+	}
+	cb, ok := h.Backend.(ConditionalBackend)
+	if !ok {
+		// Conditions which can't be evaluated must not be ignored
+		return HTTPErrorf(http.StatusPreconditionFailed, "webdav: If header conditions aren't supported")
+	}
+
+	states := make(map[string]*ResourceState)
+	ok, err = ifHeader.Evaluate(r.URL.Path, func(p string) (*ResourceState, error) {
+		st, err := cb.ResourceState(r, p)
+		if IsNotFound(err) {
+			st, err = nil, nil
+		}
+		states[p] = st
+		return st, err
+	})
+	if err != nil {
+		return err
+	} else if ok {
+		return nil
+	}
+
+	// Report submitted lock tokens which don't identify a lock on the
+	// resource they've been evaluated against
+	for _, l := range ifHeader.Lists {
+		p := r.URL.Path
+		if l.Resource != "" {
+			p = l.Resource
+		}
+		st := states[path.Clean(p)]
+		if st == nil {
+			st = &ResourceState{}
+		}
+		for i := range l.Conditions {
+			cond := &l.Conditions[i]
+			if cond.StateToken != "" && !cond.Not && !st.match(cond) {
+				return NewPreconditionError(http.StatusPreconditionFailed, &LockTokenMatchesRequestURI{})
+			}
+		}
+	}
+	return HTTPErrorf(http.StatusPreconditionFailed, "webdav: If header condition failed")
+}
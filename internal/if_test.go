@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseIf(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want *IfHeader
+	}{
+		{
+			s:    "",
+			want: nil,
+		},
+		{
+			s: "(<urn:uuid:181d4fae-7d8c-11d0-a765-00a0c91e6bf2>)",
+			want: &IfHeader{Lists: []IfList{
+				{Conditions: []IfCondition{{StateToken: "urn:uuid:181d4fae-7d8c-11d0-a765-00a0c91e6bf2"}}},
+			}},
+		},
+		{
+			// RFC 4918 section 10.4.7
+			s: `(<urn:uuid:181d4fae-7d8c-11d0-a765-00a0c91e6bf2> ["I am an ETag"]) (["I am another ETag"])`,
+			want: &IfHeader{Lists: []IfList{
+				{Conditions: []IfCondition{
+					{StateToken: "urn:uuid:181d4fae-7d8c-11d0-a765-00a0c91e6bf2"},
+					{ETag: "I am an ETag"},
+				}},
+				{Conditions: []IfCondition{{ETag: "I am another ETag"}}},
+			}},
+		},
+		{
+			// RFC 4918 section 10.4.8
+			s: "(Not <urn:uuid:181d4fae-7d8c-11d0-a765-00a0c91e6bf2> <urn:uuid:58f202ac-22cf-11d1-b12d-002035b29092>)",
+			want: &IfHeader{Lists: []IfList{
+				{Conditions: []IfCondition{
+					{Not: true, StateToken: "urn:uuid:181d4fae-7d8c-11d0-a765-00a0c91e6bf2"},
+					{StateToken: "urn:uuid:58f202ac-22cf-11d1-b12d-002035b29092"},
+				}},
+			}},
+		},
+		{
+			// RFC 4918 section 10.4.10
+			s: `<http://www.example.com/specs/> (["4217"]) <http://www.example.com/specs/rfc2518.doc> (["4218"]) ([W/"4219"])`,
+			want: &IfHeader{Lists: []IfList{
+				{Resource: "/specs/", Conditions: []IfCondition{{ETag: "4217"}}},
+				{Resource: "/specs/rfc2518.doc", Conditions: []IfCondition{{ETag: "4218"}}},
+				{Resource: "/specs/rfc2518.doc", Conditions: []IfCondition{{ETag: "4219"}}},
+			}},
+		},
+	} {
+		h, err := ParseIf(tc.s)
+		if err != nil {
+			t.Errorf("ParseIf(%q) = %v", tc.s, err)
+		} else if !reflect.DeepEqual(h, tc.want) {
+			t.Errorf("ParseIf(%q) = %+v, want %+v", tc.s, h, tc.want)
+		}
+	}
+
+	for _, s := range []string{
+		"(",
+		"()",
+		"<urn:x>",
+		"(<urn:x>) <http://example.org/> (<urn:y>)",
+		"(foo)",
+		`(W/"4219")`,
+	} {
+		if _, err := ParseIf(s); err == nil {
+			t.Errorf("ParseIf(%q): expected an error", s)
+		}
+	}
+}
+
+func TestIfHeader_Evaluate(t *testing.T) {
+	states := map[string]*ResourceState{
+		"/a":   {ETag: "1", LockTokens: []string{"urn:lock-a"}},
+		"/b":   {ETag: "2"},
+		"/dir": {},
+	}
+	state := func(p string) (*ResourceState, error) {
+		return states[p], nil
+	}
+
+	for _, tc := range []struct {
+		path string
+		s    string
+		want bool
+	}{
+		{"/a", "(<urn:lock-a>)", true},
+		{"/a", "(<urn:lock-b>)", false},
+		{"/a", `(<urn:lock-a> ["1"])`, true},
+		{"/a", `(<urn:lock-a> ["2"])`, false},
+		{"/a", `(["2"]) (["1"])`, true},
+		{"/b", "(<urn:lock-a>)", false},
+		{"/b", "(Not <urn:lock-a>)", true},
+		{"/b", "(Not <DAV:no-lock>)", true},
+		{"/b", "(<DAV:no-lock>)", false},
+		{"/b", "</a> (<urn:lock-a>)", true},
+		{"/b", `</a> (["2"]) </b> (["2"])`, true},
+		{"/b", `</b/> (["2"])`, true},
+		{"/missing", `(["1"])`, false},
+		{"/missing", `(Not ["1"])`, true},
+	} {
+		h, err := ParseIf(tc.s)
+		if err != nil {
+			t.Fatalf("ParseIf(%q) = %v", tc.s, err)
+		}
+		got, err := h.Evaluate(tc.path, state)
+		if err != nil {
+			t.Errorf("Evaluate(%q, %q) = %v", tc.path, tc.s, err)
+		} else if got != tc.want {
+			t.Errorf("Evaluate(%q, %q) = %v, want %v", tc.path, tc.s, got, tc.want)
+		}
+	}
+}
@@ -6,6 +6,10 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Depth indicates whether a request applies to the resource's members. It's
@@ -49,6 +53,68 @@ func (d Depth) String() string {
 	panic("webdav: invalid Depth value")
 }
 
+// MarshalText implements encoding.TextMarshaler.
+func (d Depth) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Depth) UnmarshalText(b []byte) error {
+	v, err := ParseDepth(strings.ToLower(string(b)))
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+// Timeout is a lock timeout, as defined in RFC 4918 section 10.7. A zero
+// Timeout is infinite.
+type Timeout time.Duration
+
+// ParseTimeout parses a Timeout header. The first supported timeout type in
+// the list is returned.
+func ParseTimeout(s string) (Timeout, error) {
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if strings.EqualFold(v, "Infinite") {
+			return 0, nil
+		}
+		if len(v) > len("Second-") && strings.EqualFold(v[:len("Second-")], "Second-") {
+			n, err := strconv.ParseUint(v[len("Second-"):], 10, 32)
+			if err != nil || n == 0 {
+				continue
+			}
+			return Timeout(time.Duration(n) * time.Second), nil
+		}
+	}
+	return 0, fmt.Errorf("webdav: invalid Timeout value")
+}
+
+// String formats the timeout.
+func (t Timeout) String() string {
+	if t <= 0 {
+		return "Infinite"
+	}
+	secs := (time.Duration(t) + time.Second - 1) / time.Second
+	return fmt.Sprintf("Second-%d", secs)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (t Timeout) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (t *Timeout) UnmarshalText(b []byte) error {
+	v, err := ParseTimeout(string(b))
+	if err != nil {
+		return err
+	}
+	*t = v
+	return nil
+}
+
 // ParseOverwrite parses an Overwrite header.
 func ParseOverwrite(s string) (bool, error) {
 	switch s {
@@ -110,6 +176,43 @@ func (err *HTTPError) Unwrap() error {
 	return err.Err
 }
 
+// MemberError is an error affecting a single member of a collection.
+type MemberError struct {
+	Path string
+	Err  error
+}
+
+// PartialError reports failures on individual members of a collection, for
+// instance when some files of a directory couldn't be deleted. Handlers reply
+// with a 207 Multi-Status response, see RFC 4918 sections 9.6.1 and 9.8.8.
+type PartialError struct {
+	Errors []MemberError
+}
+
+func (err *PartialError) Error() string {
+	if len(err.Errors) == 1 {
+		merr := err.Errors[0]
+		return fmt.Sprintf("%v: %v", merr.Path, merr.Err)
+	}
+	return fmt.Sprintf("operation failed on %v members", len(err.Errors))
+}
+
+// Affects returns true if the operation failed on the resource at path p or
+// on one of its members. It's safe to call on a nil PartialError.
+func (err *PartialError) Affects(p string) bool {
+	if err == nil {
+		return false
+	}
+	p = path.Clean(p)
+	for _, merr := range err.Errors {
+		mp := path.Clean(merr.Path)
+		if mp == p || p == "/" || strings.HasPrefix(mp, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
 type HrefError struct {
 	Href url.URL
 	Err  error
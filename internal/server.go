@@ -8,10 +8,17 @@ import (
 	"mime"
 	"net/http"
 	"net/url"
+	"path"
 	"strings"
 )
 
 func ServeError(w http.ResponseWriter, err error) {
+	var aborted *abortedError
+	if errors.As(err, &aborted) {
+		// The response has already been terminated
+		return
+	}
+
 	code := http.StatusInternalServerError
 	var httpErr *HTTPError
 	if errors.As(err, &httpErr) {
@@ -55,10 +62,169 @@ func ServeXML(w http.ResponseWriter) *xml.Encoder {
 	return xml.NewEncoder(w)
 }
 
+func serveXMLStatus(w http.ResponseWriter, code int, v interface{}) error {
+	w.Header().Add("Content-Type", "application/xml; charset=\"utf-8\"")
+	w.WriteHeader(code)
+	w.Write([]byte(xml.Header))
+	return xml.NewEncoder(w).Encode(v)
+}
+
+// servePartialError replies with a 207 Multi-Status response listing the
+// failed members if err is a *PartialError. name is the path of the resource
+// targeted by the operation. Other errors are returned as-is.
+func servePartialError(w http.ResponseWriter, name string, err error) error {
+	var partial *PartialError
+	if !errors.As(err, &partial) || len(partial.Errors) == 0 {
+		return err
+	}
+
+	// A failure on the request URI itself is reported with a regular status
+	if len(partial.Errors) == 1 && path.Clean(partial.Errors[0].Path) == path.Clean(name) {
+		return partial.Errors[0].Err
+	}
+
+	resps := make([]Response, len(partial.Errors))
+	for i, merr := range partial.Errors {
+		resps[i] = *NewErrorResponse(merr.Path, merr.Err)
+	}
+	return ServeMultiStatus(w, NewMultiStatus(resps...))
+}
+
 func ServeMultiStatus(w http.ResponseWriter, ms *MultiStatus) error {
-	// TODO: streaming
-	w.WriteHeader(http.StatusMultiStatus)
-	return ServeXML(w).Encode(ms)
+	mw := NewMultiStatusWriter(w)
+	mw.ResponseDescription = ms.ResponseDescription
+	mw.SyncToken = ms.SyncToken
+	for i := range ms.Responses {
+		if err := mw.WriteResponse(&ms.Responses[i]); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+// MultiStatusWriter streams a multistatus response. Each Response is encoded
+// and flushed as soon as it's written.
+//
+// The 207 Multi-Status status code is sent with the first response, after
+// which errors can't be reported to the client anymore.
+type MultiStatusWriter struct {
+	// ResponseDescription and SyncToken are written when closing.
+	ResponseDescription string
+	SyncToken           string
+
+	w       http.ResponseWriter
+	enc     *xml.Encoder
+	started bool
+
+	// transform is called on each response before it's written
+	transform func(resp *Response) error
+}
+
+var multiStatusStart = xml.StartElement{Name: xml.Name{Namespace, "multistatus"}}
+
+// NewMultiStatusWriter creates a new multistatus writer.
+func NewMultiStatusWriter(w http.ResponseWriter) *MultiStatusWriter {
+	return &MultiStatusWriter{w: w}
+}
+
+func (mw *MultiStatusWriter) start() error {
+	if mw.started {
+		return nil
+	}
+	mw.started = true
+
+	mw.w.Header().Add("Content-Type", "application/xml; charset=\"utf-8\"")
+	mw.w.WriteHeader(http.StatusMultiStatus)
+	if _, err := mw.w.Write([]byte(xml.Header)); err != nil {
+		return err
+	}
+	mw.enc = xml.NewEncoder(mw.w)
+	return mw.enc.EncodeToken(multiStatusStart)
+}
+
+func (mw *MultiStatusWriter) flush() error {
+	if err := mw.enc.Flush(); err != nil {
+		return err
+	}
+	if f, ok := mw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// Started reports whether the status code has already been sent.
+func (mw *MultiStatusWriter) Started() bool {
+	return mw.started
+}
+
+// WriteResponse writes a response.
+func (mw *MultiStatusWriter) WriteResponse(resp *Response) error {
+	if mw.transform != nil {
+		if err := mw.transform(resp); err != nil {
+			return err
+		}
+	}
+	if err := mw.start(); err != nil {
+		return err
+	}
+	if err := mw.enc.Encode(resp); err != nil {
+		return err
+	}
+	return mw.flush()
+}
+
+// Abort terminates a multistatus response which has already been started
+// after an error: a final response carrying the error is written for path. The
+// error is returned wrapped so that it isn't served again.
+func (mw *MultiStatusWriter) Abort(path string, err error) error {
+	// The sync token would acknowledge changes which haven't been reported
+	mw.SyncToken = ""
+
+	resp := NewErrorResponse(path, err)
+	if encErr := mw.enc.Encode(resp); encErr != nil {
+		return &abortedError{encErr}
+	}
+	if closeErr := mw.Close(); closeErr != nil {
+		return &abortedError{closeErr}
+	}
+	return &abortedError{err}
+}
+
+// abortedError is an error which happened after the response has been
+// started. It can't be reported to the client anymore.
+type abortedError struct {
+	err error
+}
+
+func (err *abortedError) Error() string {
+	return err.err.Error()
+}
+
+func (err *abortedError) Unwrap() error {
+	return err.err
+}
+
+// Close terminates the multistatus response.
+func (mw *MultiStatusWriter) Close() error {
+	if err := mw.start(); err != nil {
+		return err
+	}
+	if mw.ResponseDescription != "" {
+		start := xml.StartElement{Name: xml.Name{Namespace, "responsedescription"}}
+		if err := mw.enc.EncodeElement(mw.ResponseDescription, start); err != nil {
+			return err
+		}
+	}
+	if mw.SyncToken != "" {
+		start := xml.StartElement{Name: xml.Name{Namespace, "sync-token"}}
+		if err := mw.enc.EncodeElement(mw.SyncToken, start); err != nil {
+			return err
+		}
+	}
+	if err := mw.enc.EncodeToken(multiStatusStart.End()); err != nil {
+		return err
+	}
+	return mw.flush()
 }
 
 type Backend interface {
@@ -73,15 +239,37 @@ type Backend interface {
 	Move(r *http.Request, dest *Href, overwrite bool) (created bool, err error)
 }
 
+// PropFindStreamer is implemented by backends able to stream PROPFIND
+// responses. Handlers use it instead of Backend.PropFind, so that responses
+// don't need to be held in memory.
+type PropFindStreamer interface {
+	StreamPropFind(r *http.Request, pf *PropFind, depth Depth, mw *MultiStatusWriter) error
+}
+
+// LockBackend is implemented by backends supporting WebDAV locks, as defined
+// in RFC 4918 section 6. Handlers advertise DAV compliance class 2 for such
+// backends.
+type LockBackend interface {
+	Lock(r *http.Request, depth Depth, timeout Timeout, info *LockInfo) (lock *ActiveLock, created bool, err error)
+	RefreshLock(r *http.Request, token string, timeout Timeout) (*ActiveLock, error)
+	Unlock(r *http.Request, token string) error
+}
+
 type Handler struct {
 	Backend Backend
+	// Authorizer enables access control, as defined in RFC 3744. If nil,
+	// all requests are allowed.
+	Authorizer Authorizer
+	// Privileges lists the supported privileges. If nil, the privileges
+	// defined in RFC 3744 are used.
+	Privileges *SupportedPrivilegeSet
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	var err error
 	if h.Backend == nil {
 		err = fmt.Errorf("webdav: no backend available")
-	} else {
+	} else if err = h.checkPreconditions(r); err == nil {
 		switch r.Method {
 		case http.MethodOptions:
 			err = h.handleOptions(w, r)
@@ -90,10 +278,11 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		case http.MethodPut:
 			err = h.Backend.Put(w, r)
 		case http.MethodDelete:
-			// TODO: send a multistatus in case of partial failure
 			err = h.Backend.Delete(r)
 			if err == nil {
 				w.WriteHeader(http.StatusNoContent)
+			} else {
+				err = servePartialError(w, r.URL.Path, err)
 			}
 		case "PROPFIND":
 			err = h.handlePropfind(w, r)
@@ -106,6 +295,14 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			}
 		case "COPY", "MOVE":
 			err = h.handleCopyMove(w, r)
+		case "LOCK":
+			err = h.handleLock(w, r)
+		case "UNLOCK":
+			err = h.handleUnlock(w, r)
+		case "ACL":
+			err = h.handleACL(w, r)
+		case "REPORT":
+			err = h.handleReport(w, r)
 		default:
 			err = HTTPErrorf(http.StatusMethodNotAllowed, "webdav: unsupported method")
 		}
@@ -116,12 +313,29 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// checkPreconditions checks privileges, then evaluates the If header, so that
+// users can't probe the state of resources they can't access.
+func (h *Handler) checkPreconditions(r *http.Request) error {
+	if err := h.Authorize(r); err != nil {
+		return err
+	}
+	return h.checkIf(r)
+}
+
 func (h *Handler) handleOptions(w http.ResponseWriter, r *http.Request) error {
 	caps, allow, err := h.Backend.Options(r)
 	if err != nil {
 		return err
 	}
-	caps = append([]string{"1", "3"}, caps...)
+	if _, ok := h.Backend.(LockBackend); ok {
+		caps = append([]string{"1", "2", "3"}, caps...)
+	} else {
+		caps = append([]string{"1", "3"}, caps...)
+	}
+	if h.Authorizer != nil {
+		caps = append(caps, "access-control")
+		allow = append(allow, "ACL")
+	}
 
 	w.Header().Add("DAV", strings.Join(caps, ", "))
 	w.Header().Add("Allow", strings.Join(allow, ", "))
@@ -152,14 +366,73 @@ func (h *Handler) handlePropfind(w http.ResponseWriter, r *http.Request) error {
 		}
 	}
 
+	var transform func(resp *Response) error
+	if h.Authorizer != nil {
+		pf := aclPropFinder{h: h, r: r, propfind: &propfind, target: r.URL.Path}
+		transform = pf.transform
+	}
+
+	if pfs, ok := h.Backend.(PropFindStreamer); ok {
+		mw := NewMultiStatusWriter(w)
+		mw.transform = transform
+		if err := pfs.StreamPropFind(r, &propfind, depth, mw); err != nil {
+			if mw.Started() {
+				// Too late to send an error status
+				return mw.Abort(r.URL.Path, err)
+			}
+			return err
+		}
+		return mw.Close()
+	}
+
 	ms, err := h.Backend.PropFind(r, &propfind, depth)
 	if err != nil {
 		return err
 	}
 
+	if transform != nil {
+		for i := range ms.Responses {
+			if err := transform(&ms.Responses[i]); err != nil {
+				return err
+			}
+		}
+	}
+
 	return ServeMultiStatus(w, ms)
 }
 
+type reportReq struct {
+	ExpandProperty *ExpandProperty
+	SyncCollection *SyncCollectionQuery
+}
+
+func (r *reportReq) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var v interface{}
+	switch start.Name {
+	case ExpandPropertyName:
+		r.ExpandProperty = &ExpandProperty{}
+		v = r.ExpandProperty
+	case SyncCollectionName:
+		r.SyncCollection = &SyncCollectionQuery{}
+		v = r.SyncCollection
+	default:
+		return fmt.Errorf("webdav: unsupported REPORT root %q %q", start.Name.Space, start.Name.Local)
+	}
+
+	return d.DecodeElement(v, &start)
+}
+
+func (h *Handler) handleReport(w http.ResponseWriter, r *http.Request) error {
+	var report reportReq
+	if err := DecodeXMLRequest(r, &report); err != nil {
+		return err
+	}
+	if report.SyncCollection != nil {
+		return h.ServeSyncCollection(w, r, report.SyncCollection)
+	}
+	return h.ServeExpandProperty(w, r, report.ExpandProperty)
+}
+
 type PropFindFunc func(raw *RawXMLValue) (interface{}, error)
 
 func PropFindValue(value interface{}) PropFindFunc {
@@ -304,7 +577,7 @@ func (h *Handler) handleCopyMove(w http.ResponseWriter, r *http.Request) error {
 		created, err = h.Backend.Move(r, dest, overwrite)
 	}
 	if err != nil {
-		return err
+		return servePartialError(w, dest.Path, err)
 	}
 
 	if created {
@@ -314,3 +587,96 @@ func (h *Handler) handleCopyMove(w http.ResponseWriter, r *http.Request) error {
 	}
 	return nil
 }
+
+func (h *Handler) handleLock(w http.ResponseWriter, r *http.Request) error {
+	lb, ok := h.Backend.(LockBackend)
+	if !ok {
+		return HTTPErrorf(http.StatusMethodNotAllowed, "webdav: unsupported method")
+	}
+
+	var timeout Timeout
+	if s := r.Header.Get("Timeout"); s != "" {
+		var err error
+		timeout, err = ParseTimeout(s)
+		if err != nil {
+			return &HTTPError{http.StatusBadRequest, err}
+		}
+	}
+
+	var (
+		lock    *ActiveLock
+		created bool
+		err     error
+	)
+	refresh := IsRequestBodyEmpty(r)
+	if refresh {
+		// A LOCK request without a body refreshes an existing lock, see RFC
+		// 4918 section 9.10.2
+		ifHeader, _ := ParseIf(r.Header.Get("If"))
+		tokens := ifHeader.LockTokens()
+		if len(tokens) != 1 {
+			return HTTPErrorf(http.StatusBadRequest, "webdav: expected exactly one lock token in If header to refresh lock")
+		}
+		lock, err = lb.RefreshLock(r, tokens[0], timeout)
+	} else {
+		var info LockInfo
+		if err := DecodeXMLRequest(r, &info); err != nil {
+			return err
+		}
+		if info.LockType.Write == nil {
+			return HTTPErrorf(http.StatusBadRequest, "webdav: unsupported lock type")
+		}
+		if (info.LockScope.Exclusive == nil) == (info.LockScope.Shared == nil) {
+			return HTTPErrorf(http.StatusBadRequest, "webdav: expected exactly one of exclusive or shared lock scope")
+		}
+
+		depth := DepthInfinity
+		if s := r.Header.Get("Depth"); s != "" {
+			depth, err = ParseDepth(s)
+			if err != nil {
+				return &HTTPError{http.StatusBadRequest, err}
+			}
+			if depth == DepthOne {
+				return HTTPErrorf(http.StatusBadRequest, `webdav: "Depth: 1" is not supported in LOCK request`)
+			}
+		}
+
+		lock, created, err = lb.Lock(r, depth, timeout, &info)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !refresh && lock.LockToken != nil {
+		w.Header().Set("Lock-Token", "<"+lock.LockToken.Href.String()+">")
+	}
+
+	prop, err := EncodeProp(&LockDiscovery{ActiveLock: []ActiveLock{*lock}})
+	if err != nil {
+		return err
+	}
+
+	code := http.StatusOK
+	if created {
+		code = http.StatusCreated
+	}
+	return serveXMLStatus(w, code, prop)
+}
+
+func (h *Handler) handleUnlock(w http.ResponseWriter, r *http.Request) error {
+	lb, ok := h.Backend.(LockBackend)
+	if !ok {
+		return HTTPErrorf(http.StatusMethodNotAllowed, "webdav: unsupported method")
+	}
+
+	s := strings.TrimSpace(r.Header.Get("Lock-Token"))
+	if len(s) < 2 || s[0] != '<' || s[len(s)-1] != '>' {
+		return HTTPErrorf(http.StatusBadRequest, "webdav: missing or malformed Lock-Token header in UNLOCK request")
+	}
+
+	if err := lb.Unlock(r, s[1:len(s)-1]); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
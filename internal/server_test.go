@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMultiStatusWriter(t *testing.T) {
+	w := httptest.NewRecorder()
+	mw := NewMultiStatusWriter(w)
+	mw.SyncToken = "http://example.org/sync/1"
+
+	if mw.Started() {
+		t.Errorf("Started() = true before writing a response")
+	}
+	resps := []Response{*NewOKResponse("/a"), *NewOKResponse("/b")}
+	for i := range resps {
+		if err := mw.WriteResponse(&resps[i]); err != nil {
+			t.Fatalf("WriteResponse() = %v", err)
+		}
+	}
+	if !w.Flushed {
+		t.Errorf("response wasn't flushed after WriteResponse()")
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+
+	if w.Code != http.StatusMultiStatus {
+		t.Errorf("status = %v, want %v", w.Code, http.StatusMultiStatus)
+	}
+	if ct := w.Header().Get("Content-Type"); ct == "" {
+		t.Errorf("missing Content-Type header")
+	}
+
+	var ms MultiStatus
+	if err := xml.Unmarshal(w.Body.Bytes(), &ms); err != nil {
+		t.Fatalf("xml.Unmarshal() = %v", err)
+	}
+	if len(ms.Responses) != len(resps) {
+		t.Fatalf("got %v responses, want %v", len(ms.Responses), len(resps))
+	}
+	for i, resp := range ms.Responses {
+		if !reflect.DeepEqual(resp.Hrefs, resps[i].Hrefs) {
+			t.Errorf("response %v: hrefs = %v, want %v", i, resp.Hrefs, resps[i].Hrefs)
+		}
+	}
+	if ms.SyncToken != mw.SyncToken {
+		t.Errorf("sync token = %q, want %q", ms.SyncToken, mw.SyncToken)
+	}
+}
+
+func TestMultiStatusWriter_abort(t *testing.T) {
+	w := httptest.NewRecorder()
+	mw := NewMultiStatusWriter(w)
+	mw.SyncToken = "http://example.org/sync/1"
+
+	if err := mw.WriteResponse(NewOKResponse("/a")); err != nil {
+		t.Fatalf("WriteResponse() = %v", err)
+	}
+	failure := HTTPErrorf(http.StatusInsufficientStorage, "out of space")
+	err := mw.Abort("/", failure)
+	if !errors.Is(err, failure) {
+		t.Errorf("Abort() = %v, want %v", err, failure)
+	}
+
+	// The response must not be written to again
+	ServeError(w, err)
+
+	var ms MultiStatus
+	if err := xml.Unmarshal(w.Body.Bytes(), &ms); err != nil {
+		t.Fatalf("xml.Unmarshal() = %v:\n%v", err, w.Body.String())
+	}
+	if len(ms.Responses) != 2 {
+		t.Fatalf("got %v responses, want 2", len(ms.Responses))
+	}
+	if status := ms.Responses[1].Status; status == nil || status.Code != http.StatusInsufficientStorage {
+		t.Errorf("final response status = %v, want %v", status, http.StatusInsufficientStorage)
+	}
+	if ms.SyncToken != "" {
+		t.Errorf("aborted response has sync token %q", ms.SyncToken)
+	}
+}
+
+const exampleMultiStatusStr = `<?xml version="1.0" encoding="utf-8" ?>
+<d:multistatus xmlns:d="DAV:">
+  <d:response>
+    <d:href>/a</d:href>
+    <d:status>HTTP/1.1 200 OK</d:status>
+  </d:response>
+  <d:unknown><d:response/></d:unknown>
+  <d:response>
+    <d:href>/b</d:href>
+    <d:status>HTTP/1.1 404 Not Found</d:status>
+  </d:response>
+  <d:responsedescription>Some description</d:responsedescription>
+  <d:sync-token>http://example.org/sync/2</d:sync-token>
+</d:multistatus>`
+
+func TestMultiStatusReader(t *testing.T) {
+	mr := NewMultiStatusReader(io.NopCloser(strings.NewReader(exampleMultiStatusStr)))
+	defer mr.Close()
+
+	var paths []string
+	for mr.Next() {
+		paths = append(paths, mr.Response().Hrefs[0].Path)
+	}
+	if err := mr.Err(); err != nil {
+		t.Fatalf("Err() = %v", err)
+	}
+
+	if want := []string{"/a", "/b"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("paths = %v, want %v", paths, want)
+	}
+	if want := "Some description"; mr.ResponseDescription != want {
+		t.Errorf("ResponseDescription = %q, want %q", mr.ResponseDescription, want)
+	}
+	if want := "http://example.org/sync/2"; mr.SyncToken != want {
+		t.Errorf("SyncToken = %q, want %q", mr.SyncToken, want)
+	}
+
+	truncated := exampleMultiStatusStr[:strings.Index(exampleMultiStatusStr, "<d:responsedescription>")]
+	mr = NewMultiStatusReader(io.NopCloser(strings.NewReader(truncated)))
+	for mr.Next() {
+	}
+	if mr.Err() == nil {
+		t.Errorf("Err() = nil for a truncated multistatus")
+	}
+}
@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// SyncBackend is implemented by backends supporting collection
+// synchronization, as defined in RFC 6578.
+type SyncBackend interface {
+	// SyncCollection writes the members of the collection which changed since
+	// the sync token of the query, and sets MultiStatusWriter.SyncToken to
+	// the new sync token. Members are either described with the requested
+	// properties, or with a 404 Not Found status if they have been removed.
+	//
+	// Members of the collection are included if level is DepthOne, and all
+	// descendants if level is DepthInfinity.
+	//
+	// ErrInvalidSyncToken is returned if the sync token is malformed or has
+	// expired. If the query has a limit and more members changed, truncated
+	// is set: the new sync token must then allow the client to fetch the
+	// remaining changes. If the changes can't be truncated, a 507
+	// Insufficient Storage HTTP error is returned.
+	SyncCollection(r *http.Request, query *SyncCollectionQuery, level Depth, mw *MultiStatusWriter) (truncated bool, err error)
+}
+
+// ErrInvalidSyncToken indicates that a sync token is malformed or has expired.
+var ErrInvalidSyncToken = errors.New("webdav: invalid sync token")
+
+func newSyncLimitError() error {
+	return NewPreconditionError(http.StatusInsufficientStorage, &NumberOfMatchesWithinLimits{})
+}
+
+// ParseSyncLevel parses the DAV:sync-level element of a sync-collection
+// request.
+func ParseSyncLevel(s string) (Depth, error) {
+	switch s {
+	case "1":
+		return DepthOne, nil
+	case "infinite", "infinity":
+		// RFC 6578 uses "infinite", but older clients sent "infinity"
+		return DepthInfinity, nil
+	}
+	return 0, fmt.Errorf("webdav: invalid sync-level %q", s)
+}
+
+func formatSyncLevel(level Depth) string {
+	if level == DepthInfinity {
+		return "infinite"
+	}
+	return level.String()
+}
+
+// ServeSyncCollection replies to a sync-collection REPORT request, as defined
+// in RFC 6578 section 3.
+func (h *Handler) ServeSyncCollection(w http.ResponseWriter, r *http.Request, query *SyncCollectionQuery) error {
+	sb, ok := h.Backend.(SyncBackend)
+	if !ok {
+		return HTTPErrorf(http.StatusForbidden, "webdav: sync-collection is not supported")
+	}
+
+	if s := r.Header.Get("Depth"); s != "" && s != "0" {
+		return HTTPErrorf(http.StatusBadRequest, "webdav: sync-collection REPORT requests require Depth: 0")
+	}
+	level, err := ParseSyncLevel(query.SyncLevel)
+	if err != nil {
+		return &HTTPError{http.StatusBadRequest, err}
+	}
+	if query.Limit != nil && query.Limit.NResults == 0 {
+		return newSyncLimitError()
+	}
+	if query.Prop == nil {
+		query.Prop = &Prop{}
+	}
+
+	mw := NewMultiStatusWriter(w)
+	if h.Authorizer != nil {
+		pf := aclPropFinder{h: h, r: r, propfind: &PropFind{Prop: query.Prop}, target: r.URL.Path}
+		mw.transform = pf.transform
+	}
+
+	truncated, err := sb.SyncCollection(r, query, level, mw)
+	if err != nil {
+		if mw.Started() {
+			// Too late to send an error status
+			return mw.Abort(r.URL.Path, err)
+		}
+
+		var httpErr *HTTPError
+		if errors.Is(err, ErrInvalidSyncToken) {
+			return NewPreconditionError(http.StatusForbidden, &ValidSyncToken{})
+		} else if errors.As(err, &httpErr) && httpErr.Code == http.StatusInsufficientStorage {
+			return newSyncLimitError()
+		}
+		return err
+	}
+
+	if truncated {
+		resp := NewErrorResponse(r.URL.Path, newSyncLimitError())
+		if err := mw.WriteResponse(resp); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
@@ -65,6 +65,17 @@ func (val *RawXMLValue) MarshalXML(e *xml.Encoder, start xml.StartElement) error
 
 	switch tok := val.tok.(type) {
 	case xml.StartElement:
+		// The encoder declares the element namespace itself, drop the
+		// default namespace declaration to avoid duplicate attributes
+		attr := make([]xml.Attr, 0, len(tok.Attr))
+		for _, a := range tok.Attr {
+			if a.Name.Space == "" && a.Name.Local == "xmlns" {
+				continue
+			}
+			attr = append(attr, a)
+		}
+		tok.Attr = attr
+
 		if err := e.EncodeToken(tok); err != nil {
 			return err
 		}
@@ -90,6 +101,13 @@ func (val *RawXMLValue) Decode(v interface{}) error {
 }
 
 func (val *RawXMLValue) XMLName() (name xml.Name, ok bool) {
+	if val.out != nil {
+		if raw, ok := val.out.(*RawXMLValue); ok {
+			return raw.XMLName()
+		}
+		name, err := valueXMLName(val.out)
+		return name, err == nil
+	}
 	if start, ok := val.tok.(xml.StartElement); ok {
 		return start.Name, true
 	}
@@ -0,0 +1,2107 @@
+package jsmodel
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/emersion/go-webdav/caldav"
+)
+
+const (
+	typeGroup           = "Group"
+	typeEvent           = "Event"
+	typeTask            = "Task"
+	typeLocation        = "Location"
+	typeParticipant     = "Participant"
+	typeAlert           = "Alert"
+	typeOffsetTrigger   = "OffsetTrigger"
+	typeAbsoluteTrigger = "AbsoluteTrigger"
+	typeUnknownTrigger  = "UnknownTrigger"
+	typeRecurrenceRule  = "RecurrenceRule"
+	typeNDay            = "NDay"
+	typeTimeZone        = "TimeZone"
+	typeTimeZoneRule    = "TimeZoneRule"
+)
+
+// utcTimeZone is the time zone of date-times with a "Z" suffix.
+const utcTimeZone = "Etc/UTC"
+
+// Properties and parameters not defined by go-ical: EXRULE is from RFC 2445,
+// ACKNOWLEDGED from RFC 9074, JSPROP and JSPTR from the JSCalendar to
+// iCalendar mapping.
+const (
+	propExceptionRule = "EXRULE"
+	propAcknowledged  = "ACKNOWLEDGED"
+	propJSProp        = "JSPROP"
+	paramJSPointer    = "JSPTR"
+)
+
+// Group is a JSCalendar group, see RFC 8984 section 5.3. It represents a
+// VCALENDAR component.
+type Group struct {
+	Type        string `json:"@type"`
+	UID         string `json:"uid,omitempty"`
+	ProdID      string `json:"prodId,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Color       string `json:"color,omitempty"`
+
+	Entries []Object `json:"entries"`
+
+	// TimeZones contains the VTIMEZONE components, by TZID prefixed with a
+	// slash.
+	TimeZones map[string]*TimeZone `json:"timeZones,omitempty"`
+
+	ICalProps []interface{} `json:"iCalProps,omitempty"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (g *Group) UnmarshalJSON(b []byte) error {
+	type group Group
+	var v struct {
+		group
+		Entries []json.RawMessage `json:"entries"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*g = Group(v.group)
+
+	g.Entries = make([]Object, len(v.Entries))
+	for i, raw := range v.Entries {
+		var t struct {
+			Type string `json:"@type"`
+		}
+		if err := json.Unmarshal(raw, &t); err != nil {
+			return err
+		}
+		var obj Object
+		switch t.Type {
+		case typeEvent:
+			obj = new(Event)
+		case typeTask:
+			obj = new(Task)
+		default:
+			return fmt.Errorf("jsmodel: unsupported group entry type %q", t.Type)
+		}
+		if err := json.Unmarshal(raw, obj); err != nil {
+			return err
+		}
+		g.Entries[i] = obj
+	}
+	return nil
+}
+
+// Object is a JSCalendar object which can be an entry of a group: an *Event or
+// a *Task.
+type Object interface {
+	common() *Common
+}
+
+// Common contains the properties shared by events and tasks, see RFC 8984
+// section 4.
+type Common struct {
+	Type     string `json:"@type"`
+	UID      string `json:"uid"`
+	Created  string `json:"created,omitempty"`
+	Updated  string `json:"updated,omitempty"`
+	Sequence int    `json:"sequence,omitempty"`
+
+	Title         string                 `json:"title,omitempty"`
+	Description   string                 `json:"description,omitempty"`
+	Locations     map[string]*Location   `json:"locations,omitempty"`
+	Keywords      map[string]bool        `json:"keywords,omitempty"`
+	Color         string                 `json:"color,omitempty"`
+	Locale        string                 `json:"locale,omitempty"`
+	Localizations map[string]PatchObject `json:"localizations,omitempty"`
+
+	// TimeZone is empty for floating date-times.
+	TimeZone        string `json:"timeZone,omitempty"`
+	ShowWithoutTime bool   `json:"showWithoutTime,omitempty"`
+
+	RecurrenceID            string                 `json:"recurrenceId,omitempty"`
+	RecurrenceRules         []*RecurrenceRule      `json:"recurrenceRules,omitempty"`
+	ExcludedRecurrenceRules []*RecurrenceRule      `json:"excludedRecurrenceRules,omitempty"`
+	RecurrenceOverrides     map[string]PatchObject `json:"recurrenceOverrides,omitempty"`
+
+	Priority       int    `json:"priority,omitempty"`
+	FreeBusyStatus string `json:"freeBusyStatus,omitempty"`
+	Privacy        string `json:"privacy,omitempty"`
+
+	ReplyTo      map[string]string       `json:"replyTo,omitempty"`
+	Participants map[string]*Participant `json:"participants,omitempty"`
+	Alerts       map[string]*Alert       `json:"alerts,omitempty"`
+
+	ICalProps []interface{} `json:"iCalProps,omitempty"`
+}
+
+func (c *Common) common() *Common {
+	return c
+}
+
+// Event is a JSCalendar event, see RFC 8984 section 5.1. It represents a
+// VEVENT component.
+type Event struct {
+	Common
+	Start    string `json:"start,omitempty"`
+	Duration string `json:"duration,omitempty"`
+	Status   string `json:"status,omitempty"`
+}
+
+// Task is a JSCalendar task, see RFC 8984 section 5.2. It represents a VTODO
+// component.
+type Task struct {
+	Common
+	Start             string `json:"start,omitempty"`
+	Due               string `json:"due,omitempty"`
+	EstimatedDuration string `json:"estimatedDuration,omitempty"`
+	PercentComplete   int    `json:"percentComplete,omitempty"`
+	Progress          string `json:"progress,omitempty"`
+	ProgressUpdated   string `json:"progressUpdated,omitempty"`
+}
+
+// Location is a JSCalendar location, see RFC 8984 section 4.2.5.
+type Location struct {
+	Type        string `json:"@type"`
+	Name        string `json:"name,omitempty"`
+	Coordinates string `json:"coordinates,omitempty"`
+}
+
+// RecurrenceRule is a JSCalendar recurrence rule, see RFC 8984 section
+// 4.3.3.
+type RecurrenceRule struct {
+	Type           string   `json:"@type"`
+	Frequency      string   `json:"frequency"`
+	Interval       int      `json:"interval,omitempty"`
+	RScale         string   `json:"rscale,omitempty"`
+	Skip           string   `json:"skip,omitempty"`
+	FirstDayOfWeek string   `json:"firstDayOfWeek,omitempty"`
+	ByDay          []NDay   `json:"byDay,omitempty"`
+	ByMonthDay     []int    `json:"byMonthDay,omitempty"`
+	ByMonth        []string `json:"byMonth,omitempty"`
+	ByYearDay      []int    `json:"byYearDay,omitempty"`
+	ByWeekNo       []int    `json:"byWeekNo,omitempty"`
+	ByHour         []int    `json:"byHour,omitempty"`
+	ByMinute       []int    `json:"byMinute,omitempty"`
+	BySecond       []int    `json:"bySecond,omitempty"`
+	BySetPosition  []int    `json:"bySetPosition,omitempty"`
+	Count          int      `json:"count,omitempty"`
+	Until          string   `json:"until,omitempty"`
+}
+
+// NDay is a day of the week in a recurrence rule.
+type NDay struct {
+	Type        string `json:"@type"`
+	Day         string `json:"day"`
+	NthOfPeriod int    `json:"nthOfPeriod,omitempty"`
+}
+
+// Participant is a JSCalendar participant, see RFC 8984 section 4.4.6. It
+// represents an ATTENDEE or ORGANIZER property.
+type Participant struct {
+	Type                string            `json:"@type"`
+	Name                string            `json:"name,omitempty"`
+	Email               string            `json:"email,omitempty"`
+	Kind                string            `json:"kind,omitempty"`
+	Roles               map[string]bool   `json:"roles,omitempty"`
+	SendTo              map[string]string `json:"sendTo,omitempty"`
+	ParticipationStatus string            `json:"participationStatus,omitempty"`
+	ExpectReply         bool              `json:"expectReply,omitempty"`
+	DelegatedTo         map[string]bool   `json:"delegatedTo,omitempty"`
+	DelegatedFrom       map[string]bool   `json:"delegatedFrom,omitempty"`
+
+	ICalParams map[string]interface{} `json:"iCalParams,omitempty"`
+}
+
+// Alert is a JSCalendar alert, see RFC 8984 section 4.5.2. It represents a
+// VALARM component.
+type Alert struct {
+	Type         string   `json:"@type"`
+	Trigger      *Trigger `json:"trigger"`
+	Acknowledged string   `json:"acknowledged,omitempty"`
+	Action       string   `json:"action,omitempty"`
+
+	ICalProps []interface{} `json:"iCalProps,omitempty"`
+}
+
+// Trigger is the trigger of an alert: an OffsetTrigger, an AbsoluteTrigger or
+// an UnknownTrigger.
+type Trigger struct {
+	Type       string `json:"@type"`
+	Offset     string `json:"offset,omitempty"`
+	RelativeTo string `json:"relativeTo,omitempty"`
+	When       string `json:"when,omitempty"`
+}
+
+// TimeZone is a JSCalendar time zone, see RFC 8984 section 4.7.2. It
+// represents a VTIMEZONE component.
+type TimeZone struct {
+	Type     string          `json:"@type"`
+	TzID     string          `json:"tzId"`
+	Updated  string          `json:"updated,omitempty"`
+	URL      string          `json:"url,omitempty"`
+	Standard []*TimeZoneRule `json:"standard,omitempty"`
+	Daylight []*TimeZoneRule `json:"daylight,omitempty"`
+
+	ICalProps []interface{} `json:"iCalProps,omitempty"`
+}
+
+// TimeZoneRule is a rule of a JSCalendar time zone. It represents a STANDARD
+// or DAYLIGHT component.
+type TimeZoneRule struct {
+	Type            string            `json:"@type"`
+	Start           string            `json:"start"`
+	OffsetFrom      string            `json:"offsetFrom"`
+	OffsetTo        string            `json:"offsetTo"`
+	RecurrenceRules []*RecurrenceRule `json:"recurrenceRules,omitempty"`
+	Names           map[string]bool   `json:"names,omitempty"`
+
+	ICalProps []interface{} `json:"iCalProps,omitempty"`
+}
+
+// FromICal converts a calendar to a JSCalendar group. Events and tasks are
+// converted along with their overridden recurrences. Other components, such
+// as journals, aren't supported.
+func FromICal(cal *ical.Calendar) (*Group, error) {
+	g := &Group{Type: typeGroup, Entries: []Object{}}
+
+	var unconverted []ical.Prop
+	for _, name := range sortedPropNames(cal.Props) {
+		props := cal.Props[name]
+		if name == ical.PropVersion {
+			continue
+		}
+		var dst *string
+		switch name {
+		case ical.PropProductID:
+			dst = &g.ProdID
+		case ical.PropUID:
+			dst = &g.UID
+		case ical.PropName:
+			dst = &g.Title
+		case ical.PropDescription:
+			dst = &g.Description
+		case ical.PropColor:
+			dst = &g.Color
+		}
+		if dst != nil && len(props) == 1 && len(props[0].Params) == 0 {
+			*dst = unescapeText(props[0].Value)
+		} else {
+			unconverted = append(unconverted, props...)
+		}
+	}
+	var err error
+	if g.ICalProps, err = encodeICalProps(unconverted); err != nil {
+		return nil, err
+	}
+
+	var uids []string
+	masters := make(map[string]*ical.Component)
+	overrides := make(map[string][]*ical.Component)
+	for _, child := range cal.Children {
+		switch child.Name {
+		case ical.CompTimezone:
+			tz, err := fromTimeZoneComponent(child)
+			if err != nil {
+				return nil, err
+			}
+			if g.TimeZones == nil {
+				g.TimeZones = make(map[string]*TimeZone)
+			}
+			g.TimeZones["/"+tz.TzID] = tz
+		case ical.CompEvent, ical.CompToDo:
+			uid, _ := child.Props.Text(ical.PropUID)
+			if _, ok := masters[uid]; !ok && len(overrides[uid]) == 0 {
+				uids = append(uids, uid)
+			}
+			if child.Props.Get(ical.PropRecurrenceID) != nil {
+				overrides[uid] = append(overrides[uid], child)
+			} else if masters[uid] == nil {
+				masters[uid] = child
+			} else {
+				return nil, fmt.Errorf("jsmodel: duplicate %v with UID %q", child.Name, uid)
+			}
+		default:
+			return nil, fmt.Errorf("jsmodel: unsupported component %v", child.Name)
+		}
+	}
+
+	for _, uid := range uids {
+		master := masters[uid]
+		if master == nil {
+			// Overridden recurrences without a master
+			for _, comp := range overrides[uid] {
+				obj, err := fromComponent(comp)
+				if err != nil {
+					return nil, err
+				}
+				g.Entries = append(g.Entries, obj)
+			}
+			continue
+		}
+
+		obj, err := fromComponent(master)
+		if err != nil {
+			return nil, err
+		}
+		if err := addRecurrenceOverrides(obj, overrides[uid]); err != nil {
+			return nil, err
+		}
+		g.Entries = append(g.Entries, obj)
+	}
+
+	return g, nil
+}
+
+// recurrenceKeys lists the properties of a master object which don't apply to
+// its recurrence instances.
+var recurrenceKeys = []string{
+	"recurrenceId",
+	"recurrenceRules",
+	"excludedRecurrenceRules",
+	"recurrenceOverrides",
+}
+
+// instanceBase returns the generic JSON object of the recurrence instance of
+// a master object starting at recurrenceID, before any override is applied.
+func instanceBase(master map[string]interface{}, recurrenceID string) map[string]interface{} {
+	base := make(map[string]interface{}, len(master))
+	for k, v := range master {
+		base[k] = v
+	}
+	for _, k := range recurrenceKeys {
+		delete(base, k)
+	}
+	base["start"] = recurrenceID
+	return base
+}
+
+// addRecurrenceOverrides converts overridden recurrences to patches in the
+// recurrenceOverrides property of their master object.
+func addRecurrenceOverrides(obj Object, comps []*ical.Component) error {
+	if len(comps) == 0 {
+		return nil
+	}
+
+	master, err := toJSONMap(obj)
+	if err != nil {
+		return err
+	}
+
+	c := obj.common()
+	if c.RecurrenceOverrides == nil {
+		c.RecurrenceOverrides = make(map[string]PatchObject)
+	}
+	for _, comp := range comps {
+		override, err := fromComponent(comp)
+		if err != nil {
+			return err
+		}
+		recurrenceID := override.common().RecurrenceID
+
+		m, err := toJSONMap(override)
+		if err != nil {
+			return err
+		}
+		for _, k := range recurrenceKeys {
+			delete(m, k)
+		}
+
+		base := instanceBase(master, recurrenceID)
+		patch := make(PatchObject)
+		for k, v := range m {
+			if !reflect.DeepEqual(base[k], v) {
+				patch[escapePointer(k)] = v
+			}
+		}
+		for k := range base {
+			if _, ok := m[k]; !ok {
+				patch[escapePointer(k)] = nil
+			}
+		}
+		c.RecurrenceOverrides[recurrenceID] = patch
+	}
+	return nil
+}
+
+// dateTimeProp is a DATE or DATE-TIME property converted to a local
+// date-time.
+type dateTimeProp struct {
+	Local    string
+	TimeZone string
+	DateOnly bool
+}
+
+// fromDateTimeProp converts a DATE or DATE-TIME property. ok is false if the
+// property can't be converted.
+func fromDateTimeProp(prop *ical.Prop) (dt dateTimeProp, ok bool) {
+	for k := range prop.Params {
+		if k != ical.ParamValue && k != ical.ParamTimezoneID {
+			return dt, false
+		}
+	}
+
+	v := prop.Value
+	switch prop.ValueType() {
+	case ical.ValueDate:
+		dt.DateOnly = true
+	case ical.ValueDateTime:
+		if strings.HasSuffix(v, "Z") {
+			dt.TimeZone = utcTimeZone
+			v = strings.TrimSuffix(v, "Z")
+		}
+	default:
+		return dt, false
+	}
+	if tzid := prop.Params.Get(ical.ParamTimezoneID); tzid != "" {
+		if dt.TimeZone != "" || dt.DateOnly {
+			return dt, false
+		}
+		dt.TimeZone = timeZoneID(tzid)
+	}
+
+	var err error
+	if dt.Local, err = formatDateTime(v); err != nil {
+		return dt, false
+	}
+	return dt, true
+}
+
+// timeZoneID converts a TZID to a JSCalendar time zone identifier. Custom
+// time zones are prefixed with a slash.
+func timeZoneID(tzid string) string {
+	if tzid == "" || tzid == "Local" {
+		return "/" + tzid
+	}
+	if _, err := time.LoadLocation(tzid); err != nil {
+		return "/" + tzid
+	}
+	return tzid
+}
+
+// toDateTimeProp is the reverse of fromDateTimeProp.
+func toDateTimeProp(name string, dt dateTimeProp) (*ical.Prop, error) {
+	v, err := parseDateTime(dt.Local, dt.DateOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	prop := ical.NewProp(name)
+	switch {
+	case dt.DateOnly:
+		prop.Params.Set(ical.ParamValue, string(ical.ValueDate))
+	case dt.TimeZone == utcTimeZone:
+		v += "Z"
+	case dt.TimeZone != "":
+		prop.Params.Set(ical.ParamTimezoneID, strings.TrimPrefix(dt.TimeZone, "/"))
+	}
+	prop.Value = v
+	return prop, nil
+}
+
+func fromUTCDateTimeProp(prop *ical.Prop) (string, bool) {
+	if len(prop.Params) != 0 || !strings.HasSuffix(prop.Value, "Z") {
+		return "", false
+	}
+	v, err := formatDateTime(prop.Value)
+	return v, err == nil
+}
+
+func toUTCDateTimeProp(name, s string) (*ical.Prop, error) {
+	v, err := parseDateTime(s, false)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(v, "Z") {
+		return nil, fmt.Errorf("jsmodel: expected UTC date-time, got %q", s)
+	}
+	prop := ical.NewProp(name)
+	prop.Value = v
+	return prop, nil
+}
+
+// componentConverter converts the properties of a VEVENT or VTODO component.
+type componentConverter struct {
+	c           *Common
+	start       dateTimeProp
+	unconverted []ical.Prop
+	jsProps     []ical.Prop
+}
+
+func (conv *componentConverter) text(prop *ical.Prop) (string, bool) {
+	if len(prop.Params) != 0 {
+		return "", false
+	}
+	return unescapeText(prop.Value), true
+}
+
+func (conv *componentConverter) int(prop *ical.Prop) (int, bool) {
+	if len(prop.Params) != 0 {
+		return 0, false
+	}
+	i, err := strconv.Atoi(prop.Value)
+	return i, err == nil
+}
+
+func (conv *componentConverter) localize(lang, path, text string) {
+	if conv.c.Localizations == nil {
+		conv.c.Localizations = make(map[string]PatchObject)
+	}
+	if conv.c.Localizations[lang] == nil {
+		conv.c.Localizations[lang] = make(PatchObject)
+	}
+	conv.c.Localizations[lang][path] = text
+}
+
+// localizedText converts SUMMARY, DESCRIPTION and LOCATION properties. The
+// properties in the locale of the object are converted to the main
+// properties, the other ones to localizations.
+func (conv *componentConverter) localizedText(props []ical.Prop, path string, set func(string)) {
+	main := false
+	for i := range props {
+		prop := &props[i]
+		lang := prop.Params.Get(ical.ParamLanguage)
+		if len(prop.Params) > 1 || (len(prop.Params) == 1 && lang == "") {
+			conv.unconverted = append(conv.unconverted, *prop)
+			continue
+		}
+		text := unescapeText(prop.Value)
+		switch {
+		case !main && (lang == "" || lang == conv.c.Locale):
+			set(text)
+			main = true
+		case lang != "" && lang != conv.c.Locale && conv.c.Localizations[lang][path] == nil:
+			conv.localize(lang, path, text)
+		default:
+			conv.unconverted = append(conv.unconverted, *prop)
+		}
+	}
+}
+
+func (conv *componentConverter) location() *Location {
+	if conv.c.Locations == nil {
+		conv.c.Locations = make(map[string]*Location)
+	}
+	loc := conv.c.Locations["1"]
+	if loc == nil {
+		loc = &Location{Type: typeLocation}
+		conv.c.Locations["1"] = loc
+	}
+	return loc
+}
+
+func fromComponent(comp *ical.Component) (Object, error) {
+	var (
+		obj   Object
+		event *Event
+		task  *Task
+	)
+	switch comp.Name {
+	case ical.CompEvent:
+		event = &Event{Common: Common{Type: typeEvent}}
+		obj = event
+	case ical.CompToDo:
+		task = &Task{Common: Common{Type: typeTask}}
+		obj = task
+	default:
+		return nil, fmt.Errorf("jsmodel: unsupported component %v", comp.Name)
+	}
+	c := obj.common()
+	conv := componentConverter{c: c}
+
+	// The start determines the time zone of the other date-times
+	startName := ical.PropDateTimeStart
+	if task != nil && comp.Props.Get(startName) == nil {
+		startName = ical.PropDue
+	}
+	hasStart := false
+	if prop := comp.Props.Get(startName); prop != nil {
+		conv.start, hasStart = fromDateTimeProp(prop)
+		c.TimeZone = conv.start.TimeZone
+		c.ShowWithoutTime = conv.start.DateOnly
+	}
+	sameTimeZone := func(dt dateTimeProp) bool {
+		return hasStart && dt.TimeZone == conv.start.TimeZone && dt.DateOnly == conv.start.DateOnly
+	}
+
+	for _, name := range []string{ical.PropSummary, ical.PropDescription} {
+		if prop := comp.Props.Get(name); prop != nil {
+			c.Locale = prop.Params.Get(ical.ParamLanguage)
+			break
+		}
+	}
+
+	var attendees []ical.Prop
+	var organizer *ical.Prop
+	for _, name := range sortedPropNames(comp.Props) {
+		props := comp.Props[name]
+
+		switch name {
+		case ical.PropSummary:
+			conv.localizedText(props, "title", func(s string) { c.Title = s })
+			continue
+		case ical.PropDescription:
+			conv.localizedText(props, "description", func(s string) { c.Description = s })
+			continue
+		case ical.PropLocation:
+			conv.localizedText(props, "locations/1/name", func(s string) { conv.location().Name = s })
+			continue
+		case ical.PropCategories:
+			ok := true
+			for _, prop := range props {
+				ok = ok && len(prop.Params) == 0
+			}
+			if !ok {
+				break
+			}
+			c.Keywords = make(map[string]bool)
+			for _, prop := range props {
+				for _, s := range splitEscaped(prop.Value, ',') {
+					c.Keywords[unescapeText(s)] = true
+				}
+			}
+			continue
+		case ical.PropRecurrenceRule, propExceptionRule:
+			var rules []*RecurrenceRule
+			for _, prop := range props {
+				rule, err := fromRecurrenceRuleProp(&prop, c, conv.start)
+				if err != nil {
+					conv.unconverted = append(conv.unconverted, prop)
+					continue
+				}
+				rules = append(rules, rule)
+			}
+			if name == ical.PropRecurrenceRule {
+				c.RecurrenceRules = rules
+			} else {
+				c.ExcludedRecurrenceRules = rules
+			}
+			continue
+		case ical.PropExceptionDates, ical.PropRecurrenceDates:
+			for _, prop := range props {
+				dt, ok := fromDateTimeProp(&prop)
+				if !ok || !sameTimeZone(dt) || prop.Params.Get(ical.ParamValue) == string(ical.ValuePeriod) {
+					conv.unconverted = append(conv.unconverted, prop)
+					continue
+				}
+				if c.RecurrenceOverrides == nil {
+					c.RecurrenceOverrides = make(map[string]PatchObject)
+				}
+				for _, v := range strings.Split(prop.Value, ",") {
+					local, err := formatDateTime(strings.TrimSuffix(v, "Z"))
+					if err != nil {
+						return nil, err
+					}
+					patch := make(PatchObject)
+					if name == ical.PropExceptionDates {
+						patch["excluded"] = true
+					}
+					c.RecurrenceOverrides[local] = patch
+				}
+			}
+			continue
+		case ical.PropAttendee:
+			attendees = props
+			continue
+		case propJSProp:
+			for _, prop := range props {
+				if len(prop.Params) == 1 && prop.Params.Get(paramJSPointer) != "" {
+					conv.jsProps = append(conv.jsProps, prop)
+				} else {
+					conv.unconverted = append(conv.unconverted, prop)
+				}
+			}
+			continue
+		case ical.PropOrganizer:
+			if len(props) == 1 {
+				organizer = &props[0]
+				continue
+			}
+		}
+
+		for i := range props {
+			if !conv.convertProp(comp, &props[i], event, task, sameTimeZone) {
+				conv.unconverted = append(conv.unconverted, props[i])
+			}
+		}
+	}
+
+	if err := conv.participants(organizer, attendees); err != nil {
+		return nil, err
+	}
+
+	for _, child := range comp.Children {
+		if child.Name != ical.CompAlarm {
+			return nil, fmt.Errorf("jsmodel: unsupported component %v in %v", child.Name, comp.Name)
+		}
+		alert, err := fromAlarmComponent(child)
+		if err != nil {
+			return nil, err
+		}
+		if c.Alerts == nil {
+			c.Alerts = make(map[string]*Alert)
+		}
+		c.Alerts[strconv.Itoa(len(c.Alerts)+1)] = alert
+	}
+
+	var err error
+	if c.ICalProps, err = encodeICalProps(conv.unconverted); err != nil {
+		return nil, err
+	}
+	if len(conv.jsProps) == 0 {
+		return obj, nil
+	}
+
+	m, err := toJSONMap(obj)
+	if err != nil {
+		return nil, err
+	}
+	for _, prop := range conv.jsProps {
+		var v interface{}
+		if err := unmarshalJSON([]byte(unescapeText(prop.Value)), &v); err != nil {
+			return nil, fmt.Errorf("jsmodel: malformed %v value: %v", propJSProp, err)
+		}
+		if err := applyPatch(m, PatchObject{prop.Params.Get(paramJSPointer): v}); err != nil {
+			return nil, err
+		}
+	}
+	if event != nil {
+		obj = new(Event)
+	} else {
+		obj = new(Task)
+	}
+	if err := fromJSONMap(m, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// jsProp creates a JSPROP property, which holds a JSCalendar property without
+// an iCalendar equivalent.
+func jsProp(ptr string, v interface{}) (*ical.Prop, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	prop := ical.NewProp(propJSProp)
+	prop.Params.Set(paramJSPointer, ptr)
+	prop.Value = textEscaper.Replace(string(b))
+	return prop, nil
+}
+
+// convertProp converts a property with a single value in the object model.
+// It returns false if the property can't be converted.
+func (conv *componentConverter) convertProp(comp *ical.Component, prop *ical.Prop, event *Event, task *Task, sameTimeZone func(dateTimeProp) bool) bool {
+	c := conv.c
+	if len(comp.Props[prop.Name]) > 1 {
+		return false
+	}
+
+	switch prop.Name {
+	case ical.PropUID:
+		c.UID, _ = conv.text(prop)
+		return len(prop.Params) == 0
+	case ical.PropDateTimeStamp:
+		var ok bool
+		c.Updated, ok = fromUTCDateTimeProp(prop)
+		return ok
+	case ical.PropCreated:
+		var ok bool
+		c.Created, ok = fromUTCDateTimeProp(prop)
+		return ok
+	case ical.PropSequence:
+		var ok bool
+		c.Sequence, ok = conv.int(prop)
+		return ok
+	case ical.PropPriority:
+		var ok bool
+		c.Priority, ok = conv.int(prop)
+		return ok
+	case ical.PropColor:
+		var ok bool
+		c.Color, ok = conv.text(prop)
+		return ok
+	case ical.PropClass:
+		privacy := map[string]string{"PUBLIC": "public", "PRIVATE": "private", "CONFIDENTIAL": "secret"}
+		c.Privacy = privacy[prop.Value]
+		return c.Privacy != "" && len(prop.Params) == 0
+	case ical.PropTransparency:
+		freeBusyStatus := map[string]string{"OPAQUE": "busy", "TRANSPARENT": "free"}
+		c.FreeBusyStatus = freeBusyStatus[prop.Value]
+		return c.FreeBusyStatus != "" && len(prop.Params) == 0
+	case ical.PropRecurrenceID:
+		dt, ok := fromDateTimeProp(prop)
+		c.RecurrenceID = dt.Local
+		return ok
+	case ical.PropGeo:
+		parts := strings.Split(prop.Value, ";")
+		if len(parts) != 2 || len(prop.Params) != 0 {
+			return false
+		}
+		conv.location().Coordinates = "geo:" + parts[0] + "," + parts[1]
+		return true
+	case ical.PropDateTimeStart:
+		dt, ok := fromDateTimeProp(prop)
+		if !ok {
+			return false
+		}
+		if event != nil {
+			event.Start = dt.Local
+		} else {
+			task.Start = dt.Local
+		}
+		return true
+	}
+
+	if event != nil {
+		switch prop.Name {
+		case ical.PropDuration:
+			if len(prop.Params) != 0 {
+				return false
+			}
+			event.Duration = prop.Value
+			return true
+		case ical.PropDateTimeEnd:
+			dt, ok := fromDateTimeProp(prop)
+			if !ok || !sameTimeZone(dt) || comp.Props.Get(ical.PropDuration) != nil {
+				return false
+			}
+			d, err := localDuration(conv.start.Local, dt.Local)
+			if err != nil {
+				return false
+			}
+			event.Duration = d
+			return true
+		case ical.PropStatus:
+			switch prop.Value {
+			case "CONFIRMED", "TENTATIVE", "CANCELLED":
+				event.Status = strings.ToLower(prop.Value)
+				return len(prop.Params) == 0
+			}
+		}
+		return false
+	}
+
+	switch prop.Name {
+	case ical.PropDue:
+		dt, ok := fromDateTimeProp(prop)
+		if !ok || !sameTimeZone(dt) {
+			return false
+		}
+		task.Due = dt.Local
+		return true
+	case ical.PropDuration:
+		if len(prop.Params) != 0 {
+			return false
+		}
+		task.EstimatedDuration = prop.Value
+		return true
+	case ical.PropPercentComplete:
+		var ok bool
+		task.PercentComplete, ok = conv.int(prop)
+		return ok
+	case ical.PropCompleted:
+		var ok bool
+		task.ProgressUpdated, ok = fromUTCDateTimeProp(prop)
+		return ok
+	case ical.PropStatus:
+		switch prop.Value {
+		case "NEEDS-ACTION", "IN-PROCESS", "COMPLETED", "CANCELLED":
+			task.Progress = strings.ToLower(prop.Value)
+			return len(prop.Params) == 0
+		}
+	}
+	return false
+}
+
+// localDuration returns the duration between two local date-times.
+func localDuration(start, end string) (string, error) {
+	const layout = "2006-01-02T15:04:05"
+	s, err := time.Parse(layout, start)
+	if err != nil {
+		return "", err
+	}
+	e, err := time.Parse(layout, end)
+	if err != nil {
+		return "", err
+	}
+	d := e.Sub(s)
+	if d < 0 {
+		return "", fmt.Errorf("jsmodel: end before start")
+	}
+
+	var sb strings.Builder
+	sb.WriteString("P")
+	if days := d / (24 * time.Hour); days > 0 {
+		fmt.Fprintf(&sb, "%dD", days)
+		d -= days * 24 * time.Hour
+	}
+	if d > 0 || sb.Len() == 1 {
+		sb.WriteString("T")
+		h, m, sec := d/time.Hour, (d%time.Hour)/time.Minute, (d%time.Minute)/time.Second
+		if h > 0 {
+			fmt.Fprintf(&sb, "%dH", h)
+		}
+		if m > 0 {
+			fmt.Fprintf(&sb, "%dM", m)
+		}
+		if sec > 0 || (h == 0 && m == 0) {
+			fmt.Fprintf(&sb, "%dS", sec)
+		}
+	}
+	return sb.String(), nil
+}
+
+var participantKinds = map[string]string{
+	"INDIVIDUAL": "individual",
+	"GROUP":      "group",
+	"RESOURCE":   "resource",
+	"ROOM":       "location",
+}
+
+var participantRoles = map[string][]string{
+	"CHAIR":           {"attendee", "chair"},
+	"REQ-PARTICIPANT": {"attendee"},
+	"OPT-PARTICIPANT": {"attendee", "optional"},
+	"NON-PARTICIPANT": {"informational"},
+}
+
+func sendTo(addr string) map[string]string {
+	if strings.HasPrefix(strings.ToLower(addr), "mailto:") {
+		return map[string]string{"imip": addr}
+	}
+	return map[string]string{"other": addr}
+}
+
+func participantAddress(p *Participant) string {
+	if addr, ok := p.SendTo["imip"]; ok {
+		return addr
+	} else if addr, ok := p.SendTo["other"]; ok {
+		return addr
+	}
+	for _, k := range sortedKeys(p.SendTo) {
+		return p.SendTo[k]
+	}
+	return ""
+}
+
+// participants converts the ORGANIZER and ATTENDEE properties.
+func (conv *componentConverter) participants(organizer *ical.Prop, attendees []ical.Prop) error {
+	c := conv.c
+	if organizer == nil && len(attendees) == 0 {
+		return nil
+	}
+	c.Participants = make(map[string]*Participant)
+
+	var ids idGenerator
+	byAddr := make(map[string]string)
+	delegations := make(map[string]ical.Params)
+	for i := range attendees {
+		prop := &attendees[i]
+		p := &Participant{
+			Type:   typeParticipant,
+			SendTo: sendTo(prop.Value),
+			Roles:  make(map[string]bool),
+		}
+		unconverted := make(ical.Params)
+		for k, values := range prop.Params {
+			v := values[0]
+			ok := len(values) == 1
+			switch k {
+			case ical.ParamCommonName:
+				p.Name = v
+			case ical.ParamEmail:
+				p.Email = v
+			case ical.ParamCalendarUserType:
+				p.Kind = participantKinds[v]
+				ok = ok && p.Kind != ""
+			case ical.ParamRole:
+				for _, role := range participantRoles[v] {
+					p.Roles[role] = true
+				}
+				ok = ok && participantRoles[v] != nil
+			case ical.ParamParticipationStatus:
+				p.ParticipationStatus = strings.ToLower(v)
+			case ical.ParamRSVP:
+				p.ExpectReply = v == "TRUE"
+				ok = ok && p.ExpectReply
+			case ical.ParamDelegatedFrom, ical.ParamDelegatedTo:
+				ok = false
+			default:
+				ok = false
+			}
+			if !ok {
+				unconverted[k] = values
+			}
+		}
+		if prop.Params.Get(ical.ParamRole) == "" {
+			p.Roles["attendee"] = true
+		}
+
+		id := ids.next()
+		c.Participants[id] = p
+		byAddr[strings.ToLower(prop.Value)] = id
+		delegations[id] = unconverted
+	}
+
+	// Delegations refer to other participants
+	resolve := func(addrs []string) (map[string]bool, bool) {
+		m := make(map[string]bool)
+		for _, addr := range addrs {
+			id, ok := byAddr[strings.ToLower(addr)]
+			if !ok {
+				return nil, false
+			}
+			m[id] = true
+		}
+		return m, true
+	}
+	for id, params := range delegations {
+		p := c.Participants[id]
+		if addrs, ok := params[ical.ParamDelegatedTo]; ok {
+			if p.DelegatedTo, ok = resolve(addrs); ok {
+				delete(params, ical.ParamDelegatedTo)
+			}
+		}
+		if addrs, ok := params[ical.ParamDelegatedFrom]; ok {
+			if p.DelegatedFrom, ok = resolve(addrs); ok {
+				delete(params, ical.ParamDelegatedFrom)
+			}
+		}
+		p.ICalParams = encodeParams(params)
+	}
+
+	if organizer != nil {
+		c.ReplyTo = sendTo(organizer.Value)
+
+		name := organizer.Params.Get(ical.ParamCommonName)
+		id, ok := byAddr[strings.ToLower(organizer.Value)]
+		if ok {
+			// Only merge with the attendee if no information is lost
+			p := c.Participants[id]
+			_, hasName := organizer.Params[ical.ParamCommonName]
+			ok = len(organizer.Params) == 0 || (len(organizer.Params) == 1 && hasName && name == p.Name)
+		}
+		if ok {
+			c.Participants[id].Roles["owner"] = true
+		} else {
+			params := make(ical.Params)
+			for k, v := range organizer.Params {
+				if k != ical.ParamCommonName {
+					params[k] = v
+				}
+			}
+			c.Participants[ids.next()] = &Participant{
+				Type:       typeParticipant,
+				Name:       name,
+				SendTo:     sendTo(organizer.Value),
+				Roles:      map[string]bool{"owner": true},
+				ICalParams: encodeParams(params),
+			}
+		}
+	}
+	return nil
+}
+
+func fromAlarmComponent(comp *ical.Component) (*Alert, error) {
+	alert := &Alert{Type: typeAlert, Trigger: &Trigger{Type: typeUnknownTrigger}}
+	if len(comp.Children) > 0 {
+		return nil, fmt.Errorf("jsmodel: unsupported component in %v", comp.Name)
+	}
+
+	var unconverted []ical.Prop
+	for _, name := range sortedPropNames(comp.Props) {
+		props := comp.Props[name]
+		if len(props) != 1 {
+			unconverted = append(unconverted, props...)
+			continue
+		}
+		prop := &props[0]
+
+		ok := false
+		switch name {
+		case ical.PropAction:
+			switch prop.Value {
+			case "DISPLAY", "EMAIL":
+				alert.Action = strings.ToLower(prop.Value)
+				ok = len(prop.Params) == 0
+			}
+		case ical.PropTrigger:
+			ok = true
+			for k := range prop.Params {
+				ok = ok && (k == ical.ParamValue || k == ical.ParamRelated)
+			}
+			if !ok {
+				break
+			}
+			switch prop.ValueType() {
+			case ical.ValueDuration:
+				alert.Trigger = &Trigger{
+					Type:       typeOffsetTrigger,
+					Offset:     prop.Value,
+					RelativeTo: strings.ToLower(prop.Params.Get(ical.ParamRelated)),
+				}
+			case ical.ValueDateTime:
+				when, utc := fromUTCDateTimeProp(&ical.Prop{Value: prop.Value})
+				ok = utc && prop.Params.Get(ical.ParamRelated) == ""
+				alert.Trigger = &Trigger{Type: typeAbsoluteTrigger, When: when}
+			default:
+				ok = false
+			}
+			if !ok {
+				alert.Trigger = &Trigger{Type: typeUnknownTrigger}
+			}
+		case propAcknowledged:
+			alert.Acknowledged, ok = fromUTCDateTimeProp(prop)
+		}
+		if !ok {
+			unconverted = append(unconverted, *prop)
+		}
+	}
+
+	var err error
+	if alert.ICalProps, err = encodeICalProps(unconverted); err != nil {
+		return nil, err
+	}
+	return alert, nil
+}
+
+func fromTimeZoneComponent(comp *ical.Component) (*TimeZone, error) {
+	tz := &TimeZone{Type: typeTimeZone}
+
+	var unconverted []ical.Prop
+	for _, name := range sortedPropNames(comp.Props) {
+		props := comp.Props[name]
+		if len(props) != 1 || len(props[0].Params) != 0 {
+			unconverted = append(unconverted, props...)
+			continue
+		}
+		prop := &props[0]
+
+		ok := true
+		switch name {
+		case ical.PropTimezoneID:
+			tz.TzID = prop.Value
+		case ical.PropTimezoneURL:
+			tz.URL = prop.Value
+		case ical.PropLastModified:
+			tz.Updated, ok = fromUTCDateTimeProp(prop)
+		default:
+			ok = false
+		}
+		if !ok {
+			unconverted = append(unconverted, *prop)
+		}
+	}
+	if tz.TzID == "" {
+		return nil, fmt.Errorf("jsmodel: missing TZID in VTIMEZONE")
+	}
+
+	for _, child := range comp.Children {
+		rule, err := fromTimeZoneRuleComponent(child)
+		if err != nil {
+			return nil, err
+		}
+		switch child.Name {
+		case ical.CompTimezoneStandard:
+			tz.Standard = append(tz.Standard, rule)
+		case ical.CompTimezoneDaylight:
+			tz.Daylight = append(tz.Daylight, rule)
+		default:
+			return nil, fmt.Errorf("jsmodel: unsupported component %v in VTIMEZONE", child.Name)
+		}
+	}
+
+	var err error
+	if tz.ICalProps, err = encodeICalProps(unconverted); err != nil {
+		return nil, err
+	}
+	return tz, nil
+}
+
+func fromTimeZoneRuleComponent(comp *ical.Component) (*TimeZoneRule, error) {
+	rule := &TimeZoneRule{Type: typeTimeZoneRule}
+
+	var unconverted []ical.Prop
+	for _, name := range sortedPropNames(comp.Props) {
+		props := comp.Props[name]
+		switch name {
+		case ical.PropTimezoneName:
+			rule.Names = make(map[string]bool)
+			for _, prop := range props {
+				if len(prop.Params) != 0 {
+					unconverted = append(unconverted, prop)
+					continue
+				}
+				rule.Names[unescapeText(prop.Value)] = true
+			}
+			continue
+		case ical.PropRecurrenceRule:
+			for _, prop := range props {
+				if len(prop.Params) != 0 {
+					unconverted = append(unconverted, prop)
+					continue
+				}
+				r, err := parseRecurrenceRule(prop.Value, formatDateTime)
+				if err != nil {
+					unconverted = append(unconverted, prop)
+					continue
+				}
+				rule.RecurrenceRules = append(rule.RecurrenceRules, r)
+			}
+			continue
+		}
+
+		if len(props) != 1 || len(props[0].Params) != 0 {
+			unconverted = append(unconverted, props...)
+			continue
+		}
+		prop := &props[0]
+
+		ok := true
+		switch name {
+		case ical.PropDateTimeStart:
+			start, err := formatDateTime(prop.Value)
+			if ok = err == nil && !strings.HasSuffix(prop.Value, "Z"); ok {
+				rule.Start = start
+			}
+		case ical.PropTimezoneOffsetFrom:
+			rule.OffsetFrom, ok = formatUTCOffset(prop.Value)
+		case ical.PropTimezoneOffsetTo:
+			rule.OffsetTo, ok = formatUTCOffset(prop.Value)
+		default:
+			ok = false
+		}
+		if !ok {
+			unconverted = append(unconverted, *prop)
+		}
+	}
+
+	var err error
+	if rule.ICalProps, err = encodeICalProps(unconverted); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// formatUTCOffset converts an UTC offset, e.g. "-0500", to the JSCalendar
+// format, e.g. "-05:00".
+func formatUTCOffset(s string) (string, bool) {
+	if (len(s) != 5 && len(s) != 7) || (s[0] != '+' && s[0] != '-') || !isDigits(s[1:]) {
+		return "", false
+	}
+	v := s[:3] + ":" + s[3:5]
+	if len(s) == 7 {
+		v += ":" + s[5:]
+	}
+	return v, true
+}
+
+// fromRecurrenceRuleProp converts a RRULE or EXRULE property. The UNTIL part
+// is converted to the time zone of the object.
+func fromRecurrenceRuleProp(prop *ical.Prop, c *Common, start dateTimeProp) (*RecurrenceRule, error) {
+	if len(prop.Params) != 0 {
+		return nil, fmt.Errorf("jsmodel: unsupported parameters in %v", prop.Name)
+	}
+	return parseRecurrenceRule(prop.Value, func(until string) (string, error) {
+		if !strings.HasSuffix(until, "Z") || c.TimeZone == utcTimeZone {
+			return formatDateTime(strings.TrimSuffix(until, "Z"))
+		}
+		loc, err := time.LoadLocation(c.TimeZone)
+		if err != nil {
+			return "", err
+		}
+		t, err := time.Parse("20060102T150405Z", until)
+		if err != nil {
+			return "", err
+		}
+		return t.In(loc).Format("2006-01-02T15:04:05"), nil
+	})
+}
+
+func parseRecurrenceRule(s string, formatUntil func(string) (string, error)) (*RecurrenceRule, error) {
+	rule := &RecurrenceRule{Type: typeRecurrenceRule}
+
+	ints := func(v string) ([]int, error) {
+		var l []int
+		for _, s := range strings.Split(v, ",") {
+			i, err := strconv.Atoi(s)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, i)
+		}
+		return l, nil
+	}
+
+	for _, part := range strings.Split(s, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("jsmodel: malformed recurrence rule %q", s)
+		}
+		k, v := strings.ToUpper(kv[0]), kv[1]
+
+		var err error
+		switch k {
+		case "FREQ":
+			rule.Frequency = strings.ToLower(v)
+		case "INTERVAL":
+			rule.Interval, err = strconv.Atoi(v)
+		case "RSCALE":
+			rule.RScale = strings.ToLower(v)
+		case "SKIP":
+			rule.Skip = strings.ToLower(v)
+		case "WKST":
+			rule.FirstDayOfWeek = strings.ToLower(v)
+		case "BYDAY":
+			for _, s := range strings.Split(v, ",") {
+				if len(s) < 2 {
+					return nil, fmt.Errorf("jsmodel: malformed BYDAY in recurrence rule %q", s)
+				}
+				day := NDay{Type: typeNDay, Day: strings.ToLower(s[len(s)-2:])}
+				if n := s[:len(s)-2]; n != "" {
+					if day.NthOfPeriod, err = strconv.Atoi(n); err != nil {
+						return nil, err
+					}
+				}
+				rule.ByDay = append(rule.ByDay, day)
+			}
+		case "BYMONTHDAY":
+			rule.ByMonthDay, err = ints(v)
+		case "BYMONTH":
+			rule.ByMonth = strings.Split(v, ",")
+		case "BYYEARDAY":
+			rule.ByYearDay, err = ints(v)
+		case "BYWEEKNO":
+			rule.ByWeekNo, err = ints(v)
+		case "BYHOUR":
+			rule.ByHour, err = ints(v)
+		case "BYMINUTE":
+			rule.ByMinute, err = ints(v)
+		case "BYSECOND":
+			rule.BySecond, err = ints(v)
+		case "BYSETPOS":
+			rule.BySetPosition, err = ints(v)
+		case "COUNT":
+			rule.Count, err = strconv.Atoi(v)
+		case "UNTIL":
+			rule.Until, err = formatUntil(v)
+		default:
+			return nil, fmt.Errorf("jsmodel: unsupported recurrence rule part %q", k)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("jsmodel: malformed %v in recurrence rule: %v", k, err)
+		}
+	}
+	if rule.Frequency == "" {
+		return nil, fmt.Errorf("jsmodel: missing FREQ in recurrence rule %q", s)
+	}
+	return rule, nil
+}
+
+func formatRecurrenceRule(rule *RecurrenceRule, parseUntil func(string) (string, error)) (string, error) {
+	var parts []string
+	add := func(k, v string) {
+		parts = append(parts, k+"="+v)
+	}
+	addInts := func(k string, l []int) {
+		if len(l) == 0 {
+			return
+		}
+		s := make([]string, len(l))
+		for i, v := range l {
+			s[i] = strconv.Itoa(v)
+		}
+		add(k, strings.Join(s, ","))
+	}
+
+	if rule.Frequency == "" {
+		return "", fmt.Errorf("jsmodel: missing frequency in recurrence rule")
+	}
+	add("FREQ", strings.ToUpper(rule.Frequency))
+	if rule.RScale != "" {
+		add("RSCALE", strings.ToUpper(rule.RScale))
+	}
+	if rule.Skip != "" {
+		add("SKIP", strings.ToUpper(rule.Skip))
+	}
+	if rule.Interval != 0 {
+		add("INTERVAL", strconv.Itoa(rule.Interval))
+	}
+	if rule.Until != "" {
+		until, err := parseUntil(rule.Until)
+		if err != nil {
+			return "", err
+		}
+		add("UNTIL", until)
+	}
+	if rule.Count != 0 {
+		add("COUNT", strconv.Itoa(rule.Count))
+	}
+	if rule.FirstDayOfWeek != "" {
+		add("WKST", strings.ToUpper(rule.FirstDayOfWeek))
+	}
+	addInts("BYSECOND", rule.BySecond)
+	addInts("BYMINUTE", rule.ByMinute)
+	addInts("BYHOUR", rule.ByHour)
+	if len(rule.ByDay) > 0 {
+		days := make([]string, len(rule.ByDay))
+		for i, day := range rule.ByDay {
+			days[i] = strings.ToUpper(day.Day)
+			if day.NthOfPeriod != 0 {
+				days[i] = strconv.Itoa(day.NthOfPeriod) + days[i]
+			}
+		}
+		add("BYDAY", strings.Join(days, ","))
+	}
+	addInts("BYMONTHDAY", rule.ByMonthDay)
+	addInts("BYYEARDAY", rule.ByYearDay)
+	addInts("BYWEEKNO", rule.ByWeekNo)
+	if len(rule.ByMonth) > 0 {
+		add("BYMONTH", strings.Join(rule.ByMonth, ","))
+	}
+	addInts("BYSETPOS", rule.BySetPosition)
+	return strings.Join(parts, ";"), nil
+}
+
+// ICal converts a JSCalendar group to a calendar.
+func (g *Group) ICal() (*ical.Calendar, error) {
+	cal := ical.NewCalendar()
+	cal.Props.SetText(ical.PropVersion, "2.0")
+	for name, v := range map[string]string{
+		ical.PropProductID:   g.ProdID,
+		ical.PropUID:         g.UID,
+		ical.PropName:        g.Title,
+		ical.PropDescription: g.Description,
+		ical.PropColor:       g.Color,
+	} {
+		if v != "" {
+			cal.Props.SetText(name, v)
+		}
+	}
+	if err := decodeICalProps(cal.Component, g.ICalProps); err != nil {
+		return nil, err
+	}
+
+	for _, k := range sortedKeys(g.TimeZones) {
+		comp, err := g.TimeZones[k].component()
+		if err != nil {
+			return nil, err
+		}
+		cal.Children = append(cal.Children, comp)
+	}
+
+	for _, obj := range g.Entries {
+		comps, err := toComponents(obj)
+		if err != nil {
+			return nil, err
+		}
+		cal.Children = append(cal.Children, comps...)
+	}
+
+	return cal, nil
+}
+
+// toComponents converts an object to a component, followed by the components
+// of its overridden recurrences.
+func toComponents(obj Object) ([]*ical.Component, error) {
+	c := obj.common()
+	comp, err := toComponent(obj)
+	if err != nil {
+		return nil, err
+	}
+	comps := []*ical.Component{comp}
+
+	start := dateTimeProp{TimeZone: c.TimeZone, DateOnly: c.ShowWithoutTime}
+	var exDates, rDates []string
+	var master map[string]interface{}
+	for _, recurrenceID := range sortedKeys(c.RecurrenceOverrides) {
+		patch := c.RecurrenceOverrides[recurrenceID]
+		if excluded, _ := patch["excluded"].(bool); excluded {
+			exDates = append(exDates, recurrenceID)
+			continue
+		} else if len(patch) == 0 {
+			rDates = append(rDates, recurrenceID)
+			continue
+		}
+
+		if master == nil {
+			if master, err = toJSONMap(obj); err != nil {
+				return nil, err
+			}
+		}
+		instance := instanceBase(master, recurrenceID)
+		if err := applyPatch(instance, patch); err != nil {
+			return nil, err
+		}
+
+		var override Object
+		switch obj.(type) {
+		case *Event:
+			override = new(Event)
+		case *Task:
+			override = new(Task)
+		}
+		if err := fromJSONMap(instance, override); err != nil {
+			return nil, err
+		}
+		overrideComp, err := toComponent(override)
+		if err != nil {
+			return nil, err
+		}
+		start.Local = recurrenceID
+		prop, err := toDateTimeProp(ical.PropRecurrenceID, start)
+		if err != nil {
+			return nil, err
+		}
+		overrideComp.Props.Set(prop)
+		comps = append(comps, overrideComp)
+	}
+
+	for name, dates := range map[string][]string{
+		ical.PropExceptionDates:  exDates,
+		ical.PropRecurrenceDates: rDates,
+	} {
+		if len(dates) == 0 {
+			continue
+		}
+		values := make([]string, len(dates))
+		var prop *ical.Prop
+		for i, date := range dates {
+			start.Local = date
+			if prop, err = toDateTimeProp(name, start); err != nil {
+				return nil, err
+			}
+			values[i] = prop.Value
+		}
+		prop.Value = strings.Join(values, ",")
+		comp.Props.Add(prop)
+	}
+
+	return comps, nil
+}
+
+func toComponent(obj Object) (*ical.Component, error) {
+	c := obj.common()
+
+	var comp *ical.Component
+	switch obj.(type) {
+	case *Event:
+		comp = ical.NewComponent(ical.CompEvent)
+	case *Task:
+		comp = ical.NewComponent(ical.CompToDo)
+	default:
+		return nil, fmt.Errorf("jsmodel: unsupported object type %T", obj)
+	}
+	props := comp.Props
+
+	setText := func(name, v string) {
+		if v != "" {
+			props.SetText(name, v)
+		}
+	}
+	setInt := func(name string, v int) {
+		if v != 0 {
+			prop := ical.NewProp(name)
+			prop.Value = strconv.Itoa(v)
+			props.Set(prop)
+		}
+	}
+	setUTC := func(name, v string) error {
+		if v == "" {
+			return nil
+		}
+		prop, err := toUTCDateTimeProp(name, v)
+		if err != nil {
+			return err
+		}
+		props.Set(prop)
+		return nil
+	}
+	setDateTime := func(name, v string) error {
+		if v == "" {
+			return nil
+		}
+		prop, err := toDateTimeProp(name, dateTimeProp{
+			Local:    v,
+			TimeZone: c.TimeZone,
+			DateOnly: c.ShowWithoutTime,
+		})
+		if err != nil {
+			return err
+		}
+		props.Set(prop)
+		return nil
+	}
+
+	setText(ical.PropUID, c.UID)
+	if err := setUTC(ical.PropDateTimeStamp, c.Updated); err != nil {
+		return nil, err
+	}
+	if err := setUTC(ical.PropCreated, c.Created); err != nil {
+		return nil, err
+	}
+	setInt(ical.PropSequence, c.Sequence)
+	setInt(ical.PropPriority, c.Priority)
+	setText(ical.PropColor, c.Color)
+	if err := setDateTime(ical.PropRecurrenceID, c.RecurrenceID); err != nil {
+		return nil, err
+	}
+
+	addLocalized := func(name, v string) {
+		if v == "" {
+			return
+		}
+		prop := ical.NewProp(name)
+		prop.SetText(v)
+		if c.Locale != "" {
+			prop.Params.Set(ical.ParamLanguage, c.Locale)
+		}
+		props.Add(prop)
+	}
+	addLocalized(ical.PropSummary, c.Title)
+	addLocalized(ical.PropDescription, c.Description)
+	for _, id := range sortedKeys(c.Locations) {
+		loc := c.Locations[id]
+		addLocalized(ical.PropLocation, loc.Name)
+		if loc.Coordinates != "" && props.Get(ical.PropGeo) == nil {
+			coords := strings.TrimPrefix(loc.Coordinates, "geo:")
+			if i := strings.IndexByte(coords, ';'); i >= 0 {
+				// Strip geo URI parameters
+				coords = coords[:i]
+			}
+			prop := ical.NewProp(ical.PropGeo)
+			prop.Value = strings.Replace(coords, ",", ";", 1)
+			props.Set(prop)
+		}
+	}
+	// iCalendar doesn't allow more than one SUMMARY, DESCRIPTION or LOCATION
+	for _, lang := range sortedKeys(c.Localizations) {
+		prop, err := jsProp("localizations/"+escapePointer(lang), c.Localizations[lang])
+		if err != nil {
+			return nil, err
+		}
+		props.Add(prop)
+	}
+
+	if len(c.Keywords) > 0 {
+		prop := ical.NewProp(ical.PropCategories)
+		prop.SetTextList(sortedSet(c.Keywords))
+		props.Set(prop)
+	}
+
+	for k, v := range map[string]string{"public": "PUBLIC", "private": "PRIVATE", "secret": "CONFIDENTIAL"} {
+		if c.Privacy == k {
+			setText(ical.PropClass, v)
+		}
+	}
+	for k, v := range map[string]string{"busy": "OPAQUE", "free": "TRANSPARENT"} {
+		if c.FreeBusyStatus == k {
+			setText(ical.PropTransparency, v)
+		}
+	}
+
+	formatUntil := func(until string) (string, error) {
+		switch {
+		case c.ShowWithoutTime:
+			return parseDateTime(until, true)
+		case c.TimeZone == "":
+			return parseDateTime(until, false)
+		case c.TimeZone == utcTimeZone:
+			v, err := parseDateTime(until, false)
+			return strings.TrimSuffix(v, "Z") + "Z", err
+		}
+		loc, err := time.LoadLocation(c.TimeZone)
+		if err != nil {
+			return "", err
+		}
+		t, err := time.ParseInLocation("2006-01-02T15:04:05", until, loc)
+		if err != nil {
+			return "", err
+		}
+		return t.UTC().Format("20060102T150405Z"), nil
+	}
+	for name, rules := range map[string][]*RecurrenceRule{
+		ical.PropRecurrenceRule: c.RecurrenceRules,
+		propExceptionRule:       c.ExcludedRecurrenceRules,
+	} {
+		for _, rule := range rules {
+			v, err := formatRecurrenceRule(rule, formatUntil)
+			if err != nil {
+				return nil, err
+			}
+			prop := ical.NewProp(name)
+			prop.Value = v
+			props.Add(prop)
+		}
+	}
+
+	switch obj := obj.(type) {
+	case *Event:
+		if err := setDateTime(ical.PropDateTimeStart, obj.Start); err != nil {
+			return nil, err
+		}
+		if obj.Duration != "" {
+			prop := ical.NewProp(ical.PropDuration)
+			prop.Value = obj.Duration
+			props.Set(prop)
+		}
+		setText(ical.PropStatus, strings.ToUpper(obj.Status))
+	case *Task:
+		if err := setDateTime(ical.PropDateTimeStart, obj.Start); err != nil {
+			return nil, err
+		}
+		if err := setDateTime(ical.PropDue, obj.Due); err != nil {
+			return nil, err
+		}
+		if obj.EstimatedDuration != "" {
+			prop := ical.NewProp(ical.PropDuration)
+			prop.Value = obj.EstimatedDuration
+			props.Set(prop)
+		}
+		setInt(ical.PropPercentComplete, obj.PercentComplete)
+		setText(ical.PropStatus, strings.ToUpper(obj.Progress))
+		if err := setUTC(ical.PropCompleted, obj.ProgressUpdated); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.participantProps(props); err != nil {
+		return nil, err
+	}
+
+	for _, id := range sortedKeys(c.Alerts) {
+		alarm, err := c.Alerts[id].component()
+		if err != nil {
+			return nil, err
+		}
+		comp.Children = append(comp.Children, alarm)
+	}
+
+	if err := decodeICalProps(comp, c.ICalProps); err != nil {
+		return nil, err
+	}
+	return comp, nil
+}
+
+// participantProps converts the participants to ORGANIZER and ATTENDEE
+// properties.
+func (c *Common) participantProps(props ical.Props) error {
+	ids := sortedKeys(c.Participants)
+	addrs := func(m map[string]bool) []string {
+		var l []string
+		for _, id := range ids {
+			if m[id] {
+				l = append(l, participantAddress(c.Participants[id]))
+			}
+		}
+		return l
+	}
+
+	hasOrganizer := false
+	for _, id := range ids {
+		p := c.Participants[id]
+		params, err := decodeParams(p.ICalParams)
+		if err != nil {
+			return err
+		}
+
+		isAttendee := false
+		for role := range p.Roles {
+			isAttendee = isAttendee || role != "owner"
+		}
+		if p.Roles["owner"] && !hasOrganizer {
+			prop := ical.NewProp(ical.PropOrganizer)
+			prop.Value = participantAddress(p)
+			if p.Name != "" {
+				prop.Params.Set(ical.ParamCommonName, p.Name)
+			}
+			if !isAttendee {
+				for k, v := range params {
+					prop.Params[k] = v
+				}
+			}
+			props.Set(prop)
+			hasOrganizer = true
+		}
+		if !isAttendee {
+			continue
+		}
+
+		prop := ical.NewProp(ical.PropAttendee)
+		prop.Value = participantAddress(p)
+		prop.Params = ical.Params(params)
+		if p.Name != "" {
+			prop.Params.Set(ical.ParamCommonName, p.Name)
+		}
+		if p.Email != "" {
+			prop.Params.Set(ical.ParamEmail, p.Email)
+		}
+		for k, v := range participantKinds {
+			if p.Kind == v {
+				prop.Params.Set(ical.ParamCalendarUserType, k)
+			}
+		}
+		switch {
+		case p.Roles["chair"]:
+			prop.Params.Set(ical.ParamRole, "CHAIR")
+		case p.Roles["optional"]:
+			prop.Params.Set(ical.ParamRole, "OPT-PARTICIPANT")
+		case p.Roles["informational"] && !p.Roles["attendee"]:
+			prop.Params.Set(ical.ParamRole, "NON-PARTICIPANT")
+		}
+		if p.ParticipationStatus != "" {
+			prop.Params.Set(ical.ParamParticipationStatus, strings.ToUpper(p.ParticipationStatus))
+		}
+		if p.ExpectReply {
+			prop.Params.Set(ical.ParamRSVP, "TRUE")
+		}
+		if l := addrs(p.DelegatedTo); len(l) > 0 {
+			prop.Params[ical.ParamDelegatedTo] = l
+		}
+		if l := addrs(p.DelegatedFrom); len(l) > 0 {
+			prop.Params[ical.ParamDelegatedFrom] = l
+		}
+		props.Add(prop)
+	}
+
+	if !hasOrganizer && len(c.ReplyTo) > 0 {
+		prop := ical.NewProp(ical.PropOrganizer)
+		prop.Value = participantAddress(&Participant{SendTo: c.ReplyTo})
+		props.Set(prop)
+	}
+	return nil
+}
+
+func (alert *Alert) component() (*ical.Component, error) {
+	comp := ical.NewComponent(ical.CompAlarm)
+	if alert.Action != "" {
+		comp.Props.SetText(ical.PropAction, strings.ToUpper(alert.Action))
+	}
+	if t := alert.Trigger; t != nil {
+		switch t.Type {
+		case typeOffsetTrigger:
+			prop := ical.NewProp(ical.PropTrigger)
+			prop.Value = t.Offset
+			if t.RelativeTo != "" {
+				prop.Params.Set(ical.ParamRelated, strings.ToUpper(t.RelativeTo))
+			}
+			comp.Props.Set(prop)
+		case typeAbsoluteTrigger:
+			prop, err := toUTCDateTimeProp(ical.PropTrigger, t.When)
+			if err != nil {
+				return nil, err
+			}
+			prop.Params.Set(ical.ParamValue, string(ical.ValueDateTime))
+			comp.Props.Set(prop)
+		}
+	}
+	if alert.Acknowledged != "" {
+		prop, err := toUTCDateTimeProp(propAcknowledged, alert.Acknowledged)
+		if err != nil {
+			return nil, err
+		}
+		comp.Props.Set(prop)
+	}
+	if err := decodeICalProps(comp, alert.ICalProps); err != nil {
+		return nil, err
+	}
+	return comp, nil
+}
+
+func (tz *TimeZone) component() (*ical.Component, error) {
+	comp := ical.NewComponent(ical.CompTimezone)
+	comp.Props.SetText(ical.PropTimezoneID, tz.TzID)
+	if tz.URL != "" {
+		comp.Props.SetText(ical.PropTimezoneURL, tz.URL)
+	}
+	if tz.Updated != "" {
+		prop, err := toUTCDateTimeProp(ical.PropLastModified, tz.Updated)
+		if err != nil {
+			return nil, err
+		}
+		comp.Props.Set(prop)
+	}
+	if err := decodeICalProps(comp, tz.ICalProps); err != nil {
+		return nil, err
+	}
+
+	for _, rules := range []struct {
+		name  string
+		rules []*TimeZoneRule
+	}{
+		{ical.CompTimezoneDaylight, tz.Daylight},
+		{ical.CompTimezoneStandard, tz.Standard},
+	} {
+		for _, rule := range rules.rules {
+			child, err := rule.component(rules.name)
+			if err != nil {
+				return nil, err
+			}
+			comp.Children = append(comp.Children, child)
+		}
+	}
+	return comp, nil
+}
+
+func (rule *TimeZoneRule) component(name string) (*ical.Component, error) {
+	comp := ical.NewComponent(name)
+
+	if rule.Start != "" {
+		start, err := parseDateTime(rule.Start, false)
+		if err != nil {
+			return nil, err
+		}
+		prop := ical.NewProp(ical.PropDateTimeStart)
+		prop.Value = start
+		comp.Props.Set(prop)
+	}
+
+	for name, v := range map[string]string{
+		ical.PropTimezoneOffsetFrom: rule.OffsetFrom,
+		ical.PropTimezoneOffsetTo:   rule.OffsetTo,
+	} {
+		if v == "" {
+			continue
+		}
+		prop := ical.NewProp(name)
+		prop.Value = strings.Replace(v, ":", "", -1)
+		comp.Props.Set(prop)
+	}
+	for _, name := range sortedSet(rule.Names) {
+		prop := ical.NewProp(ical.PropTimezoneName)
+		prop.SetText(name)
+		comp.Props.Add(prop)
+	}
+	for _, r := range rule.RecurrenceRules {
+		v, err := formatRecurrenceRule(r, func(until string) (string, error) {
+			return parseDateTime(until, false)
+		})
+		if err != nil {
+			return nil, err
+		}
+		prop := ical.NewProp(ical.PropRecurrenceRule)
+		prop.Value = v
+		comp.Props.Add(prop)
+	}
+	if err := decodeICalProps(comp, rule.ICalProps); err != nil {
+		return nil, err
+	}
+	return comp, nil
+}
+
+// encodeICalProps converts properties to the jCal format.
+func encodeICalProps(props []ical.Prop) ([]interface{}, error) {
+	if len(props) == 0 {
+		return nil, nil
+	}
+
+	comp := ical.NewComponent(ical.CompCalendar)
+	for i := range props {
+		comp.Props.Add(&props[i])
+	}
+	var buf bytes.Buffer
+	if err := caldav.EncodeJCal(&buf, &ical.Calendar{Component: comp}); err != nil {
+		return nil, err
+	}
+
+	var v []interface{}
+	if err := unmarshalJSON(buf.Bytes(), &v); err != nil {
+		return nil, err
+	}
+	return v[1].([]interface{}), nil
+}
+
+// decodeICalProps adds properties in the jCal format to a component.
+func decodeICalProps(comp *ical.Component, props []interface{}) error {
+	if len(props) == 0 {
+		return nil
+	}
+
+	b, err := json.Marshal([]interface{}{"vcalendar", props, []interface{}{}})
+	if err != nil {
+		return err
+	}
+	cal, err := caldav.DecodeJCal(bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	for _, props := range cal.Props {
+		for i := range props {
+			comp.Props.Add(&props[i])
+		}
+	}
+	return nil
+}
+
+func sortedPropNames(props ical.Props) []string {
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedKeys(m interface{}) []string {
+	v := reflect.ValueOf(m)
+	keys := make([]string, 0, v.Len())
+	for _, k := range v.MapKeys() {
+		keys = append(keys, k.String())
+	}
+	return sortedIDs(keys)
+}
+
+// sortedSet returns the keys of a map in lexical order.
+func sortedSet(m interface{}) []string {
+	v := reflect.ValueOf(m)
+	l := make([]string, 0, v.Len())
+	for _, k := range v.MapKeys() {
+		l = append(l, k.String())
+	}
+	sort.Strings(l)
+	return l
+}
+
+var textEscaper = strings.NewReplacer(`\\`, `\\\\`, "\n", `\n`, ";", `\;`, ",", `\,`)
+
+// unescapeText unescapes an iCalendar or vCard text value.
+func unescapeText(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) {
+			i++
+			c = s[i]
+			if c == 'n' || c == 'N' {
+				c = '\n'
+			}
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+// splitEscaped splits an iCalendar or vCard value on a separator, ignoring
+// escaped separators. The returned parts are still escaped.
+func splitEscaped(s string, sep byte) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
@@ -0,0 +1,440 @@
+package jsmodel
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-ical"
+)
+
+// testCalendars are the calendars used by the CalDAV filter tests.
+var testCalendars = []struct {
+	name string
+	data string
+}{
+	{"event1", `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VTIMEZONE
+LAST-MODIFIED:20040110T032845Z
+TZID:US/Eastern
+BEGIN:DAYLIGHT
+DTSTART:20000404T020000
+RRULE:FREQ=YEARLY;BYDAY=1SU;BYMONTH=4
+TZNAME:EDT
+TZOFFSETFROM:-0500
+TZOFFSETTO:-0400
+END:DAYLIGHT
+BEGIN:STANDARD
+DTSTART:20001026T020000
+RRULE:FREQ=YEARLY;BYDAY=-1SU;BYMONTH=10
+TZNAME:EST
+TZOFFSETFROM:-0400
+TZOFFSETTO:-0500
+END:STANDARD
+END:VTIMEZONE
+BEGIN:VEVENT
+DTSTAMP:20060206T001102Z
+DTSTART;TZID=US/Eastern:20060102T100000
+DURATION:PT1H
+SUMMARY:Event #1
+Description:Go Steelers!
+UID:74855313FA803DA593CD579A@example.com
+END:VEVENT
+END:VCALENDAR`},
+	{"event2", `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VTIMEZONE
+LAST-MODIFIED:20040110T032845Z
+TZID:US/Eastern
+BEGIN:DAYLIGHT
+DTSTART:20000404T020000
+RRULE:FREQ=YEARLY;BYDAY=1SU;BYMONTH=4
+TZNAME:EDT
+TZOFFSETFROM:-0500
+TZOFFSETTO:-0400
+END:DAYLIGHT
+BEGIN:STANDARD
+DTSTART:20001026T020000
+RRULE:FREQ=YEARLY;BYDAY=-1SU;BYMONTH=10
+TZNAME:EST
+TZOFFSETFROM:-0400
+TZOFFSETTO:-0500
+END:STANDARD
+END:VTIMEZONE
+BEGIN:VEVENT
+DTSTAMP:20060206T001121Z
+DTSTART;TZID=US/Eastern:20060102T120000
+DURATION:PT1H
+RRULE:FREQ=DAILY;COUNT=5
+SUMMARY:Event #2
+UID:00959BC664CA650E933C892C@example.com
+END:VEVENT
+BEGIN:VEVENT
+DTSTAMP:20060206T001121Z
+DTSTART;TZID=US/Eastern:20060104T140000
+DURATION:PT1H
+RECURRENCE-ID;TZID=US/Eastern:20060104T120000
+SUMMARY:Event #2 bis
+UID:00959BC664CA650E933C892C@example.com
+END:VEVENT
+BEGIN:VEVENT
+DTSTAMP:20060206T001121Z
+DTSTART;TZID=US/Eastern:20060106T140000
+DURATION:PT1H
+RECURRENCE-ID;TZID=US/Eastern:20060106T120000
+SUMMARY:Event #2 bis bis
+UID:00959BC664CA650E933C892C@example.com
+END:VEVENT
+END:VCALENDAR`},
+	{"event3", `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VTIMEZONE
+LAST-MODIFIED:20040110T032845Z
+TZID:US/Eastern
+BEGIN:DAYLIGHT
+DTSTART:20000404T020000
+RRULE:FREQ=YEARLY;BYDAY=1SU;BYMONTH=4
+TZNAME:EDT
+TZOFFSETFROM:-0500
+TZOFFSETTO:-0400
+END:DAYLIGHT
+BEGIN:STANDARD
+DTSTART:20001026T020000
+RRULE:FREQ=YEARLY;BYDAY=-1SU;BYMONTH=10
+TZNAME:EST
+TZOFFSETFROM:-0400
+TZOFFSETTO:-0500
+END:STANDARD
+END:VTIMEZONE
+BEGIN:VEVENT
+ATTENDEE;PARTSTAT=ACCEPTED;ROLE=CHAIR:mailto:cyrus@example.com
+ATTENDEE;PARTSTAT=NEEDS-ACTION:mailto:lisa@example.com
+DTSTAMP:20060206T001220Z
+DTSTART;TZID=US/Eastern:20060104T100000
+DURATION:PT1H
+LAST-MODIFIED:20060206T001330Z
+ORGANIZER:mailto:cyrus@example.com
+SEQUENCE:1
+STATUS:TENTATIVE
+SUMMARY:Event #3
+UID:DC6C50A017428C5216A2F1CD@example.com
+END:VEVENT
+END:VCALENDAR`},
+	{"todo1", `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VTODO
+DTSTAMP:20060205T235335Z
+DUE;VALUE=DATE:20060104
+STATUS:NEEDS-ACTION
+SUMMARY:Task #1
+UID:DDDEEB7915FA61233B861457@example.com
+BEGIN:VALARM
+ACTION:AUDIO
+TRIGGER;RELATED=START:-PT10M
+END:VALARM
+END:VTODO
+END:VCALENDAR`},
+	{"todo2", `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VTODO
+DTSTAMP:20060205T235335Z
+DTSTART:20060106T100000Z
+DUE:20060108T100000Z
+SUMMARY:Task #2
+UID:E10BA47467C5C69BB74E8720@example.com
+END:VTODO
+END:VCALENDAR`},
+	{"todo3", `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VTODO
+DTSTAMP:20060205T235335Z
+CREATED:20060101T100000Z
+COMPLETED:20060103T100000Z
+STATUS:COMPLETED
+SUMMARY:Task #3
+UID:E10BA47467C5C69BB74E8725@example.com
+END:VTODO
+END:VCALENDAR`},
+	{"todo4", `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VTODO
+DTSTAMP:20060205T235335Z
+SUMMARY:Task #4
+UID:E10BA47467C5C69BB74E8727@example.com
+END:VTODO
+END:VCALENDAR`},
+	{"journal1", `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VJOURNAL
+DTSTAMP:20060205T235335Z
+DTSTART;VALUE=DATE:20060105
+SUMMARY:Journal #1
+UID:0F6C1E79D44F5B6C1B4CA1D3@example.com
+END:VJOURNAL
+END:VCALENDAR`},
+	{"freebusy1", `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VFREEBUSY
+DTSTAMP:20060205T235335Z
+FREEBUSY:20060107T100000Z/PT1H
+UID:4A4E6E3E5A8E6DE1B8F7E4F2@example.com
+END:VFREEBUSY
+END:VCALENDAR`},
+	{"event4", `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VEVENT
+DTSTAMP:20060206T001121Z
+DTSTART:20060110T100000Z
+DURATION:PT1H
+RRULE:FREQ=WEEKLY
+SUMMARY:Event #4
+UID:A3E9A0B1E23B4F5A8C1B0D2E@example.com
+BEGIN:VALARM
+ACTION:DISPLAY
+DESCRIPTION:Follow-up
+TRIGGER;RELATED=END:PT5M
+REPEAT:2
+DURATION:PT5M
+END:VALARM
+END:VEVENT
+END:VCALENDAR`},
+	{"event5", `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VEVENT
+DTSTAMP:20060206T001121Z
+DTSTART:20060111T090000
+DURATION:PT1H
+SUMMARY:Floating event
+UID:B52E9A2C7F4D4E1A9C3B8D6F@example.com
+END:VEVENT
+BEGIN:VEVENT
+DTSTAMP:20060206T001121Z
+DTSTART;VALUE=DATE:20060112
+SUMMARY:All-day event
+UID:C63FAB3D8A5E4F2BAD4C9E7A@example.com
+END:VEVENT
+END:VCALENDAR`},
+	{"event6", `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VEVENT
+UID:meeting@example.com
+DTSTAMP:20060206T001102Z
+DTSTART:20060115T100000Z
+DURATION:PT1H
+SUMMARY:Meeting
+ATTENDEE;PARTSTAT=ACCEPTED:mailto:alice@example.com
+ATTENDEE;PARTSTAT=NEEDS-ACTION;DELEGATED-FROM="mailto:carol@example.com","mailto:dave@example.com":mailto:bob@example.com
+END:VEVENT
+END:VCALENDAR`},
+}
+
+// unsupportedCalendars contain components which have no JSCalendar equivalent.
+var unsupportedCalendars = map[string]bool{
+	"journal1":  true,
+	"freebusy1": true,
+}
+
+func decodeTestCalendar(t *testing.T, s string) *ical.Calendar {
+	cal, err := ical.NewDecoder(strings.NewReader(s)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cal
+}
+
+func encodeTestCalendar(t *testing.T, cal *ical.Calendar) string {
+	var buf bytes.Buffer
+	if err := ical.NewEncoder(&buf).Encode(cal); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestCalendarRoundTrip(t *testing.T) {
+	for _, tc := range testCalendars {
+		t.Run(tc.name, func(t *testing.T) {
+			cal := decodeTestCalendar(t, tc.data)
+
+			g, err := FromICal(cal)
+			if unsupportedCalendars[tc.name] {
+				if err == nil {
+					t.Fatalf("FromICal() succeeded with an unsupported component")
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("FromICal() = %v", err)
+			}
+
+			b, err := json.Marshal(g)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var decoded Group
+			if err := json.Unmarshal(b, &decoded); err != nil {
+				t.Fatalf("json.Unmarshal() = %v", err)
+			}
+
+			out, err := decoded.ICal()
+			if err != nil {
+				t.Fatalf("ICal() = %v", err)
+			}
+			got, want := encodeTestCalendar(t, out), encodeTestCalendar(t, cal)
+			if got != want {
+				t.Errorf("round-tripped calendar = \n%v\nwant\n%v\nJSCalendar:\n%s", got, want, b)
+			}
+		})
+	}
+}
+
+var meetingCalendarData = `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Inc.//Example Calendar//EN
+BEGIN:VEVENT
+UID:2a1e2f4c-7d42-4a7b-8c0e-5d3f2b1a9c8e
+DTSTAMP:20060206T001121Z
+DTSTART;TZID=Europe/Paris:20060102T100000
+DURATION:PT1H
+RRULE:FREQ=WEEKLY;UNTIL=20060301T090000Z;BYDAY=MO,WE
+EXDATE;TZID=Europe/Paris:20060104T100000
+SUMMARY;LANGUAGE=en:Team meeting
+JSPROP;JSPTR=localizations/fr:{"title":"Réunion d'équipe"}
+LOCATION;LANGUAGE=en:Room 1
+GEO:48.85;2.35
+CATEGORIES:MEETING,WORK
+CLASS:PRIVATE
+TRANSP:OPAQUE
+ORGANIZER;CN=Alice:mailto:alice@example.org
+ATTENDEE;CN=Alice;ROLE=CHAIR;PARTSTAT=ACCEPTED:mailto:alice@example.org
+ATTENDEE;CN=Bob;RSVP=TRUE;DELEGATED-TO="mailto:carol@example.org":mailto:bob@example.org
+ATTENDEE;CN=Carol;CUTYPE=INDIVIDUAL;DELEGATED-FROM="mailto:bob@example.org":mailto:carol@example.org
+X-EXAMPLE-FLAG;VALUE=BOOLEAN:TRUE
+BEGIN:VALARM
+ACTION:DISPLAY
+TRIGGER;VALUE=DATE-TIME:20060102T083000Z
+END:VALARM
+END:VEVENT
+END:VCALENDAR`
+
+func TestFromICal(t *testing.T) {
+	cal := decodeTestCalendar(t, meetingCalendarData)
+	g, err := FromICal(cal)
+	if err != nil {
+		t.Fatalf("FromICal() = %v", err)
+	}
+	if len(g.Entries) != 1 {
+		t.Fatalf("FromICal() returned %v entries, want 1", len(g.Entries))
+	}
+	event, ok := g.Entries[0].(*Event)
+	if !ok {
+		t.Fatalf("entry is a %T, want an *Event", g.Entries[0])
+	}
+
+	if event.Title != "Team meeting" || event.Locale != "en" {
+		t.Errorf("title = %q, locale = %q", event.Title, event.Locale)
+	}
+	if v := event.Localizations["fr"]["title"]; v != "Réunion d'équipe" {
+		t.Errorf("French title = %v", v)
+	}
+	if loc := event.Locations["1"]; loc == nil || loc.Name != "Room 1" || loc.Coordinates != "geo:48.85,2.35" {
+		t.Errorf("location = %+v", loc)
+	}
+	if !event.Keywords["WORK"] || !event.Keywords["MEETING"] {
+		t.Errorf("keywords = %v", event.Keywords)
+	}
+	if event.Privacy != "private" || event.FreeBusyStatus != "busy" {
+		t.Errorf("privacy = %q, freeBusyStatus = %q", event.Privacy, event.FreeBusyStatus)
+	}
+	if patch := event.RecurrenceOverrides["2006-01-04T10:00:00"]; patch["excluded"] != true {
+		t.Errorf("excluded recurrence override = %v", patch)
+	}
+
+	alice, bob, carol := event.Participants["1"], event.Participants["2"], event.Participants["3"]
+	if len(event.Participants) != 3 || alice == nil || bob == nil || carol == nil {
+		t.Fatalf("participants = %+v", event.Participants)
+	}
+	if !alice.Roles["owner"] || !alice.Roles["chair"] || alice.ParticipationStatus != "accepted" {
+		t.Errorf("organizer participant = %+v", alice)
+	}
+	if !bob.ExpectReply || !bob.DelegatedTo["3"] || !carol.DelegatedFrom["2"] || carol.Kind != "individual" {
+		t.Errorf("delegated participants = %+v, %+v", bob, carol)
+	}
+	if event.ReplyTo["imip"] != "mailto:alice@example.org" {
+		t.Errorf("replyTo = %v", event.ReplyTo)
+	}
+
+	alert := event.Alerts["1"]
+	if alert == nil || alert.Action != "display" || alert.Trigger.Type != "AbsoluteTrigger" || alert.Trigger.When != "2006-01-02T08:30:00Z" {
+		t.Errorf("alert = %+v", alert)
+	}
+	if len(event.ICalProps) != 1 {
+		t.Errorf("iCalProps = %v, want X-EXAMPLE-FLAG only", event.ICalProps)
+	}
+
+	out, err := g.ICal()
+	if err != nil {
+		t.Fatalf("ICal() = %v", err)
+	}
+	if got, want := encodeTestCalendar(t, out), encodeTestCalendar(t, cal); got != want {
+		t.Errorf("round-tripped calendar = \n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestFromICal_overrides(t *testing.T) {
+	var data string
+	for _, tc := range testCalendars {
+		if tc.name == "event2" {
+			data = tc.data
+		}
+	}
+	g, err := FromICal(decodeTestCalendar(t, data))
+	if err != nil {
+		t.Fatalf("FromICal() = %v", err)
+	}
+	if len(g.Entries) != 1 {
+		t.Fatalf("FromICal() returned %v entries, want the master event only", len(g.Entries))
+	}
+	event := g.Entries[0].(*Event)
+	if len(event.RecurrenceRules) != 1 || event.RecurrenceRules[0].Frequency != "daily" || event.RecurrenceRules[0].Count != 5 {
+		t.Errorf("recurrence rules = %+v", event.RecurrenceRules)
+	}
+
+	patch := event.RecurrenceOverrides["2006-01-04T12:00:00"]
+	want := PatchObject{"start": "2006-01-04T14:00:00", "title": "Event #2 bis"}
+	if len(patch) != len(want) || patch["start"] != want["start"] || patch["title"] != want["title"] {
+		t.Errorf("recurrence override = %v, want %v", patch, want)
+	}
+}
+
+func TestFromICal_duration(t *testing.T) {
+	cal := decodeTestCalendar(t, `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VEVENT
+UID:dtend@example.com
+DTSTAMP:20060206T001121Z
+DTSTART:20060102T100000Z
+DTEND:20060103T113000Z
+END:VEVENT
+END:VCALENDAR`)
+	g, err := FromICal(cal)
+	if err != nil {
+		t.Fatalf("FromICal() = %v", err)
+	}
+	if d := g.Entries[0].(*Event).Duration; d != "P1DT1H30M" {
+		t.Errorf("duration = %q, want %q", d, "P1DT1H30M")
+	}
+}
@@ -0,0 +1,1315 @@
+package jsmodel
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-vcard"
+	"github.com/emersion/go-webdav/carddav"
+)
+
+// Properties and parameters not defined by go-vcard, from RFC 6350, RFC 6474,
+// RFC 6715 and RFC 9554.
+const (
+	fieldDeathDate    = "DEATHDATE"
+	fieldOrgDirectory = "ORG-DIRECTORY"
+	fieldContactURI   = "CONTACT-URI"
+	fieldCreated      = "CREATED"
+	fieldLanguage     = "LANGUAGE"
+	paramLabel        = "LABEL"
+	paramCountryCode  = "CC"
+)
+
+// paramGroup holds the group of a property in vCardParams, as in jCard.
+const paramGroup = "GROUP"
+
+const (
+	typeCard              = "Card"
+	typeName              = "Name"
+	typeNameComponent     = "NameComponent"
+	typeNickname          = "Nickname"
+	typeOrganization      = "Organization"
+	typeOrgUnit           = "OrgUnit"
+	typeTitle             = "Title"
+	typeEmailAddress      = "EmailAddress"
+	typePhone             = "Phone"
+	typeOnlineService     = "OnlineService"
+	typeLanguagePref      = "LanguagePref"
+	typeCalendar          = "Calendar"
+	typeSchedulingAddress = "SchedulingAddress"
+	typeAddress           = "Address"
+	typeAddressComponent  = "AddressComponent"
+	typeCryptoKey         = "CryptoKey"
+	typeDirectory         = "Directory"
+	typeLink              = "Link"
+	typeMedia             = "Media"
+	typeAnniversary       = "Anniversary"
+	typePartialDate       = "PartialDate"
+	typeTimestamp         = "Timestamp"
+	typeNote              = "Note"
+	typeRelation          = "Relation"
+)
+
+// cardVersion is the JSContact version of converted cards.
+const cardVersion = "1.0"
+
+// namePathFull is the path of the full name in localizations.
+const namePathFull = "name/full"
+
+// Card is a JSContact card, see RFC 9553 section 2. It represents a vCard.
+type Card struct {
+	Type     string `json:"@type"`
+	Version  string `json:"version"`
+	UID      string `json:"uid"`
+	Kind     string `json:"kind,omitempty"`
+	Language string `json:"language,omitempty"`
+	ProdID   string `json:"prodId,omitempty"`
+	Created  string `json:"created,omitempty"`
+	Updated  string `json:"updated,omitempty"`
+
+	Members   map[string]bool      `json:"members,omitempty"`
+	RelatedTo map[string]*Relation `json:"relatedTo,omitempty"`
+
+	Name          *Name                    `json:"name,omitempty"`
+	Nicknames     map[string]*Nickname     `json:"nicknames,omitempty"`
+	Organizations map[string]*Organization `json:"organizations,omitempty"`
+	Titles        map[string]*Title        `json:"titles,omitempty"`
+
+	Emails              map[string]*EmailAddress  `json:"emails,omitempty"`
+	Phones              map[string]*Phone         `json:"phones,omitempty"`
+	OnlineServices      map[string]*OnlineService `json:"onlineServices,omitempty"`
+	PreferredLanguages  map[string]*LanguagePref  `json:"preferredLanguages,omitempty"`
+	Calendars           map[string]*Resource      `json:"calendars,omitempty"`
+	SchedulingAddresses map[string]*Resource      `json:"schedulingAddresses,omitempty"`
+
+	Addresses map[string]*Address `json:"addresses,omitempty"`
+
+	CryptoKeys  map[string]*Resource `json:"cryptoKeys,omitempty"`
+	Directories map[string]*Resource `json:"directories,omitempty"`
+	Links       map[string]*Resource `json:"links,omitempty"`
+	Media       map[string]*Resource `json:"media,omitempty"`
+
+	Anniversaries map[string]*Anniversary `json:"anniversaries,omitempty"`
+	Keywords      map[string]bool         `json:"keywords,omitempty"`
+	Notes         map[string]*Note        `json:"notes,omitempty"`
+
+	Localizations map[string]PatchObject `json:"localizations,omitempty"`
+
+	VCardProps []interface{} `json:"vCardProps,omitempty"`
+}
+
+// Relation describes the relation to another card, see RFC 9553 section
+// 2.1.8.
+type Relation struct {
+	Type     string          `json:"@type"`
+	Relation map[string]bool `json:"relation,omitempty"`
+}
+
+// Name is the name of the entity represented by a card, see RFC 9553 section
+// 2.2.1. It represents the N and FN properties.
+type Name struct {
+	Type       string            `json:"@type"`
+	Components []*NameComponent  `json:"components,omitempty"`
+	Full       string            `json:"full,omitempty"`
+	SortAs     map[string]string `json:"sortAs,omitempty"`
+
+	// VCardParams contains the parameters of the FN property.
+	VCardParams map[string]interface{} `json:"vCardParams,omitempty"`
+}
+
+// NameComponent is a component of a name.
+type NameComponent struct {
+	Type  string `json:"@type"`
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+// Nickname is a nickname, see RFC 9553 section 2.2.2.
+type Nickname struct {
+	Type     string          `json:"@type"`
+	Name     string          `json:"name"`
+	Contexts map[string]bool `json:"contexts,omitempty"`
+	Pref     int             `json:"pref,omitempty"`
+
+	VCardParams map[string]interface{} `json:"vCardParams,omitempty"`
+}
+
+// Organization is an organization, see RFC 9553 section 2.2.3.
+type Organization struct {
+	Type     string          `json:"@type"`
+	Name     string          `json:"name,omitempty"`
+	Units    []*OrgUnit      `json:"units,omitempty"`
+	Contexts map[string]bool `json:"contexts,omitempty"`
+	Pref     int             `json:"pref,omitempty"`
+
+	VCardParams map[string]interface{} `json:"vCardParams,omitempty"`
+}
+
+// OrgUnit is an organizational unit.
+type OrgUnit struct {
+	Type string `json:"@type"`
+	Name string `json:"name"`
+}
+
+// Title is a job title or a role, see RFC 9553 section 2.2.5.
+type Title struct {
+	Type string `json:"@type"`
+	Name string `json:"name"`
+	Kind string `json:"kind,omitempty"`
+
+	VCardParams map[string]interface{} `json:"vCardParams,omitempty"`
+}
+
+// EmailAddress is an email address, see RFC 9553 section 2.3.1.
+type EmailAddress struct {
+	Type     string          `json:"@type"`
+	Address  string          `json:"address"`
+	Contexts map[string]bool `json:"contexts,omitempty"`
+	Pref     int             `json:"pref,omitempty"`
+
+	VCardParams map[string]interface{} `json:"vCardParams,omitempty"`
+}
+
+// Phone is a phone number, see RFC 9553 section 2.3.3.
+type Phone struct {
+	Type     string          `json:"@type"`
+	Number   string          `json:"number"`
+	Features map[string]bool `json:"features,omitempty"`
+	Contexts map[string]bool `json:"contexts,omitempty"`
+	Pref     int             `json:"pref,omitempty"`
+
+	VCardParams map[string]interface{} `json:"vCardParams,omitempty"`
+}
+
+// OnlineService is an online service, see RFC 9553 section 2.3.2. It
+// represents an IMPP property.
+type OnlineService struct {
+	Type     string          `json:"@type"`
+	URI      string          `json:"uri"`
+	Contexts map[string]bool `json:"contexts,omitempty"`
+	Pref     int             `json:"pref,omitempty"`
+
+	VCardParams map[string]interface{} `json:"vCardParams,omitempty"`
+}
+
+// LanguagePref is a preferred language, see RFC 9553 section 2.3.4.
+type LanguagePref struct {
+	Type     string          `json:"@type"`
+	Language string          `json:"language"`
+	Contexts map[string]bool `json:"contexts,omitempty"`
+	Pref     int             `json:"pref,omitempty"`
+
+	VCardParams map[string]interface{} `json:"vCardParams,omitempty"`
+}
+
+// Resource is a resource referenced by URI: a Calendar, a SchedulingAddress,
+// a CryptoKey, a Directory, a Link or a Media, see RFC 9553 section 1.4.4.
+type Resource struct {
+	Type      string          `json:"@type"`
+	Kind      string          `json:"kind,omitempty"`
+	URI       string          `json:"uri"`
+	MediaType string          `json:"mediaType,omitempty"`
+	Contexts  map[string]bool `json:"contexts,omitempty"`
+	Pref      int             `json:"pref,omitempty"`
+
+	VCardParams map[string]interface{} `json:"vCardParams,omitempty"`
+}
+
+// Address is a postal address, see RFC 9553 section 2.5.1.
+type Address struct {
+	Type        string              `json:"@type"`
+	Components  []*AddressComponent `json:"components,omitempty"`
+	Full        string              `json:"full,omitempty"`
+	CountryCode string              `json:"countryCode,omitempty"`
+	Coordinates string              `json:"coordinates,omitempty"`
+	TimeZone    string              `json:"timeZone,omitempty"`
+	Contexts    map[string]bool     `json:"contexts,omitempty"`
+	Pref        int                 `json:"pref,omitempty"`
+
+	VCardParams map[string]interface{} `json:"vCardParams,omitempty"`
+}
+
+// AddressComponent is a component of a postal address.
+type AddressComponent struct {
+	Type  string `json:"@type"`
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+// Anniversary is a memorable date, see RFC 9553 section 2.8.1.
+type Anniversary struct {
+	Type string           `json:"@type"`
+	Kind string           `json:"kind"`
+	Date *AnniversaryDate `json:"date"`
+
+	VCardParams map[string]interface{} `json:"vCardParams,omitempty"`
+}
+
+// AnniversaryDate is the date of an anniversary: a PartialDate or a
+// Timestamp.
+type AnniversaryDate struct {
+	Type  string `json:"@type"`
+	Year  int    `json:"year,omitempty"`
+	Month int    `json:"month,omitempty"`
+	Day   int    `json:"day,omitempty"`
+	UTC   string `json:"utc,omitempty"`
+}
+
+// Note is a free-text note, see RFC 9553 section 2.8.3.
+type Note struct {
+	Type string `json:"@type"`
+	Note string `json:"note"`
+
+	VCardParams map[string]interface{} `json:"vCardParams,omitempty"`
+}
+
+var contactNameKinds = []string{"surname", "given", "given2", "title", "credential", "surname2", "generation"}
+
+var contactAddressKinds = []string{"postOfficeBox", "apartment", "name", "locality", "region", "postcode", "country"}
+
+var phoneFeatures = map[string]string{
+	"voice":       "voice",
+	"fax":         "fax",
+	"cell":        "mobile",
+	"video":       "video",
+	"pager":       "pager",
+	"textphone":   "textphone",
+	"text":        "text",
+	"main-number": "main-number",
+}
+
+var anniversaryKinds = map[string]string{
+	vcard.FieldBirthday:    "birth",
+	vcard.FieldAnniversary: "wedding",
+	fieldDeathDate:         "death",
+}
+
+// resourceFields maps vCard properties to the Card property, the type and
+// the kind of the resources they represent.
+var resourceFields = map[string]struct {
+	path, typ, kind string
+}{
+	vcard.FieldCalendarURI:        {"calendars", typeCalendar, "calendar"},
+	vcard.FieldFreeOrBusyURL:      {"calendars", typeCalendar, "freeBusy"},
+	vcard.FieldCalendarAddressURI: {"schedulingAddresses", typeSchedulingAddress, ""},
+	vcard.FieldKey:                {"cryptoKeys", typeCryptoKey, ""},
+	vcard.FieldSource:             {"directories", typeDirectory, "entry"},
+	fieldOrgDirectory:             {"directories", typeDirectory, "directory"},
+	vcard.FieldURL:                {"links", typeLink, ""},
+	fieldContactURI:               {"links", typeLink, "contact"},
+	vcard.FieldPhoto:              {"media", typeMedia, "photo"},
+	vcard.FieldLogo:               {"media", typeMedia, "logo"},
+	vcard.FieldSound:              {"media", typeMedia, "sound"},
+}
+
+// fieldParams contains the parameters of a vCard property which are common
+// to most JSContact objects.
+type fieldParams struct {
+	Contexts map[string]bool
+	Pref     int
+	// Types contains the TYPE values other than contexts.
+	Types  []string
+	Params vcard.Params
+}
+
+func parseFieldParams(field *vcard.Field) *fieldParams {
+	p := &fieldParams{Params: make(vcard.Params)}
+	for k, values := range fieldParamsWithGroup(field) {
+		switch k {
+		case vcard.ParamType:
+			for _, t := range values {
+				switch strings.ToLower(t) {
+				case "work":
+					p.addContext("work")
+				case "home":
+					p.addContext("private")
+				default:
+					p.Types = append(p.Types, t)
+				}
+			}
+			continue
+		case vcard.ParamPreferred:
+			if len(values) == 1 {
+				if pref, err := strconv.Atoi(values[0]); err == nil && pref >= 1 && pref <= 100 {
+					p.Pref = pref
+					continue
+				}
+			}
+		}
+		p.Params[k] = values
+	}
+	return p
+}
+
+// fieldParamsWithGroup returns the parameters of a property, with its group
+// stored like in jCard.
+func fieldParamsWithGroup(field *vcard.Field) vcard.Params {
+	params := make(vcard.Params, len(field.Params)+1)
+	for k, v := range field.Params {
+		params[k] = v
+	}
+	if field.Group != "" {
+		params[paramGroup] = []string{field.Group}
+	}
+	return params
+}
+
+func (p *fieldParams) addContext(ctx string) {
+	if p.Contexts == nil {
+		p.Contexts = make(map[string]bool)
+	}
+	p.Contexts[ctx] = true
+}
+
+// takeParam removes a parameter with a single value.
+func (p *fieldParams) takeParam(k string) string {
+	values := p.Params[k]
+	if len(values) != 1 {
+		return ""
+	}
+	delete(p.Params, k)
+	return values[0]
+}
+
+// vCardParams returns the unconverted parameters, including the TYPE values
+// other than contexts.
+func (p *fieldParams) vCardParams() map[string]interface{} {
+	params := make(vcard.Params, len(p.Params)+1)
+	for k, v := range p.Params {
+		params[k] = v
+	}
+	if len(p.Types) > 0 {
+		params[vcard.ParamType] = p.Types
+	}
+	return encodeParams(params)
+}
+
+// newField creates a vCard property. TYPE values are written in this order:
+// contexts, types, then the TYPE values of vCardParams.
+func newField(value string, contexts map[string]bool, pref int, types []string, vCardParams map[string]interface{}) (*vcard.Field, error) {
+	params, err := decodeParams(vCardParams)
+	if err != nil {
+		return nil, err
+	}
+	field := &vcard.Field{Value: value, Params: vcard.Params(params)}
+	if group := params[paramGroup]; len(group) == 1 {
+		field.Group = group[0]
+		delete(params, paramGroup)
+	}
+
+	var t []string
+	if contexts["work"] {
+		t = append(t, "work")
+	}
+	if contexts["private"] {
+		t = append(t, "home")
+	}
+	t = append(t, types...)
+	t = append(t, params[vcard.ParamType]...)
+	if len(t) > 0 {
+		field.Params[vcard.ParamType] = t
+	}
+	if pref != 0 {
+		field.Params.Set(vcard.ParamPreferred, strconv.Itoa(pref))
+	}
+	return field, nil
+}
+
+// splitStructured splits a structured vCard value on semicolons, and each
+// part on commas.
+func splitStructured(s string) [][]string {
+	var parts [][]string
+	for _, part := range splitEscaped(s, ';') {
+		part = strings.Replace(part, `\;`, ";", -1)
+		if part == "" {
+			parts = append(parts, nil)
+		} else {
+			parts = append(parts, strings.Split(part, ","))
+		}
+	}
+	return parts
+}
+
+// joinStructured is the reverse of splitStructured.
+func joinStructured(parts [][]string) string {
+	l := make([]string, len(parts))
+	for i, values := range parts {
+		escaped := make([]string, len(values))
+		for j, v := range values {
+			escaped[j] = strings.Replace(v, ";", `\;`, -1)
+		}
+		l[i] = strings.Join(escaped, ",")
+	}
+	return strings.Join(l, ";")
+}
+
+// cardConverter converts the properties of a vCard.
+type cardConverter struct {
+	card        *Card
+	ids         map[string]*idGenerator
+	unconverted vcard.Card
+}
+
+func newCardConverter() *cardConverter {
+	return &cardConverter{
+		card:        &Card{Type: typeCard, Version: cardVersion},
+		ids:         make(map[string]*idGenerator),
+		unconverted: make(vcard.Card),
+	}
+}
+
+// add adds an object to a map of the card, and returns its path. m is a
+// pointer to the map.
+func (conv *cardConverter) add(path string, m interface{}, obj interface{}) string {
+	if conv.ids[path] == nil {
+		conv.ids[path] = new(idGenerator)
+	}
+	id := conv.ids[path].next()
+
+	v := reflect.ValueOf(m).Elem()
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(v.Type()))
+	}
+	v.SetMapIndex(reflect.ValueOf(id), reflect.ValueOf(obj))
+	return path + "/" + id
+}
+
+// convert converts a vCard property. It returns the path of the object the
+// property was converted to, if any, and false if the property can't be
+// converted.
+func (conv *cardConverter) convert(name string, field *vcard.Field) (string, bool) {
+	c := conv.card
+
+	// Properties without parameters
+	var dst *string
+	switch name {
+	case vcard.FieldUID:
+		dst = &c.UID
+	case vcard.FieldProductID:
+		dst = &c.ProdID
+	case fieldLanguage:
+		dst = &c.Language
+	case vcard.FieldKind:
+		dst = &c.Kind
+	}
+	if dst != nil {
+		if len(field.Params) != 0 || field.Group != "" || *dst != "" {
+			return "", false
+		}
+		*dst = field.Value
+		if name == vcard.FieldKind {
+			*dst = strings.ToLower(field.Value)
+		}
+		return "", true
+	}
+
+	switch name {
+	case vcard.FieldRevision, fieldCreated:
+		if len(field.Params) != 0 || field.Group != "" || !strings.HasSuffix(field.Value, "Z") {
+			return "", false
+		}
+		v, err := formatDateTime(field.Value)
+		if err != nil {
+			return "", false
+		}
+		if name == vcard.FieldRevision {
+			c.Updated = v
+		} else {
+			c.Created = v
+		}
+		return "", true
+	case vcard.FieldMember:
+		if len(field.Params) != 0 || field.Group != "" {
+			return "", false
+		}
+		if c.Members == nil {
+			c.Members = make(map[string]bool)
+		}
+		c.Members[field.Value] = true
+		return "", true
+	case vcard.FieldRelated:
+		for k := range field.Params {
+			if k != vcard.ParamType {
+				return "", false
+			}
+		}
+		if field.Group != "" || c.RelatedTo[field.Value] != nil {
+			return "", false
+		}
+		rel := &Relation{Type: typeRelation}
+		for _, t := range field.Params[vcard.ParamType] {
+			if rel.Relation == nil {
+				rel.Relation = make(map[string]bool)
+			}
+			rel.Relation[strings.ToLower(t)] = true
+		}
+		if c.RelatedTo == nil {
+			c.RelatedTo = make(map[string]*Relation)
+		}
+		c.RelatedTo[field.Value] = rel
+		return "", true
+	case vcard.FieldCategories:
+		if len(field.Params) != 0 || field.Group != "" {
+			return "", false
+		}
+		if c.Keywords == nil {
+			c.Keywords = make(map[string]bool)
+		}
+		for _, k := range strings.Split(field.Value, ",") {
+			c.Keywords[k] = true
+		}
+		return "", true
+	case vcard.FieldFormattedName:
+		if c.Name != nil && c.Name.Full != "" {
+			return "", false
+		}
+		if c.Name == nil {
+			c.Name = &Name{Type: typeName}
+		}
+		c.Name.Full = field.Value
+		c.Name.VCardParams = encodeParams(fieldParamsWithGroup(field))
+		return namePathFull, true
+	case vcard.FieldName:
+		return "", conv.convertName(field)
+	}
+
+	p := parseFieldParams(field)
+	switch name {
+	case vcard.FieldNickname:
+		var path string
+		for _, nickname := range strings.Split(field.Value, ",") {
+			path = conv.add("nicknames", &c.Nicknames, &Nickname{
+				Type:        typeNickname,
+				Name:        nickname,
+				Contexts:    p.Contexts,
+				Pref:        p.Pref,
+				VCardParams: p.vCardParams(),
+			})
+		}
+		if strings.Contains(field.Value, ",") {
+			// Localizations only apply to a single nickname
+			path = ""
+		}
+		return path, true
+	case vcard.FieldOrganization:
+		parts := splitEscaped(field.Value, ';')
+		org := &Organization{
+			Type:        typeOrganization,
+			Name:        strings.Replace(parts[0], `\;`, ";", -1),
+			Contexts:    p.Contexts,
+			Pref:        p.Pref,
+			VCardParams: p.vCardParams(),
+		}
+		for _, unit := range parts[1:] {
+			org.Units = append(org.Units, &OrgUnit{Type: typeOrgUnit, Name: strings.Replace(unit, `\;`, ";", -1)})
+		}
+		return conv.add("organizations", &c.Organizations, org), true
+	case vcard.FieldTitle, vcard.FieldRole:
+		if p.Contexts != nil || p.Pref != 0 {
+			return "", false
+		}
+		return conv.add("titles", &c.Titles, &Title{
+			Type:        typeTitle,
+			Name:        field.Value,
+			Kind:        strings.ToLower(name),
+			VCardParams: p.vCardParams(),
+		}), true
+	case vcard.FieldEmail:
+		return conv.add("emails", &c.Emails, &EmailAddress{
+			Type:        typeEmailAddress,
+			Address:     field.Value,
+			Contexts:    p.Contexts,
+			Pref:        p.Pref,
+			VCardParams: p.vCardParams(),
+		}), true
+	case vcard.FieldTelephone:
+		phone := &Phone{
+			Type:     typePhone,
+			Number:   field.Value,
+			Contexts: p.Contexts,
+			Pref:     p.Pref,
+		}
+		var types []string
+		for _, t := range p.Types {
+			if feature, ok := phoneFeatures[strings.ToLower(t)]; ok {
+				if phone.Features == nil {
+					phone.Features = make(map[string]bool)
+				}
+				phone.Features[feature] = true
+			} else {
+				types = append(types, t)
+			}
+		}
+		p.Types = types
+		phone.VCardParams = p.vCardParams()
+		return conv.add("phones", &c.Phones, phone), true
+	case vcard.FieldIMPP:
+		return conv.add("onlineServices", &c.OnlineServices, &OnlineService{
+			Type:        typeOnlineService,
+			URI:         field.Value,
+			Contexts:    p.Contexts,
+			Pref:        p.Pref,
+			VCardParams: p.vCardParams(),
+		}), true
+	case vcard.FieldLanguage:
+		return conv.add("preferredLanguages", &c.PreferredLanguages, &LanguagePref{
+			Type:        typeLanguagePref,
+			Language:    field.Value,
+			Contexts:    p.Contexts,
+			Pref:        p.Pref,
+			VCardParams: p.vCardParams(),
+		}), true
+	case vcard.FieldAddress:
+		return conv.add("addresses", &c.Addresses, conv.address(field, p)), true
+	case vcard.FieldNote:
+		if p.Contexts != nil || p.Pref != 0 {
+			return "", false
+		}
+		return conv.add("notes", &c.Notes, &Note{
+			Type:        typeNote,
+			Note:        field.Value,
+			VCardParams: p.vCardParams(),
+		}), true
+	}
+
+	if kind, ok := anniversaryKinds[name]; ok {
+		date, ok := parseAnniversaryDate(field.Value)
+		if !ok || p.Contexts != nil || p.Pref != 0 {
+			return "", false
+		}
+		if strings.EqualFold(p.Params.Get(vcard.ParamValue), "text") {
+			return "", false
+		}
+		return conv.add("anniversaries", &c.Anniversaries, &Anniversary{
+			Type:        typeAnniversary,
+			Kind:        kind,
+			Date:        date,
+			VCardParams: p.vCardParams(),
+		}), true
+	}
+
+	if rf, ok := resourceFields[name]; ok {
+		res := &Resource{
+			Type:      rf.typ,
+			Kind:      rf.kind,
+			URI:       field.Value,
+			MediaType: p.takeParam(vcard.ParamMediaType),
+			Contexts:  p.Contexts,
+			Pref:      p.Pref,
+		}
+		res.VCardParams = p.vCardParams()
+		m := reflect.ValueOf(c).Elem().FieldByIndex(cardMapFields[rf.path]).Addr().Interface()
+		return conv.add(rf.path, m, res), true
+	}
+
+	return "", false
+}
+
+// cardMapFields contains the indices of the Card fields, by JSON name.
+var cardMapFields = func() map[string][]int {
+	m := make(map[string][]int)
+	t := reflect.TypeOf(Card{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		m[name] = f.Index
+	}
+	return m
+}()
+
+// convertName converts the N property. Sort names are converted for the
+// surname and the given name, other parameters aren't supported.
+func (conv *cardConverter) convertName(field *vcard.Field) bool {
+	c := conv.card
+	if c.Name != nil && c.Name.Components != nil {
+		return false
+	}
+	for k := range field.Params {
+		if k != vcard.ParamSortAs {
+			return false
+		}
+	}
+	sortAs := field.Params[vcard.ParamSortAs]
+	parts := splitStructured(field.Value)
+	if field.Group != "" || len(sortAs) > 2 || (len(parts) != 5 && len(parts) != len(contactNameKinds)) {
+		return false
+	}
+
+	if c.Name == nil {
+		c.Name = &Name{Type: typeName}
+	}
+	c.Name.Components = []*NameComponent{}
+	for i, values := range parts {
+		for _, v := range values {
+			c.Name.Components = append(c.Name.Components, &NameComponent{
+				Type:  typeNameComponent,
+				Kind:  contactNameKinds[i],
+				Value: v,
+			})
+		}
+	}
+	for i, v := range sortAs {
+		if c.Name.SortAs == nil {
+			c.Name.SortAs = make(map[string]string)
+		}
+		c.Name.SortAs[contactNameKinds[i]] = v
+	}
+	return true
+}
+
+func (conv *cardConverter) address(field *vcard.Field, p *fieldParams) *Address {
+	addr := &Address{
+		Type:        typeAddress,
+		Full:        p.takeParam(paramLabel),
+		CountryCode: p.takeParam(paramCountryCode),
+		Coordinates: p.takeParam(vcard.ParamGeolocation),
+		TimeZone:    p.takeParam(vcard.ParamTimezone),
+		Contexts:    p.Contexts,
+		Pref:        p.Pref,
+	}
+	for i, values := range splitStructured(field.Value) {
+		kind := contactAddressKinds[len(contactAddressKinds)-1]
+		if i < len(contactAddressKinds) {
+			kind = contactAddressKinds[i]
+		}
+		for _, v := range values {
+			addr.Components = append(addr.Components, &AddressComponent{
+				Type:  typeAddressComponent,
+				Kind:  kind,
+				Value: v,
+			})
+		}
+	}
+	addr.VCardParams = p.vCardParams()
+	return addr
+}
+
+func parseAnniversaryDate(s string) (*AnniversaryDate, bool) {
+	atoi := func(s string) int {
+		i, _ := strconv.Atoi(s)
+		return i
+	}
+	switch {
+	case len(s) == 8 && isDigits(s):
+		return &AnniversaryDate{Type: typePartialDate, Year: atoi(s[:4]), Month: atoi(s[4:6]), Day: atoi(s[6:])}, true
+	case len(s) == 4 && isDigits(s):
+		return &AnniversaryDate{Type: typePartialDate, Year: atoi(s)}, true
+	case len(s) == 7 && s[4] == '-' && isDigits(s[:4]) && isDigits(s[5:]):
+		return &AnniversaryDate{Type: typePartialDate, Year: atoi(s[:4]), Month: atoi(s[5:])}, true
+	case len(s) == 6 && strings.HasPrefix(s, "--") && isDigits(s[2:]):
+		return &AnniversaryDate{Type: typePartialDate, Month: atoi(s[2:4]), Day: atoi(s[4:])}, true
+	case len(s) == 5 && strings.HasPrefix(s, "---") && isDigits(s[3:]):
+		return &AnniversaryDate{Type: typePartialDate, Day: atoi(s[3:])}, true
+	case len(s) == 16 && strings.HasSuffix(s, "Z"):
+		utc, err := formatDateTime(s)
+		if err != nil {
+			return nil, false
+		}
+		return &AnniversaryDate{Type: typeTimestamp, UTC: utc}, true
+	}
+	return nil, false
+}
+
+func (date *AnniversaryDate) format() (string, error) {
+	if date.Type == typeTimestamp {
+		return parseDateTime(date.UTC, false)
+	}
+	switch {
+	case date.Year != 0 && date.Month != 0 && date.Day != 0:
+		return fmt.Sprintf("%04d%02d%02d", date.Year, date.Month, date.Day), nil
+	case date.Year != 0 && date.Month != 0:
+		return fmt.Sprintf("%04d-%02d", date.Year, date.Month), nil
+	case date.Year != 0 && date.Day == 0:
+		return fmt.Sprintf("%04d", date.Year), nil
+	case date.Year == 0 && date.Month != 0 && date.Day != 0:
+		return fmt.Sprintf("--%02d%02d", date.Month, date.Day), nil
+	case date.Year == 0 && date.Month == 0 && date.Day != 0:
+		return fmt.Sprintf("---%02d", date.Day), nil
+	}
+	return "", fmt.Errorf("jsmodel: invalid partial date %+v", date)
+}
+
+// localizedVariant is a vCard property which is the variant of another one in
+// another language, as indicated by the ALTID parameter.
+type localizedVariant struct {
+	name     string
+	field    *vcard.Field
+	path     string
+	language string
+}
+
+// FromVCard converts a card to a JSContact card. Cards which aren't vCard 4.0
+// are converted with carddav.ConvertCard first.
+//
+// Properties which share an ALTID parameter with a property converted to a
+// JSContact object are converted to localizations of that object.
+func FromVCard(card vcard.Card) (*Card, error) {
+	if card.Value(vcard.FieldVersion) != "4.0" {
+		var err error
+		if card, err = carddav.ConvertCard(card, "4.0"); err != nil {
+			return nil, err
+		}
+	}
+
+	conv := newCardConverter()
+	var variants []localizedVariant
+	for _, name := range sortedFieldNames(card) {
+		if name == vcard.FieldVersion {
+			continue
+		}
+
+		// Paths and languages of the properties with an ALTID parameter
+		paths := make(map[string]string)
+		languages := make(map[string]map[string]bool)
+		for _, field := range card[name] {
+			altID := field.Params.Get(vcard.ParamAltID)
+			lang := field.Params.Get(vcard.ParamLanguage)
+			if path, ok := paths[altID]; ok && altID != "" && lang != "" && !languages[altID][lang] && isLocalizable(path, field) {
+				languages[altID][lang] = true
+				variants = append(variants, localizedVariant{name, field, path, lang})
+				continue
+			}
+
+			path, ok := conv.convert(name, field)
+			if !ok {
+				conv.unconverted.Add(name, field)
+				continue
+			}
+			if _, ok := paths[altID]; !ok && altID != "" && path != "" {
+				paths[altID] = path
+				languages[altID] = map[string]bool{lang: true}
+			}
+		}
+	}
+
+	for _, variant := range variants {
+		if err := conv.localize(variant); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(conv.unconverted) > 0 {
+		var err error
+		if conv.card.VCardProps, err = encodeVCardProps(conv.unconverted); err != nil {
+			return nil, err
+		}
+	}
+	return conv.card, nil
+}
+
+// isLocalizable checks whether a property can be converted to a localization
+// of the object at path. The localization of a full name only contains a
+// string, so the property can't have parameters other than ALTID and
+// LANGUAGE.
+func isLocalizable(path string, field *vcard.Field) bool {
+	if path != namePathFull {
+		return true
+	}
+	return len(field.Params) == 2 && field.Group == ""
+}
+
+func (conv *cardConverter) localize(variant localizedVariant) error {
+	field := &vcard.Field{
+		Value:  variant.field.Value,
+		Params: make(vcard.Params, len(variant.field.Params)),
+		Group:  variant.field.Group,
+	}
+	for k, v := range variant.field.Params {
+		if k != vcard.ParamLanguage {
+			field.Params[k] = v
+		}
+	}
+
+	tmp := newCardConverter()
+	path, ok := tmp.convert(variant.name, field)
+	if !ok || path == "" {
+		conv.unconverted.Add(variant.name, variant.field)
+		return nil
+	}
+	m, err := toJSONMap(tmp.card)
+	if err != nil {
+		return err
+	}
+	var v interface{} = m
+	for _, k := range strings.Split(path, "/") {
+		v = v.(map[string]interface{})[k]
+	}
+
+	c := conv.card
+	if c.Localizations == nil {
+		c.Localizations = make(map[string]PatchObject)
+	}
+	if c.Localizations[variant.language] == nil {
+		c.Localizations[variant.language] = make(PatchObject)
+	}
+	c.Localizations[variant.language][variant.path] = v
+	return nil
+}
+
+// VCard converts a JSContact card to a vCard 4.0 card.
+func (c *Card) VCard() (vcard.Card, error) {
+	card := make(vcard.Card)
+	card.SetValue(vcard.FieldVersion, "4.0")
+
+	for name, v := range map[string]string{
+		vcard.FieldUID:       c.UID,
+		vcard.FieldProductID: c.ProdID,
+		fieldLanguage:        c.Language,
+		vcard.FieldKind:      c.Kind,
+	} {
+		if v != "" {
+			card.SetValue(name, v)
+		}
+	}
+	for name, v := range map[string]string{
+		vcard.FieldRevision: c.Updated,
+		fieldCreated:        c.Created,
+	} {
+		if v == "" {
+			continue
+		}
+		ts, err := parseDateTime(v, false)
+		if err != nil {
+			return nil, err
+		}
+		card.SetValue(name, ts)
+	}
+	for _, member := range sortedSet(c.Members) {
+		card.AddValue(vcard.FieldMember, member)
+	}
+	for _, uri := range sortedSet(c.RelatedTo) {
+		field := &vcard.Field{Value: uri, Params: make(vcard.Params)}
+		if rel := c.RelatedTo[uri]; rel != nil && len(rel.Relation) > 0 {
+			field.Params[vcard.ParamType] = sortedSet(rel.Relation)
+		}
+		card.Add(vcard.FieldRelated, field)
+	}
+	if len(c.Keywords) > 0 {
+		card.SetValue(vcard.FieldCategories, strings.Join(sortedSet(c.Keywords), ","))
+	}
+
+	localized := 0
+	addLocalizations := func(path string, toField func(interface{}) (string, *vcard.Field, error)) error {
+		for _, lang := range sortedKeys(c.Localizations) {
+			v, ok := c.Localizations[lang][path]
+			if !ok {
+				continue
+			}
+			name, field, err := toField(v)
+			if err != nil {
+				return err
+			}
+			field.Params.Set(vcard.ParamLanguage, lang)
+			card.Add(name, field)
+			localized++
+		}
+		return nil
+	}
+
+	if name := c.Name; name != nil {
+		if err := c.nameFields(card, addLocalizations); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, path := range cardObjectPaths {
+		m := reflect.ValueOf(c).Elem().FieldByIndex(cardMapFields[path])
+		for _, id := range sortedKeys(m.Interface()) {
+			obj := m.MapIndex(reflect.ValueOf(id))
+			if obj.IsNil() {
+				continue
+			}
+			name, field, err := obj.Interface().(cardObject).field()
+			if err != nil {
+				return nil, err
+			}
+			card.Add(name, field)
+
+			err = addLocalizations(path+"/"+id, func(v interface{}) (string, *vcard.Field, error) {
+				variant := reflect.New(obj.Type().Elem())
+				if err := fromJSONValue(v, variant.Interface()); err != nil {
+					return "", nil, err
+				}
+				return variant.Interface().(cardObject).field()
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	total := 0
+	for _, patch := range c.Localizations {
+		total += len(patch)
+	}
+	if localized != total {
+		return nil, fmt.Errorf("jsmodel: unsupported localizations")
+	}
+
+	if len(c.VCardProps) > 0 {
+		props, err := decodeVCardProps(c.VCardProps)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range sortedFieldNames(props) {
+			for _, field := range props[name] {
+				card.Add(name, field)
+			}
+		}
+	}
+
+	return card, nil
+}
+
+func (c *Card) nameFields(card vcard.Card, addLocalizations func(string, func(interface{}) (string, *vcard.Field, error)) error) error {
+	name := c.Name
+	if name.Full != "" {
+		field, err := newField(name.Full, nil, 0, nil, name.VCardParams)
+		if err != nil {
+			return err
+		}
+		card.Add(vcard.FieldFormattedName, field)
+
+		altID := field.Params.Get(vcard.ParamAltID)
+		err = addLocalizations(namePathFull, func(v interface{}) (string, *vcard.Field, error) {
+			s, ok := v.(string)
+			if !ok || altID == "" {
+				return "", nil, fmt.Errorf("jsmodel: invalid localization of %v", namePathFull)
+			}
+			field := &vcard.Field{Value: s, Params: make(vcard.Params)}
+			field.Params.Set(vcard.ParamAltID, altID)
+			return vcard.FieldFormattedName, field, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if name.Components == nil {
+		return nil
+	}
+	n := 5
+	parts := make([][]string, len(contactNameKinds))
+	for _, comp := range name.Components {
+		i := indexOf(contactNameKinds, comp.Kind)
+		if i < 0 {
+			return fmt.Errorf("jsmodel: unsupported name component kind %q", comp.Kind)
+		} else if i >= n {
+			n = len(contactNameKinds)
+		}
+		parts[i] = append(parts[i], comp.Value)
+	}
+	field := &vcard.Field{Value: joinStructured(parts[:n]), Params: make(vcard.Params)}
+	if len(name.SortAs) > 0 {
+		sortAs := []string{name.SortAs["surname"]}
+		if given, ok := name.SortAs["given"]; ok {
+			sortAs = append(sortAs, given)
+		}
+		field.Params[vcard.ParamSortAs] = sortAs
+	}
+	card.Add(vcard.FieldName, field)
+	return nil
+}
+
+func indexOf(l []string, s string) int {
+	for i, v := range l {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// cardObjectPaths lists the Card properties containing objects converted
+// from vCard properties, in the order they are converted back.
+var cardObjectPaths = []string{
+	"nicknames",
+	"organizations",
+	"titles",
+	"emails",
+	"phones",
+	"onlineServices",
+	"preferredLanguages",
+	"calendars",
+	"schedulingAddresses",
+	"addresses",
+	"cryptoKeys",
+	"directories",
+	"links",
+	"media",
+	"anniversaries",
+	"notes",
+}
+
+// cardObject is a JSContact object converted from a vCard property.
+type cardObject interface {
+	field() (string, *vcard.Field, error)
+}
+
+func (nickname *Nickname) field() (string, *vcard.Field, error) {
+	field, err := newField(nickname.Name, nickname.Contexts, nickname.Pref, nil, nickname.VCardParams)
+	return vcard.FieldNickname, field, err
+}
+
+func (org *Organization) field() (string, *vcard.Field, error) {
+	parts := [][]string{{org.Name}}
+	for _, unit := range org.Units {
+		parts = append(parts, []string{unit.Name})
+	}
+	field, err := newField(joinStructured(parts), org.Contexts, org.Pref, nil, org.VCardParams)
+	return vcard.FieldOrganization, field, err
+}
+
+func (title *Title) field() (string, *vcard.Field, error) {
+	name := vcard.FieldTitle
+	if title.Kind == "role" {
+		name = vcard.FieldRole
+	}
+	field, err := newField(title.Name, nil, 0, nil, title.VCardParams)
+	return name, field, err
+}
+
+func (email *EmailAddress) field() (string, *vcard.Field, error) {
+	field, err := newField(email.Address, email.Contexts, email.Pref, nil, email.VCardParams)
+	return vcard.FieldEmail, field, err
+}
+
+func (phone *Phone) field() (string, *vcard.Field, error) {
+	features := sortedSet(phoneFeatureTypes(phone.Features))
+	field, err := newField(phone.Number, phone.Contexts, phone.Pref, features, phone.VCardParams)
+	return vcard.FieldTelephone, field, err
+}
+
+func phoneFeatureTypes(features map[string]bool) map[string]bool {
+	types := make(map[string]bool, len(features))
+	for t, feature := range phoneFeatures {
+		if features[feature] {
+			types[t] = true
+		}
+	}
+	return types
+}
+
+func (service *OnlineService) field() (string, *vcard.Field, error) {
+	field, err := newField(service.URI, service.Contexts, service.Pref, nil, service.VCardParams)
+	return vcard.FieldIMPP, field, err
+}
+
+func (lang *LanguagePref) field() (string, *vcard.Field, error) {
+	field, err := newField(lang.Language, lang.Contexts, lang.Pref, nil, lang.VCardParams)
+	return vcard.FieldLanguage, field, err
+}
+
+func (res *Resource) field() (string, *vcard.Field, error) {
+	var name string
+	for k, rf := range resourceFields {
+		if rf.typ == res.Type && rf.kind == res.Kind {
+			name = k
+		}
+	}
+	if name == "" {
+		return "", nil, fmt.Errorf("jsmodel: unsupported %v kind %q", res.Type, res.Kind)
+	}
+	field, err := newField(res.URI, res.Contexts, res.Pref, nil, res.VCardParams)
+	if err == nil && res.MediaType != "" {
+		field.Params.Set(vcard.ParamMediaType, res.MediaType)
+	}
+	return name, field, err
+}
+
+func (addr *Address) field() (string, *vcard.Field, error) {
+	parts := make([][]string, len(contactAddressKinds))
+	for _, comp := range addr.Components {
+		i := indexOf(contactAddressKinds, comp.Kind)
+		if i < 0 {
+			// Address components introduced by RFC 9554 are part of the
+			// street address in vCard 4.0
+			i = indexOf(contactAddressKinds, "name")
+		}
+		parts[i] = append(parts[i], comp.Value)
+	}
+	field, err := newField(joinStructured(parts), addr.Contexts, addr.Pref, nil, addr.VCardParams)
+	if err != nil {
+		return "", nil, err
+	}
+	for k, v := range map[string]string{
+		paramLabel:             addr.Full,
+		paramCountryCode:       addr.CountryCode,
+		vcard.ParamGeolocation: addr.Coordinates,
+		vcard.ParamTimezone:    addr.TimeZone,
+	} {
+		if v != "" {
+			field.Params.Set(k, v)
+		}
+	}
+	return vcard.FieldAddress, field, nil
+}
+
+func (anniversary *Anniversary) field() (string, *vcard.Field, error) {
+	var name string
+	for k, kind := range anniversaryKinds {
+		if kind == anniversary.Kind {
+			name = k
+		}
+	}
+	if name == "" || anniversary.Date == nil {
+		return "", nil, fmt.Errorf("jsmodel: unsupported anniversary kind %q", anniversary.Kind)
+	}
+	v, err := anniversary.Date.format()
+	if err != nil {
+		return "", nil, err
+	}
+	field, err := newField(v, nil, 0, nil, anniversary.VCardParams)
+	return name, field, err
+}
+
+func (note *Note) field() (string, *vcard.Field, error) {
+	field, err := newField(note.Note, nil, 0, nil, note.VCardParams)
+	return vcard.FieldNote, field, err
+}
+
+// fromJSONValue converts a generic JSON value to a value.
+func fromJSONValue(v interface{}, dst interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, dst)
+}
+
+// encodeVCardProps converts properties to the jCard format.
+func encodeVCardProps(props vcard.Card) ([]interface{}, error) {
+	card := make(vcard.Card, len(props)+1)
+	for name, fields := range props {
+		card[name] = fields
+	}
+	card.SetValue(vcard.FieldVersion, "4.0")
+
+	var buf bytes.Buffer
+	if err := carddav.EncodeJCard(&buf, card); err != nil {
+		return nil, err
+	}
+	var v []interface{}
+	if err := unmarshalJSON(buf.Bytes(), &v); err != nil {
+		return nil, err
+	}
+	// Strip the VERSION property
+	return v[1].([]interface{})[1:], nil
+}
+
+// decodeVCardProps converts properties in the jCard format.
+func decodeVCardProps(props []interface{}) (vcard.Card, error) {
+	b, err := json.Marshal([]interface{}{"vcard", props})
+	if err != nil {
+		return nil, err
+	}
+	return carddav.DecodeJCard(bytes.NewReader(b))
+}
+
+func sortedFieldNames(card vcard.Card) []string {
+	return sortedSet(card)
+}
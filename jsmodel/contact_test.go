@@ -0,0 +1,190 @@
+package jsmodel
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-vcard"
+)
+
+// testCards are the cards used by the CardDAV filter tests.
+var testCards = []struct {
+	name string
+	data string
+}{
+	{"alice", `BEGIN:VCARD
+VERSION:4.0
+UID:urn:uuid:4fbe8971-0bc3-424c-9c26-36c3e1eff6b1
+FN;PID=1.1:Alice Gopher
+N:Gopher;Alice;;;
+EMAIL;PID=1.1:alice@example.com
+CLIENTPIDMAP:1;urn:uuid:53e374d9-337e-4727-8803-a1e9c14e0551
+END:VCARD`},
+	{"bob", `BEGIN:VCARD
+VERSION:4.0
+UID:urn:uuid:4fbe8971-0bc3-424c-9c26-36c3e1eff6b2
+FN;PID=1.1:Bob Gopher
+N:Gopher;Bob;;;
+EMAIL;PID=1.1:bob@example.com
+CLIENTPIDMAP:1;urn:uuid:53e374d9-337e-4727-8803-a1e9c14e0552
+END:VCARD`},
+	{"carla", `BEGIN:VCARD
+VERSION:4.0
+UID:urn:uuid:4fbe8971-0bc3-424c-9c26-36c3e1eff6b3
+FN;PID=1.1:Carla Gopher
+N:Gopher;Carla;;;
+EMAIL;PID=1.1:carla@example.com
+CLIENTPIDMAP:1;urn:uuid:53e374d9-337e-4727-8803-a1e9c14e0553
+END:VCARD`},
+	{"carlaFiltered", `BEGIN:VCARD
+VERSION:4.0
+UID:urn:uuid:4fbe8971-0bc3-424c-9c26-36c3e1eff6b3
+EMAIL;PID=1.1:carla@example.com
+END:VCARD`},
+	{"dave", `BEGIN:VCARD
+VERSION:4.0
+UID:urn:uuid:4fbe8971-0bc3-424c-9c26-36c3e1eff6b4
+FN:Dave Gopher
+EMAIL;TYPE=home:dave@example.com
+EMAIL;TYPE=work,pref:dave@example.org
+END:VCARD`},
+	{"localized", localizedCardData},
+}
+
+const localizedCardData = `BEGIN:VCARD
+VERSION:4.0
+UID:urn:uuid:4fbe8971-0bc3-424c-9c26-36c3e1eff6b5
+KIND:individual
+FN;ALTID=1:Erin Gopher
+FN;ALTID=1;LANGUAGE=fr:Erin la Gopher
+N;SORT-AS=Gopher,Erin:Gopher;Erin;;Dr.,Prof.;
+NICKNAME:Gophy
+ORG:Example Inc.;Research\; Development
+TITLE;ALTID=2;LANGUAGE=en:Research Scientist
+TITLE;ALTID=2;LANGUAGE=fr:Chercheuse
+ROLE:Lead
+TEL;VALUE=uri;TYPE=work,voice;PREF=1:tel:+1-555-555-5555
+item1.EMAIL;TYPE=work:erin@example.org
+IMPP;PREF=1:xmpp:erin@example.org
+LANG;PREF=1:fr
+ADR;TYPE=work;CC=US;LABEL=100 Waters Edge:;;100 Waters Edge;Baytown;LA;30314;United States of America
+BDAY:--0412
+ANNIVERSARY:20090808T1430-0500
+REV:20230101T120000Z
+URL:https://example.org/erin
+PHOTO;MEDIATYPE=image/jpeg:https://example.org/erin.jpg
+RELATED;TYPE=friend:urn:uuid:4fbe8971-0bc3-424c-9c26-36c3e1eff6b4
+CATEGORIES:gophers
+NOTE:Likes burrowing\, and digging
+GENDER:F
+X-EXAMPLE-FLAG:on
+END:VCARD`
+
+func decodeTestCard(t *testing.T, s string) vcard.Card {
+	card, err := vcard.NewDecoder(strings.NewReader(s)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return card
+}
+
+func encodeTestCard(t *testing.T, card vcard.Card) string {
+	var buf bytes.Buffer
+	if err := vcard.NewEncoder(&buf).Encode(card); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestCardRoundTrip(t *testing.T) {
+	for _, tc := range testCards {
+		t.Run(tc.name, func(t *testing.T) {
+			card := decodeTestCard(t, tc.data)
+
+			c, err := FromVCard(card)
+			if err != nil {
+				t.Fatalf("FromVCard() = %v", err)
+			}
+
+			b, err := json.Marshal(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var decoded Card
+			if err := json.Unmarshal(b, &decoded); err != nil {
+				t.Fatalf("json.Unmarshal() = %v", err)
+			}
+
+			out, err := decoded.VCard()
+			if err != nil {
+				t.Fatalf("VCard() = %v", err)
+			}
+			got, want := encodeTestCard(t, out), encodeTestCard(t, card)
+			if got != want {
+				t.Errorf("round-tripped card = \n%v\nwant\n%v\nJSContact:\n%s", got, want, b)
+			}
+		})
+	}
+}
+
+func TestFromVCard(t *testing.T) {
+	c, err := FromVCard(decodeTestCard(t, localizedCardData))
+	if err != nil {
+		t.Fatalf("FromVCard() = %v", err)
+	}
+
+	if c.Type != "Card" || c.Version != "1.0" || c.Kind != "individual" || c.Updated != "2023-01-01T12:00:00Z" {
+		t.Errorf("card = %+v", c)
+	}
+	if c.Name == nil || c.Name.Full != "Erin Gopher" || len(c.Name.Components) != 4 || c.Name.SortAs["given"] != "Erin" {
+		t.Errorf("name = %+v", c.Name)
+	}
+	if v := c.Localizations["fr"]["name/full"]; v != "Erin la Gopher" {
+		t.Errorf("French full name = %v", v)
+	}
+	if v, ok := c.Localizations["fr"]["titles/2"].(map[string]interface{}); !ok || v["name"] != "Chercheuse" {
+		t.Errorf("French title = %v", c.Localizations["fr"]["titles/2"])
+	}
+	if org := c.Organizations["1"]; org == nil || org.Name != "Example Inc." || len(org.Units) != 1 || org.Units[0].Name != "Research; Development" {
+		t.Errorf("organization = %+v", org)
+	}
+	if phone := c.Phones["1"]; phone == nil || !phone.Features["voice"] || !phone.Contexts["work"] || phone.Pref != 1 {
+		t.Errorf("phone = %+v", phone)
+	}
+	if email := c.Emails["1"]; email == nil || email.Address != "erin@example.org" || email.VCardParams["group"] != "item1" {
+		t.Errorf("email = %+v", email)
+	}
+	if addr := c.Addresses["1"]; addr == nil || addr.CountryCode != "US" || addr.Full != "100 Waters Edge" || len(addr.Components) != 5 {
+		t.Errorf("address = %+v", addr)
+	}
+	if bday := c.Anniversaries["1"]; bday == nil || bday.Kind != "birth" || bday.Date.Month != 4 || bday.Date.Day != 12 {
+		t.Errorf("birthday = %+v", bday)
+	}
+	if media := c.Media["1"]; media == nil || media.Kind != "photo" || media.MediaType != "image/jpeg" {
+		t.Errorf("media = %+v", media)
+	}
+	if rel := c.RelatedTo["urn:uuid:4fbe8971-0bc3-424c-9c26-36c3e1eff6b4"]; rel == nil || !rel.Relation["friend"] {
+		t.Errorf("relatedTo = %+v", c.RelatedTo)
+	}
+	if len(c.VCardProps) != 3 {
+		t.Errorf("vCardProps = %v, want ANNIVERSARY, GENDER and X-EXAMPLE-FLAG", c.VCardProps)
+	}
+}
+
+func TestFromVCard_v3(t *testing.T) {
+	c, err := FromVCard(decodeTestCard(t, `BEGIN:VCARD
+VERSION:3.0
+UID:urn:uuid:4fbe8971-0bc3-424c-9c26-36c3e1eff6b6
+FN:Frank Gopher
+N:Gopher;Frank;;;
+EMAIL;TYPE=INTERNET,HOME:frank@example.com
+END:VCARD`))
+	if err != nil {
+		t.Fatalf("FromVCard() = %v", err)
+	}
+	if email := c.Emails["1"]; email == nil || email.Address != "frank@example.com" || !email.Contexts["private"] {
+		t.Errorf("email = %+v", email)
+	}
+}
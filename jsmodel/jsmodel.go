@@ -0,0 +1,219 @@
+// Package jsmodel converts iCalendar and vCard data to the JSCalendar and
+// JSContact object models, and back.
+//
+// JSCalendar is defined in RFC 8984 and JSContact in RFC 9553. Calendar data
+// converts to a Group containing Event and Task objects, address data to a
+// Card object.
+//
+// Properties which have no equivalent in the object models are kept in the
+// iCalProps and vCardProps properties of the objects, in the jCal and jCard
+// formats. Like in RFC 9555, parameters which have no equivalent are kept in
+// the iCalParams and vCardParams properties. This makes conversions lossless
+// for most iCalendar and vCard data.
+//
+// Localizations of calendar objects have no iCalendar equivalent: they are
+// kept in JSPROP properties, as in the JSCalendar to iCalendar mapping.
+// Localizations of cards are converted to properties sharing an ALTID
+// parameter.
+package jsmodel
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PatchObject is a patch object, as defined in RFC 8984 section 1.4.9. Keys
+// are JSON pointers, relative to the patched object, with the leading slash
+// omitted. A nil value removes the property.
+type PatchObject map[string]interface{}
+
+// applyPatch applies a patch to an object decoded into a generic JSON value.
+func applyPatch(obj map[string]interface{}, patch PatchObject) error {
+	for path, v := range patch {
+		keys := strings.Split(path, "/")
+		m := obj
+		for _, k := range keys[:len(keys)-1] {
+			k = unescapePointer(k)
+			child, ok := m[k].(map[string]interface{})
+			if !ok {
+				if _, exists := m[k]; exists {
+					return fmt.Errorf("jsmodel: invalid patch path %q", path)
+				}
+				child = make(map[string]interface{})
+				m[k] = child
+			}
+			m = child
+		}
+		k := unescapePointer(keys[len(keys)-1])
+		if v == nil {
+			delete(m, k)
+		} else {
+			m[k] = v
+		}
+	}
+	return nil
+}
+
+var pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+
+func unescapePointer(s string) string {
+	return pointerUnescaper.Replace(s)
+}
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+func escapePointer(s string) string {
+	return pointerEscaper.Replace(s)
+}
+
+// toJSONMap converts a value to a generic JSON object.
+func toJSONMap(v interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := unmarshalJSON(b, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// fromJSONMap converts a generic JSON object to a value.
+func fromJSONMap(m map[string]interface{}, v interface{}) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// unmarshalJSON decodes JSON data, keeping numbers as json.Number values so
+// that they are re-encoded verbatim.
+func unmarshalJSON(b []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// sortedIDs returns the keys of a map of objects in a stable order. Numeric
+// identifiers, as generated by the conversion functions, are sorted by value.
+func sortedIDs(ids []string) []string {
+	sort.Slice(ids, func(i, j int) bool {
+		if len(ids[i]) != len(ids[j]) {
+			return len(ids[i]) < len(ids[j])
+		}
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+// idGenerator generates the identifiers of the objects of a map.
+type idGenerator int
+
+func (g *idGenerator) next() string {
+	*g++
+	return strconv.Itoa(int(*g))
+}
+
+// encodeParams converts parameters to the representation used in
+// iCalParams and vCardParams: names are lowercase, values with a single
+// element are strings.
+func encodeParams(params map[string][]string) map[string]interface{} {
+	if len(params) == 0 {
+		return nil
+	}
+	m := make(map[string]interface{}, len(params))
+	for k, values := range params {
+		if len(values) == 1 {
+			m[strings.ToLower(k)] = values[0]
+		} else {
+			l := make([]string, len(values))
+			copy(l, values)
+			m[strings.ToLower(k)] = l
+		}
+	}
+	return m
+}
+
+// decodeParams is the reverse of encodeParams.
+func decodeParams(m map[string]interface{}) (map[string][]string, error) {
+	params := make(map[string][]string, len(m))
+	for k, v := range m {
+		switch v := v.(type) {
+		case string:
+			params[strings.ToUpper(k)] = []string{v}
+		case []string:
+			params[strings.ToUpper(k)] = v
+		case []interface{}:
+			l := make([]string, len(v))
+			for i, v := range v {
+				s, ok := v.(string)
+				if !ok {
+					return nil, fmt.Errorf("jsmodel: invalid value for parameter %q", k)
+				}
+				l[i] = s
+			}
+			params[strings.ToUpper(k)] = l
+		default:
+			return nil, fmt.Errorf("jsmodel: invalid value for parameter %q", k)
+		}
+	}
+	return params, nil
+}
+
+// formatDateTime converts a date or date-time in the iCalendar and vCard
+// basic format, e.g. "20060102T150405", to the JSCalendar and JSContact
+// extended format, e.g. "2006-01-02T15:04:05". A trailing "Z" is kept.
+// Dates are converted to the start of the day.
+func formatDateTime(s string) (string, error) {
+	utc := strings.HasSuffix(s, "Z")
+	s = strings.TrimSuffix(s, "Z")
+	date, t := s, "000000"
+	if i := strings.IndexByte(s, 'T'); i >= 0 {
+		date, t = s[:i], s[i+1:]
+	}
+	if len(date) != 8 || len(t) != 6 || !isDigits(date) || !isDigits(t) {
+		return "", fmt.Errorf("jsmodel: invalid date-time %q", s)
+	}
+	v := date[:4] + "-" + date[4:6] + "-" + date[6:] + "T" + t[:2] + ":" + t[2:4] + ":" + t[4:]
+	if utc {
+		v += "Z"
+	}
+	return v, nil
+}
+
+// parseDateTime is the reverse of formatDateTime. If dateOnly is set, the
+// time is omitted.
+func parseDateTime(s string, dateOnly bool) (string, error) {
+	utc := strings.HasSuffix(s, "Z")
+	s = strings.TrimSuffix(s, "Z")
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		// Fractional seconds aren't supported by iCalendar and vCard
+		s = s[:i]
+	}
+	v := strings.Replace(strings.Replace(s, "-", "", -1), ":", "", -1)
+	if len(v) != 15 || v[8] != 'T' || !isDigits(v[:8]) || !isDigits(v[9:]) {
+		return "", fmt.Errorf("jsmodel: invalid date-time %q", s)
+	}
+	if dateOnly {
+		return v[:8], nil
+	}
+	if utc {
+		v += "Z"
+	}
+	return v, nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,262 @@
+package webdav
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-webdav/internal"
+)
+
+// Lock describes a WebDAV lock, as defined in RFC 4918 section 6.
+type Lock struct {
+	// Token is the lock token, a URI uniquely identifying the lock. It's
+	// generated by the LockSystem when the lock is created.
+	Token string
+	// Root is the path of the locked resource.
+	Root string
+	// Shared indicates a shared lock. Exclusive locks are used otherwise.
+	Shared bool
+	// Recursive indicates that the lock applies to all members of the locked
+	// collection ("Depth: infinity").
+	Recursive bool
+	// Owner holds the raw XML describing the lock owner, as supplied by the
+	// client.
+	Owner string
+	// Timeout is the remaining lifetime of the lock. Zero means infinite.
+	Timeout time.Duration
+}
+
+// LockSystem manages WebDAV locks.
+//
+// Paths are compared after cleaning: trailing slashes are not significant.
+type LockSystem interface {
+	// Create creates a new lock. Lock.Token is ignored and filled in by the
+	// lock system. A 423 Locked HTTP error is returned if the lock conflicts
+	// with an existing one.
+	Create(ctx context.Context, lock *Lock) (*Lock, error)
+	// Refresh resets the timeout of an existing lock applying to name.
+	Refresh(ctx context.Context, name, token string, timeout time.Duration) (*Lock, error)
+	// Unlock removes an existing lock applying to name.
+	Unlock(ctx context.Context, name, token string) error
+	// Locks returns the locks applying to name: locks rooted at name and
+	// recursive locks rooted at one of its ancestors. If recursive is set,
+	// locks rooted at one of its descendants are returned as well.
+	Locks(ctx context.Context, name string, recursive bool) ([]Lock, error)
+}
+
+// lockApplies reports whether a lock applies to name.
+func lockApplies(lock *Lock, name string) bool {
+	root := path.Clean(lock.Root)
+	name = path.Clean(name)
+	if root == name {
+		return true
+	}
+	return lock.Recursive && isDescendant(root, name)
+}
+
+// isDescendant reports whether name is a strict descendant of root. Both
+// paths must be clean.
+func isDescendant(root, name string) bool {
+	if root == "/" {
+		return name != "/"
+	}
+	return strings.HasPrefix(name, root+"/")
+}
+
+func newLockToken() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // variant 10
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+type memLock struct {
+	Lock
+	expires time.Time
+}
+
+func (l *memLock) expired(now time.Time) bool {
+	return !l.expires.IsZero() && !now.Before(l.expires)
+}
+
+func (l *memLock) snapshot(now time.Time) Lock {
+	lock := l.Lock
+	if !l.expires.IsZero() {
+		lock.Timeout = l.expires.Sub(now)
+	}
+	return lock
+}
+
+const (
+	// defaultLockTimeout is the timeout of locks created or refreshed by
+	// clients which request an infinite timeout or don't request any.
+	defaultLockTimeout = time.Hour
+	// maxLockTimeout is the maximum timeout of locks.
+	maxLockTimeout = 24 * time.Hour
+)
+
+// lockTimeout returns the timeout applied to a lock when a client requests
+// timeout. RFC 4918 section 10.7 allows servers to pick a different timeout,
+// so that abandoned locks eventually expire.
+func lockTimeout(timeout time.Duration) time.Duration {
+	switch {
+	case timeout <= 0:
+		return defaultLockTimeout
+	case timeout > maxLockTimeout:
+		return maxLockTimeout
+	}
+	return timeout
+}
+
+type memLockSystem struct {
+	mutex sync.Mutex
+	locks map[string]*memLock
+}
+
+// NewMemLockSystem returns a LockSystem keeping locks in memory. Locks are
+// lost when the process exits.
+//
+// Locks never have an infinite timeout: locks without a timeout expire after
+// an hour, and timeouts are capped to a day.
+func NewMemLockSystem() LockSystem {
+	return &memLockSystem{locks: make(map[string]*memLock)}
+}
+
+var _ LockSystem = (*memLockSystem)(nil)
+
+// collect removes expired locks. The caller must hold the mutex.
+func (ls *memLockSystem) collect(now time.Time) {
+	for token, l := range ls.locks {
+		if l.expired(now) {
+			delete(ls.locks, token)
+		}
+	}
+}
+
+func (ls *memLockSystem) Create(ctx context.Context, lock *Lock) (*Lock, error) {
+	ls.mutex.Lock()
+	defer ls.mutex.Unlock()
+
+	now := time.Now()
+	ls.collect(now)
+
+	root := path.Clean(lock.Root)
+	var conflicts []internal.Href
+	for _, l := range ls.locks {
+		if l.Shared && lock.Shared {
+			continue
+		}
+		if lockApplies(&l.Lock, root) || (lock.Recursive && isDescendant(root, path.Clean(l.Root))) {
+			conflicts = append(conflicts, internal.Href{Path: l.Root})
+		}
+	}
+	if len(conflicts) > 0 {
+		return nil, internal.NewPreconditionError(http.StatusLocked, &internal.NoConflictingLock{Hrefs: conflicts})
+	}
+
+	token, err := newLockToken()
+	if err != nil {
+		return nil, err
+	}
+
+	l := &memLock{Lock: *lock}
+	l.Token = token
+	l.Root = root
+	l.Timeout = lockTimeout(lock.Timeout)
+	l.expires = now.Add(l.Timeout)
+	ls.locks[token] = l
+
+	ret := l.snapshot(now)
+	return &ret, nil
+}
+
+func (ls *memLockSystem) lookup(name, token string) (*memLock, error) {
+	l, ok := ls.locks[token]
+	if !ok {
+		return nil, NewHTTPError(http.StatusPreconditionFailed, fmt.Errorf("webdav: unknown lock token %q", token))
+	}
+	if !lockApplies(&l.Lock, name) {
+		return nil, internal.NewPreconditionError(http.StatusConflict, &internal.LockTokenMatchesRequestURI{})
+	}
+	return l, nil
+}
+
+func (ls *memLockSystem) Refresh(ctx context.Context, name, token string, timeout time.Duration) (*Lock, error) {
+	ls.mutex.Lock()
+	defer ls.mutex.Unlock()
+
+	now := time.Now()
+	ls.collect(now)
+
+	l, err := ls.lookup(name, token)
+	if err != nil {
+		return nil, err
+	}
+
+	l.Timeout = lockTimeout(timeout)
+	l.expires = now.Add(l.Timeout)
+
+	ret := l.snapshot(now)
+	return &ret, nil
+}
+
+func (ls *memLockSystem) Unlock(ctx context.Context, name, token string) error {
+	ls.mutex.Lock()
+	defer ls.mutex.Unlock()
+
+	ls.collect(time.Now())
+
+	if _, err := ls.lookup(name, token); err != nil {
+		return err
+	}
+	delete(ls.locks, token)
+	return nil
+}
+
+func (ls *memLockSystem) Locks(ctx context.Context, name string, recursive bool) ([]Lock, error) {
+	ls.mutex.Lock()
+	defer ls.mutex.Unlock()
+
+	now := time.Now()
+	ls.collect(now)
+
+	name = path.Clean(name)
+	var l []Lock
+	for _, lock := range ls.locks {
+		if lockApplies(&lock.Lock, name) || (recursive && isDescendant(name, lock.Root)) {
+			l = append(l, lock.snapshot(now))
+		}
+	}
+	return l, nil
+}
+
+func activeLockFromLock(lock *Lock) *internal.ActiveLock {
+	al := internal.ActiveLock{
+		LockType:  internal.LockType{Write: &struct{}{}},
+		Depth:     internal.DepthZero,
+		Timeout:   internal.Timeout(lock.Timeout),
+		LockToken: &internal.LockToken{Href: internal.Href{Opaque: lock.Token}},
+		LockRoot:  internal.LockRoot{Href: internal.Href{Path: lock.Root}},
+	}
+	if lock.Shared {
+		al.LockScope.Shared = &struct{}{}
+	} else {
+		al.LockScope.Exclusive = &struct{}{}
+	}
+	if lock.Recursive {
+		al.Depth = internal.DepthInfinity
+	}
+	if lock.Owner != "" {
+		al.Owner = &internal.Owner{InnerXML: lock.Owner}
+	}
+	return &al
+}
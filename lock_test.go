@@ -0,0 +1,219 @@
+package webdav
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemLockSystem(t *testing.T) {
+	ctx := context.Background()
+	ls := NewMemLockSystem()
+
+	dirLock, err := ls.Create(ctx, &Lock{Root: "/dir/", Recursive: true})
+	if err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	if dirLock.Token == "" {
+		t.Fatalf("Create() returned an empty lock token")
+	}
+
+	if _, err := ls.Create(ctx, &Lock{Root: "/dir/file"}); err == nil {
+		t.Errorf("Create() on a member of an exclusively locked collection succeeded")
+	}
+	if _, err := ls.Create(ctx, &Lock{Root: "/", Recursive: true}); err == nil {
+		t.Errorf("Create() on an ancestor of an exclusively locked collection succeeded")
+	}
+	if _, err := ls.Create(ctx, &Lock{Root: "/dirfoo"}); err != nil {
+		t.Errorf("Create() on a sibling = %v", err)
+	}
+
+	locks, err := ls.Locks(ctx, "/dir/a/b", false)
+	if err != nil {
+		t.Fatalf("Locks() = %v", err)
+	} else if len(locks) != 1 || locks[0].Token != dirLock.Token {
+		t.Errorf("Locks() = %v, want the collection lock", locks)
+	}
+
+	if err := ls.Unlock(ctx, "/other", dirLock.Token); err == nil {
+		t.Errorf("Unlock() with a non-matching request URI succeeded")
+	}
+	if err := ls.Unlock(ctx, "/dir/a", dirLock.Token); err != nil {
+		t.Errorf("Unlock() = %v", err)
+	}
+
+	a, err := ls.Create(ctx, &Lock{Root: "/shared", Shared: true})
+	if err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	b, err := ls.Create(ctx, &Lock{Root: "/shared", Shared: true})
+	if err != nil {
+		t.Fatalf("Create() of a second shared lock = %v", err)
+	}
+	if a.Token == b.Token {
+		t.Errorf("Create() returned the same token twice")
+	}
+
+	if a.Timeout <= 0 || a.Timeout > defaultLockTimeout {
+		t.Errorf("Create() without a timeout returned timeout %v, want %v", a.Timeout, defaultLockTimeout)
+	}
+	b, err = ls.Refresh(ctx, "/shared", b.Token, 7*24*time.Hour)
+	if err != nil {
+		t.Fatalf("Refresh() = %v", err)
+	} else if b.Timeout <= 0 || b.Timeout > maxLockTimeout {
+		t.Errorf("Refresh() with a week timeout returned timeout %v, want %v", b.Timeout, maxLockTimeout)
+	}
+}
+
+const lockInfoExclusive = `<?xml version="1.0" encoding="utf-8" ?>
+<D:lockinfo xmlns:D="DAV:">
+  <D:lockscope><D:exclusive/></D:lockscope>
+  <D:locktype><D:write/></D:locktype>
+  <D:owner><D:href>http://example.org/~ejw/contact.html</D:href></D:owner>
+</D:lockinfo>`
+
+func TestHandler_lock(t *testing.T) {
+	dir, err := os.MkdirTemp("", "webdav-lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	h := &Handler{FileSystem: LocalFileSystem(dir)}
+	serve := func(method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if method == "LOCK" && body != "" {
+			req.Header.Set("Content-Type", "application/xml")
+		}
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve(http.MethodOptions, "/", "", nil)
+	if dav := w.Header().Get("DAV"); !strings.Contains(dav, "2") {
+		t.Errorf("OPTIONS DAV header = %q, want class 2", dav)
+	}
+
+	w = serve("LOCK", "/file.txt", lockInfoExclusive, map[string]string{"Timeout": "Second-600"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("LOCK on unmapped URL = %v, want %v", w.Code, http.StatusCreated)
+	}
+	token := w.Header().Get("Lock-Token")
+	if token == "" {
+		t.Fatalf("LOCK response is missing a Lock-Token header")
+	}
+	if !strings.Contains(w.Body.String(), "Second-") {
+		t.Errorf("LOCK response is missing the lock timeout:\n%v", w.Body.String())
+	}
+
+	if w := serve(http.MethodPut, "/file.txt", "hello", nil); w.Code != http.StatusLocked {
+		t.Errorf("PUT without lock token = %v, want %v", w.Code, http.StatusLocked)
+	}
+	if w := serve(http.MethodPut, "/file.txt", "hello", map[string]string{"If": "(<urn:uuid:unknown>)"}); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("PUT with unknown lock token = %v, want %v", w.Code, http.StatusPreconditionFailed)
+	}
+	w = serve(http.MethodPut, "/file.txt", "hello", map[string]string{"If": "(" + token + ")"})
+	if w.Code/100 != 2 {
+		t.Errorf("PUT with lock token = %v, want 2xx", w.Code)
+	}
+	etag := w.Header().Get("ETag")
+	if w := serve(http.MethodPut, "/file.txt", "hello", map[string]string{"If": `(` + token + ` ["nope"])`}); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("PUT with mismatched ETag = %v, want %v", w.Code, http.StatusPreconditionFailed)
+	}
+	if w := serve(http.MethodPut, "/file.txt", "hello", map[string]string{"If": `</file.txt> (` + token + ` [` + etag + `])`}); w.Code/100 != 2 {
+		t.Errorf("PUT with tagged list = %v, want 2xx", w.Code)
+	}
+	w = serve("LOCK", "/file.txt", "", map[string]string{"If": "(" + token + ")", "Timeout": "Infinite"})
+	if w.Code != http.StatusOK {
+		t.Errorf("LOCK refresh = %v, want %v", w.Code, http.StatusOK)
+	} else if !strings.Contains(w.Body.String(), "Second-") {
+		t.Errorf("LOCK refresh with an infinite timeout didn't report a finite timeout:\n%v", w.Body.String())
+	}
+	if w := serve("UNLOCK", "/file.txt", "", map[string]string{"Lock-Token": token}); w.Code != http.StatusNoContent {
+		t.Errorf("UNLOCK = %v, want %v", w.Code, http.StatusNoContent)
+	}
+	if w := serve(http.MethodDelete, "/file.txt", "", nil); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE after UNLOCK = %v, want %v", w.Code, http.StatusNoContent)
+	}
+}
+
+func TestHandler_lockCollection(t *testing.T) {
+	dir, err := os.MkdirTemp("", "webdav-lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.Mkdir(filepath.Join(dir, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"top.txt", "dir/a.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := &Handler{FileSystem: LocalFileSystem(dir)}
+	serve := func(method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if method == "LOCK" && body != "" {
+			req.Header.Set("Content-Type", "application/xml")
+		}
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve("LOCK", "/dir/", lockInfoExclusive, map[string]string{"Depth": "0"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("LOCK = %v, want %v", w.Code, http.StatusOK)
+	}
+	token := w.Header().Get("Lock-Token")
+
+	// A depth-0 lock doesn't protect the content of existing members
+	if w := serve(http.MethodPut, "/dir/a.txt", "b", nil); w.Code/100 != 2 {
+		t.Errorf("PUT on existing member = %v, want 2xx", w.Code)
+	}
+
+	// ... but it protects the membership of the collection
+	for _, tc := range []struct {
+		method, path string
+		header       map[string]string
+	}{
+		{http.MethodPut, "/dir/b.txt", nil},
+		{"MKCOL", "/dir/sub/", nil},
+		{http.MethodDelete, "/dir/a.txt", nil},
+		{"MOVE", "/dir/a.txt", map[string]string{"Destination": "/a.txt"}},
+		{"MOVE", "/top.txt", map[string]string{"Destination": "/dir/top.txt"}},
+		{"COPY", "/dir/a.txt", map[string]string{"Destination": "/dir/c.txt"}},
+		{"LOCK", "/dir/d.txt", nil},
+	} {
+		body := ""
+		if tc.method == "LOCK" {
+			body = lockInfoExclusive
+		}
+		if w := serve(tc.method, tc.path, body, tc.header); w.Code != http.StatusLocked {
+			t.Errorf("%v %v without parent lock token = %v, want %v", tc.method, tc.path, w.Code, http.StatusLocked)
+		}
+	}
+
+	ifHeader := map[string]string{"If": "</dir/> (" + token + ")"}
+	if w := serve(http.MethodPut, "/dir/b.txt", "b", ifHeader); w.Code != http.StatusCreated {
+		t.Errorf("PUT with parent lock token = %v, want %v", w.Code, http.StatusCreated)
+	}
+	if w := serve(http.MethodDelete, "/dir/b.txt", "", ifHeader); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE with parent lock token = %v, want %v", w.Code, http.StatusNoContent)
+	}
+}
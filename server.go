@@ -3,16 +3,26 @@ package webdav
 import (
 	"context"
 	"encoding/xml"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/emersion/go-webdav/internal"
 )
 
 // FileSystem is a WebDAV server backend.
+//
+// RemoveAll, Copy and Move may fail on some members of a collection only.
+// Implementations can report this with NewPartialError.
 type FileSystem interface {
 	Open(ctx context.Context, name string) (io.ReadCloser, error)
 	Stat(ctx context.Context, name string) (*FileInfo, error)
@@ -24,10 +34,162 @@ type FileSystem interface {
 	Move(ctx context.Context, name, dest string, options *MoveOptions) (created bool, err error)
 }
 
+// FileIterator iterates over files. Next must be called before the first
+// call to FileInfo.
+type FileIterator interface {
+	// Next advances to the next file. It returns false when there are no
+	// more files or when an error occurs.
+	Next() bool
+	// FileInfo returns the current file.
+	FileInfo() *FileInfo
+	// Err returns the error which stopped the iteration, if any.
+	Err() error
+	// Close releases the resources held by the iterator.
+	Close() error
+}
+
+// WalkFileSystem is an optional interface which can be implemented by a
+// FileSystem to enumerate directories incrementally. Large trees can then be
+// listed without loading all of their entries in memory.
+type WalkFileSystem interface {
+	// Walk returns an iterator over the directory name and its children. If
+	// recursive is set, all descendants are included. It's the incremental
+	// equivalent of FileSystem.ReadDir.
+	Walk(ctx context.Context, name string, recursive bool) (FileIterator, error)
+}
+
+// walkFileSystem enumerates a directory, using WalkFileSystem if available
+// and falling back to FileSystem.ReadDir.
+func walkFileSystem(ctx context.Context, fs FileSystem, name string, recursive bool) (FileIterator, error) {
+	if wfs, ok := fs.(WalkFileSystem); ok {
+		return wfs.Walk(ctx, name, recursive)
+	}
+	l, err := fs.ReadDir(ctx, name, recursive)
+	if err != nil {
+		return nil, err
+	}
+	return &sliceFileIterator{l: l, i: -1}, nil
+}
+
+type sliceFileIterator struct {
+	l []FileInfo
+	i int
+}
+
+func (it *sliceFileIterator) Next() bool {
+	if it.i+1 >= len(it.l) {
+		return false
+	}
+	it.i++
+	return true
+}
+
+func (it *sliceFileIterator) FileInfo() *FileInfo {
+	return &it.l[it.i]
+}
+
+func (it *sliceFileIterator) Err() error {
+	return nil
+}
+
+func (it *sliceFileIterator) Close() error {
+	return nil
+}
+
+// PropertyStore is an optional interface which can be implemented by a
+// FileSystem to store dead properties, as defined in RFC 4918 section 4.
+//
+// Property values are complete XML elements, for instance
+// `<color xmlns="http://example.org/ns">red</color>`.
+//
+// Properties belong to their resource: FileSystem.Copy, FileSystem.Move and
+// FileSystem.RemoveAll must copy, move and remove them along with the
+// resources they're attached to, including members of collections.
+type PropertyStore interface {
+	// ListProps returns the names of the dead properties of a resource.
+	ListProps(ctx context.Context, name string) ([]xml.Name, error)
+	// GetProp returns the value of a dead property. A 404 Not Found HTTP
+	// error is returned if the property isn't set.
+	GetProp(ctx context.Context, name string, prop xml.Name) ([]byte, error)
+	// SetProp creates or replaces a dead property.
+	SetProp(ctx context.Context, name string, prop xml.Name, value []byte) error
+	// RemoveProp removes a dead property. Removing a property which isn't
+	// set isn't an error.
+	RemoveProp(ctx context.Context, name string, prop xml.Name) error
+}
+
+// QuotaFileSystem is an optional interface which can be implemented by a
+// FileSystem to report storage quotas, as defined in RFC 4331. The available
+// space is exposed via the DAV:quota-available-bytes property and enforced on
+// PUT requests. The DAV:quota-used-bytes property is computed from the sizes
+// of files.
+//
+// When a write exceeds the quota, FileSystem.Create should return a 507
+// Insufficient Storage HTTP error.
+type QuotaFileSystem interface {
+	// QuotaAvailable returns the number of bytes which can still be stored in
+	// a resource. It's called on each write, so it should be cheap. A 404 Not
+	// Found HTTP error is returned if there is no quota.
+	QuotaAvailable(ctx context.Context, name string) (int64, error)
+}
+
+// SyncOptions holds options for SyncFileSystem.SyncCollection.
+type SyncOptions struct {
+	// SyncToken is the token returned by a previous synchronization. If
+	// empty, all members are returned.
+	SyncToken string
+	// Recursive is set to include all descendants of the directory, instead
+	// of its direct members only.
+	Recursive bool
+	// Limit is the maximum number of changed members to return. Zero means
+	// unlimited.
+	Limit int
+}
+
+// SyncResponse describes the changes in a directory since a sync token.
+type SyncResponse struct {
+	SyncToken string
+	Updated   []FileInfo
+	// Deleted contains the paths of removed members. The members of a
+	// removed directory don't need to be listed.
+	Deleted []string
+	// Truncated is set if more changes than SyncOptions.Limit are available.
+	// SyncToken can then be used to fetch the remaining changes.
+	Truncated bool
+}
+
+// ErrInvalidSyncToken is returned by SyncFileSystem.SyncCollection when a
+// sync token is malformed or has expired.
+var ErrInvalidSyncToken = internal.ErrInvalidSyncToken
+
+// SyncFileSystem is an optional interface which can be implemented by a
+// FileSystem to support collection synchronization, as defined in RFC 6578.
+// Clients can then fetch the changes since their last synchronization with
+// the sync-collection REPORT.
+type SyncFileSystem interface {
+	// SyncToken returns the current sync token of a directory, exposed via
+	// the DAV:sync-token property.
+	SyncToken(ctx context.Context, name string) (string, error)
+	// SyncCollection returns the members of a directory which changed since
+	// a sync token.
+	//
+	// If the changes don't fit within the limit and the response can't be
+	// truncated, a 507 Insufficient Storage HTTP error is returned.
+	SyncCollection(ctx context.Context, name string, opts *SyncOptions) (*SyncResponse, error)
+}
+
 // Handler handles WebDAV HTTP requests. It can be used to create a WebDAV
 // server.
 type Handler struct {
 	FileSystem FileSystem
+	// LockSystem manages WebDAV locks. If nil, locks are kept in memory.
+	LockSystem LockSystem
+	// Authorizer enables access control, as defined in RFC 3744. If nil,
+	// all requests are allowed.
+	Authorizer Authorizer
+
+	memLockSystemOnce sync.Once
+	memLockSystem     LockSystem
 }
 
 // ServeHTTP implements http.Handler.
@@ -37,8 +199,16 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	b := backend{h.FileSystem}
-	hh := internal.Handler{Backend: &b}
+	ls := h.LockSystem
+	if ls == nil {
+		h.memLockSystemOnce.Do(func() {
+			h.memLockSystem = NewMemLockSystem()
+		})
+		ls = h.memLockSystem
+	}
+
+	b := backend{h.FileSystem, ls}
+	hh := internal.Handler{Backend: &b, Authorizer: internal.NewAuthorizer(h.Authorizer)}
 	hh.ServeHTTP(w, r)
 }
 
@@ -51,14 +221,40 @@ func NewHTTPError(statusCode int, cause error) error {
 	return &internal.HTTPError{Code: statusCode, Err: cause}
 }
 
+// NewPartialError creates a new error reporting failures on individual
+// members of a collection. errs maps member paths to their errors. For Copy
+// and Move, paths refer to members of the destination.
+//
+// The handler replies with a 207 Multi-Status response containing one entry
+// per failed member.
+func NewPartialError(errs map[string]error) error {
+	paths := make([]string, 0, len(errs))
+	for p := range errs {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	partial := &PartialError{Errors: make([]MemberError, len(paths))}
+	for i, p := range paths {
+		code := http.StatusInternalServerError
+		var httpErr *internal.HTTPError
+		if errors.As(errs[p], &httpErr) {
+			code = httpErr.Code
+		}
+		partial.Errors[i] = MemberError{Path: p, StatusCode: code, Err: errs[p]}
+	}
+	return partial
+}
+
 type backend struct {
 	FileSystem FileSystem
+	LockSystem LockSystem
 }
 
 func (b *backend) Options(r *http.Request) (caps []string, allow []string, err error) {
 	fi, err := b.FileSystem.Stat(r.Context(), r.URL.Path)
 	if internal.IsNotFound(err) {
-		return nil, []string{http.MethodOptions, http.MethodPut, "MKCOL"}, nil
+		return nil, []string{http.MethodOptions, http.MethodPut, "MKCOL", "LOCK"}, nil
 	} else if err != nil {
 		return nil, nil, err
 	}
@@ -67,8 +263,11 @@ func (b *backend) Options(r *http.Request) (caps []string, allow []string, err e
 		http.MethodOptions,
 		http.MethodDelete,
 		"PROPFIND",
+		"REPORT",
 		"COPY",
 		"MOVE",
+		"LOCK",
+		"UNLOCK",
 	}
 
 	if !fi.IsDir {
@@ -116,41 +315,105 @@ func (b *backend) HeadGet(w http.ResponseWriter, r *http.Request) error {
 }
 
 func (b *backend) PropFind(r *http.Request, propfind *internal.PropFind, depth internal.Depth) (*internal.MultiStatus, error) {
-	// TODO: use partial error Response on error
+	var resps []internal.Response
+	err := b.propFind(r, propfind, depth, func(resp *internal.Response) error {
+		resps = append(resps, *resp)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return internal.NewMultiStatus(resps...), nil
+}
 
+func (b *backend) StreamPropFind(r *http.Request, propfind *internal.PropFind, depth internal.Depth, mw *internal.MultiStatusWriter) error {
+	return b.propFind(r, propfind, depth, mw.WriteResponse)
+}
+
+func (b *backend) propFind(r *http.Request, propfind *internal.PropFind, depth internal.Depth, fn func(resp *internal.Response) error) error {
 	fi, err := b.FileSystem.Stat(r.Context(), r.URL.Path)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	var resps []internal.Response
-	if depth != internal.DepthZero && fi.IsDir {
-		children, err := b.FileSystem.ReadDir(r.Context(), r.URL.Path, depth == internal.DepthInfinity)
+	usage := &quotaUsage{fs: b.FileSystem, root: r.URL.Path}
+	if depth == internal.DepthZero || !fi.IsDir {
+		resp, err := b.propFindFile(r.Context(), propfind, fi, usage)
 		if err != nil {
-			return nil, err
+			return err
 		}
+		return fn(resp)
+	}
 
-		resps = make([]internal.Response, len(children))
-		for i, child := range children {
-			resp, err := b.propFindFile(propfind, &child)
-			if err != nil {
-				return nil, err
-			}
-			resps[i] = *resp
-		}
-	} else {
-		resp, err := b.propFindFile(propfind, fi)
+	it, err := walkFileSystem(r.Context(), b.FileSystem, r.URL.Path, depth == internal.DepthInfinity)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+
+	for it.Next() {
+		fi := it.FileInfo()
+		resp, err := b.propFindFile(r.Context(), propfind, fi, usage)
 		if err != nil {
-			return nil, err
+			// Report the failing member and carry on with the others
+			resp = internal.NewErrorResponse(fi.Path, err)
+		}
+		if err := fn(resp); err != nil {
+			return err
 		}
+	}
+	return it.Err()
+}
 
-		resps = []internal.Response{*resp}
+// quotaUsage computes the space used by the resources of a request, as
+// reported by the DAV:quota-used-bytes property. The sizes of all collections
+// are computed with a single walk, so that PROPFIND requests with a Depth
+// header don't walk the tree of each member.
+type quotaUsage struct {
+	fs   FileSystem
+	root string
+	dirs map[string]int64
+	err  error
+}
+
+func (u *quotaUsage) used(ctx context.Context, fi *FileInfo) (int64, error) {
+	if !fi.IsDir {
+		return fi.Size, nil
 	}
+	if u.dirs == nil && u.err == nil {
+		u.dirs, u.err = u.walk(ctx)
+	}
+	if u.err != nil {
+		return 0, u.err
+	}
+	return u.dirs[path.Clean(fi.Path)], nil
+}
 
-	return internal.NewMultiStatus(resps...), nil
+func (u *quotaUsage) walk(ctx context.Context) (map[string]int64, error) {
+	it, err := walkFileSystem(ctx, u.fs, u.root, true)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	root := path.Clean(u.root)
+	dirs := make(map[string]int64)
+	for it.Next() {
+		fi := it.FileInfo()
+		if fi.IsDir {
+			continue
+		}
+		for dir := path.Dir(path.Clean(fi.Path)); ; dir = path.Dir(dir) {
+			dirs[dir] += fi.Size
+			if dir == root || dir == "/" {
+				break
+			}
+		}
+	}
+	return dirs, it.Err()
 }
 
-func (b *backend) propFindFile(propfind *internal.PropFind, fi *FileInfo) (*internal.Response, error) {
+func (b *backend) propFindFile(ctx context.Context, propfind *internal.PropFind, fi *FileInfo, usage *quotaUsage) (*internal.Response, error) {
 	props := make(map[xml.Name]internal.PropFindFunc)
 
 	props[internal.ResourceTypeName] = func(*internal.RawXMLValue) (interface{}, error) {
@@ -161,6 +424,19 @@ func (b *backend) propFindFile(propfind *internal.PropFind, fi *FileInfo) (*inte
 		return internal.NewResourceType(types...), nil
 	}
 
+	props[internal.SupportedLockName] = internal.PropFindValue(internal.NewSupportedLock())
+	props[internal.LockDiscoveryName] = func(*internal.RawXMLValue) (interface{}, error) {
+		locks, err := b.LockSystem.Locks(ctx, fi.Path, false)
+		if err != nil {
+			return nil, err
+		}
+		discovery := &internal.LockDiscovery{}
+		for _, lock := range locks {
+			discovery.ActiveLock = append(discovery.ActiveLock, *activeLockFromLock(&lock))
+		}
+		return discovery, nil
+	}
+
 	if !fi.IsDir {
 		props[internal.GetContentLengthName] = internal.PropFindValue(&internal.GetContentLength{
 			Length: fi.Size,
@@ -185,67 +461,299 @@ func (b *backend) propFindFile(propfind *internal.PropFind, fi *FileInfo) (*inte
 		}
 	}
 
+	// Quotas can be expensive to compute, RFC 4331 section 3 excludes them
+	// from allprop
+	if qfs, ok := b.FileSystem.(QuotaFileSystem); ok && propfind.AllProp == nil {
+		props[internal.QuotaAvailableBytesName] = func(*internal.RawXMLValue) (interface{}, error) {
+			available, err := qfs.QuotaAvailable(ctx, fi.Path)
+			if err != nil {
+				return nil, err
+			}
+			return &internal.QuotaAvailableBytes{Bytes: available}, nil
+		}
+		props[internal.QuotaUsedBytesName] = func(*internal.RawXMLValue) (interface{}, error) {
+			used, err := usage.used(ctx, fi)
+			if err != nil {
+				return nil, err
+			}
+			return &internal.QuotaUsedBytes{Bytes: used}, nil
+		}
+	}
+
+	// RFC 6578 section 4 excludes the sync token from allprop
+	if sfs, ok := b.FileSystem.(SyncFileSystem); ok && fi.IsDir && propfind.AllProp == nil {
+		props[internal.SyncTokenName] = func(*internal.RawXMLValue) (interface{}, error) {
+			token, err := sfs.SyncToken(ctx, fi.Path)
+			if err != nil {
+				return nil, err
+			}
+			return &internal.SyncToken{Token: token}, nil
+		}
+	}
+
+	if ps, ok := b.FileSystem.(PropertyStore); ok {
+		names, err := ps.ListProps(ctx, fi.Path)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			if _, ok := props[name]; ok {
+				continue
+			}
+			name := name
+			props[name] = func(*internal.RawXMLValue) (interface{}, error) {
+				b, err := ps.GetProp(ctx, fi.Path, name)
+				if err != nil {
+					return nil, err
+				}
+				var raw internal.RawXMLValue
+				if err := xml.Unmarshal(b, &raw); err != nil {
+					return nil, err
+				}
+				return &raw, nil
+			}
+		}
+	}
+
 	return internal.NewPropFindResponse(fi.Path, propfind, props)
 }
 
+func (b *backend) SyncCollection(r *http.Request, query *internal.SyncCollectionQuery, level internal.Depth, mw *internal.MultiStatusWriter) (truncated bool, err error) {
+	sfs, ok := b.FileSystem.(SyncFileSystem)
+	if !ok {
+		return false, internal.HTTPErrorf(http.StatusForbidden, "webdav: sync-collection is not supported")
+	}
+
+	ctx := r.Context()
+	fi, err := b.FileSystem.Stat(ctx, r.URL.Path)
+	if err != nil {
+		return false, err
+	} else if !fi.IsDir {
+		return false, internal.HTTPErrorf(http.StatusForbidden, "webdav: sync-collection is only supported on collections")
+	}
+
+	opts := SyncOptions{
+		SyncToken: query.SyncToken,
+		Recursive: level == internal.DepthInfinity,
+	}
+	if query.Limit != nil {
+		opts.Limit = int(query.Limit.NResults)
+	}
+
+	changes, err := sfs.SyncCollection(ctx, r.URL.Path, &opts)
+	if err != nil {
+		return false, err
+	}
+
+	propfind := internal.PropFind{Prop: query.Prop}
+	usage := &quotaUsage{fs: b.FileSystem, root: r.URL.Path}
+	for i := range changes.Updated {
+		resp, err := b.propFindFile(ctx, &propfind, &changes.Updated[i], usage)
+		if err != nil {
+			return false, err
+		}
+		if err := mw.WriteResponse(resp); err != nil {
+			return false, err
+		}
+	}
+	for _, p := range changes.Deleted {
+		resp := internal.Response{
+			Hrefs:  []internal.Href{{Path: p}},
+			Status: &internal.Status{Code: http.StatusNotFound},
+		}
+		if err := mw.WriteResponse(&resp); err != nil {
+			return false, err
+		}
+	}
+
+	mw.SyncToken = changes.SyncToken
+	return changes.Truncated, nil
+}
+
 func (b *backend) PropPatch(r *http.Request, update *internal.PropertyUpdate) (*internal.Response, error) {
-	fi, err := b.FileSystem.Stat(r.Context(), r.URL.Path)
+	ctx := r.Context()
+
+	fi, err := b.FileSystem.Stat(ctx, r.URL.Path)
 	if err != nil {
 		return nil, err
 	}
 
-	resp := &internal.Response{Hrefs: []internal.Href{internal.Href{Path: fi.Path}}}
+	if err := b.checkLocks(r, r.URL.Path, false); err != nil {
+		return nil, err
+	}
 
-	for _, set := range update.Set {
-		for _, raw := range set.Prop.Raw {
-			xmlName, ok := raw.XMLName()
-			if !ok {
-				continue
+	// Instructions are processed in document order, see RFC 4918 section 9.2
+	var patches []propPatch
+	for _, inst := range update.Instructions {
+		if inst.Remove != nil {
+			for i := range inst.Remove.Prop.Raw {
+				if name, ok := inst.Remove.Prop.Raw[i].XMLName(); ok {
+					patches = append(patches, propPatch{name: name})
+				}
+			}
+		} else if inst.Set != nil {
+			for i := range inst.Set.Prop.Raw {
+				if name, ok := inst.Set.Prop.Raw[i].XMLName(); ok {
+					patches = append(patches, propPatch{name: name, value: &inst.Set.Prop.Raw[i]})
+				}
 			}
+		}
+	}
+	if len(patches) == 0 {
+		return nil, internal.HTTPErrorf(http.StatusBadRequest,
+			"webdav: request missing properties to update")
+	}
 
-			emptyVal := internal.NewRawXMLElement(xmlName, nil, nil)
+	resp := &internal.Response{Hrefs: []internal.Href{internal.Href{Path: fi.Path}}}
 
+	ps, ok := b.FileSystem.(PropertyStore)
+	if !ok {
+		for _, patch := range patches {
+			emptyVal := internal.NewRawXMLElement(patch.name, nil, nil)
 			if err := resp.EncodeProp(http.StatusForbidden, emptyVal); err != nil {
 				return nil, err
 			}
 		}
+		return resp, nil
+	}
 
+	// PROPPATCH is atomic: either all instructions succeed, or none is
+	// applied, see RFC 4918 section 9.2
+	failed := -1
+	var failedErr error
+	for i, patch := range patches {
+		if liveProps[patch.name] {
+			failed = i
+			failedErr = internal.NewPreconditionError(http.StatusForbidden, &internal.CannotModifyProtectedProperty{})
+			break
+		}
 	}
 
-	for _, remove := range update.Remove {
-		for _, raw := range remove.Prop.Raw {
-			xmlName, ok := raw.XMLName()
-			if !ok {
-				continue
+	var applied []propPatch
+	if failed < 0 {
+		for i, patch := range patches {
+			old, err := ps.GetProp(ctx, r.URL.Path, patch.name)
+			if internal.IsNotFound(err) {
+				old = nil
+			} else if err != nil {
+				failed, failedErr = i, err
+				break
 			}
 
-			emptyVal := internal.NewRawXMLElement(xmlName, nil, nil)
-
-			if err := resp.EncodeProp(http.StatusForbidden, emptyVal); err != nil {
-				return nil, err
+			if patch.value != nil {
+				var raw []byte
+				raw, err = xml.Marshal(patch.value)
+				if err == nil {
+					err = ps.SetProp(ctx, r.URL.Path, patch.name, raw)
+				}
+			} else {
+				err = ps.RemoveProp(ctx, r.URL.Path, patch.name)
+			}
+			if err != nil {
+				failed, failedErr = i, err
+				break
 			}
+
+			applied = append(applied, propPatch{name: patch.name, old: old})
 		}
+	}
 
+	if failed >= 0 {
+		// Roll back in reverse order, so that the oldest value wins when the
+		// same property has been modified multiple times
+		for i := len(applied) - 1; i >= 0; i-- {
+			patch := applied[i]
+			var err error
+			if patch.old != nil {
+				err = ps.SetProp(ctx, r.URL.Path, patch.name, patch.old)
+			} else {
+				err = ps.RemoveProp(ctx, r.URL.Path, patch.name)
+			}
+			if err != nil {
+				// The resource is left in an inconsistent state, which
+				// can't be reported with a multistatus
+				return nil, fmt.Errorf("webdav: failed to roll back PROPPATCH after %v: %w", failedErr, err)
+			}
+		}
 	}
 
-	if len(resp.PropStats) == 0 {
-		return nil, internal.HTTPErrorf(http.StatusBadRequest,
-			"webdav: request missing properties to update")
+	for i, patch := range patches {
+		code := http.StatusOK
+		if i == failed {
+			code = internal.HTTPErrorFromError(failedErr).Code
+		} else if failed >= 0 {
+			code = http.StatusFailedDependency
+		}
+		emptyVal := internal.NewRawXMLElement(patch.name, nil, nil)
+		if err := resp.EncodeProp(code, emptyVal); err != nil {
+			return nil, err
+		}
+	}
+	if failed >= 0 {
+		var errElt *internal.Error
+		if errors.As(failedErr, &errElt) {
+			code := internal.HTTPErrorFromError(failedErr).Code
+			for i := range resp.PropStats {
+				if resp.PropStats[i].Status.Code == code {
+					resp.PropStats[i].Error = errElt
+				}
+			}
+		}
 	}
 
 	return resp, nil
 }
 
+// propPatch is a single PROPPATCH instruction. A nil value removes the
+// property.
+type propPatch struct {
+	name  xml.Name
+	value *internal.RawXMLValue
+	old   []byte
+}
+
+// liveProps contains the properties maintained by the server. These are
+// protected and can't be modified with PROPPATCH.
+var liveProps = map[xml.Name]bool{
+	internal.ResourceTypeName:     true,
+	internal.GetContentLengthName: true,
+	internal.GetContentTypeName:   true,
+	internal.GetLastModifiedName:  true,
+	internal.GetETagName:          true,
+	internal.LockDiscoveryName:    true,
+	internal.SupportedLockName:    true,
+
+	internal.QuotaAvailableBytesName: true,
+	internal.QuotaUsedBytesName:      true,
+	internal.SyncTokenName:           true,
+}
+
 func (b *backend) Put(w http.ResponseWriter, r *http.Request) error {
+	if err := b.checkLocks(r, r.URL.Path, false); err != nil {
+		return err
+	}
+	if err := b.checkCreateLocks(r, r.URL.Path); err != nil {
+		return err
+	}
+
 	ifNoneMatch := ConditionalMatch(r.Header.Get("If-None-Match"))
 	ifMatch := ConditionalMatch(r.Header.Get("If-Match"))
 
+	body, err := b.limitQuota(r)
+	if err != nil {
+		return err
+	}
+
 	opts := CreateOptions{
 		IfNoneMatch: ifNoneMatch,
 		IfMatch:     ifMatch,
+		If:          ifListsFromRequest(r),
 	}
-	fi, created, err := b.FileSystem.Create(r.Context(), r.URL.Path, r.Body, &opts)
-	if err != nil {
+	fi, created, err := b.FileSystem.Create(r.Context(), r.URL.Path, body, &opts)
+	var httpErr *internal.HTTPError
+	if errors.As(err, &httpErr) && httpErr.Code == http.StatusInsufficientStorage {
+		return quotaExceededError()
+	} else if err != nil {
 		return err
 	}
 
@@ -268,21 +776,96 @@ func (b *backend) Put(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// limitQuota returns the body of a PUT request, limited to the space
+// available in the parent collection. Requests whose Content-Length exceeds
+// the quota are rejected right away, and reading past the quota fails.
+func (b *backend) limitQuota(r *http.Request) (io.ReadCloser, error) {
+	qfs, ok := b.FileSystem.(QuotaFileSystem)
+	if !ok {
+		return r.Body, nil
+	}
+
+	available, err := qfs.QuotaAvailable(r.Context(), path.Dir(path.Clean(r.URL.Path)))
+	if internal.IsNotFound(err) {
+		return r.Body, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// The body replaces the existing file, if any
+	if fi, err := b.FileSystem.Stat(r.Context(), r.URL.Path); err == nil && !fi.IsDir {
+		available += fi.Size
+	}
+
+	if r.ContentLength > available {
+		return nil, quotaExceededError()
+	}
+	return &quotaReader{ReadCloser: r.Body, remaining: available}, nil
+}
+
+// quotaReader fails with a quota-not-exceeded error once more than remaining
+// bytes have been read.
+type quotaReader struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (qr *quotaReader) Read(p []byte) (int, error) {
+	// Read one more byte than allowed to detect bodies exceeding the quota
+	if max := qr.remaining + 1; max > 0 && int64(len(p)) > max {
+		p = p[:max]
+	}
+	n, err := qr.ReadCloser.Read(p)
+	if int64(n) > qr.remaining {
+		n = int(qr.remaining)
+		qr.remaining = 0
+		return n, quotaExceededError()
+	}
+	qr.remaining -= int64(n)
+	return n, err
+}
+
+func quotaExceededError() error {
+	return internal.NewPreconditionError(http.StatusInsufficientStorage, &internal.QuotaNotExceeded{})
+}
+
 func (b *backend) Delete(r *http.Request) error {
 	ifNoneMatch := ConditionalMatch(r.Header.Get("If-None-Match"))
 	ifMatch := ConditionalMatch(r.Header.Get("If-Match"))
 
+	if err := b.checkLocks(r, r.URL.Path, true); err != nil {
+		return err
+	}
+	if err := b.checkParentLocks(r, r.URL.Path); err != nil {
+		return err
+	}
+
 	opts := RemoveAllOptions{
 		IfNoneMatch: ifNoneMatch,
 		IfMatch:     ifMatch,
+		If:          ifListsFromRequest(r),
 	}
-	return b.FileSystem.RemoveAll(r.Context(), r.URL.Path, &opts)
+	err := b.FileSystem.RemoveAll(r.Context(), r.URL.Path, &opts)
+	partial, err := partialError(err)
+	if err != nil {
+		return err
+	}
+
+	// Members which couldn't be removed keep their locks
+	b.removeLocks(r.Context(), r.URL.Path, partial)
+	return partialOrNil(partial)
 }
 
 func (b *backend) Mkcol(r *http.Request) error {
 	if r.Header.Get("Content-Type") != "" {
 		return internal.HTTPErrorf(http.StatusUnsupportedMediaType, "webdav: request body not supported in MKCOL request")
 	}
+	if err := b.checkLocks(r, r.URL.Path, false); err != nil {
+		return err
+	}
+	if err := b.checkParentLocks(r, r.URL.Path); err != nil {
+		return err
+	}
 	err := b.FileSystem.Mkdir(r.Context(), r.URL.Path)
 	if internal.IsNotFound(err) {
 		return &internal.HTTPError{Code: http.StatusConflict, Err: err}
@@ -291,26 +874,273 @@ func (b *backend) Mkcol(r *http.Request) error {
 }
 
 func (b *backend) Copy(r *http.Request, dest *internal.Href, recursive, overwrite bool) (created bool, err error) {
+	if err := b.checkLocks(r, dest.Path, true); err != nil {
+		return false, err
+	}
+	if err := b.checkCreateLocks(r, dest.Path); err != nil {
+		return false, err
+	}
+
 	options := CopyOptions{
 		NoRecursive: !recursive,
 		NoOverwrite: !overwrite,
+		If:          ifListsFromRequest(r),
 	}
 	created, err = b.FileSystem.Copy(r.Context(), r.URL.Path, dest.Path, &options)
+	partial, err := partialError(err)
 	if os.IsExist(err) {
 		return false, &internal.HTTPError{http.StatusPreconditionFailed, err}
+	} else if err != nil {
+		return false, err
 	}
-	return created, err
+	return created, partialOrNil(partial)
 }
 
 func (b *backend) Move(r *http.Request, dest *internal.Href, overwrite bool) (created bool, err error) {
+	if err := b.checkLocks(r, r.URL.Path, true); err != nil {
+		return false, err
+	}
+	if err := b.checkLocks(r, dest.Path, true); err != nil {
+		return false, err
+	}
+	if err := b.checkParentLocks(r, r.URL.Path); err != nil {
+		return false, err
+	}
+	if err := b.checkCreateLocks(r, dest.Path); err != nil {
+		return false, err
+	}
+
 	options := MoveOptions{
 		NoOverwrite: !overwrite,
+		If:          ifListsFromRequest(r),
 	}
 	created, err = b.FileSystem.Move(r.Context(), r.URL.Path, dest.Path, &options)
+	partial, err := partialError(err)
 	if os.IsExist(err) {
 		return false, &internal.HTTPError{http.StatusPreconditionFailed, err}
+	} else if err != nil {
+		return false, err
+	}
+
+	// Locks don't move along with the resource, see RFC 4918 section 7.7. On
+	// partial failure, some members remain at the source and keep their locks.
+	if partial == nil {
+		b.removeLocks(r.Context(), r.URL.Path, nil)
+	}
+	return created, partialOrNil(partial)
+}
+
+// partialError splits err into a *internal.PartialError, if err reports
+// failures on individual members, and any other error.
+func partialError(err error) (*internal.PartialError, error) {
+	var partial *PartialError
+	if !errors.As(err, &partial) {
+		return nil, err
+	}
+	ipartial := &internal.PartialError{Errors: make([]internal.MemberError, len(partial.Errors))}
+	for i, merr := range partial.Errors {
+		err := merr.Err
+		var httpErr *internal.HTTPError
+		if !errors.As(err, &httpErr) {
+			err = &internal.HTTPError{Code: merr.StatusCode, Err: err}
+		}
+		ipartial.Errors[i] = internal.MemberError{Path: merr.Path, Err: err}
+	}
+	return ipartial, nil
+}
+
+func partialOrNil(partial *internal.PartialError) error {
+	if partial == nil {
+		return nil
+	}
+	return partial
+}
+
+func (b *backend) Lock(r *http.Request, depth internal.Depth, timeout internal.Timeout, info *internal.LockInfo) (lock *internal.ActiveLock, created bool, err error) {
+	ctx := r.Context()
+
+	_, err = b.FileSystem.Stat(ctx, r.URL.Path)
+	if internal.IsNotFound(err) {
+		created = true
+	} else if err != nil {
+		return nil, false, err
+	}
+	if created {
+		if err := b.checkParentLocks(r, r.URL.Path); err != nil {
+			return nil, false, err
+		}
+	}
+
+	l := Lock{
+		Root:      r.URL.Path,
+		Shared:    info.LockScope.Shared != nil,
+		Recursive: depth == internal.DepthInfinity,
+		Timeout:   time.Duration(timeout),
+	}
+	if info.Owner != nil {
+		owner, err := internal.NewOwner(info.Owner)
+		if err != nil {
+			return nil, false, err
+		}
+		l.Owner = owner.InnerXML
+	}
+	newLock, err := b.LockSystem.Create(ctx, &l)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if created {
+		// Locking an unmapped URL creates an empty resource, see RFC 4918
+		// section 7.3
+		_, _, err := b.FileSystem.Create(ctx, r.URL.Path, http.NoBody, &CreateOptions{})
+		if err != nil {
+			b.LockSystem.Unlock(ctx, r.URL.Path, newLock.Token)
+			if internal.IsNotFound(err) {
+				return nil, false, &internal.HTTPError{Code: http.StatusConflict, Err: err}
+			}
+			return nil, false, err
+		}
+	}
+
+	return activeLockFromLock(newLock), created, nil
+}
+
+func (b *backend) RefreshLock(r *http.Request, token string, timeout internal.Timeout) (*internal.ActiveLock, error) {
+	lock, err := b.LockSystem.Refresh(r.Context(), r.URL.Path, token, time.Duration(timeout))
+	if err != nil {
+		return nil, err
+	}
+	return activeLockFromLock(lock), nil
+}
+
+func (b *backend) Unlock(r *http.Request, token string) error {
+	return b.LockSystem.Unlock(r.Context(), r.URL.Path, token)
+}
+
+func (b *backend) ResourceState(r *http.Request, name string) (*internal.ResourceState, error) {
+	var state internal.ResourceState
+
+	fi, err := b.FileSystem.Stat(r.Context(), name)
+	if err == nil {
+		state.Exists = true
+		state.ETag = fi.ETag
+	} else if !internal.IsNotFound(err) {
+		return nil, err
+	}
+
+	// Locks may apply to unmapped URLs, e.g. members of a locked collection
+	locks, err := b.LockSystem.Locks(r.Context(), name, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, lock := range locks {
+		state.LockTokens = append(state.LockTokens, lock.Token)
+	}
+
+	return &state, nil
+}
+
+// ifListsFromRequest returns the parsed If header of a request. The header
+// has already been validated by internal.Handler.
+func ifListsFromRequest(r *http.Request) []IfList {
+	ifHeader, _ := internal.ParseIf(r.Header.Get("If"))
+	if ifHeader == nil {
+		return nil
+	}
+
+	lists := make([]IfList, len(ifHeader.Lists))
+	for i, l := range ifHeader.Lists {
+		conds := make([]IfCondition, len(l.Conditions))
+		for j, cond := range l.Conditions {
+			conds[j] = IfCondition{
+				Not:        cond.Not,
+				StateToken: cond.StateToken,
+				ETag:       string(cond.ETag),
+			}
+		}
+		lists[i] = IfList{Resource: l.Resource, Conditions: conds}
+	}
+	return lists
+}
+
+// checkLocks ensures that the request submitted the lock tokens required to
+// modify name. If recursive is set, locks on descendants of name are
+// checked as well.
+func (b *backend) checkLocks(r *http.Request, name string, recursive bool) error {
+	locks, err := b.LockSystem.Locks(r.Context(), name, recursive)
+	if err != nil {
+		return err
+	}
+	if len(locks) == 0 {
+		return nil
+	}
+
+	submitted := make(map[string]bool)
+	ifHeader, _ := internal.ParseIf(r.Header.Get("If"))
+	for _, token := range ifHeader.LockTokens() {
+		submitted[token] = true
+	}
+
+	// Submitting any of the shared locks held on a resource is enough
+	sharedRoots := make(map[string]bool)
+	for _, lock := range locks {
+		if lock.Shared && submitted[lock.Token] {
+			sharedRoots[lock.Root] = true
+		}
+	}
+
+	var hrefs []internal.Href
+	for _, lock := range locks {
+		if submitted[lock.Token] || (lock.Shared && sharedRoots[lock.Root]) {
+			continue
+		}
+		hrefs = append(hrefs, internal.Href{Path: lock.Root})
+	}
+	if len(hrefs) > 0 {
+		return internal.NewPreconditionError(http.StatusLocked, &internal.LockTokenSubmitted{Hrefs: hrefs})
+	}
+	return nil
+}
+
+// checkParentLocks ensures that the request submitted the lock tokens
+// required to add or remove name from its parent collection. A lock on a
+// collection protects its membership, see RFC 4918 section 7.4.
+func (b *backend) checkParentLocks(r *http.Request, name string) error {
+	name = path.Clean(name)
+	if name == "/" {
+		return nil
+	}
+	return b.checkLocks(r, path.Dir(name), false)
+}
+
+// checkCreateLocks is like checkParentLocks, but only checks the parent
+// collection if name doesn't exist yet, since overwriting an existing member
+// leaves the membership unchanged.
+func (b *backend) checkCreateLocks(r *http.Request, name string) error {
+	_, err := b.FileSystem.Stat(r.Context(), name)
+	if internal.IsNotFound(err) {
+		return b.checkParentLocks(r, name)
+	}
+	return err
+}
+
+// removeLocks removes the locks rooted at name or at one of its members,
+// except for members affected by partial.
+func (b *backend) removeLocks(ctx context.Context, name string, partial *internal.PartialError) {
+	locks, err := b.LockSystem.Locks(ctx, name, true)
+	if err != nil {
+		return
+	}
+	name = path.Clean(name)
+	for _, lock := range locks {
+		root := path.Clean(lock.Root)
+		if partial.Affects(root) {
+			continue
+		}
+		if root == name || isDescendant(name, root) {
+			b.LockSystem.Unlock(ctx, root, lock.Token)
+		}
 	}
-	return created, err
 }
 
 // BackendSuppliedHomeSet represents either a CalDAV calendar-home-set or a
@@ -336,6 +1166,94 @@ type ServePrincipalOptions struct {
 	CurrentUserPrincipalPath string
 	HomeSets                 []BackendSuppliedHomeSet
 	Capabilities             []Capability
+	// DisplayName, AlternateURIs and GroupMembership describe the principal,
+	// see Principal.
+	DisplayName     string
+	AlternateURIs   []string
+	GroupMembership []string
+	// Directory, if set, is used to answer principal-property-search REPORT
+	// requests.
+	Directory PrincipalDirectory
+}
+
+// Principal describes a principal, as defined in RFC 3744 section 2.
+type Principal struct {
+	// Path is the principal URL.
+	Path        string
+	DisplayName string
+	// AlternateURIs contains URIs such as "mailto:alice@example.org", as
+	// defined in RFC 3744 section 4.1.
+	AlternateURIs []string
+	// GroupMembership contains the paths of the group principals the
+	// principal is a member of, as defined in RFC 3744 section 4.4.
+	GroupMembership []string
+}
+
+// PrincipalSearchTerm matches principals whose property contains a string.
+type PrincipalSearchTerm struct {
+	// Prop is one of the properties listed in PrincipalSearchProperties, or
+	// another property the directory supports.
+	Prop  xml.Name
+	Match string
+}
+
+// PrincipalSearchQuery is a principal-property-search query, as defined in
+// RFC 3744 section 9.4.
+type PrincipalSearchQuery struct {
+	Terms []PrincipalSearchTerm
+	// AnyOf is true if a principal matches when any of the terms match. By
+	// default, all of the terms need to match.
+	AnyOf bool
+}
+
+// PrincipalSearchProperties lists the properties which can be searched in a
+// PrincipalSearchQuery.
+var PrincipalSearchProperties = []xml.Name{
+	internal.DisplayNameName,
+	principalAlternateURISetName,
+	principalURLName,
+	groupMembershipName,
+}
+
+// Match reports whether a principal matches the query. Values are compared
+// with a case-insensitive substring match.
+func (q *PrincipalSearchQuery) Match(p *Principal) bool {
+	for _, term := range q.Terms {
+		if matchPrincipalTerm(p, &term) == q.AnyOf {
+			return q.AnyOf
+		}
+	}
+	return !q.AnyOf
+}
+
+func matchPrincipalTerm(p *Principal, term *PrincipalSearchTerm) bool {
+	var values []string
+	switch term.Prop {
+	case internal.DisplayNameName:
+		values = []string{p.DisplayName}
+	case principalAlternateURISetName:
+		values = p.AlternateURIs
+	case principalURLName:
+		values = []string{p.Path}
+	case groupMembershipName:
+		values = p.GroupMembership
+	}
+
+	match := strings.ToLower(term.Match)
+	for _, v := range values {
+		if strings.Contains(strings.ToLower(v), match) {
+			return true
+		}
+	}
+	return false
+}
+
+// PrincipalDirectory is a searchable list of principals.
+type PrincipalDirectory interface {
+	// SearchPrincipals returns the principals matching a query. Simple
+	// directories can list all of their principals and filter them with
+	// PrincipalSearchQuery.Match.
+	SearchPrincipals(ctx context.Context, query *PrincipalSearchQuery) ([]Principal, error)
 }
 
 // ServePrincipal replies to requests for a principal URL.
@@ -354,34 +1272,193 @@ func ServePrincipal(w http.ResponseWriter, r *http.Request, options *ServePrinci
 		if err := servePrincipalPropfind(w, r, options); err != nil {
 			internal.ServeError(w, err)
 		}
+	case "REPORT":
+		if err := servePrincipalReport(w, r, options); err != nil {
+			internal.ServeError(w, err)
+		}
 	default:
 		http.Error(w, "unsupported method", http.StatusMethodNotAllowed)
 	}
 }
 
+func pathsToHrefs(paths []string) []internal.Href {
+	hrefs := make([]internal.Href, len(paths))
+	for i, p := range paths {
+		hrefs[i] = internal.Href{Path: p}
+	}
+	return hrefs
+}
+
+func principalProps(p *Principal) map[xml.Name]internal.PropFindFunc {
+	props := map[xml.Name]internal.PropFindFunc{
+		internal.ResourceTypeName: internal.PropFindValue(internal.NewResourceType(internal.PrincipalName)),
+		principalURLName: internal.PropFindValue(&principalURL{
+			Href: internal.Href{Path: p.Path},
+		}),
+		principalAlternateURISetName: func(*internal.RawXMLValue) (interface{}, error) {
+			var set principalAlternateURISet
+			for _, s := range p.AlternateURIs {
+				u, err := url.Parse(s)
+				if err != nil {
+					return nil, err
+				}
+				set.Hrefs = append(set.Hrefs, internal.Href(*u))
+			}
+			return &set, nil
+		},
+		groupMembershipName: internal.PropFindValue(&groupMembership{
+			Hrefs: pathsToHrefs(p.GroupMembership),
+		}),
+	}
+	if p.DisplayName != "" {
+		props[internal.DisplayNameName] = internal.PropFindValue(&internal.DisplayName{
+			Name: p.DisplayName,
+		})
+	}
+	return props
+}
+
 func servePrincipalPropfind(w http.ResponseWriter, r *http.Request, options *ServePrincipalOptions) error {
 	var propfind internal.PropFind
 	if err := internal.DecodeXMLRequest(r, &propfind); err != nil {
 		return err
 	}
-	props := map[xml.Name]internal.PropFindFunc{
-		internal.ResourceTypeName: internal.PropFindValue(internal.NewResourceType(internal.PrincipalName)),
-		internal.CurrentUserPrincipalName: internal.PropFindValue(&internal.CurrentUserPrincipal{
-			Href: internal.Href{Path: options.CurrentUserPrincipalPath},
-		}),
+
+	// The principal resource isn't a collection, so all depths return the
+	// principal only
+	if s := r.Header.Get("Depth"); s != "" {
+		if _, err := internal.ParseDepth(s); err != nil {
+			return &internal.HTTPError{Code: http.StatusBadRequest, Err: err}
+		}
 	}
 
-	// TODO: handle Depth and more properties
+	resp, err := newPrincipalPropFindResponse(r, options, &propfind)
+	if err != nil {
+		return err
+	}
+
+	ms := internal.NewMultiStatus(*resp)
+	return internal.ServeMultiStatus(w, ms)
+}
+
+func newPrincipalPropFindResponse(r *http.Request, options *ServePrincipalOptions, propfind *internal.PropFind) (*internal.Response, error) {
+	props := principalProps(&Principal{
+		Path:            r.URL.Path,
+		DisplayName:     options.DisplayName,
+		AlternateURIs:   options.AlternateURIs,
+		GroupMembership: options.GroupMembership,
+	})
+	props[internal.CurrentUserPrincipalName] = internal.PropFindValue(&internal.CurrentUserPrincipal{
+		Href: internal.Href{Path: options.CurrentUserPrincipalPath},
+	})
 
 	for _, homeSet := range options.HomeSets {
 		props[homeSet.GetXMLName()] = internal.PropFindValue(homeSet)
 	}
 
-	resp, err := internal.NewPropFindResponse(r.URL.Path, &propfind, props)
+	return internal.NewPropFindResponse(r.URL.Path, propfind, props)
+}
+
+func servePrincipalReport(w http.ResponseWriter, r *http.Request, options *ServePrincipalOptions) error {
+	if s := r.Header.Get("Depth"); s != "" && s != "0" {
+		return internal.HTTPErrorf(http.StatusBadRequest, "webdav: principal REPORT requests require Depth: 0")
+	}
+
+	var report principalReportReq
+	if err := internal.DecodeXMLRequest(r, &report); err != nil {
+		return err
+	}
+
+	if report.PropertySearch != nil {
+		return servePrincipalPropertySearch(w, r, options, report.PropertySearch)
+	} else if report.ExpandProperty != nil {
+		return servePrincipalExpandProperty(w, r, options, report.ExpandProperty)
+	}
+
+	set := principalSearchPropertySet{
+		PrincipalSearchProperty: make([]principalSearchProperty, len(PrincipalSearchProperties)),
+	}
+	for i, name := range PrincipalSearchProperties {
+		prop, err := internal.EncodeProp(internal.NewRawXMLElement(name, nil, nil))
+		if err != nil {
+			return err
+		}
+		set.PrincipalSearchProperty[i] = principalSearchProperty{
+			Prop:        *prop,
+			Description: description{Lang: "en", Text: principalSearchPropertyDescriptions[name]},
+		}
+	}
+	return internal.ServeXML(w).Encode(&set)
+}
+
+var principalSearchPropertyDescriptions = map[xml.Name]string{
+	internal.DisplayNameName:     "Display name",
+	principalAlternateURISetName: "Alternate URIs",
+	principalURLName:             "Principal URL",
+	groupMembershipName:          "Group membership",
+}
+
+func servePrincipalPropertySearch(w http.ResponseWriter, r *http.Request, options *ServePrincipalOptions, search *principalPropertySearch) error {
+	if options.Directory == nil {
+		return internal.HTTPErrorf(http.StatusForbidden, "webdav: principal-property-search is not supported")
+	}
+
+	var query PrincipalSearchQuery
+	switch search.Test {
+	case "", "allof":
+	case "anyof":
+		query.AnyOf = true
+	default:
+		return internal.HTTPErrorf(http.StatusBadRequest, "webdav: invalid principal-property-search test %q", search.Test)
+	}
+	for _, ps := range search.PropertySearch {
+		for _, raw := range ps.Prop.Raw {
+			name, ok := raw.XMLName()
+			if !ok {
+				continue
+			}
+			query.Terms = append(query.Terms, PrincipalSearchTerm{Prop: name, Match: ps.Match})
+		}
+	}
+	if len(query.Terms) == 0 {
+		return internal.HTTPErrorf(http.StatusBadRequest, "webdav: principal-property-search requires at least one property-search element")
+	}
+
+	principals, err := options.Directory.SearchPrincipals(r.Context(), &query)
 	if err != nil {
 		return err
 	}
 
-	ms := internal.NewMultiStatus(*resp)
-	return internal.ServeMultiStatus(w, ms)
+	propfind := internal.PropFind{Prop: search.Prop}
+	if propfind.Prop == nil {
+		propfind.Prop = &internal.Prop{}
+	}
+
+	mw := internal.NewMultiStatusWriter(w)
+	for i := range principals {
+		resp, err := internal.NewPropFindResponse(principals[i].Path, &propfind, principalProps(&principals[i]))
+		if err != nil {
+			return err
+		}
+		if err := mw.WriteResponse(resp); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+// servePrincipalExpandProperty replies to expand-property REPORT requests.
+// Only the properties of the principal itself can be expanded.
+func servePrincipalExpandProperty(w http.ResponseWriter, r *http.Request, options *ServePrincipalOptions, ep *internal.ExpandProperty) error {
+	resp, err := internal.NewExpandPropertyResponse(r.URL.Path, ep.Property, func(p string, propfind *internal.PropFind) (*internal.Response, error) {
+		if p != r.URL.Path {
+			return nil, internal.HTTPErrorf(http.StatusNotFound, "webdav: resource %q not found", p)
+		}
+		return newPrincipalPropFindResponse(r, options, propfind)
+	})
+	if err != nil {
+		return err
+	}
+
+	return internal.ServeMultiStatus(w, internal.NewMultiStatus(*resp))
 }
@@ -0,0 +1,686 @@
+package webdav
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-webdav/internal"
+)
+
+// testPropFileSystem is a LocalFileSystem with an in-memory PropertyStore.
+// Properties are copied, moved and removed along with their resources.
+type testPropFileSystem struct {
+	LocalFileSystem
+	props map[string]map[xml.Name][]byte
+}
+
+var _ PropertyStore = (*testPropFileSystem)(nil)
+
+func (fs *testPropFileSystem) ListProps(ctx context.Context, name string) ([]xml.Name, error) {
+	var names []xml.Name
+	for propName := range fs.props[path.Clean(name)] {
+		names = append(names, propName)
+	}
+	return names, nil
+}
+
+func (fs *testPropFileSystem) GetProp(ctx context.Context, name string, prop xml.Name) ([]byte, error) {
+	v, ok := fs.props[path.Clean(name)][prop]
+	if !ok {
+		return nil, NewHTTPError(http.StatusNotFound, fmt.Errorf("property not found"))
+	}
+	return v, nil
+}
+
+func (fs *testPropFileSystem) SetProp(ctx context.Context, name string, prop xml.Name, value []byte) error {
+	name = path.Clean(name)
+	if fs.props[name] == nil {
+		fs.props[name] = make(map[xml.Name][]byte)
+	}
+	fs.props[name][prop] = value
+	return nil
+}
+
+func (fs *testPropFileSystem) RemoveProp(ctx context.Context, name string, prop xml.Name) error {
+	delete(fs.props[path.Clean(name)], prop)
+	return nil
+}
+
+// propPaths returns the paths of the resources with properties in the tree
+// rooted at name.
+func (fs *testPropFileSystem) propPaths(name string) []string {
+	name = path.Clean(name)
+	var l []string
+	for p := range fs.props {
+		if p == name || strings.HasPrefix(p, strings.TrimSuffix(name, "/")+"/") {
+			l = append(l, p)
+		}
+	}
+	return l
+}
+
+func (fs *testPropFileSystem) RemoveAll(ctx context.Context, name string, opts *RemoveAllOptions) error {
+	if err := fs.LocalFileSystem.RemoveAll(ctx, name, opts); err != nil {
+		return err
+	}
+	for _, p := range fs.propPaths(name) {
+		delete(fs.props, p)
+	}
+	return nil
+}
+
+func (fs *testPropFileSystem) Copy(ctx context.Context, src, dst string, opts *CopyOptions) (bool, error) {
+	created, err := fs.LocalFileSystem.Copy(ctx, src, dst, opts)
+	if err != nil {
+		return false, err
+	}
+	for _, p := range fs.propPaths(dst) {
+		delete(fs.props, p)
+	}
+	for _, p := range fs.propPaths(src) {
+		props := make(map[xml.Name][]byte)
+		for k, v := range fs.props[p] {
+			props[k] = v
+		}
+		fs.props[path.Join(dst, strings.TrimPrefix(p, path.Clean(src)))] = props
+	}
+	return created, nil
+}
+
+func (fs *testPropFileSystem) Move(ctx context.Context, src, dst string, opts *MoveOptions) (bool, error) {
+	created, err := fs.LocalFileSystem.Move(ctx, src, dst, opts)
+	if err != nil {
+		return false, err
+	}
+	for _, p := range fs.propPaths(dst) {
+		delete(fs.props, p)
+	}
+	for _, p := range fs.propPaths(src) {
+		fs.props[path.Join(dst, strings.TrimPrefix(p, path.Clean(src)))] = fs.props[p]
+		delete(fs.props, p)
+	}
+	return created, nil
+}
+
+const propPatchSetColor = `<?xml version="1.0" encoding="utf-8" ?>
+<D:propertyupdate xmlns:D="DAV:" xmlns:Z="http://example.org/ns">
+  <D:set>
+    <D:prop><Z:color>red</Z:color></D:prop>
+  </D:set>
+</D:propertyupdate>`
+
+const propPatchProtected = `<?xml version="1.0" encoding="utf-8" ?>
+<D:propertyupdate xmlns:D="DAV:" xmlns:Z="http://example.org/ns">
+  <D:set>
+    <D:prop><Z:color>blue</Z:color></D:prop>
+    <D:prop><D:getetag>"nope"</D:getetag></D:prop>
+  </D:set>
+</D:propertyupdate>`
+
+// The last instruction wins, see RFC 4918 section 9.2
+const propPatchSetRemove = `<?xml version="1.0" encoding="utf-8" ?>
+<D:propertyupdate xmlns:D="DAV:" xmlns:Z="http://example.org/ns">
+  <D:set>
+    <D:prop><Z:shape>round</Z:shape></D:prop>
+  </D:set>
+  <D:remove>
+    <D:prop><Z:shape/></D:prop>
+  </D:remove>
+  <D:set>
+    <D:prop><Z:size>large</Z:size></D:prop>
+  </D:set>
+  <D:remove>
+    <D:prop><Z:size/></D:prop>
+  </D:remove>
+  <D:set>
+    <D:prop><Z:size>small</Z:size></D:prop>
+  </D:set>
+</D:propertyupdate>`
+
+func TestHandler_deadProps(t *testing.T) {
+	dir, err := os.MkdirTemp("", "webdav-props")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fs := &testPropFileSystem{
+		LocalFileSystem: LocalFileSystem(dir),
+		props:           make(map[string]map[xml.Name][]byte),
+	}
+	h := &Handler{FileSystem: fs}
+	serve := func(method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" && method != http.MethodPut {
+			req.Header.Set("Content-Type", "application/xml")
+		}
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := serve(http.MethodPut, "/file.txt", "hello", nil); w.Code != http.StatusCreated {
+		t.Fatalf("PUT = %v, want %v", w.Code, http.StatusCreated)
+	}
+
+	colorName := xml.Name{"http://example.org/ns", "color"}
+
+	w := serve("PROPPATCH", "/file.txt", propPatchSetColor, nil)
+	if w.Code != http.StatusMultiStatus || !strings.Contains(w.Body.String(), "200 OK") {
+		t.Fatalf("PROPPATCH = %v, want 207 with 200 propstat:\n%v", w.Code, w.Body.String())
+	}
+	if _, ok := fs.props["/file.txt"][colorName]; !ok {
+		t.Fatalf("PROPPATCH didn't store the property")
+	}
+
+	w = serve("PROPPATCH", "/file.txt", propPatchSetRemove, nil)
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("PROPPATCH = %v, want %v", w.Code, http.StatusMultiStatus)
+	}
+	if _, ok := fs.props["/file.txt"][xml.Name{"http://example.org/ns", "shape"}]; ok {
+		t.Errorf("PROPPATCH didn't remove the property set by a previous instruction")
+	}
+	if v := string(fs.props["/file.txt"][xml.Name{"http://example.org/ns", "size"}]); !strings.Contains(v, "small") {
+		t.Errorf("PROPPATCH didn't apply instructions in document order: %q", v)
+	}
+
+	w = serve("PROPPATCH", "/file.txt", propPatchProtected, nil)
+	body := w.Body.String()
+	if !strings.Contains(body, "403 Forbidden") || !strings.Contains(body, "424 Failed Dependency") || !strings.Contains(body, "cannot-modify-protected-property") {
+		t.Errorf("PROPPATCH on protected property:\n%v", body)
+	}
+	if v := string(fs.props["/file.txt"][colorName]); !strings.Contains(v, "red") {
+		t.Errorf("failed PROPPATCH modified property: %v", v)
+	}
+
+	w = serve("PROPFIND", "/file.txt", "", map[string]string{"Depth": "0"})
+	if !strings.Contains(w.Body.String(), ">red</color>") {
+		t.Errorf("allprop PROPFIND is missing the dead property:\n%v", w.Body.String())
+	}
+
+	if w := serve("COPY", "/file.txt", "", map[string]string{"Destination": "/copy.txt"}); w.Code != http.StatusCreated {
+		t.Fatalf("COPY = %v, want %v", w.Code, http.StatusCreated)
+	}
+	if _, ok := fs.props["/copy.txt"][colorName]; !ok {
+		t.Errorf("COPY didn't copy the dead property")
+	}
+
+	if w := serve("MOVE", "/copy.txt", "", map[string]string{"Destination": "/moved.txt"}); w.Code != http.StatusCreated {
+		t.Fatalf("MOVE = %v, want %v", w.Code, http.StatusCreated)
+	}
+	if _, ok := fs.props["/moved.txt"][colorName]; !ok {
+		t.Errorf("MOVE didn't carry the dead property")
+	}
+	if _, ok := fs.props["/copy.txt"][colorName]; ok {
+		t.Errorf("MOVE left the dead property on the source")
+	}
+
+	if w := serve(http.MethodDelete, "/moved.txt", "", nil); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE = %v, want %v", w.Code, http.StatusNoContent)
+	}
+	if _, ok := fs.props["/moved.txt"][colorName]; ok {
+		t.Errorf("DELETE left the dead property behind")
+	}
+}
+
+func TestClient_Walk(t *testing.T) {
+	dir, err := os.MkdirTemp("", "webdav-walk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	fs := LocalFileSystem(dir)
+	if err := fs.Mkdir(ctx, "/dir"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/a.txt", "/dir/b.txt"} {
+		if _, _, err := fs.Create(ctx, name, io.NopCloser(strings.NewReader(name)), &CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ts := httptest.NewServer(&Handler{FileSystem: fs})
+	defer ts.Close()
+
+	client, err := NewClient(nil, ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	it, err := client.Walk(ctx, "/", true)
+	if err != nil {
+		t.Fatalf("Walk() = %v", err)
+	}
+	defer it.Close()
+
+	got := make(map[string]bool)
+	for it.Next() {
+		got[path.Clean(it.FileInfo().Path)] = true
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("iterator error: %v", err)
+	}
+	for _, name := range []string{"/", "/a.txt", "/dir", "/dir/b.txt"} {
+		if !got[name] {
+			t.Errorf("Walk() is missing %q, got %v", name, got)
+		}
+	}
+}
+
+// testPartialFileSystem is a LocalFileSystem which fails to remove some files.
+type testPartialFileSystem struct {
+	LocalFileSystem
+	locked map[string]bool
+}
+
+func (fs *testPartialFileSystem) RemoveAll(ctx context.Context, name string, opts *RemoveAllOptions) error {
+	name = path.Clean(name)
+	if fs.locked[name] {
+		return NewHTTPError(http.StatusLocked, fmt.Errorf("locked"))
+	}
+
+	fis, err := fs.ReadDir(ctx, name, true)
+	if err != nil {
+		return err
+	}
+	errs := make(map[string]error)
+	for _, fi := range fis {
+		p := path.Clean(fi.Path)
+		if fs.locked[p] {
+			errs[p] = NewHTTPError(http.StatusLocked, fmt.Errorf("locked"))
+		} else if !fi.IsDir {
+			if err := fs.LocalFileSystem.RemoveAll(ctx, p, opts); err != nil {
+				return err
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return NewPartialError(errs)
+	}
+	return fs.LocalFileSystem.RemoveAll(ctx, name, opts)
+}
+
+func TestHandler_partialDelete(t *testing.T) {
+	dir, err := os.MkdirTemp("", "webdav-partial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	fs := &testPartialFileSystem{
+		LocalFileSystem: LocalFileSystem(dir),
+		locked:          map[string]bool{"/dir/locked.txt": true},
+	}
+	if err := fs.Mkdir(ctx, "/dir"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/dir/a.txt", "/dir/locked.txt"} {
+		if _, _, err := fs.Create(ctx, name, io.NopCloser(strings.NewReader(name)), &CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := &Handler{FileSystem: fs}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/dir", nil))
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("DELETE = %v, want %v", w.Code, http.StatusMultiStatus)
+	}
+
+	var ms struct {
+		Responses []struct {
+			Href   string `xml:"href"`
+			Status string `xml:"status"`
+		} `xml:"response"`
+	}
+	if err := xml.NewDecoder(w.Body).Decode(&ms); err != nil {
+		t.Fatalf("failed to decode multistatus: %v", err)
+	}
+	if len(ms.Responses) != 1 {
+		t.Fatalf("DELETE returned %v responses, want 1", len(ms.Responses))
+	}
+	if resp := ms.Responses[0]; resp.Href != "/dir/locked.txt" || !strings.Contains(resp.Status, "423") {
+		t.Errorf("DELETE response = %+v, want 423 for /dir/locked.txt", resp)
+	}
+	if _, err := fs.Stat(ctx, "/dir/a.txt"); err == nil {
+		t.Errorf("DELETE didn't remove /dir/a.txt")
+	}
+
+	// A failure on the request URI itself is reported with a regular status
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/dir/locked.txt", nil))
+	if w.Code != http.StatusLocked {
+		t.Errorf("DELETE = %v, want %v", w.Code, http.StatusLocked)
+	}
+
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	client, err := NewClient(nil, ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.RemoveAll(ctx, "/dir")
+	var partial *PartialError
+	if !errors.As(err, &partial) {
+		t.Fatalf("RemoveAll() = %v, want a *PartialError", err)
+	}
+	if len(partial.Errors) != 1 || partial.Errors[0].Path != "/dir/locked.txt" || partial.Errors[0].StatusCode != http.StatusLocked {
+		t.Errorf("RemoveAll() = %+v, want 423 for /dir/locked.txt", partial.Errors)
+	}
+	if !strings.Contains(err.Error(), "/dir/locked.txt") {
+		t.Errorf("RemoveAll() error %q doesn't list /dir/locked.txt", err)
+	}
+}
+
+// testQuotaFileSystem is a LocalFileSystem with a fixed quota.
+type testQuotaFileSystem struct {
+	LocalFileSystem
+	available int64
+}
+
+var _ QuotaFileSystem = (*testQuotaFileSystem)(nil)
+
+func (fs *testQuotaFileSystem) QuotaAvailable(ctx context.Context, name string) (int64, error) {
+	return fs.available, nil
+}
+
+func TestHandler_quota(t *testing.T) {
+	dir, err := os.MkdirTemp("", "webdav-quota")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	fs := &testQuotaFileSystem{LocalFileSystem: LocalFileSystem(dir), available: 10}
+	if err := fs.Mkdir(ctx, "/dir"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/a.txt", "/dir/b.txt", "/dir/c.txt"} {
+		if _, _, err := fs.Create(ctx, name, io.NopCloser(strings.NewReader("hello")), &CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := &Handler{FileSystem: fs}
+
+	propfind := `<?xml version="1.0" encoding="utf-8" ?>
+<D:propfind xmlns:D="DAV:">
+  <D:prop><D:quota-available-bytes/><D:quota-used-bytes/></D:prop>
+</D:propfind>`
+	req := httptest.NewRequest("PROPFIND", "/", strings.NewReader(propfind))
+	req.Header.Set("Content-Type", "application/xml")
+	req.Header.Set("Depth", "1")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("PROPFIND = %v, want %v", w.Code, http.StatusMultiStatus)
+	}
+	body := w.Body.String()
+	for _, s := range []string{">10</quota-available-bytes>", ">15</quota-used-bytes>", ">10</quota-used-bytes>", ">5</quota-used-bytes>"} {
+		if !strings.Contains(body, s) {
+			t.Errorf("PROPFIND response doesn't contain %q: %v", s, body)
+		}
+	}
+
+	req = httptest.NewRequest("PROPFIND", "/", strings.NewReader(`<propfind xmlns="DAV:"><allprop/></propfind>`))
+	req.Header.Set("Content-Type", "application/xml")
+	req.Header.Set("Depth", "0")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if strings.Contains(w.Body.String(), "quota-used-bytes") {
+		t.Errorf("allprop PROPFIND response contains quota properties: %v", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/small.txt", strings.NewReader("small")))
+	if w.Code != http.StatusCreated {
+		t.Errorf("PUT = %v, want %v", w.Code, http.StatusCreated)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/large.txt", strings.NewReader("way too large")))
+	if w.Code != http.StatusInsufficientStorage {
+		t.Errorf("PUT = %v, want %v", w.Code, http.StatusInsufficientStorage)
+	} else if !strings.Contains(w.Body.String(), "quota-not-exceeded") {
+		t.Errorf("PUT response doesn't contain the quota-not-exceeded precondition: %v", w.Body.String())
+	}
+
+	// Chunked bodies don't have a Content-Length
+	req = httptest.NewRequest(http.MethodPut, "/chunked.txt", io.MultiReader(strings.NewReader("way too "), strings.NewReader("large")))
+	req.ContentLength = -1
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusInsufficientStorage {
+		t.Errorf("chunked PUT = %v, want %v", w.Code, http.StatusInsufficientStorage)
+	}
+}
+
+type testPrincipalDirectory []Principal
+
+func (dir testPrincipalDirectory) SearchPrincipals(ctx context.Context, query *PrincipalSearchQuery) ([]Principal, error) {
+	var l []Principal
+	for _, p := range dir {
+		if query.Match(&p) {
+			l = append(l, p)
+		}
+	}
+	return l, nil
+}
+
+func TestServePrincipal_search(t *testing.T) {
+	options := &ServePrincipalOptions{
+		CurrentUserPrincipalPath: "/principals/alice/",
+		Directory: testPrincipalDirectory{
+			{Path: "/principals/alice/", DisplayName: "Alice Liddell", AlternateURIs: []string{"mailto:alice@example.org"}},
+			{Path: "/principals/bob/", DisplayName: "Bob", AlternateURIs: []string{"mailto:bob@example.org"}, GroupMembership: []string{"/principals/staff/"}},
+			{Path: "/principals/staff/", DisplayName: "Staff"},
+		},
+	}
+
+	report := func(body string) string {
+		req := httptest.NewRequest("REPORT", "/principals/", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/xml")
+		req.Header.Set("Depth", "0")
+		w := httptest.NewRecorder()
+		ServePrincipal(w, req, options)
+		if w.Code != http.StatusOK && w.Code != http.StatusMultiStatus {
+			t.Fatalf("REPORT = %v: %v", w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+
+	body := report(`<?xml version="1.0" encoding="utf-8" ?>
+<D:principal-search-property-set xmlns:D="DAV:"/>`)
+	for _, s := range []string{"<displayname", "<alternate-URI-set", "<principal-URL", "<group-membership"} {
+		if !strings.Contains(body, s) {
+			t.Errorf("principal-search-property-set response doesn't contain %q: %v", s, body)
+		}
+	}
+
+	body = report(`<?xml version="1.0" encoding="utf-8" ?>
+<D:principal-property-search xmlns:D="DAV:" test="anyof">
+  <D:property-search>
+    <D:prop><D:displayname/></D:prop>
+    <D:match>ALICE</D:match>
+  </D:property-search>
+  <D:property-search>
+    <D:prop><D:alternate-URI-set/></D:prop>
+    <D:match>bob@</D:match>
+  </D:property-search>
+  <D:prop><D:displayname/><D:group-membership/></D:prop>
+</D:principal-property-search>`)
+	for _, s := range []string{"<href>/principals/alice/</href>", "Alice Liddell", "<href>/principals/bob/</href>", "<href>/principals/staff/</href>"} {
+		if !strings.Contains(body, s) {
+			t.Errorf("principal-property-search response doesn't contain %q: %v", s, body)
+		}
+	}
+	if strings.Contains(body, "Staff") {
+		t.Errorf("principal-property-search response contains a principal which doesn't match: %v", body)
+	}
+
+	body = report(`<?xml version="1.0" encoding="utf-8" ?>
+<D:principal-property-search xmlns:D="DAV:">
+  <D:property-search>
+    <D:prop><D:displayname/></D:prop>
+    <D:match>a</D:match>
+  </D:property-search>
+  <D:property-search>
+    <D:prop><D:alternate-URI-set/></D:prop>
+    <D:match>example.org</D:match>
+  </D:property-search>
+</D:principal-property-search>`)
+	if !strings.Contains(body, "/principals/alice/") || strings.Contains(body, "/principals/bob/") || strings.Contains(body, "/principals/staff/") {
+		t.Errorf("principal-property-search with allof returned unexpected results: %v", body)
+	}
+}
+
+func TestServePrincipal_depth(t *testing.T) {
+	options := &ServePrincipalOptions{CurrentUserPrincipalPath: "/principals/alice/"}
+	propfind := `<?xml version="1.0" encoding="utf-8" ?>
+<D:propfind xmlns:D="DAV:"><D:prop><D:resourcetype/></D:prop></D:propfind>`
+
+	for depth, want := range map[string]int{
+		"0":        http.StatusMultiStatus,
+		"1":        http.StatusMultiStatus,
+		"infinity": http.StatusMultiStatus,
+		"2":        http.StatusBadRequest,
+	} {
+		req := httptest.NewRequest("PROPFIND", "/principals/alice/", strings.NewReader(propfind))
+		req.Header.Set("Content-Type", "application/xml")
+		req.Header.Set("Depth", depth)
+		w := httptest.NewRecorder()
+		ServePrincipal(w, req, options)
+		if w.Code != want {
+			t.Errorf("PROPFIND with Depth: %v = %v, want %v", depth, w.Code, want)
+		} else if want == http.StatusMultiStatus && strings.Count(w.Body.String(), "<href>") != 1 {
+			t.Errorf("PROPFIND with Depth: %v didn't return the principal only: %v", depth, w.Body.String())
+		}
+	}
+}
+
+func TestHandler_syncCollection(t *testing.T) {
+	dir, err := os.MkdirTemp("", "webdav-sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	fs := NewLocalSyncFileSystem(dir, filepath.Join(t.TempDir(), "journal"))
+	h := &Handler{FileSystem: fs}
+
+	report := func(token, level, limit string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8" ?>
+<D:sync-collection xmlns:D="DAV:">
+  <D:sync-token>%v</D:sync-token>
+  <D:sync-level>%v</D:sync-level>
+  %v
+  <D:prop><D:getetag/></D:prop>
+</D:sync-collection>`, token, level, limit)
+		req := httptest.NewRequest("REPORT", "/", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/xml")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+	decode := func(w *httptest.ResponseRecorder) *internal.MultiStatus {
+		if w.Code != http.StatusMultiStatus {
+			t.Fatalf("REPORT = %v: %v", w.Code, w.Body.String())
+		}
+		var ms internal.MultiStatus
+		if err := xml.NewDecoder(w.Body).Decode(&ms); err != nil {
+			t.Fatal(err)
+		}
+		return &ms
+	}
+
+	if err := fs.Mkdir(ctx, "/dir"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/a.txt", "/dir/b.txt"} {
+		if _, _, err := fs.Create(ctx, name, io.NopCloser(strings.NewReader(name)), &CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ms := decode(report("", "1", ""))
+	if len(ms.Responses) != 2 || ms.SyncToken == "" {
+		t.Fatalf("initial sync-collection = %+v, want 2 responses and a sync token", ms)
+	}
+	token := ms.SyncToken
+
+	// Initial synchronizations over the limit are paginated
+	var members []string
+	pageToken := ""
+	for i := 0; ; i++ {
+		if i > 3 {
+			t.Fatalf("paginated initial sync-collection doesn't end: %v", members)
+		}
+		ms := decode(report(pageToken, "infinite", "<D:limit><D:nresults>1</D:nresults></D:limit>"))
+		truncated := false
+		for _, resp := range ms.Responses {
+			if resp.Status != nil && resp.Status.Code == http.StatusInsufficientStorage {
+				truncated = true
+			} else {
+				members = append(members, resp.Hrefs[0].Path)
+			}
+		}
+		pageToken = ms.SyncToken
+		if !truncated {
+			break
+		}
+	}
+	if got, want := strings.Join(members, " "), "/a.txt /dir /dir/b.txt"; got != want {
+		t.Errorf("paginated initial sync-collection = %q, want %q", got, want)
+	}
+	if w := report(pageToken, "infinite", ""); w.Code != http.StatusMultiStatus || strings.Contains(w.Body.String(), "<response") {
+		t.Errorf("sync-collection after pagination = %v, want no changes: %v", w.Code, w.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/dir/c.txt", strings.NewReader("c"))
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	req = httptest.NewRequest(http.MethodDelete, "/a.txt", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	ms = decode(report(token, "infinite", ""))
+	statuses := make(map[string]int)
+	for _, resp := range ms.Responses {
+		p, err := resp.Path()
+		if err != nil {
+			if internal.IsNotFound(err) {
+				statuses[resp.Hrefs[0].Path] = http.StatusNotFound
+				continue
+			}
+			t.Fatal(err)
+		}
+		statuses[p] = http.StatusOK
+	}
+	if len(statuses) != 2 || statuses["/dir/c.txt"] != http.StatusOK || statuses["/a.txt"] != http.StatusNotFound {
+		t.Errorf("incremental sync-collection = %v, want /dir/c.txt updated and /a.txt removed", statuses)
+	}
+	if ms.SyncToken == token {
+		t.Errorf("sync token didn't change")
+	}
+
+	if w := report(token+"x", "1", ""); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "valid-sync-token") {
+		t.Errorf("sync-collection with invalid token = %v, want valid-sync-token error: %v", w.Code, w.Body.String())
+	}
+}
@@ -4,6 +4,9 @@
 package webdav
 
 import (
+	"fmt"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/emersion/go-webdav/internal"
@@ -22,20 +25,82 @@ type FileInfo struct {
 type CreateOptions struct {
 	IfMatch     ConditionalMatch
 	IfNoneMatch ConditionalMatch
+	If          []IfList
 }
 
 type RemoveAllOptions struct {
 	IfMatch     ConditionalMatch
 	IfNoneMatch ConditionalMatch
+	If          []IfList
 }
 
 type CopyOptions struct {
 	NoRecursive bool
 	NoOverwrite bool
+	If          []IfList
 }
 
 type MoveOptions struct {
 	NoOverwrite bool
+	If          []IfList
+}
+
+// MemberError is a failure affecting a single member of a collection.
+type MemberError struct {
+	// Path is the path of the member.
+	Path string
+	// StatusCode is the HTTP status code describing the failure.
+	StatusCode int
+	Err        error
+}
+
+func (err *MemberError) Error() string {
+	if err.Err != nil {
+		return fmt.Sprintf("%v: %v", err.Path, err.Err)
+	}
+	return fmt.Sprintf("%v: %v %v", err.Path, err.StatusCode, http.StatusText(err.StatusCode))
+}
+
+func (err *MemberError) Unwrap() error {
+	return err.Err
+}
+
+// PartialError reports failures on individual members of a collection, for
+// instance when some files of a directory couldn't be deleted. It's returned
+// by Client.RemoveAll, Client.Copy and Client.Move when the server replies
+// with a 207 Multi-Status response, and can be returned by FileSystem
+// implementations, see NewPartialError.
+type PartialError struct {
+	Errors []MemberError
+}
+
+func (err *PartialError) Error() string {
+	l := make([]string, len(err.Errors))
+	for i := range err.Errors {
+		l[i] = err.Errors[i].Error()
+	}
+	return fmt.Sprintf("webdav: operation failed on %v members: %v", len(err.Errors), strings.Join(l, "; "))
+}
+
+// IfCondition is a condition of an If header list. Exactly one of StateToken
+// or ETag is set.
+type IfCondition struct {
+	Not        bool
+	StateToken string
+	ETag       string
+}
+
+// IfList is a list of conditions from an If header, as defined in RFC 4918
+// section 10.4. The list matches if all of its conditions hold.
+//
+// The handler evaluates If headers before calling the FileSystem. The parsed
+// lists are passed along so that implementations can re-check them
+// atomically with the operation.
+type IfList struct {
+	// Resource is the path of the resource the list applies to. It's empty
+	// if the list applies to the request URI.
+	Resource   string
+	Conditions []IfCondition
 }
 
 // ConditionalMatch represents the value of a conditional header